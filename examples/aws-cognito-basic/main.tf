@@ -23,7 +23,6 @@ module "cognito" {
   # Basic configuration
   user_pool_name = var.user_pool_name
   client_name    = var.client_name
-  environment    = var.environment
 
   # Application URLs
   callback_urls = var.callback_urls
@@ -35,7 +34,7 @@ module "cognito" {
   # MFA configuration
   mfa_configuration          = var.mfa_configuration
   software_token_mfa_enabled = var.software_token_mfa_enabled
-  sms_mfa_enabled           = var.sms_mfa_enabled
+  sms_mfa_enabled            = var.sms_mfa_enabled
 
   # Advanced security
   advanced_security_mode = var.advanced_security_mode
@@ -47,9 +46,6 @@ module "cognito" {
   create_identity_pool = var.create_identity_pool
   identity_pool_name   = var.identity_pool_name
 
-  # Lambda triggers (optional)
-  lambda_triggers = var.lambda_triggers
-
   # Tags
   tags = var.tags
 } 
\ No newline at end of file
@@ -13,6 +13,16 @@ output "user_pool_endpoint" {
   value       = module.cognito.user_pool_endpoint
 }
 
+output "issuer" {
+  description = "OpenID Connect issuer identifier"
+  value       = module.cognito.issuer
+}
+
+output "openid_configuration_url" {
+  description = "OpenID Connect configuration endpoint URL"
+  value       = module.cognito.openid_configuration_url
+}
+
 output "user_pool_client_id" {
   description = "ID of the Cognito User Pool client"
   value       = module.cognito.user_pool_client_id
@@ -26,12 +36,12 @@ output "user_pool_client_secret" {
 
 output "hosted_ui_url" {
   description = "URL of the hosted UI for authentication"
-  value       = module.cognito.hosted_ui_url
+  value       = module.cognito.user_pool_hosted_ui_url
 }
 
 output "oauth_endpoints" {
   description = "OAuth endpoint URLs"
-  value       = module.cognito.oauth_endpoints
+  value       = module.cognito.oauth_urls
 }
 
 output "identity_pool_id" {
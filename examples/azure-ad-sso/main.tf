@@ -33,6 +33,9 @@ module "azure_ad" {
   # Required resource access (API permissions)
   required_resource_access = var.required_resource_access
 
+  # Client secret, output as client_secret
+  create_application_secret = true
+
   # Groups
   groups = var.groups
 
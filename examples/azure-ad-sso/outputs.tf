@@ -5,12 +5,12 @@ output "application_id" {
 
 output "object_id" {
   description = "Object ID of the Azure AD application"
-  value       = module.azure_ad.object_id
+  value       = module.azure_ad.application_object_id
 }
 
 output "client_secret" {
   description = "Client secret for the Azure AD application"
-  value       = module.azure_ad.client_secret
+  value       = module.azure_ad.application_secret_value
   sensitive   = true
 }
 
@@ -41,7 +41,12 @@ output "oauth2_token_url" {
 
 output "openid_configuration_url" {
   description = "OpenID Connect configuration endpoint URL"
-  value       = "https://login.microsoftonline.com/${var.tenant_id}/v2.0/.well-known/openid_configuration"
+  value       = "https://login.microsoftonline.com/${var.tenant_id}/v2.0/.well-known/openid-configuration"
+}
+
+output "issuer" {
+  description = "OpenID Connect issuer identifier"
+  value       = "https://login.microsoftonline.com/${var.tenant_id}/v2.0"
 }
 
 output "saml_metadata_url" {
@@ -51,7 +56,7 @@ output "saml_metadata_url" {
 
 output "group_ids" {
   description = "Object IDs of the created Azure AD groups"
-  value       = module.azure_ad.group_ids
+  value       = module.azure_ad.group_object_ids
 }
 
 output "app_role_ids" {
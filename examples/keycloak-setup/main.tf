@@ -25,8 +25,32 @@ module "keycloak" {
   realm_display_name = var.realm_display_name
   realm_enabled      = var.realm_enabled
 
-  # OIDC clients
-  oidc_clients = var.oidc_clients
+  # OIDC clients, with the module's remaining client settings left at
+  # the provider defaults
+  openid_clients = {
+    for key, client in var.oidc_clients : key => {
+      client_id                       = client.client_id
+      name                            = client.name
+      description                     = client.description
+      enabled                         = client.enabled
+      access_type                     = client.access_type
+      valid_redirect_uris             = client.redirect_uris
+      valid_post_logout_redirect_uris = []
+      web_origins                     = client.web_origins
+      admin_url                       = null
+      base_url                        = null
+      root_url                        = null
+      standard_flow_enabled           = client.standard_flow_enabled
+      implicit_flow_enabled           = false
+      direct_access_grants_enabled    = client.direct_access_grants_enabled
+      service_accounts_enabled        = client.service_accounts_enabled
+      pkce_code_challenge_method      = null
+      client_authenticator_type       = null
+      client_secret                   = null
+      access_token_lifespan           = null
+      extra_config                    = {}
+    }
+  }
 
   # Users
   users = var.users
@@ -37,9 +61,17 @@ module "keycloak" {
   # Roles
   realm_roles = var.realm_roles
 
-  # Identity providers
-  identity_providers = var.identity_providers
+  # Memberships and role mappings
+  user_group_memberships   = var.user_group_memberships
+  user_realm_role_mappings = var.user_realm_role_mappings
+
+  # Group claims
+  group_membership_mappers = var.group_membership_mappers
+
+  # SAML identity providers
+  saml_identity_providers = var.saml_identity_providers
 
-  # Tags
-  tags = var.tags
+  # OpenID Connect identity providers and the claims they map
+  oidc_identity_providers        = var.oidc_identity_providers
+  oidc_identity_provider_mappers = var.oidc_identity_provider_mappers
 } 
\ No newline at end of file
@@ -10,12 +10,12 @@ output "realm_name" {
 
 output "client_ids" {
   description = "IDs of the created OIDC clients"
-  value       = module.keycloak.client_ids
+  value       = module.keycloak.openid_client_ids
 }
 
 output "client_secrets" {
   description = "Secrets of the created OIDC clients"
-  value       = module.keycloak.client_secrets
+  value       = module.keycloak.openid_client_secrets
   sensitive   = true
 }
 
@@ -36,7 +36,7 @@ output "realm_role_ids" {
 
 output "openid_configuration_url" {
   description = "OpenID Connect configuration endpoint URL"
-  value       = "${var.keycloak_url}/realms/${var.realm_name}/.well-known/openid_configuration"
+  value       = "${var.keycloak_url}/realms/${var.realm_name}/.well-known/openid-configuration"
 }
 
 output "token_endpoint" {
@@ -64,12 +64,30 @@ output "issuer" {
   value       = "${var.keycloak_url}/realms/${var.realm_name}"
 }
 
+output "saml_descriptor_url" {
+  description = "SAML 2.0 identity provider metadata URL for the realm"
+  value       = "${var.keycloak_url}/realms/${var.realm_name}/protocol/saml/descriptor"
+}
+
 output "realm_admin_url" {
   description = "URL to access the realm admin console"
   value       = "${var.keycloak_url}/admin/master/console/#/${var.realm_name}"
 }
 
+output "saml_identity_providers" {
+  description = "SAML identity providers brokered by the realm"
+  value       = module.keycloak.saml_identity_providers
+}
+
+output "oidc_identity_providers" {
+  description = "OpenID Connect identity providers brokered by the realm"
+  value       = module.keycloak.oidc_identity_providers
+}
+
 output "identity_provider_ids" {
   description = "IDs of the configured identity providers"
-  value       = module.keycloak.identity_provider_ids
+  value = merge(
+    { for key, idp in module.keycloak.saml_identity_providers : key => idp.alias },
+    { for key, idp in module.keycloak.oidc_identity_providers : key => idp.alias },
+  )
 } 
\ No newline at end of file
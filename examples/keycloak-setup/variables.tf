@@ -42,21 +42,29 @@ variable "realm_enabled" {
 variable "oidc_clients" {
   description = "OpenID Connect clients to create"
   type = map(object({
-    client_id     = string
-    name          = string
-    description   = string
-    enabled       = bool
-    redirect_uris = list(string)
-    web_origins   = list(string)
+    client_id                    = string
+    name                         = string
+    description                  = string
+    enabled                      = bool
+    access_type                  = string
+    standard_flow_enabled        = bool
+    direct_access_grants_enabled = bool
+    service_accounts_enabled     = bool
+    redirect_uris                = list(string)
+    web_origins                  = list(string)
   }))
   default = {
     "webapp" = {
-      client_id     = "example-webapp"
-      name          = "Example Web Application"
-      description   = "Example web application using OpenID Connect"
-      enabled       = true
-      redirect_uris = ["https://example.com/auth/callback", "https://localhost:3000/auth/callback"]
-      web_origins   = ["https://example.com", "https://localhost:3000"]
+      client_id                    = "example-webapp"
+      name                         = "Example Web Application"
+      description                  = "Example web application using OpenID Connect"
+      enabled                      = true
+      access_type                  = "CONFIDENTIAL"
+      standard_flow_enabled        = true
+      direct_access_grants_enabled = false
+      service_accounts_enabled     = false
+      redirect_uris                = ["https://example.com/auth/callback", "https://localhost:3000/auth/callback"]
+      web_origins                  = ["https://example.com", "https://localhost:3000"]
     }
   }
 }
@@ -117,6 +125,38 @@ variable "realm_roles" {
   }
 }
 
+variable "user_group_memberships" {
+  description = "Groups to add users to, by user and group key"
+  type = map(object({
+    user_key   = string
+    group_keys = list(string)
+  }))
+  default = {}
+}
+
+variable "user_realm_role_mappings" {
+  description = "Realm roles to grant users, by user and role key"
+  type = map(object({
+    user_key  = string
+    role_keys = list(string)
+  }))
+  default = {}
+}
+
+variable "group_membership_mappers" {
+  description = "Protocol mappers adding the group paths of users to the tokens of a client"
+  type = map(object({
+    client_key          = string
+    name                = string
+    claim_name          = string
+    full_path           = bool
+    add_to_id_token     = bool
+    add_to_access_token = bool
+    add_to_userinfo     = bool
+  }))
+  default = {}
+}
+
 variable "identity_providers" {
   description = "Identity providers to configure"
   type = map(object({
@@ -129,6 +169,74 @@ variable "identity_providers" {
   default = {}
 }
 
+variable "saml_identity_providers" {
+  description = "SAML identity providers to broker"
+  type = map(object({
+    alias                         = string
+    display_name                  = string
+    enabled                       = bool
+    store_token                   = bool
+    add_read_token_role_on_create = bool
+    trust_email                   = bool
+    link_only                     = bool
+    first_broker_login_flow_alias = string
+    single_sign_on_service_url    = string
+    single_logout_service_url     = string
+    backchannel_supported         = bool
+    name_id_policy_format         = string
+    post_binding_response         = bool
+    post_binding_authn_request    = bool
+    post_binding_logout           = bool
+    want_assertions_signed        = bool
+    want_assertions_encrypted     = bool
+    force_authn                   = bool
+    validate_signature            = bool
+    signing_certificate           = string
+    signature_algorithm           = string
+    extra_config                  = map(string)
+  }))
+  default = {}
+}
+
+variable "oidc_identity_providers" {
+  description = "OpenID Connect identity providers to broker"
+  type = map(object({
+    alias                         = string
+    display_name                  = string
+    enabled                       = bool
+    store_token                   = bool
+    add_read_token_role_on_create = bool
+    trust_email                   = bool
+    link_only                     = bool
+    first_broker_login_flow_alias = string
+    authorization_url             = string
+    token_url                     = string
+    user_info_url                 = string
+    jwks_url                      = string
+    logout_url                    = string
+    client_id                     = string
+    client_secret                 = string
+    default_scopes                = string
+    validate_signature            = bool
+    use_jwks_url                  = bool
+    pkce_enabled                  = bool
+    extra_config                  = map(string)
+  }))
+  default = {}
+}
+
+variable "oidc_identity_provider_mappers" {
+  description = "Mappers importing claims of the OpenID Connect identity providers into user attributes"
+  type = map(object({
+    identity_provider_key = string
+    name                  = string
+    claim_name            = string
+    user_attribute        = string
+    sync_mode             = string
+  }))
+  default = {}
+}
+
 variable "tags" {
   description = "A map of tags to assign to resources"
   type        = map(string)
@@ -21,7 +21,6 @@ module "okta" {
   # Basic configuration
   app_name        = var.app_name
   app_description = var.app_description
-  environment     = var.environment
 
   # SAML application (optional)
   create_saml_app = var.create_saml_app
@@ -46,7 +45,4 @@ module "okta" {
 
   # Authentication policies
   signon_policies = var.signon_policies
-
-  # Tags
-  tags = var.tags
 } 
\ No newline at end of file
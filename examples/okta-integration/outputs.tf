@@ -18,6 +18,11 @@ output "saml_sso_url" {
   value       = module.okta.saml_sso_url
 }
 
+output "saml_certificate" {
+  description = "SAML signing certificate"
+  value       = module.okta.saml_certificate
+}
+
 output "oauth_client_id" {
   description = "OAuth client ID"
   value       = module.okta.oauth_client_id
@@ -51,7 +56,12 @@ output "oauth_userinfo_url" {
 
 output "openid_configuration_url" {
   description = "OpenID Connect configuration endpoint URL"
-  value       = "https://${var.okta_org_name}.${var.okta_base_url}/oauth2/default/.well-known/openid_configuration"
+  value       = "https://${var.okta_org_name}.${var.okta_base_url}/oauth2/default/.well-known/openid-configuration"
+}
+
+output "issuer" {
+  description = "OpenID Connect issuer identifier of the default authorization server"
+  value       = "https://${var.okta_org_name}.${var.okta_base_url}/oauth2/default"
 }
 
 output "group_ids" {
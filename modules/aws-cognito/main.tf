@@ -24,6 +24,25 @@ resource "aws_cognito_user_pool" "main" {
     advanced_security_mode = var.advanced_security_mode
   }
 
+  # MFA; the API calls REQUIRED "ON"
+  mfa_configuration = var.mfa_configuration == "REQUIRED" ? "ON" : var.mfa_configuration
+
+  dynamic "software_token_mfa_configuration" {
+    for_each = var.mfa_configuration != "OFF" && var.software_token_mfa_enabled ? [1] : []
+    content {
+      enabled = true
+    }
+  }
+
+  dynamic "sms_configuration" {
+    for_each = var.sms_mfa_enabled ? [1] : []
+    content {
+      external_id    = local.sms_external_id
+      sns_caller_arn = aws_iam_role.sms[0].arn
+      sns_region     = data.aws_region.current.name
+    }
+  }
+
   # Auto-verified attributes
   auto_verified_attributes = var.auto_verified_attributes
 
@@ -39,6 +58,68 @@ resource "aws_cognito_user_pool" "main" {
   }
 
   tags = var.tags
+
+  # Cognito checks the SMS role can publish when the pool is created
+  depends_on = [aws_iam_role_policy.sms]
+
+  lifecycle {
+    precondition {
+      condition     = var.mfa_configuration == "OFF" || var.software_token_mfa_enabled || var.sms_mfa_enabled
+      error_message = "MFA configuration ${var.mfa_configuration} needs software token or SMS MFA enabled."
+    }
+  }
+}
+
+locals {
+  sms_external_id = "${var.user_pool_name}-sms"
+}
+
+data "aws_caller_identity" "current" {}
+
+# IAM role Cognito sends SMS messages through
+resource "aws_iam_role" "sms" {
+  count = var.sms_mfa_enabled ? 1 : 0
+  name  = "${var.user_pool_name}-sms-role"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Allow"
+        Principal = {
+          Service = "cognito-idp.amazonaws.com"
+        }
+        Action = "sts:AssumeRole"
+        Condition = {
+          StringEquals = {
+            "sts:ExternalId"    = local.sms_external_id
+            "aws:SourceAccount" = data.aws_caller_identity.current.account_id
+          }
+        }
+      }
+    ]
+  })
+
+  tags = var.tags
+}
+
+resource "aws_iam_role_policy" "sms" {
+  count = var.sms_mfa_enabled ? 1 : 0
+  name  = "sns-publish"
+  role  = aws_iam_role.sms[0].id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        # SMS messages go to phone numbers, which have no ARN; this allows
+        # them and nothing published to topics or endpoints
+        Effect      = "Allow"
+        Action      = "sns:Publish"
+        NotResource = "arn:aws:sns:*:*:*"
+      }
+    ]
+  })
 }
 
 # User Pool Domain
@@ -14,6 +14,16 @@ output "user_pool_endpoint" {
   value       = aws_cognito_user_pool.main.endpoint
 }
 
+output "issuer" {
+  description = "OpenID Connect issuer identifier of the User Pool"
+  value       = "https://${aws_cognito_user_pool.main.endpoint}"
+}
+
+output "openid_configuration_url" {
+  description = "OpenID Connect configuration endpoint URL"
+  value       = "https://${aws_cognito_user_pool.main.endpoint}/.well-known/openid-configuration"
+}
+
 output "user_pool_domain" {
   description = "Domain name of the Cognito User Pool"
   value       = var.domain_name != null ? aws_cognito_user_pool_domain.main[0].domain : null
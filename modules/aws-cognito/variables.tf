@@ -39,6 +39,28 @@ variable "advanced_security_mode" {
   }
 }
 
+variable "mfa_configuration" {
+  description = "MFA configuration for the user pool (OFF, OPTIONAL, or REQUIRED)"
+  type        = string
+  default     = "OFF"
+  validation {
+    condition     = contains(["OFF", "OPTIONAL", "REQUIRED"], var.mfa_configuration)
+    error_message = "MFA configuration must be OFF, OPTIONAL, or REQUIRED."
+  }
+}
+
+variable "software_token_mfa_enabled" {
+  description = "Whether users can use an authenticator app (TOTP) as second factor"
+  type        = bool
+  default     = true
+}
+
+variable "sms_mfa_enabled" {
+  description = "Whether users can receive codes by SMS as second factor. Creates an IAM role Cognito sends the messages through"
+  type        = bool
+  default     = false
+}
+
 variable "auto_verified_attributes" {
   description = "Attributes to be auto-verified"
   type        = list(string)
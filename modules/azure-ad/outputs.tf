@@ -19,6 +19,11 @@ output "application_identifier_uris" {
   value       = azuread_application.main.identifier_uris
 }
 
+output "app_role_ids" {
+  description = "Map of app role values to their IDs"
+  value       = azuread_application.main.app_role_ids
+}
+
 # Service Principal Outputs
 output "service_principal_id" {
   description = "The Object ID of the service principal"
@@ -32,6 +32,12 @@ output "openid_client_ids" {
   value       = { for k, v in keycloak_openid_client.main : k => v.client_id }
 }
 
+output "openid_client_secrets" {
+  description = "Map of OpenID Connect client secrets"
+  value       = { for k, v in keycloak_openid_client.main : k => v.client_secret }
+  sensitive   = true
+}
+
 # SAML Client Outputs
 output "saml_clients" {
   description = "Map of SAML clients"
@@ -195,26 +195,26 @@ variable "realm_attributes" {
 variable "openid_clients" {
   description = "Map of OpenID Connect clients to create"
   type = map(object({
-    client_id   = string
-    name        = string
-    description = string
-    enabled     = bool
-    access_type = string
-    valid_redirect_uris = list(string)
+    client_id                       = string
+    name                            = string
+    description                     = string
+    enabled                         = bool
+    access_type                     = string
+    valid_redirect_uris             = list(string)
     valid_post_logout_redirect_uris = list(string)
-    web_origins = list(string)
-    admin_url   = string
-    base_url    = string
-    root_url    = string
-    standard_flow_enabled = bool
-    implicit_flow_enabled = bool
-    direct_access_grants_enabled = bool
-    service_accounts_enabled = bool
-    pkce_code_challenge_method = string
-    client_authenticator_type = string
-    client_secret = string
-    access_token_lifespan = number
-    extra_config = map(string)
+    web_origins                     = list(string)
+    admin_url                       = string
+    base_url                        = string
+    root_url                        = string
+    standard_flow_enabled           = bool
+    implicit_flow_enabled           = bool
+    direct_access_grants_enabled    = bool
+    service_accounts_enabled        = bool
+    pkce_code_challenge_method      = string
+    client_authenticator_type       = string
+    client_secret                   = string
+    access_token_lifespan           = number
+    extra_config                    = map(string)
   }))
   default = {}
 }
@@ -223,27 +223,27 @@ variable "openid_clients" {
 variable "saml_clients" {
   description = "Map of SAML clients to create"
   type = map(object({
-    client_id = string
-    name      = string
-    sign_documents = bool
-    sign_assertions = bool
-    encrypt_assertions = bool
-    client_signature_required = bool
-    valid_redirect_uris = list(string)
-    base_url = string
-    master_saml_processing_url = string
-    name_id_format = string
-    root_url = string
-    signing_certificate = string
-    signing_private_key = string
-    encryption_certificate = string
-    idp_initiated_sso_url_name = string
-    idp_initiated_sso_relay_state = string
-    assertion_consumer_post_url = string
-    assertion_consumer_redirect_url = string
-    logout_service_post_binding_url = string
+    client_id                           = string
+    name                                = string
+    sign_documents                      = bool
+    sign_assertions                     = bool
+    encrypt_assertions                  = bool
+    client_signature_required           = bool
+    valid_redirect_uris                 = list(string)
+    base_url                            = string
+    master_saml_processing_url          = string
+    name_id_format                      = string
+    root_url                            = string
+    signing_certificate                 = string
+    signing_private_key                 = string
+    encryption_certificate              = string
+    idp_initiated_sso_url_name          = string
+    idp_initiated_sso_relay_state       = string
+    assertion_consumer_post_url         = string
+    assertion_consumer_redirect_url     = string
+    logout_service_post_binding_url     = string
     logout_service_redirect_binding_url = string
-    extra_config = map(string)
+    extra_config                        = map(string)
   }))
   default = {}
 }
@@ -252,8 +252,8 @@ variable "saml_clients" {
 variable "groups" {
   description = "Map of groups to create"
   type = map(object({
-    name      = string
-    parent_id = string
+    name       = string
+    parent_id  = string
     attributes = map(list(string))
   }))
   default = {}
@@ -263,14 +263,14 @@ variable "groups" {
 variable "users" {
   description = "Map of users to create"
   type = map(object({
-    username = string
-    enabled  = bool
-    email    = string
-    first_name = string
-    last_name  = string
-    email_verified = bool
-    attributes = map(list(string))
-    initial_password = string
+    username           = string
+    enabled            = bool
+    email              = string
+    first_name         = string
+    last_name          = string
+    email_verified     = bool
+    attributes         = map(list(string))
+    initial_password   = string
     temporary_password = bool
   }))
   default = {}
@@ -323,28 +323,28 @@ variable "user_realm_role_mappings" {
 variable "saml_identity_providers" {
   description = "Map of SAML identity providers"
   type = map(object({
-    alias = string
-    display_name = string
-    enabled = bool
-    store_token = bool
+    alias                         = string
+    display_name                  = string
+    enabled                       = bool
+    store_token                   = bool
     add_read_token_role_on_create = bool
-    trust_email = bool
-    link_only = bool
+    trust_email                   = bool
+    link_only                     = bool
     first_broker_login_flow_alias = string
-    single_sign_on_service_url = string
-    single_logout_service_url = string
-    backchannel_supported = bool
-    name_id_policy_format = string
-    post_binding_response = bool
-    post_binding_authn_request = bool
-    post_binding_logout = bool
-    want_assertions_signed = bool
-    want_assertions_encrypted = bool
-    force_authn = bool
-    validate_signature = bool
-    signing_certificate = string
-    signature_algorithm = string
-    extra_config = map(string)
+    single_sign_on_service_url    = string
+    single_logout_service_url     = string
+    backchannel_supported         = bool
+    name_id_policy_format         = string
+    post_binding_response         = bool
+    post_binding_authn_request    = bool
+    post_binding_logout           = bool
+    want_assertions_signed        = bool
+    want_assertions_encrypted     = bool
+    force_authn                   = bool
+    validate_signature            = bool
+    signing_certificate           = string
+    signature_algorithm           = string
+    extra_config                  = map(string)
   }))
   default = {}
 }
@@ -353,26 +353,26 @@ variable "saml_identity_providers" {
 variable "oidc_identity_providers" {
   description = "Map of OIDC identity providers"
   type = map(object({
-    alias = string
-    display_name = string
-    enabled = bool
-    store_token = bool
+    alias                         = string
+    display_name                  = string
+    enabled                       = bool
+    store_token                   = bool
     add_read_token_role_on_create = bool
-    trust_email = bool
-    link_only = bool
+    trust_email                   = bool
+    link_only                     = bool
     first_broker_login_flow_alias = string
-    authorization_url = string
-    token_url = string
-    user_info_url = string
-    jwks_url = string
-    logout_url = string
-    client_id = string
-    client_secret = string
-    default_scopes = string
-    validate_signature = bool
-    use_jwks_url = bool
-    pkce_enabled = bool
-    extra_config = map(string)
+    authorization_url             = string
+    token_url                     = string
+    user_info_url                 = string
+    jwks_url                      = string
+    logout_url                    = string
+    client_id                     = string
+    client_secret                 = string
+    default_scopes                = string
+    validate_signature            = bool
+    use_jwks_url                  = bool
+    pkce_enabled                  = bool
+    extra_config                  = map(string)
   }))
   default = {}
 }
@@ -381,7 +381,7 @@ variable "oidc_identity_providers" {
 variable "client_default_scopes" {
   description = "Map of client default scopes"
   type = map(object({
-    client_key = string
+    client_key     = string
     default_scopes = list(string)
   }))
   default = {}
@@ -391,14 +391,42 @@ variable "client_default_scopes" {
 variable "user_attribute_mappers" {
   description = "Map of user attribute protocol mappers"
   type = map(object({
-    client_key = string
-    name = string
-    user_attribute = string
-    claim_name = string
-    claim_value_type = string
-    add_to_id_token = bool
+    client_key          = string
+    name                = string
+    user_attribute      = string
+    claim_name          = string
+    claim_value_type    = string
+    add_to_id_token     = bool
     add_to_access_token = bool
-    add_to_userinfo = bool
+    add_to_userinfo     = bool
   }))
   default = {}
-} 
\ No newline at end of file
+}
+
+# Group Membership Mappers
+variable "group_membership_mappers" {
+  description = "Map of group membership protocol mappers"
+  type = map(object({
+    client_key          = string
+    name                = string
+    claim_name          = string
+    full_path           = bool
+    add_to_id_token     = bool
+    add_to_access_token = bool
+    add_to_userinfo     = bool
+  }))
+  default = {}
+}
+
+# OIDC Identity Provider Mappers
+variable "oidc_identity_provider_mappers" {
+  description = "Map of attribute importer mappers of OIDC identity providers"
+  type = map(object({
+    identity_provider_key = string
+    name                  = string
+    claim_name            = string
+    user_attribute        = string
+    sync_mode             = string
+  }))
+  default = {}
+}
@@ -29,6 +29,11 @@ output "saml_metadata_url" {
   value       = var.create_saml_app ? okta_app_saml.main[0].metadata_url : null
 }
 
+output "saml_sso_url" {
+  description = "SAML single sign-on URL for the HTTP-POST binding"
+  value       = var.create_saml_app ? okta_app_saml.main[0].http_post_binding : null
+}
+
 output "saml_certificate" {
   description = "SAML signing certificate"
   value       = var.create_saml_app ? okta_app_saml.main[0].certificate : null
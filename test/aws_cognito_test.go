@@ -1,173 +1,137 @@
 package test
 
 import (
+	"context"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/cognito"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
 )
 
 func TestAWSCognitoModule(t *testing.T) {
 	t.Parallel()
 
-	// Generate unique names for test resources
-	uniqueID := random.UniqueId()
-	userPoolName := "test-pool-" + uniqueID
-	clientName := "test-client-" + uniqueID
-
-	// Terraform options
-	terraformOptions := &terraform.Options{
-		// Path to the Terraform configuration
-		TerraformDir: "../modules/aws-cognito",
-
-		// Variables to pass to the Terraform code
-		Vars: map[string]interface{}{
-			"user_pool_name": userPoolName,
-			"client_name":    clientName,
-			"tags": map[string]string{
-				"Environment": "test",
-				"Purpose":     "terratest",
-			},
-		},
-
-		// Environment variables to set when running Terraform
-		EnvVars: map[string]string{
-			"AWS_DEFAULT_REGION": "us-east-1",
-		},
-
-		// Retry up to 3 times, with 5 seconds between retries
-		MaxRetries:         3,
-		TimeBetweenRetries: 5 * time.Second,
-	}
-
-	// Clean up resources after test
-	defer terraform.Destroy(t, terraformOptions)
+	runStages(t, config.AWS, func() *terraform.Options {
+		return CognitoModule(t).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Validate outputs
+		userPoolID := terraform.Output(t, terraformOptions, "user_pool_id")
+		userPoolArn := terraform.Output(t, terraformOptions, "user_pool_arn")
+		clientID := terraform.Output(t, terraformOptions, "user_pool_client_id")
 
-	// Run terraform init and apply
-	terraform.InitAndApply(t, terraformOptions)
+		// Verify outputs are not empty
+		assert.NotEmpty(t, userPoolID)
+		assert.NotEmpty(t, userPoolArn)
+		assert.NotEmpty(t, clientID)
 
-	// Validate outputs
-	userPoolID := terraform.Output(t, terraformOptions, "user_pool_id")
-	userPoolArn := terraform.Output(t, terraformOptions, "user_pool_arn")
-	clientID := terraform.Output(t, terraformOptions, "user_pool_client_id")
+		// Verify naming convention
+		assert.Contains(t, userPoolID, getAWSRegionFromEnv(t)+"_") // Cognito user pool ID format
 
-	// Verify outputs are not empty
-	assert.NotEmpty(t, userPoolID)
-	assert.NotEmpty(t, userPoolArn)
-	assert.NotEmpty(t, clientID)
+		// Verify the module defaults were applied
+		testCognitoConfiguration(t, terraformOptions)
 
-	// Verify naming convention
-	assert.Contains(t, userPoolID, "us-east-1_") // Cognito user pool ID format
+		// Hold the outputs to their contract
+		testOutputContract(t, "modules/aws-cognito", terraformOptions)
+	})
 }
 
 func TestAWSCognitoWithSAML(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	userPoolName := "test-saml-pool-" + uniqueID
-	clientName := "test-saml-client-" + uniqueID
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../modules/aws-cognito",
-
-		Vars: map[string]interface{}{
-			"user_pool_name": userPoolName,
-			"client_name":    clientName,
-			"saml_providers": map[string]interface{}{
-				"TestSAML": map[string]interface{}{
-					"provider_name":              "TestSAML",
-					"metadata_url":              "https://example.com/metadata.xml",
-					"sso_redirect_binding_uri":  "https://example.com/sso",
-					"slo_redirect_binding_uri":  "https://example.com/slo",
-					"attribute_mapping": map[string]string{
-						"email": "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
-					},
-				},
-			},
-			"tags": map[string]string{
-				"Environment": "test",
-				"Purpose":     "terratest-saml",
-			},
-		},
+	runStages(t, config.AWS, func() *terraform.Options {
+		return CognitoModule(t).Var("saml_providers", map[string]interface{}{
+			"TestSAML": cognitoSAMLProvider("TestSAML",
+				"https://example.com/metadata.xml",
+				"https://example.com/sso",
+				"https://example.com/slo"),
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Validate SAML provider configuration
+		userPoolID := terraform.Output(t, terraformOptions, "user_pool_id")
+		samlProviders := terraform.OutputMap(t, terraformOptions, "saml_providers")
+
+		assert.NotEmpty(t, userPoolID)
+		assert.Contains(t, samlProviders, "TestSAML")
+	})
+}
 
-		EnvVars: map[string]string{
-			"AWS_DEFAULT_REGION": "us-east-1",
-		},
+// cognitoSAMLAttributeMapping maps user pool attributes to the SAML
+// attributes the identity provider sends.
+var cognitoSAMLAttributeMapping = map[string]string{
+	"email":       "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	"given_name":  "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+	"family_name": "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+}
 
-		MaxRetries:         3,
-		TimeBetweenRetries: 5 * time.Second,
+// cognitoSAMLProvider returns a saml_providers entry for the module.
+func cognitoSAMLProvider(name, metadataURL, ssoURL, sloURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"provider_name":            name,
+		"metadata_url":             metadataURL,
+		"sso_redirect_binding_uri": ssoURL,
+		"slo_redirect_binding_uri": sloURL,
+		"attribute_mapping":        cognitoSAMLAttributeMapping,
 	}
+}
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Validate SAML provider configuration
-	userPoolID := terraform.Output(t, terraformOptions, "user_pool_id")
-	samlProviders := terraform.OutputMap(t, terraformOptions, "saml_providers")
-
-	assert.NotEmpty(t, userPoolID)
-	assert.Contains(t, samlProviders, "TestSAML")
+// testCognitoSAMLProvider signs in through the identity provider of a
+// saml_providers entry the way the user pool does and checks that every
+// attribute in its attribute_mapping arrives in the signed assertion.
+func testCognitoSAMLProvider(t *testing.T, client *http.Client, provider map[string]interface{}, userPoolID, domain string) {
+	// The user pool trusts the certificates published at metadata_url
+	metadata := validateSAMLMetadata(t, client, provider["metadata_url"].(string), saml.Options{
+		SSOURL: provider["sso_redirect_binding_uri"].(string),
+	})
+	certs, err := metadata.IDPSSODescriptor().SigningCertificates()
+	require.NoError(t, err)
+
+	assertion := testSAMLSignIn(t, client, samlServiceProvider{
+		EntityID:     "urn:amazon:cognito:sp:" + userPoolID,
+		ACSURL:       "https://" + domain + "/saml2/idpresponse",
+		SSOURL:       provider["sso_redirect_binding_uri"].(string),
+		Certificates: certs,
+	})
+
+	for poolAttr, samlAttr := range provider["attribute_mapping"].(map[string]string) {
+		assert.NotEmpty(t, assertion.Attribute(samlAttr), "%s is mapped from %s, which the assertion does not carry", poolAttr, samlAttr)
+	}
 }
 
 func TestAWSCognitoWithIdentityPool(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	userPoolName := "test-identity-pool-" + uniqueID
-	clientName := "test-identity-client-" + uniqueID
-	identityPoolName := "test-identity-pool-" + uniqueID
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../modules/aws-cognito",
-
-		Vars: map[string]interface{}{
-			"user_pool_name":        userPoolName,
-			"client_name":           clientName,
-			"create_identity_pool":  true,
-			"identity_pool_name":    identityPoolName,
-			"tags": map[string]string{
-				"Environment": "test",
-				"Purpose":     "terratest-identity",
-			},
-		},
-
-		EnvVars: map[string]string{
-			"AWS_DEFAULT_REGION": "us-east-1",
-		},
-
-		MaxRetries:         3,
-		TimeBetweenRetries: 5 * time.Second,
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Validate identity pool creation
-	userPoolID := terraform.Output(t, terraformOptions, "user_pool_id")
-	identityPoolID := terraform.Output(t, terraformOptions, "identity_pool_id")
-	authenticatedRoleArn := terraform.Output(t, terraformOptions, "authenticated_role_arn")
-
-	assert.NotEmpty(t, userPoolID)
-	assert.NotEmpty(t, identityPoolID)
-	assert.NotEmpty(t, authenticatedRoleArn)
-	assert.Contains(t, authenticatedRoleArn, "arn:aws:iam::")
+	runStages(t, config.AWS, func() *terraform.Options {
+		b := CognitoModule(t)
+		return b.Vars(map[string]interface{}{
+			"create_identity_pool": true,
+			"identity_pool_name":   b.Name("identity-pool"),
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Validate identity pool creation
+		userPoolID := terraform.Output(t, terraformOptions, "user_pool_id")
+		identityPoolID := terraform.Output(t, terraformOptions, "identity_pool_id")
+		authenticatedRoleArn := terraform.Output(t, terraformOptions, "authenticated_role_arn")
+
+		assert.NotEmpty(t, userPoolID)
+		assert.NotEmpty(t, identityPoolID)
+		assert.NotEmpty(t, authenticatedRoleArn)
+		assert.Contains(t, authenticatedRoleArn, "arn:aws:iam::")
+	})
 }
 
 func TestAWSCognitoPasswordPolicy(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	userPoolName := "test-password-pool-" + uniqueID
-	clientName := "test-password-client-" + uniqueID
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../modules/aws-cognito",
-
-		Vars: map[string]interface{}{
-			"user_pool_name": userPoolName,
-			"client_name":    clientName,
+	runStages(t, config.AWS, func() *terraform.Options {
+		return CognitoModule(t).Vars(map[string]interface{}{
 			"password_policy": map[string]interface{}{
 				"minimum_length":    12,
 				"require_lowercase": true,
@@ -176,26 +140,81 @@ func TestAWSCognitoPasswordPolicy(t *testing.T) {
 				"require_uppercase": true,
 			},
 			"advanced_security_mode": "ENFORCED",
-			"tags": map[string]string{
-				"Environment": "test",
-				"Purpose":     "terratest-security",
-			},
-		},
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		userPoolID := terraform.Output(t, terraformOptions, "user_pool_id")
+		assert.NotEmpty(t, userPoolID)
+
+		// Verify the deployed password policy and security mode
+		testCognitoConfiguration(t, terraformOptions)
+	})
+}
+
+// testCognitoConfiguration reads the deployed user pool and app client
+// back through the Cognito API and checks them against the configuration
+// terraformOptions applied.
+func testCognitoConfiguration(t *testing.T, terraformOptions *terraform.Options) {
+	userPoolID := terraform.Output(t, terraformOptions, "user_pool_id")
+	clientID := terraform.Output(t, terraformOptions, "user_pool_client_id")
 
-		EnvVars: map[string]string{
-			"AWS_DEFAULT_REGION": "us-east-1",
-		},
+	sess, err := cognito.Session(testConfig.AWS())
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	got, err := cognito.NewInspector(sess).Inspect(ctx, userPoolID, clientID)
+	require.NoError(t, err)
 
-		MaxRetries:         3,
-		TimeBetweenRetries: 5 * time.Second,
-	}
+	diffs := got.Diff(expectedCognitoConfig(t, terraformOptions))
+	assert.Empty(t, diffs, "user pool %s differs from its inputs:\n%s", userPoolID, strings.Join(diffs, "\n"))
+}
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+// expectedCognitoConfig returns the configuration terraformOptions asks
+// for: its variables over the defaults of the configuration it applies,
+// which are over the aws-cognito module's defaults and Cognito's own.
+func expectedCognitoConfig(t *testing.T, terraformOptions *terraform.Options) cognito.Config {
+	t.Helper()
 
-	userPoolID := terraform.Output(t, terraformOptions, "user_pool_id")
-	assert.NotEmpty(t, userPoolID)
+	want := cognito.Defaults
+	decodeInputs(t, terraformOptions, "modules/aws-cognito", &want)
+	return want
+}
+
+func TestUnitExpectedCognitoConfig(t *testing.T) {
+	t.Parallel()
 
-	// Additional validation could include AWS SDK calls to verify
-	// the actual password policy configuration
-} 
\ No newline at end of file
+	module := newOptionsBuilder(config.AWS, "../modules/aws-cognito").Vars(map[string]interface{}{
+		"callback_urls":          []string{"https://app.example.com/callback"},
+		"advanced_security_mode": "AUDIT",
+	}).Build()
+	assert.Equal(t, cognito.Config{
+		PasswordPolicy:       cognito.Defaults.PasswordPolicy,
+		MFAConfiguration:     "OFF", // The module leaves MFA off by default
+		AdvancedSecurityMode: "AUDIT",
+		CallbackURLs:         []string{"https://app.example.com/callback"},
+		LogoutURLs:           []string{},
+		ExplicitAuthFlows:    []string{"ALLOW_USER_PASSWORD_AUTH", "ALLOW_USER_SRP_AUTH", "ALLOW_REFRESH_TOKEN_AUTH"},
+	}, expectedCognitoConfig(t, module))
+
+	// The example's own defaults win over the module's
+	example := newOptionsBuilder(config.AWS, "../examples/aws-cognito-basic").Var("password_policy", map[string]interface{}{
+		"minimum_length":    16,
+		"require_lowercase": true,
+		"require_uppercase": true,
+		"require_numbers":   true,
+		"require_symbols":   false,
+	}).Build()
+	want := expectedCognitoConfig(t, example)
+	assert.Equal(t, cognito.PasswordPolicy{MinimumLength: 16, RequireLowercase: true, RequireNumbers: true, RequireUppercase: true}, want.PasswordPolicy)
+	assert.Equal(t, "OPTIONAL", want.MFAConfiguration)
+	assert.Equal(t, "AUDIT", want.AdvancedSecurityMode)
+	assert.NotEmpty(t, want.CallbackURLs)
+
+	// The example's MFA setting only takes effect if it reaches the module
+	call := loadModuleConfig(t, "examples/aws-cognito-basic").ModuleCall("cognito")
+	require.NotNil(t, call)
+	cognitoModule := loadModuleConfig(t, "modules/aws-cognito")
+	for _, input := range []string{"mfa_configuration", "software_token_mfa_enabled", "sms_mfa_enabled"} {
+		assert.Contains(t, call.Arguments, input)
+		assert.NotNil(t, cognitoModule.Variable(input), "modules/aws-cognito does not declare %s", input)
+	}
+}
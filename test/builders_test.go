@@ -0,0 +1,204 @@
+package test
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/random"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/retryable"
+)
+
+// Retry policy of every live test.
+const (
+	defaultMaxRetries         = 3
+	defaultTimeBetweenRetries = 5 * time.Second
+)
+
+// standardTags are set on everything the suites create. Purpose marks the
+// resources for the sweeper.
+var standardTags = map[string]string{
+	"Environment": "test",
+	"Project":     "terratest",
+	"ManagedBy":   "terraform",
+	"Purpose":     "terratest",
+}
+
+// OptionsBuilder builds the terraform.Options of a test from the
+// conventions the suites share: unique names, standard tags, provider
+// credentials and the retry policy, which retries the provider's errors
+// in the retryable catalog. Start from a provider builder such as
+// CognitoExample, override what the scenario needs and call Build.
+type OptionsBuilder struct {
+	id   string
+	opts terraform.Options
+}
+
+func newOptionsBuilder(provider config.Provider, dir string) *OptionsBuilder {
+	return &OptionsBuilder{
+		id: random.UniqueId(),
+		opts: terraform.Options{
+			TerraformDir:             dir,
+			Vars:                     map[string]interface{}{"tags": maps.Clone(standardTags)},
+			EnvVars:                  map[string]string{},
+			MaxRetries:               defaultMaxRetries,
+			TimeBetweenRetries:       defaultTimeBetweenRetries,
+			RetryableTerraformErrors: retryable.Errors(provider),
+		},
+	}
+}
+
+// ID returns the random suffix of the names the builder generates.
+func (b *OptionsBuilder) ID() string {
+	return b.id
+}
+
+// Name returns a unique name of the form terratest-<kind>-<ID>, which
+// the sweeper recognises by its sweep.DefaultPrefixes entry.
+func (b *OptionsBuilder) Name(kind string) string {
+	return fmt.Sprintf("terratest-%s-%s", kind, b.id)
+}
+
+// Var sets a variable, replacing the builder's default.
+func (b *OptionsBuilder) Var(name string, value interface{}) *OptionsBuilder {
+	b.opts.Vars[name] = value
+	return b
+}
+
+// Vars sets several variables, replacing the builder's defaults.
+func (b *OptionsBuilder) Vars(vars map[string]interface{}) *OptionsBuilder {
+	for name, value := range vars {
+		b.opts.Vars[name] = value
+	}
+	return b
+}
+
+// Env sets an environment variable for terraform.
+func (b *OptionsBuilder) Env(name, value string) *OptionsBuilder {
+	b.opts.EnvVars[name] = value
+	return b
+}
+
+// Retries replaces the retry policy.
+func (b *OptionsBuilder) Retries(max int, between time.Duration) *OptionsBuilder {
+	b.opts.MaxRetries = max
+	b.opts.TimeBetweenRetries = between
+	return b
+}
+
+// Build returns the options. The builder must not be used afterwards.
+func (b *OptionsBuilder) Build() *terraform.Options {
+	return &b.opts
+}
+
+// CognitoExample builds options for examples/aws-cognito-basic in the
+// configured region.
+func CognitoExample(t *testing.T) *OptionsBuilder {
+	return cognitoBuilder(t, "../examples/aws-cognito-basic").Var("aws_region", getAWSRegionFromEnv(t))
+}
+
+// CognitoModule builds options for modules/aws-cognito on its own.
+func CognitoModule(t *testing.T) *OptionsBuilder {
+	return cognitoBuilder(t, "../modules/aws-cognito")
+}
+
+func cognitoBuilder(t *testing.T, dir string) *OptionsBuilder {
+	b := newOptionsBuilder(config.AWS, dir)
+	return b.Vars(map[string]interface{}{
+		"user_pool_name": b.Name("pool"),
+		"client_name":    b.Name("client"),
+	}).Env("AWS_DEFAULT_REGION", getAWSRegionFromEnv(t))
+}
+
+// AzureSSO builds options for examples/azure-ad-sso in the configured
+// tenant. The azuread provider reads the client credentials from the
+// ARM_* variables the test configuration exports.
+func AzureSSO(t *testing.T) *OptionsBuilder {
+	b := newOptionsBuilder(config.Azure, "../examples/azure-ad-sso")
+	return b.Vars(map[string]interface{}{
+		"tenant_id":        getTenantIDFromEnv(t),
+		"application_name": b.Name("app"),
+	})
+}
+
+// AzureModule builds options for modules/azure-ad on its own in the
+// configured tenant.
+func AzureModule(t *testing.T) *OptionsBuilder {
+	skipUnlessConfigured(t, config.Azure)
+	b := newOptionsBuilder(config.Azure, "../modules/azure-ad")
+	return b.Var("application_name", b.Name("app"))
+}
+
+// KeycloakExample builds options for examples/keycloak-setup against the
+// configured server, with a realm of its own.
+func KeycloakExample(t *testing.T) *OptionsBuilder {
+	skipUnlessConfigured(t, config.Keycloak)
+	kc := testConfig.Keycloak()
+
+	b := newOptionsBuilder(config.Keycloak, "../examples/keycloak-setup")
+	return b.Vars(map[string]interface{}{
+		"keycloak_url":       kc.URL,
+		"keycloak_client_id": kc.ClientID,
+		"keycloak_username":  kc.Username,
+		"keycloak_password":  kc.Password,
+		"realm_name":         b.Name("realm"),
+	})
+}
+
+// OktaExample builds options for examples/okta-integration in the
+// configured organization.
+func OktaExample(t *testing.T) *OptionsBuilder {
+	skipUnlessConfigured(t, config.Okta)
+	okta := testConfig.Okta()
+
+	b := newOptionsBuilder(config.Okta, "../examples/okta-integration")
+	// The example takes no tags, since the okta provider has none
+	delete(b.opts.Vars, "tags")
+	return b.Vars(map[string]interface{}{
+		"okta_org_name":  okta.OrgName,
+		"okta_base_url":  okta.BaseURL,
+		"okta_api_token": okta.APIToken,
+		"app_name":       b.Name("app"),
+	})
+}
+
+// OktaModule builds options for modules/okta on its own in the configured
+// organization. The okta provider reads the organization and token from
+// the OKTA_* variables the test configuration exports.
+func OktaModule(t *testing.T) *OptionsBuilder {
+	skipUnlessConfigured(t, config.Okta)
+	b := newOptionsBuilder(config.Okta, "../modules/okta")
+	// The module takes no tags
+	delete(b.opts.Vars, "tags")
+	return b.Var("app_name", b.Name("app"))
+}
+
+func TestUnitOptionsBuilder(t *testing.T) {
+	t.Parallel()
+
+	b := newOptionsBuilder(config.Keycloak, "../examples/keycloak-setup")
+	opts := b.Vars(map[string]interface{}{
+		"realm_name": b.Name("realm"),
+		"tags":       map[string]string{"Purpose": "terratest-saml"},
+	}).Var("realm_enabled", false).Env("TF_LOG", "DEBUG").Retries(5, time.Second).Build()
+
+	assert.Equal(t, "../examples/keycloak-setup", opts.TerraformDir)
+	assert.Equal(t, "terratest-realm-"+b.ID(), opts.Vars["realm_name"])
+	assert.Equal(t, map[string]string{"Purpose": "terratest-saml"}, opts.Vars["tags"])
+	assert.Equal(t, false, opts.Vars["realm_enabled"])
+	assert.Equal(t, map[string]string{"TF_LOG": "DEBUG"}, opts.EnvVars)
+	assert.Equal(t, 5, opts.MaxRetries)
+	assert.Equal(t, time.Second, opts.TimeBetweenRetries)
+	assert.Equal(t, retryable.Errors(config.Keycloak), opts.RetryableTerraformErrors)
+
+	// Each builder generates names of its own.
+	assert.NotEqual(t, b.ID(), newOptionsBuilder(config.Keycloak, "../examples/keycloak-setup").ID())
+	// Builders do not share the standard tags.
+	newOptionsBuilder(config.Keycloak, "../examples/keycloak-setup").Build().Vars["tags"].(map[string]string)["Purpose"] = "changed"
+	assert.Equal(t, "terratest", standardTags["Purpose"])
+}
@@ -0,0 +1,76 @@
+// Command moduledocs regenerates the input and output tables in the
+// README.md of terraform module directories from their variable and output
+// blocks. The tables replace the text between the BEGIN_TF_DOCS and
+// END_TF_DOCS markers.
+//
+// From the test directory:
+//
+//	go run ./cmd/moduledocs ../modules/*
+//
+// With -check it only reports the READMEs that are out of date, exiting
+// with status 1 if there are any.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/tfconfig"
+)
+
+func main() {
+	check := flag.Bool("check", false, "report out-of-date READMEs instead of rewriting them")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: moduledocs [-check] module-dir...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	stale := false
+	for _, dir := range flag.Args() {
+		changed, err := update(dir, !*check)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "moduledocs: %s: %v\n", dir, err)
+			os.Exit(1)
+		}
+		if changed {
+			stale = true
+			fmt.Println(filepath.Join(dir, "README.md"))
+		}
+	}
+	if *check && stale {
+		os.Exit(1)
+	}
+}
+
+// update regenerates the tables of dir's README and reports whether they
+// changed, writing the README when write is set.
+func update(dir string, write bool) (bool, error) {
+	m, err := tfconfig.Load(dir)
+	if err != nil {
+		return false, err
+	}
+	path := filepath.Join(dir, "README.md")
+	readme, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	updated, err := m.UpdateReadme(readme)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if bytes.Equal(readme, updated) {
+		return false, nil
+	}
+	if write {
+		return true, os.WriteFile(path, updated, 0o644)
+	}
+	return true, nil
+}
@@ -0,0 +1,130 @@
+// Command sweep deletes identity provider objects leaked by the integration
+// suites: objects named with the terratest- prefix, or tagged
+// Purpose=terratest, that are older than a threshold. Credentials are resolved like the suites resolve them, from
+// the environment, .env and the IDP_TEST_PROFILE profile.
+//
+// From the test directory:
+//
+//	go run ./cmd/sweep -dry-run
+//	go run ./cmd/sweep -providers okta,keycloak -older-than 30m
+//
+// Providers without credentials are skipped unless named in -providers.
+// Keycloak has default credentials for a local server, so it is only swept
+// when KEYCLOAK_URL is set or it is named in -providers.
+// The -*-url flags point a provider at a local stand-in instead.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/cognito"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/sweep"
+)
+
+func main() {
+	var (
+		providers  = flag.String("providers", "", "comma-separated providers to sweep (default: every configured provider)")
+		olderThan  = flag.Duration("older-than", time.Hour, "only delete objects at least this old")
+		dryRun     = flag.Bool("dry-run", false, "list the objects that would be deleted without deleting them")
+		prefixes   = flag.String("prefixes", strings.Join(sweep.DefaultPrefixes, ","), "comma-separated name prefixes of test objects")
+		unknownAge = flag.Bool("include-unknown-age", false, "also delete matching objects whose creation time is unknown (Keycloak realms, Cognito identity pools)")
+		awsURL     = flag.String("aws-url", "", "Cognito endpoint, for a local stand-in such as moto (default: AWS_ENDPOINT_URL)")
+		loginURL   = flag.String("azure-login-url", "", "Azure AD login endpoint")
+		graphURL   = flag.String("graph-url", "", "Microsoft Graph endpoint")
+		oktaURL    = flag.String("okta-url", "", "Okta organization URL (default: from OKTA_ORG_NAME and OKTA_BASE_URL)")
+	)
+	flag.Parse()
+
+	namePrefixes, err := sweep.ParsePrefixes(*prefixes)
+	if err != nil {
+		fatalf("-prefixes: %v", err)
+	}
+
+	cfg, err := config.Load(config.Options{})
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	selected := map[config.Provider]bool{}
+	for _, p := range strings.Split(*providers, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			selected[config.Provider(p)] = true
+		}
+	}
+
+	var sweepers []sweep.Sweeper
+	for _, p := range config.Providers {
+		if len(selected) > 0 && !selected[p] {
+			continue
+		}
+		if reason := cfg.Missing(p); reason != "" {
+			if selected[p] {
+				fatalf("%s: %s", p, reason)
+			}
+			fmt.Printf("%s: skipped, %s\n", p, reason)
+			continue
+		}
+		if p == config.Keycloak && !selected[p] && cfg.Get("KEYCLOAK_URL").Source == config.SourceDefault {
+			fmt.Printf("%s: skipped, KEYCLOAK_URL not set; name it in -providers to sweep %s\n", p, cfg.Keycloak().URL)
+			continue
+		}
+		delete(selected, p)
+
+		switch p {
+		case config.AWS:
+			creds := cfg.AWS()
+			if *awsURL != "" {
+				creds.EndpointURL = *awsURL
+			}
+			sess, err := cognito.Session(creds)
+			if err != nil {
+				fatalf("%s: %v", p, err)
+			}
+			sweepers = append(sweepers, sweep.NewCognito(sess))
+		case config.Azure:
+			sweepers = append(sweepers, sweep.NewAzureAD(ctx, cfg.Azure(), *loginURL, *graphURL))
+		case config.Okta:
+			sweepers = append(sweepers, sweep.NewOkta(cfg.Okta(), *oktaURL))
+		case config.Keycloak:
+			sweepers = append(sweepers, sweep.NewKeycloak(ctx, cfg.Keycloak()))
+		}
+	}
+	for p := range selected {
+		fatalf("unknown provider %q", p)
+	}
+
+	c := sweep.DefaultCriteria(*olderThan)
+	c.Prefixes = namePrefixes
+	c.IncludeUnknownAge = *unknownAge
+
+	results, err := sweep.Run(ctx, sweepers, c, *dryRun, os.Stdout)
+	if *dryRun {
+		fmt.Printf("%d objects would be deleted\n", len(results))
+	} else {
+		deleted := 0
+		for _, r := range results {
+			if r.Deleted {
+				deleted++
+			}
+		}
+		fmt.Printf("%d of %d objects deleted\n", deleted, len(results))
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "sweep: "+format+"\n", args...)
+	os.Exit(1)
+}
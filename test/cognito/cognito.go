@@ -0,0 +1,220 @@
+// Package cognito reads back the configuration of a deployed user pool and
+// its app client through the Cognito API, in the terms of the aws-cognito
+// module's inputs, so the suites can check that the pool behaves the way
+// they configured it rather than only that terraform returned an ID.
+package cognito
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/compare"
+)
+
+// Session returns a session for creds. It uses static credentials when
+// they are configured and the shared configuration otherwise, as the AWS
+// provider does, and sends requests to creds.EndpointURL when it is set.
+func Session(creds config.AWSCredentials) (*session.Session, error) {
+	cfg := aws.NewConfig().WithRegion(creds.Region)
+	if creds.AccessKeyID != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken)
+	}
+	if creds.EndpointURL != "" {
+		cfg.Endpoint = aws.String(creds.EndpointURL)
+	}
+	return session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		Profile:           creds.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+}
+
+// PasswordPolicy is the module's password_policy input.
+type PasswordPolicy struct {
+	MinimumLength    int64 `json:"minimum_length"`
+	RequireLowercase bool  `json:"require_lowercase"`
+	RequireNumbers   bool  `json:"require_numbers"`
+	RequireSymbols   bool  `json:"require_symbols"`
+	RequireUppercase bool  `json:"require_uppercase"`
+}
+
+// Password returns a password satisfying p.
+func (p PasswordPolicy) Password() string {
+	return p.password(int(p.MinimumLength), "")
+}
+
+// Violations returns a password for every rule of p, keyed by the
+// password_policy attribute of the rule, that satisfies all rules but that
+// one.
+func (p PasswordPolicy) Violations() map[string]string {
+	v := map[string]string{
+		"minimum_length": p.password(int(p.MinimumLength)-1, ""),
+	}
+	for _, c := range passwordClasses {
+		if c.required(p) {
+			v[c.rule] = p.password(int(p.MinimumLength), c.rule)
+		}
+	}
+	return v
+}
+
+// passwordClasses are the character classes a password policy can require.
+var passwordClasses = []struct {
+	rule     string
+	chars    string
+	required func(PasswordPolicy) bool
+}{
+	{"require_lowercase", "abc", func(p PasswordPolicy) bool { return p.RequireLowercase }},
+	{"require_uppercase", "ABC", func(p PasswordPolicy) bool { return p.RequireUppercase }},
+	{"require_numbers", "123", func(p PasswordPolicy) bool { return p.RequireNumbers }},
+	{"require_symbols", "!#%", func(p PasswordPolicy) bool { return p.RequireSymbols }},
+}
+
+// password returns a password of length n, with a character of every
+// class but the one of the rule without, padded with a class of its own.
+func (p PasswordPolicy) password(n int, without string) string {
+	var b []byte
+	pad := byte(0)
+	for _, c := range passwordClasses {
+		if c.rule == without {
+			continue
+		}
+		b = append(b, c.chars[0])
+		if pad == 0 {
+			pad = c.chars[1]
+		}
+	}
+	for len(b) < n {
+		b = append(b, pad)
+	}
+	return string(b[:n])
+}
+
+// Config is the part of a user pool and its app client the aws-cognito
+// module inputs control, with the module's variable names as JSON names.
+// Values are in the API's terms, which differ from the inputs only for
+// MFAConfiguration.
+type Config struct {
+	PasswordPolicy PasswordPolicy `json:"password_policy"`
+	// MFAConfiguration is OFF, ON or OPTIONAL. The examples' REQUIRED is
+	// compared as ON.
+	MFAConfiguration string `json:"mfa_configuration"`
+	// AdvancedSecurityMode is OFF, AUDIT or ENFORCED.
+	AdvancedSecurityMode string   `json:"advanced_security_mode"`
+	CallbackURLs         []string `json:"callback_urls"`
+	LogoutURLs           []string `json:"logout_urls"`
+	ExplicitAuthFlows    []string `json:"explicit_auth_flows"`
+}
+
+// Defaults is what Cognito applies to settings a configuration leaves out.
+var Defaults = Config{
+	PasswordPolicy: PasswordPolicy{
+		MinimumLength:    8,
+		RequireLowercase: true,
+		RequireNumbers:   true,
+		RequireSymbols:   true,
+		RequireUppercase: true,
+	},
+	MFAConfiguration:     "OFF",
+	AdvancedSecurityMode: "OFF",
+}
+
+// Inspector reads user pool configurations.
+type Inspector struct {
+	API *cognitoidentityprovider.CognitoIdentityProvider
+}
+
+// NewInspector returns an Inspector using the session p, typically a
+// *session.Session. Set cfgs[i].Endpoint to inspect a local stand-in.
+func NewInspector(p client.ConfigProvider, cfgs ...*aws.Config) *Inspector {
+	return &Inspector{API: cognitoidentityprovider.New(p, cfgs...)}
+}
+
+// Inspect returns the configuration of the user pool userPoolID and its
+// app client clientID.
+func (i *Inspector) Inspect(ctx context.Context, userPoolID, clientID string) (Config, error) {
+	pool, err := i.API.DescribeUserPoolWithContext(ctx, &cognitoidentityprovider.DescribeUserPoolInput{
+		UserPoolId: aws.String(userPoolID),
+	})
+	if err != nil {
+		return Config{}, fmt.Errorf("describing user pool %s: %w", userPoolID, err)
+	}
+	mfa, err := i.API.GetUserPoolMfaConfigWithContext(ctx, &cognitoidentityprovider.GetUserPoolMfaConfigInput{
+		UserPoolId: aws.String(userPoolID),
+	})
+	if err != nil {
+		return Config{}, fmt.Errorf("reading MFA configuration of user pool %s: %w", userPoolID, err)
+	}
+	app, err := i.API.DescribeUserPoolClientWithContext(ctx, &cognitoidentityprovider.DescribeUserPoolClientInput{
+		UserPoolId: aws.String(userPoolID),
+		ClientId:   aws.String(clientID),
+	})
+	if err != nil {
+		return Config{}, fmt.Errorf("describing client %s of user pool %s: %w", clientID, userPoolID, err)
+	}
+
+	c := Config{
+		MFAConfiguration:     aws.StringValue(mfa.MfaConfiguration),
+		AdvancedSecurityMode: Defaults.AdvancedSecurityMode,
+		CallbackURLs:         aws.StringValueSlice(app.UserPoolClient.CallbackURLs),
+		LogoutURLs:           aws.StringValueSlice(app.UserPoolClient.LogoutURLs),
+		ExplicitAuthFlows:    aws.StringValueSlice(app.UserPoolClient.ExplicitAuthFlows),
+	}
+	if c.MFAConfiguration == "" {
+		c.MFAConfiguration = Defaults.MFAConfiguration
+	}
+	if addOns := pool.UserPool.UserPoolAddOns; addOns != nil {
+		c.AdvancedSecurityMode = aws.StringValue(addOns.AdvancedSecurityMode)
+	}
+	if policies := pool.UserPool.Policies; policies != nil && policies.PasswordPolicy != nil {
+		p := policies.PasswordPolicy
+		c.PasswordPolicy = PasswordPolicy{
+			MinimumLength:    aws.Int64Value(p.MinimumLength),
+			RequireLowercase: aws.BoolValue(p.RequireLowercase),
+			RequireNumbers:   aws.BoolValue(p.RequireNumbers),
+			RequireSymbols:   aws.BoolValue(p.RequireSymbols),
+			RequireUppercase: aws.BoolValue(p.RequireUppercase),
+		}
+	}
+	return c, nil
+}
+
+// Diff lists the settings in which c differs from want, one line per
+// setting named after the module input. URL lists and auth flows are
+// compared as sets, since Cognito does not keep their order.
+func (c Config) Diff(want Config) []string {
+	var diffs []string
+	add := func(input string, got, want interface{}) {
+		if !reflect.DeepEqual(got, want) {
+			diffs = append(diffs, fmt.Sprintf("%s: got %v, want %v", input, got, want))
+		}
+	}
+
+	add("password_policy.minimum_length", c.PasswordPolicy.MinimumLength, want.PasswordPolicy.MinimumLength)
+	add("password_policy.require_lowercase", c.PasswordPolicy.RequireLowercase, want.PasswordPolicy.RequireLowercase)
+	add("password_policy.require_numbers", c.PasswordPolicy.RequireNumbers, want.PasswordPolicy.RequireNumbers)
+	add("password_policy.require_symbols", c.PasswordPolicy.RequireSymbols, want.PasswordPolicy.RequireSymbols)
+	add("password_policy.require_uppercase", c.PasswordPolicy.RequireUppercase, want.PasswordPolicy.RequireUppercase)
+	add("mfa_configuration", mfaMode(c.MFAConfiguration), mfaMode(want.MFAConfiguration))
+	add("advanced_security_mode", c.AdvancedSecurityMode, want.AdvancedSecurityMode)
+	add("callback_urls", compare.Set(c.CallbackURLs), compare.Set(want.CallbackURLs))
+	add("logout_urls", compare.Set(c.LogoutURLs), compare.Set(want.LogoutURLs))
+	add("explicit_auth_flows", compare.Set(c.ExplicitAuthFlows), compare.Set(want.ExplicitAuthFlows))
+	return diffs
+}
+
+// mfaMode maps the examples' REQUIRED to the API's ON.
+func mfaMode(s string) string {
+	if s == "REQUIRED" {
+		return "ON"
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package cognito
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+)
+
+// standIn answers the Cognito calls of Inspect the way moto does for the
+// user pool us-east-1_pool with client app.
+func standIn(t *testing.T, mfa string, addOns interface{}) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var in map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		_, op, _ := strings.Cut(r.Header.Get("X-Amz-Target"), ".")
+
+		var out interface{}
+		switch {
+		case in["UserPoolId"] != "us-east-1_pool":
+			w.WriteHeader(400)
+			out = map[string]string{"__type": "ResourceNotFoundException", "message": "User pool does not exist."}
+		case op == "DescribeUserPool":
+			out = map[string]interface{}{"UserPool": map[string]interface{}{
+				"Id": "us-east-1_pool",
+				"Policies": map[string]interface{}{"PasswordPolicy": map[string]interface{}{
+					"MinimumLength":    12,
+					"RequireLowercase": true,
+					"RequireNumbers":   true,
+					"RequireSymbols":   false,
+					"RequireUppercase": true,
+				}},
+				"UserPoolAddOns": addOns,
+			}}
+		case op == "GetUserPoolMfaConfig":
+			out = map[string]interface{}{"MfaConfiguration": mfa}
+		case op == "DescribeUserPoolClient":
+			out = map[string]interface{}{"UserPoolClient": map[string]interface{}{
+				"ClientId":          in["ClientId"],
+				"CallbackURLs":      []string{"https://b.example.com/callback", "https://a.example.com/callback"},
+				"LogoutURLs":        []string{"https://a.example.com/logout"},
+				"ExplicitAuthFlows": []string{"ALLOW_REFRESH_TOKEN_AUTH", "ALLOW_USER_SRP_AUTH"},
+			}}
+		default:
+			w.WriteHeader(400)
+			out = map[string]string{"__type": "UnknownOperationException", "message": op}
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func inspector(t *testing.T, endpoint string) *Inspector {
+	sess, err := Session(config.AWSCredentials{
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		Region:          "us-east-1",
+		EndpointURL:     endpoint,
+	})
+	require.NoError(t, err)
+	return NewInspector(sess)
+}
+
+func TestInspect(t *testing.T) {
+	srv := standIn(t, "ON", map[string]string{"AdvancedSecurityMode": "AUDIT"})
+
+	got, err := inspector(t, srv.URL).Inspect(context.Background(), "us-east-1_pool", "app")
+	require.NoError(t, err)
+
+	assert.Equal(t, Config{
+		PasswordPolicy: PasswordPolicy{
+			MinimumLength:    12,
+			RequireLowercase: true,
+			RequireNumbers:   true,
+			RequireUppercase: true,
+		},
+		MFAConfiguration:     "ON",
+		AdvancedSecurityMode: "AUDIT",
+		CallbackURLs:         []string{"https://b.example.com/callback", "https://a.example.com/callback"},
+		LogoutURLs:           []string{"https://a.example.com/logout"},
+		ExplicitAuthFlows:    []string{"ALLOW_REFRESH_TOKEN_AUTH", "ALLOW_USER_SRP_AUTH"},
+	}, got)
+}
+
+func TestInspectDefaults(t *testing.T) {
+	// Pools created without add-ons or MFA settings leave both out.
+	srv := standIn(t, "", nil)
+
+	got, err := inspector(t, srv.URL).Inspect(context.Background(), "us-east-1_pool", "app")
+	require.NoError(t, err)
+	assert.Equal(t, "OFF", got.MFAConfiguration)
+	assert.Equal(t, "OFF", got.AdvancedSecurityMode)
+}
+
+func TestInspectMissingPool(t *testing.T) {
+	srv := standIn(t, "OFF", nil)
+
+	_, err := inspector(t, srv.URL).Inspect(context.Background(), "us-east-1_gone", "app")
+	assert.ErrorContains(t, err, "describing user pool us-east-1_gone")
+	assert.ErrorContains(t, err, "ResourceNotFoundException")
+}
+
+func TestDiff(t *testing.T) {
+	deployed := Config{
+		PasswordPolicy:       Defaults.PasswordPolicy,
+		MFAConfiguration:     "ON",
+		AdvancedSecurityMode: "ENFORCED",
+		CallbackURLs:         []string{"https://b.example.com", "https://a.example.com"},
+		ExplicitAuthFlows:    []string{"ALLOW_USER_SRP_AUTH"},
+	}
+
+	want := deployed
+	want.MFAConfiguration = "REQUIRED"
+	want.CallbackURLs = []string{"https://a.example.com", "https://b.example.com"}
+	want.LogoutURLs = []string{}
+	assert.Empty(t, deployed.Diff(want))
+
+	want.PasswordPolicy.MinimumLength = 12
+	want.AdvancedSecurityMode = "AUDIT"
+	want.ExplicitAuthFlows = append(want.ExplicitAuthFlows, "ALLOW_USER_PASSWORD_AUTH")
+	assert.Equal(t, []string{
+		"password_policy.minimum_length: got 8, want 12",
+		"advanced_security_mode: got ENFORCED, want AUDIT",
+		"explicit_auth_flows: got [ALLOW_USER_SRP_AUTH], want [ALLOW_USER_PASSWORD_AUTH ALLOW_USER_SRP_AUTH]",
+	}, deployed.Diff(want))
+}
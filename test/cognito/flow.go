@@ -0,0 +1,295 @@
+package cognito
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+)
+
+// Authentication flows of InitiateAuth.
+const (
+	PasswordAuth = cognitoidentityprovider.AuthFlowTypeUserPasswordAuth
+	SRPAuth      = cognitoidentityprovider.AuthFlowTypeUserSrpAuth
+)
+
+// ErrMFACode is returned when Cognito asks for a software token code and
+// the user has no TOTP secret.
+var ErrMFACode = errors.New("software token MFA code requested, but the user has no TOTP secret")
+
+// User is a user signed up and in by a Flow.
+type User struct {
+	Username string
+	Password string
+	Email    string
+	// TOTPSecret is the base32 software token secret. The flow sets it
+	// when it associates a token during MFA setup.
+	TOTPSecret string
+
+	lastCode string
+}
+
+// Tokens are the result of a successful sign-in.
+type Tokens struct {
+	IDToken      string
+	AccessToken  string
+	RefreshToken string
+	// Challenges are the challenges answered before the tokens were
+	// issued, in order.
+	Challenges []string
+}
+
+// Flow signs users up and in through the app client of a user pool the
+// way an application does.
+type Flow struct {
+	API          *cognitoidentityprovider.CognitoIdentityProvider
+	UserPoolID   string
+	ClientID     string
+	ClientSecret string
+	// Now is the clock for SRP timestamps and TOTP codes; time.Now when nil.
+	Now func() time.Time
+}
+
+// NewFlow returns a Flow for the client clientID of the user pool
+// userPoolID using the session p, typically a *session.Session. Pass the
+// client's secret when it has one. Set cfgs[i].Endpoint to sign in to a
+// local stand-in.
+func NewFlow(p client.ConfigProvider, userPoolID, clientID, clientSecret string, cfgs ...*aws.Config) *Flow {
+	return &Flow{
+		API:          cognitoidentityprovider.New(p, cfgs...),
+		UserPoolID:   userPoolID,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	}
+}
+
+func (f *Flow) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return time.Now()
+}
+
+// secretHash returns the SECRET_HASH of username, nil for clients
+// without a secret.
+func (f *Flow) secretHash(username string) *string {
+	if f.ClientSecret == "" {
+		return nil
+	}
+	return aws.String(secretHash(username, f.ClientID, f.ClientSecret))
+}
+
+// SignUp registers u and confirms the registration as an administrator,
+// so the user can sign in without a verification code.
+func (f *Flow) SignUp(ctx context.Context, u *User) error {
+	in := &cognitoidentityprovider.SignUpInput{
+		ClientId:   aws.String(f.ClientID),
+		Username:   aws.String(u.Username),
+		Password:   aws.String(u.Password),
+		SecretHash: f.secretHash(u.Username),
+	}
+	if u.Email != "" {
+		in.UserAttributes = []*cognitoidentityprovider.AttributeType{
+			{Name: aws.String("email"), Value: aws.String(u.Email)},
+		}
+	}
+	if _, err := f.API.SignUpWithContext(ctx, in); err != nil {
+		return fmt.Errorf("signing up %s: %w", u.Username, err)
+	}
+	_, err := f.API.AdminConfirmSignUpWithContext(ctx, &cognitoidentityprovider.AdminConfirmSignUpInput{
+		UserPoolId: aws.String(f.UserPoolID),
+		Username:   aws.String(u.Username),
+	})
+	if err != nil {
+		return fmt.Errorf("confirming %s: %w", u.Username, err)
+	}
+	return nil
+}
+
+// DeleteUser removes u from the user pool.
+func (f *Flow) DeleteUser(ctx context.Context, u *User) error {
+	_, err := f.API.AdminDeleteUserWithContext(ctx, &cognitoidentityprovider.AdminDeleteUserInput{
+		UserPoolId: aws.String(f.UserPoolID),
+		Username:   aws.String(u.Username),
+	})
+	return err
+}
+
+// step is the part of an InitiateAuth or RespondToAuthChallenge response
+// the flow acts on.
+type step struct {
+	result    *cognitoidentityprovider.AuthenticationResultType
+	challenge string
+	params    map[string]string
+	session   *string
+}
+
+// SignIn authenticates u with authFlow, PasswordAuth or SRPAuth, and
+// answers the challenges Cognito issues until it returns tokens:
+// PASSWORD_VERIFIER, MFA_SETUP by associating a software token, and
+// SOFTWARE_TOKEN_MFA with a code from u.TOTPSecret.
+func (f *Flow) SignIn(ctx context.Context, authFlow string, u *User) (*Tokens, error) {
+	params := map[string]*string{"USERNAME": aws.String(u.Username)}
+	var srp *srpClient
+	switch authFlow {
+	case PasswordAuth:
+		params["PASSWORD"] = aws.String(u.Password)
+	case SRPAuth:
+		var err error
+		if srp, err = newSRPClient(f.UserPoolID); err != nil {
+			return nil, err
+		}
+		params["SRP_A"] = aws.String(srp.srpA())
+	default:
+		return nil, fmt.Errorf("unsupported auth flow %q", authFlow)
+	}
+	if hash := f.secretHash(u.Username); hash != nil {
+		params["SECRET_HASH"] = hash
+	}
+
+	out, err := f.API.InitiateAuthWithContext(ctx, &cognitoidentityprovider.InitiateAuthInput{
+		AuthFlow:       aws.String(authFlow),
+		ClientId:       aws.String(f.ClientID),
+		AuthParameters: params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s for %s: %w", authFlow, u.Username, err)
+	}
+	s := step{out.AuthenticationResult, aws.StringValue(out.ChallengeName), aws.StringValueMap(out.ChallengeParameters), out.Session}
+
+	var answered []string
+	for s.result == nil {
+		// After PASSWORD_VERIFIER the user is named by USER_ID_FOR_SRP,
+		// which the secret hash must be computed over as well.
+		username := u.Username
+		if id := s.params["USER_ID_FOR_SRP"]; id != "" {
+			username = id
+		}
+		responses := map[string]string{}
+		switch s.challenge {
+		case cognitoidentityprovider.ChallengeNameTypePasswordVerifier:
+			if srp == nil {
+				return nil, fmt.Errorf("%s challenge in %s", s.challenge, authFlow)
+			}
+			if responses, err = srp.passwordVerifier(s.params, u.Password, f.now()); err != nil {
+				return nil, err
+			}
+		case cognitoidentityprovider.ChallengeNameTypeMfaSetup:
+			if s.session, err = f.setUpSoftwareToken(ctx, u, s.session); err != nil {
+				return nil, err
+			}
+		case cognitoidentityprovider.ChallengeNameTypeSoftwareTokenMfa:
+			if u.TOTPSecret == "" {
+				return nil, ErrMFACode
+			}
+			code, err := f.nextCode(ctx, u)
+			if err != nil {
+				return nil, err
+			}
+			responses["SOFTWARE_TOKEN_MFA_CODE"] = code
+		default:
+			return nil, fmt.Errorf("unsupported challenge %q", s.challenge)
+		}
+		responses["USERNAME"] = username
+		if hash := f.secretHash(username); hash != nil {
+			responses["SECRET_HASH"] = *hash
+		}
+
+		resp, err := f.API.RespondToAuthChallengeWithContext(ctx, &cognitoidentityprovider.RespondToAuthChallengeInput{
+			ClientId:           aws.String(f.ClientID),
+			ChallengeName:      aws.String(s.challenge),
+			ChallengeResponses: aws.StringMap(responses),
+			Session:            s.session,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("answering %s for %s: %w", s.challenge, u.Username, err)
+		}
+		answered = append(answered, s.challenge)
+		s = step{resp.AuthenticationResult, aws.StringValue(resp.ChallengeName), aws.StringValueMap(resp.ChallengeParameters), resp.Session}
+	}
+
+	return &Tokens{
+		IDToken:      aws.StringValue(s.result.IdToken),
+		AccessToken:  aws.StringValue(s.result.AccessToken),
+		RefreshToken: aws.StringValue(s.result.RefreshToken),
+		Challenges:   answered,
+	}, nil
+}
+
+// setUpSoftwareToken associates a software token with u during an
+// MFA_SETUP challenge and verifies it, returning the session to answer the
+// challenge with.
+func (f *Flow) setUpSoftwareToken(ctx context.Context, u *User, session *string) (*string, error) {
+	assoc, err := f.API.AssociateSoftwareTokenWithContext(ctx, &cognitoidentityprovider.AssociateSoftwareTokenInput{Session: session})
+	if err != nil {
+		return nil, fmt.Errorf("associating a software token with %s: %w", u.Username, err)
+	}
+	u.TOTPSecret = aws.StringValue(assoc.SecretCode)
+	u.lastCode = ""
+
+	code, err := f.nextCode(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	verify, err := f.API.VerifySoftwareTokenWithContext(ctx, &cognitoidentityprovider.VerifySoftwareTokenInput{
+		Session:  assoc.Session,
+		UserCode: aws.String(code),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verifying the software token of %s: %w", u.Username, err)
+	}
+	if status := aws.StringValue(verify.Status); status != cognitoidentityprovider.VerifySoftwareTokenResponseTypeSuccess {
+		return nil, fmt.Errorf("verifying the software token of %s: status %s", u.Username, status)
+	}
+	return verify.Session, nil
+}
+
+// totpStep is the validity period of a software token code.
+const totpStep = 30 * time.Second
+
+// nextCode returns the current TOTP code of u. Cognito accepts each code
+// once, so when the current code was already used it waits for the next.
+func (f *Flow) nextCode(ctx context.Context, u *User) (string, error) {
+	for {
+		now := f.now()
+		code, err := TOTP(u.TOTPSecret, now)
+		if err != nil {
+			return "", err
+		}
+		if code != u.lastCode {
+			u.lastCode = code
+			return code, nil
+		}
+		wait := totpStep - time.Duration(now.UnixNano())%totpStep
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// TOTP returns the six digit RFC 6238 code of the base32 secret at t.
+func TOTP(secret string, t time.Time) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("decoding TOTP secret: %w", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(totpStep/time.Second)))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000), nil
+}
@@ -0,0 +1,493 @@
+package cognito
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mockoidc"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/oidc"
+)
+
+const (
+	testPoolID   = "us-east-1_Flow"
+	testClientID = "flowclient"
+	testSecret   = "flowsecret"
+)
+
+// clock is a settable time source shared by the flow and the stand-in.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type poolUser struct {
+	password   string
+	email      string
+	confirmed  bool
+	totpSecret string
+	totpUsed   string
+}
+
+// authSession is the state the stand-in keeps between an InitiateAuth and
+// the responses to its challenges.
+type authSession struct {
+	username string
+	// SRP
+	A, B, b, v  *big.Int
+	secretBlock string
+	// MFA setup
+	totpSecret string
+	verified   bool
+}
+
+// userPool is a stand-in for the Cognito user pool API that checks what
+// real Cognito checks: secret hashes, the password policy, SRP password
+// claims and TOTP codes.
+type userPool struct {
+	t      *testing.T
+	clock  *clock
+	policy PasswordPolicy
+	mfa    string
+	key    *mockoidc.SigningKey
+
+	mu       sync.Mutex
+	users    map[string]*poolUser
+	sessions map[string]*authSession
+	server   *httptest.Server
+}
+
+func startUserPool(t *testing.T, c *clock, policy PasswordPolicy, mfa string) *userPool {
+	key, err := mockoidc.GenerateSigningKey(mockoidc.DefaultKeySize, "user pool", time.Hour)
+	require.NoError(t, err)
+
+	p := &userPool{t: t, clock: c, policy: policy, mfa: mfa, key: key, users: map[string]*poolUser{}, sessions: map[string]*authSession{}}
+	p.server = httptest.NewServer(http.HandlerFunc(p.serve))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+type apiError struct{ code, message string }
+
+func (p *userPool) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == "/"+testPoolID+"/.well-known/jwks.json" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []mockoidc.JWK{p.key.JWK()}})
+		return
+	}
+
+	var in map[string]interface{}
+	require.NoError(p.t, json.NewDecoder(r.Body).Decode(&in))
+	_, op, _ := strings.Cut(r.Header.Get("X-Amz-Target"), ".")
+
+	p.mu.Lock()
+	out, aerr := p.call(op, in)
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	if aerr != nil {
+		w.WriteHeader(400)
+		out = map[string]string{"__type": aerr.code, "message": aerr.message}
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func str(in map[string]interface{}, key string) string {
+	s, _ := in[key].(string)
+	return s
+}
+
+func strMap(in map[string]interface{}, key string) map[string]string {
+	out := map[string]string{}
+	m, _ := in[key].(map[string]interface{})
+	for k, v := range m {
+		out[k], _ = v.(string)
+	}
+	return out
+}
+
+func (p *userPool) call(op string, in map[string]interface{}) (interface{}, *apiError) {
+	switch op {
+	case "SignUp":
+		username := str(in, "Username")
+		if str(in, "SecretHash") != secretHash(username, testClientID, testSecret) {
+			return nil, &apiError{"NotAuthorizedException", "Unable to verify secret hash for client " + testClientID}
+		}
+		if _, ok := p.users[username]; ok {
+			return nil, &apiError{"UsernameExistsException", "User already exists"}
+		}
+		if msg := p.checkPassword(str(in, "Password")); msg != "" {
+			return nil, &apiError{"InvalidPasswordException", "Password did not conform with policy: " + msg}
+		}
+		u := &poolUser{password: str(in, "Password")}
+		attrs, _ := in["UserAttributes"].([]interface{})
+		for _, a := range attrs {
+			if a := a.(map[string]interface{}); a["Name"] == "email" {
+				u.email = str(a, "Value")
+			}
+		}
+		p.users[username] = u
+		return map[string]interface{}{"UserConfirmed": false, "UserSub": username}, nil
+
+	case "AdminConfirmSignUp":
+		u, ok := p.users[str(in, "Username")]
+		if !ok {
+			return nil, &apiError{"UserNotFoundException", "User does not exist."}
+		}
+		u.confirmed = true
+		return map[string]interface{}{}, nil
+
+	case "InitiateAuth":
+		params := strMap(in, "AuthParameters")
+		username := params["USERNAME"]
+		if params["SECRET_HASH"] != secretHash(username, testClientID, testSecret) {
+			return nil, &apiError{"NotAuthorizedException", "Unable to verify secret hash for client " + testClientID}
+		}
+		u, ok := p.users[username]
+		if !ok || !u.confirmed {
+			return nil, &apiError{"NotAuthorizedException", "Incorrect username or password."}
+		}
+		switch str(in, "AuthFlow") {
+		case PasswordAuth:
+			if params["PASSWORD"] != u.password {
+				return nil, &apiError{"NotAuthorizedException", "Incorrect username or password."}
+			}
+			return p.afterPassword(username)
+		case SRPAuth:
+			A, _ := new(big.Int).SetString(params["SRP_A"], 16)
+			salt := randInt(p.t, 128)
+			s := &authSession{
+				username:    username,
+				A:           A,
+				b:           randInt(p.t, 256),
+				v:           new(big.Int).Exp(srpG, srpX("Flow", username, u.password, salt), srpN),
+				secretBlock: base64.StdEncoding.EncodeToString([]byte(randInt(p.t, 256).Text(16))),
+			}
+			s.B = new(big.Int).Mul(srpK, s.v)
+			s.B.Add(s.B, new(big.Int).Exp(srpG, s.b, srpN)).Mod(s.B, srpN)
+			return p.challenge("PASSWORD_VERIFIER", s, map[string]string{
+				"SRP_B":           s.B.Text(16),
+				"SALT":            salt.Text(16),
+				"SECRET_BLOCK":    s.secretBlock,
+				"USER_ID_FOR_SRP": username,
+			}), nil
+		}
+		return nil, &apiError{"InvalidParameterException", "unsupported auth flow"}
+
+	case "RespondToAuthChallenge":
+		s, ok := p.sessions[str(in, "Session")]
+		if !ok {
+			return nil, &apiError{"NotAuthorizedException", "Invalid session for the user."}
+		}
+		delete(p.sessions, str(in, "Session"))
+		responses := strMap(in, "ChallengeResponses")
+		if responses["USERNAME"] != s.username || responses["SECRET_HASH"] != secretHash(s.username, testClientID, testSecret) {
+			return nil, &apiError{"NotAuthorizedException", "Unable to verify secret hash for client " + testClientID}
+		}
+		u := p.users[s.username]
+		switch str(in, "ChallengeName") {
+		case "PASSWORD_VERIFIER":
+			// S = (A * v^u) ^ b mod N
+			scramble := hashInts(s.A, s.B)
+			S := new(big.Int).Exp(new(big.Int).Mul(s.A, new(big.Int).Exp(s.v, scramble, srpN)), s.b, srpN)
+			block, _ := base64.StdEncoding.DecodeString(s.secretBlock)
+			want := srpSignature(srpKey(S, scramble), "Flow", s.username, block, responses["TIMESTAMP"])
+			if responses["PASSWORD_CLAIM_SIGNATURE"] != want {
+				return nil, &apiError{"NotAuthorizedException", "Incorrect username or password."}
+			}
+			if responses["TIMESTAMP"] != p.clock.Now().UTC().Format(srpTimestamp) {
+				return nil, &apiError{"NotAuthorizedException", "Invalid timestamp " + responses["TIMESTAMP"]}
+			}
+			return p.afterPassword(s.username)
+		case "MFA_SETUP":
+			if !s.verified {
+				return nil, &apiError{"NotAuthorizedException", "Software token is not verified."}
+			}
+			u.totpSecret = s.totpSecret
+			return p.tokens(s.username), nil
+		case "SOFTWARE_TOKEN_MFA":
+			code := responses["SOFTWARE_TOKEN_MFA_CODE"]
+			want, _ := TOTP(u.totpSecret, p.clock.Now())
+			if code != want || code == u.totpUsed {
+				return nil, &apiError{"CodeMismatchException", "Invalid code received for user"}
+			}
+			u.totpUsed = code
+			return p.tokens(s.username), nil
+		}
+		return nil, &apiError{"InvalidParameterException", "unsupported challenge"}
+
+	case "AssociateSoftwareToken":
+		s, ok := p.sessions[str(in, "Session")]
+		if !ok {
+			return nil, &apiError{"NotAuthorizedException", "Invalid session for the user."}
+		}
+		secret := make([]byte, 20)
+		_, err := rand.Read(secret)
+		require.NoError(p.t, err)
+		s.totpSecret = base32.StdEncoding.EncodeToString(secret)
+		return map[string]interface{}{"SecretCode": s.totpSecret, "Session": str(in, "Session")}, nil
+
+	case "VerifySoftwareToken":
+		s, ok := p.sessions[str(in, "Session")]
+		if !ok {
+			return nil, &apiError{"NotAuthorizedException", "Invalid session for the user."}
+		}
+		if want, _ := TOTP(s.totpSecret, p.clock.Now()); str(in, "UserCode") != want {
+			return nil, &apiError{"EnableSoftwareTokenMFAException", "Code mismatch"}
+		}
+		s.verified = true
+		p.users[s.username].totpUsed = str(in, "UserCode")
+		return map[string]interface{}{"Status": "SUCCESS", "Session": str(in, "Session")}, nil
+	}
+	return nil, &apiError{"UnknownOperationException", op}
+}
+
+func randInt(t *testing.T, bits int) *big.Int {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+	require.NoError(t, err)
+	return n
+}
+
+func (p *userPool) checkPassword(pw string) string {
+	if int64(len(pw)) < p.policy.MinimumLength {
+		return "Password not long enough"
+	}
+	for _, c := range passwordClasses {
+		if c.required(p.policy) && !strings.ContainsAny(pw, c.chars) {
+			return c.rule
+		}
+	}
+	return ""
+}
+
+// afterPassword issues tokens, or the MFA challenge the pool requires.
+func (p *userPool) afterPassword(username string) (interface{}, *apiError) {
+	s := &authSession{username: username}
+	switch {
+	case p.users[username].totpSecret != "":
+		return p.challenge("SOFTWARE_TOKEN_MFA", s, nil), nil
+	case p.mfa == "ON":
+		return p.challenge("MFA_SETUP", s, map[string]string{"MFAS_CAN_SETUP": `["SOFTWARE_TOKEN_MFA"]`}), nil
+	}
+	return p.tokens(username), nil
+}
+
+func (p *userPool) challenge(name string, s *authSession, params map[string]string) map[string]interface{} {
+	id := randInt(p.t, 256).Text(36)
+	p.sessions[id] = s
+	return map[string]interface{}{"ChallengeName": name, "ChallengeParameters": params, "Session": id}
+}
+
+func (p *userPool) tokens(username string) map[string]interface{} {
+	now := time.Now()
+	sign := func(claims jwt.MapClaims) string {
+		claims["iss"] = Issuer("us-east-1", testPoolID)
+		claims["sub"] = username
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(time.Hour).Unix()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = p.key.ID
+		raw, err := token.SignedString(p.key.Key)
+		require.NoError(p.t, err)
+		return raw
+	}
+	return map[string]interface{}{"AuthenticationResult": map[string]interface{}{
+		"IdToken":      sign(jwt.MapClaims{"token_use": "id", "aud": testClientID, "cognito:username": username, "email": p.users[username].email}),
+		"AccessToken":  sign(jwt.MapClaims{"token_use": "access", "client_id": testClientID, "username": username}),
+		"RefreshToken": "refresh-" + username,
+		"TokenType":    "Bearer",
+	}}
+}
+
+func newTestFlow(t *testing.T, mfa string) (*Flow, *userPool, *clock) {
+	c := &clock{now: time.Date(2024, 3, 5, 9, 7, 3, 0, time.UTC)}
+	pool := startUserPool(t, c, Defaults.PasswordPolicy, mfa)
+	sess, err := Session(config.AWSCredentials{AccessKeyID: "test", SecretAccessKey: "test", Region: "us-east-1", EndpointURL: pool.server.URL})
+	require.NoError(t, err)
+
+	f := NewFlow(sess, testPoolID, testClientID, testSecret)
+	f.Now = c.Now
+	return f, pool, c
+}
+
+func newUser(name string) *User {
+	return &User{Username: name, Password: Defaults.PasswordPolicy.Password(), Email: name + "@example.com"}
+}
+
+func awsCode(err error) string {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code()
+	}
+	return ""
+}
+
+func verifyTokens(t *testing.T, pool *userPool, tokens *Tokens) (jwt.MapClaims, jwt.MapClaims) {
+	t.Helper()
+
+	url := JWKSURL(config.AWSCredentials{EndpointURL: pool.server.URL}, testPoolID)
+	keys, err := oidc.FetchJWKS(context.Background(), pool.server.Client(), url)
+	require.NoError(t, err)
+
+	issuer := Issuer("us-east-1", testPoolID)
+	id, err := VerifyToken(keys, tokens.IDToken, issuer, testClientID, TokenUseID)
+	require.NoError(t, err)
+	access, err := VerifyToken(keys, tokens.AccessToken, issuer, testClientID, TokenUseAccess)
+	require.NoError(t, err)
+	return id, access
+}
+
+func TestSignInWithPassword(t *testing.T) {
+	f, pool, _ := newTestFlow(t, "OFF")
+	ctx := context.Background()
+	u := newUser("alice")
+
+	require.NoError(t, f.SignUp(ctx, u))
+	tokens, err := f.SignIn(ctx, PasswordAuth, u)
+	require.NoError(t, err)
+	assert.Empty(t, tokens.Challenges)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	id, access := verifyTokens(t, pool, tokens)
+	assert.Equal(t, "alice@example.com", id["email"])
+	assert.Equal(t, "alice", access["username"])
+
+	u.Password += "x"
+	_, err = f.SignIn(ctx, PasswordAuth, u)
+	assert.Equal(t, "NotAuthorizedException", awsCode(err))
+}
+
+func TestSignInWithSRP(t *testing.T) {
+	f, pool, _ := newTestFlow(t, "OFF")
+	ctx := context.Background()
+	u := newUser("bob")
+
+	require.NoError(t, f.SignUp(ctx, u))
+	tokens, err := f.SignIn(ctx, SRPAuth, u)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PASSWORD_VERIFIER"}, tokens.Challenges)
+	verifyTokens(t, pool, tokens)
+
+	// The password never leaves the client; a wrong one yields a claim
+	// the pool rejects.
+	u.Password += "x"
+	_, err = f.SignIn(ctx, SRPAuth, u)
+	assert.Equal(t, "NotAuthorizedException", awsCode(err))
+}
+
+func TestSoftwareTokenMFA(t *testing.T) {
+	f, pool, c := newTestFlow(t, "ON")
+	ctx := context.Background()
+	u := newUser("carol")
+	require.NoError(t, f.SignUp(ctx, u))
+
+	tokens, err := f.SignIn(ctx, PasswordAuth, u)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"MFA_SETUP"}, tokens.Challenges)
+	require.NotEmpty(t, u.TOTPSecret)
+	verifyTokens(t, pool, tokens)
+
+	// The code used to verify the token is spent; the flow waits for the
+	// next one, which the clock provides.
+	c.Advance(totpStep)
+	tokens, err = f.SignIn(ctx, SRPAuth, u)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PASSWORD_VERIFIER", "SOFTWARE_TOKEN_MFA"}, tokens.Challenges)
+
+	c.Advance(totpStep)
+	wrong := *u
+	wrong.TOTPSecret = base32.StdEncoding.EncodeToString([]byte("not the user's secret"))
+	_, err = f.SignIn(ctx, PasswordAuth, &wrong)
+	assert.Equal(t, "CodeMismatchException", awsCode(err))
+
+	wrong.TOTPSecret = ""
+	_, err = f.SignIn(ctx, PasswordAuth, &wrong)
+	assert.ErrorIs(t, err, ErrMFACode)
+}
+
+func TestPasswordPolicyViolations(t *testing.T) {
+	policy := PasswordPolicy{MinimumLength: 12, RequireLowercase: true, RequireNumbers: true, RequireUppercase: true}
+	f, pool, _ := newTestFlow(t, "OFF")
+	pool.policy = policy
+	ctx := context.Background()
+
+	violations := policy.Violations()
+	assert.Len(t, violations, 4)
+	assert.NotContains(t, violations, "require_symbols")
+	for rule, password := range violations {
+		err := f.SignUp(ctx, &User{Username: "dave-" + rule, Password: password})
+		assert.Equal(t, "InvalidPasswordException", awsCode(err), "%s: %s", rule, password)
+	}
+
+	assert.Len(t, policy.Password(), 12)
+	require.NoError(t, f.SignUp(ctx, &User{Username: "dave", Password: policy.Password()}))
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for unix, want := range map[int64]string{59: "287082", 1111111109: "081804", 2000000000: "279037"} {
+		code, err := TOTP(secret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "T=%d", unix)
+	}
+}
+
+func TestVerifyTokenRejects(t *testing.T) {
+	f, pool, _ := newTestFlow(t, "OFF")
+	ctx := context.Background()
+	u := newUser("erin")
+	require.NoError(t, f.SignUp(ctx, u))
+	tokens, err := f.SignIn(ctx, PasswordAuth, u)
+	require.NoError(t, err)
+
+	keys, err := oidc.FetchJWKS(ctx, pool.server.Client(), pool.server.URL+"/"+testPoolID+"/.well-known/jwks.json")
+	require.NoError(t, err)
+	issuer := Issuer("us-east-1", testPoolID)
+
+	for name, tc := range map[string]struct {
+		raw, issuer, clientID, use, err string
+	}{
+		"access token as id token": {tokens.AccessToken, issuer, testClientID, TokenUseID, `token_use is "access"`},
+		"other client":             {tokens.IDToken, issuer, "other", TokenUseID, "aud is"},
+		"other client access":      {tokens.AccessToken, issuer, "other", TokenUseAccess, "client_id is"},
+		"other pool":               {tokens.IDToken, Issuer("us-east-1", "us-east-1_Other"), testClientID, TokenUseID, "issuer"},
+		"tampered":                 {tokens.IDToken[:len(tokens.IDToken)-4] + "AAAA", issuer, testClientID, TokenUseID, "signature"},
+	} {
+		_, err := VerifyToken(keys, tc.raw, tc.issuer, tc.clientID, tc.use)
+		assert.ErrorContains(t, err, tc.err, name)
+	}
+
+	unknown := &oidc.JWKS{}
+	_, err = VerifyToken(unknown, tokens.IDToken, issuer, testClientID, TokenUseID)
+	assert.ErrorContains(t, err, fmt.Sprintf("no key %q", pool.key.ID))
+}
@@ -0,0 +1,59 @@
+package cognito
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/oidc"
+)
+
+// Issuer returns the issuer of the tokens of the user pool userPoolID.
+func Issuer(region, userPoolID string) string {
+	return fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", region, userPoolID)
+}
+
+// JWKSURL returns the URL of the signing keys of the user pool userPoolID.
+// A local stand-in serves them under the pool ID at creds.EndpointURL.
+func JWKSURL(creds config.AWSCredentials, userPoolID string) string {
+	if creds.EndpointURL != "" {
+		return strings.TrimRight(creds.EndpointURL, "/") + "/" + userPoolID + "/.well-known/jwks.json"
+	}
+	return Issuer(creds.Region, userPoolID) + "/.well-known/jwks.json"
+}
+
+// Token uses, the token_use claim.
+const (
+	TokenUseID     = "id"
+	TokenUseAccess = "access"
+)
+
+// VerifyToken checks the signature of raw against keys and that it is an
+// unexpired token of the given use, issued by issuer to the app client
+// clientID. It returns the token's claims.
+func VerifyToken(keys *oidc.JWKS, raw, issuer, clientID, use string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, keys.Keyfunc, oidc.ParserOptions(issuer, "RS256")...)
+	if err != nil {
+		return nil, fmt.Errorf("%s token: %w", use, err)
+	}
+
+	if got, _ := claims["token_use"].(string); got != use {
+		return nil, fmt.Errorf("%s token: token_use is %q", use, got)
+	}
+	// ID tokens name the client in aud, access tokens in client_id.
+	switch use {
+	case TokenUseID:
+		aud, err := claims.GetAudience()
+		if err != nil || len(aud) != 1 || aud[0] != clientID {
+			return nil, fmt.Errorf("id token: aud is %v, want %s", claims["aud"], clientID)
+		}
+	case TokenUseAccess:
+		if got, _ := claims["client_id"].(string); got != clientID {
+			return nil, fmt.Errorf("access token: client_id is %q, want %s", got, clientID)
+		}
+	}
+	return claims, nil
+}
@@ -0,0 +1,393 @@
+// Package config loads the credentials and endpoints the integration suites
+// need from the environment, an optional .env file and a named YAML profile.
+//
+// Values are resolved in order of precedence: process environment, .env
+// file, profile, built-in default. Every resolved value remembers where it
+// came from so skip messages can explain exactly what was checked.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Provider identifies one of the identity providers covered by the suites.
+type Provider string
+
+const (
+	AWS      Provider = "aws-cognito"
+	Azure    Provider = "azure-ad"
+	Okta     Provider = "okta"
+	Keycloak Provider = "keycloak"
+)
+
+// Providers lists every provider in the order the test runner uses.
+var Providers = []Provider{AWS, Azure, Okta, Keycloak}
+
+// Source records where a setting was resolved from.
+type Source string
+
+const (
+	SourceEnv     Source = "environment"
+	SourceDotEnv  Source = ".env"
+	SourceProfile Source = "profile"
+	SourceDefault Source = "default"
+	SourceUnset   Source = "unset"
+)
+
+// Environment variables that select the profile and files to read.
+const (
+	ProfileEnv     = "IDP_TEST_PROFILE"
+	ProfileFileEnv = "IDP_TEST_CONFIG"
+	DotEnvFileEnv  = "IDP_TEST_DOTENV"
+)
+
+// Default file names, relative to the test directory.
+const (
+	DefaultProfileFile = "idp-test.yaml"
+	DefaultDotEnvFile  = ".env"
+	DefaultProfile     = "default"
+)
+
+// setting maps an environment variable to its profile key and default.
+type setting struct {
+	provider Provider
+	env      string
+	key      string
+	def      string
+}
+
+var settings = []setting{
+	{AWS, "AWS_ACCESS_KEY_ID", "access_key_id", ""},
+	{AWS, "AWS_SECRET_ACCESS_KEY", "secret_access_key", ""},
+	{AWS, "AWS_SESSION_TOKEN", "session_token", ""},
+	{AWS, "AWS_PROFILE", "profile", ""},
+	{AWS, "AWS_DEFAULT_REGION", "region", "us-east-1"},
+	{AWS, "AWS_ENDPOINT_URL", "endpoint_url", ""},
+
+	{Azure, "ARM_TENANT_ID", "tenant_id", ""},
+	{Azure, "ARM_CLIENT_ID", "client_id", ""},
+	{Azure, "ARM_CLIENT_SECRET", "client_secret", ""},
+	{Azure, "ARM_SUBSCRIPTION_ID", "subscription_id", ""},
+
+	{Okta, "OKTA_ORG_NAME", "org_name", ""},
+	{Okta, "OKTA_BASE_URL", "base_url", "okta.com"},
+	{Okta, "OKTA_API_TOKEN", "api_token", ""},
+
+	{Keycloak, "KEYCLOAK_URL", "url", "http://localhost:8080"},
+	{Keycloak, "KEYCLOAK_CLIENT_ID", "client_id", "admin-cli"},
+	{Keycloak, "KEYCLOAK_USERNAME", "username", "admin"},
+	{Keycloak, "KEYCLOAK_PASSWORD", "password", "admin"},
+	{Keycloak, "KEYCLOAK_BROKER_HOST", "broker_host", ""},
+}
+
+// Value is a resolved setting and where it came from.
+type Value struct {
+	Value  string
+	Source Source
+}
+
+// Set reports whether the setting resolved to a non-empty value.
+func (v Value) Set() bool {
+	return v.Value != ""
+}
+
+// Options controls where Load looks for settings. Zero values fall back to
+// the IDP_TEST_* environment variables and then to the defaults above.
+type Options struct {
+	// Dir is the directory relative file names are resolved against.
+	Dir string
+	// Profile is the profile to read from ProfileFile.
+	Profile string
+	// ProfileFile is the YAML file holding named profiles.
+	ProfileFile string
+	// DotEnvFile is the dotenv file to read.
+	DotEnvFile string
+	// LookupEnv replaces os.LookupEnv, mainly for tests.
+	LookupEnv func(string) (string, bool)
+}
+
+// Config holds every resolved setting.
+type Config struct {
+	// Profile is the profile that was applied, empty when none was found.
+	Profile string
+	// ProfileFile and DotEnvFile are the files that were read, if any.
+	ProfileFile string
+	DotEnvFile  string
+
+	values map[string]Value
+}
+
+// Load resolves all settings. A missing .env or profile file is not an
+// error unless it was requested explicitly.
+func Load(opts Options) (*Config, error) {
+	lookup := opts.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	envOr := func(explicit, env, def string) (string, bool) {
+		if explicit != "" {
+			return explicit, true
+		}
+		if v, ok := lookup(env); ok && v != "" {
+			return v, true
+		}
+		return def, false
+	}
+
+	cfg := &Config{values: make(map[string]Value, len(settings))}
+
+	dotEnvPath, dotEnvExplicit := envOr(opts.DotEnvFile, DotEnvFileEnv, DefaultDotEnvFile)
+	dotEnvPath = resolvePath(opts.Dir, dotEnvPath)
+	dotEnv, err := readDotEnv(dotEnvPath)
+	switch {
+	case err == nil:
+		cfg.DotEnvFile = dotEnvPath
+	case os.IsNotExist(err) && !dotEnvExplicit:
+	default:
+		return nil, fmt.Errorf("reading %s: %w", dotEnvPath, err)
+	}
+
+	// The profile selectors may themselves live in .env.
+	selector := func(explicit, env, def string) (string, bool) {
+		if v, ok := envOr(explicit, env, ""); ok {
+			return v, true
+		}
+		if v := dotEnv[env]; v != "" {
+			return v, true
+		}
+		return def, false
+	}
+
+	profileName, profileExplicit := selector(opts.Profile, ProfileEnv, DefaultProfile)
+	profilePath, fileExplicit := selector(opts.ProfileFile, ProfileFileEnv, DefaultProfileFile)
+	profilePath = resolvePath(opts.Dir, profilePath)
+
+	var profile map[string]string
+	profiles, err := readProfiles(profilePath)
+	switch {
+	case err == nil:
+		cfg.ProfileFile = profilePath
+		p, ok := profiles[profileName]
+		if !ok && profileExplicit {
+			return nil, fmt.Errorf("profile %q not found in %s", profileName, profilePath)
+		}
+		if ok {
+			cfg.Profile = profileName
+			profile = p
+		}
+	case os.IsNotExist(err) && !fileExplicit && !profileExplicit:
+	default:
+		return nil, fmt.Errorf("reading profiles from %s: %w", profilePath, err)
+	}
+
+	for _, s := range settings {
+		v := Value{Source: SourceUnset}
+		if env, ok := lookup(s.env); ok && env != "" {
+			v = Value{env, SourceEnv}
+		} else if env := dotEnv[s.env]; env != "" {
+			v = Value{env, SourceDotEnv}
+		} else if p := profile[profileKey(s)]; p != "" {
+			v = Value{p, SourceProfile}
+		} else if s.def != "" {
+			v = Value{s.def, SourceDefault}
+		}
+		cfg.values[s.env] = v
+	}
+
+	return cfg, nil
+}
+
+// Get returns the resolved value of an environment variable name.
+func (c *Config) Get(env string) Value {
+	if v, ok := c.values[env]; ok {
+		return v
+	}
+	return Value{Source: SourceUnset}
+}
+
+func (c *Config) str(env string) string {
+	return c.Get(env).Value
+}
+
+// AWSCredentials are the settings used by the Cognito suites.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Profile         string
+	Region          string
+	// EndpointURL points terraform and the SDK at a local stand-in such as
+	// moto instead of AWS.
+	EndpointURL string
+}
+
+// AzureCredentials are the settings used by the Azure AD suites.
+type AzureCredentials struct {
+	TenantID       string
+	ClientID       string
+	ClientSecret   string
+	SubscriptionID string
+}
+
+// OktaCredentials are the settings used by the Okta suites.
+type OktaCredentials struct {
+	OrgName  string
+	BaseURL  string
+	APIToken string
+}
+
+// OrgURL returns the https URL of the Okta organization.
+func (o OktaCredentials) OrgURL() string {
+	return fmt.Sprintf("https://%s.%s", o.OrgName, o.BaseURL)
+}
+
+// KeycloakCredentials are the settings used by the Keycloak suites.
+type KeycloakCredentials struct {
+	URL      string
+	ClientID string
+	Username string
+	Password string
+	// BrokerHost is the host name the server reaches this machine at, for
+	// the upstream providers the brokering tests start. Empty when the
+	// server runs here; host.docker.internal when it runs in Docker.
+	BrokerHost string
+}
+
+// AWS returns the AWS settings.
+func (c *Config) AWS() AWSCredentials {
+	return AWSCredentials{
+		AccessKeyID:     c.str("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: c.str("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    c.str("AWS_SESSION_TOKEN"),
+		Profile:         c.str("AWS_PROFILE"),
+		Region:          c.str("AWS_DEFAULT_REGION"),
+		EndpointURL:     c.str("AWS_ENDPOINT_URL"),
+	}
+}
+
+// Azure returns the Azure AD settings.
+func (c *Config) Azure() AzureCredentials {
+	return AzureCredentials{
+		TenantID:       c.str("ARM_TENANT_ID"),
+		ClientID:       c.str("ARM_CLIENT_ID"),
+		ClientSecret:   c.str("ARM_CLIENT_SECRET"),
+		SubscriptionID: c.str("ARM_SUBSCRIPTION_ID"),
+	}
+}
+
+// Okta returns the Okta settings.
+func (c *Config) Okta() OktaCredentials {
+	return OktaCredentials{
+		OrgName:  c.str("OKTA_ORG_NAME"),
+		BaseURL:  c.str("OKTA_BASE_URL"),
+		APIToken: c.str("OKTA_API_TOKEN"),
+	}
+}
+
+// Keycloak returns the Keycloak settings.
+func (c *Config) Keycloak() KeycloakCredentials {
+	return KeycloakCredentials{
+		URL:        strings.TrimRight(c.str("KEYCLOAK_URL"), "/"),
+		ClientID:   c.str("KEYCLOAK_CLIENT_ID"),
+		Username:   c.str("KEYCLOAK_USERNAME"),
+		Password:   c.str("KEYCLOAK_PASSWORD"),
+		BrokerHost: c.str("KEYCLOAK_BROKER_HOST"),
+	}
+}
+
+// EnvVars returns the non-empty settings of a provider as environment
+// variables, suitable for terraform.Options.EnvVars.
+func (c *Config) EnvVars(p Provider) map[string]string {
+	vars := map[string]string{}
+	for _, s := range settings {
+		if s.provider != p {
+			continue
+		}
+		if v := c.str(s.env); v != "" {
+			vars[s.env] = v
+		}
+	}
+	return vars
+}
+
+// Missing returns a human readable reason when the settings required to run
+// a provider's suite are absent, or an empty string when they are present.
+func (c *Config) Missing(p Provider) string {
+	var missing []string
+	require := func(envs ...string) {
+		for _, env := range envs {
+			if !c.Get(env).Set() {
+				missing = append(missing, env)
+			}
+		}
+	}
+
+	switch p {
+	case AWS:
+		if !c.Get("AWS_PROFILE").Set() {
+			require("AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY")
+		}
+	case Azure:
+		require("ARM_TENANT_ID")
+	case Okta:
+		require("OKTA_ORG_NAME", "OKTA_API_TOKEN")
+	case Keycloak:
+		require("KEYCLOAK_URL")
+	}
+
+	if len(missing) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s not set (checked %s)", strings.Join(missing, ", "), c.describeSources())
+}
+
+// describeSources lists the places Load looked for settings.
+func (c *Config) describeSources() string {
+	sources := []string{"environment"}
+	if c.DotEnvFile != "" {
+		sources = append(sources, c.DotEnvFile)
+	}
+	if c.Profile != "" {
+		sources = append(sources, fmt.Sprintf("profile %q in %s", c.Profile, c.ProfileFile))
+	}
+	return strings.Join(sources, ", ")
+}
+
+// profileSections maps providers to their section in a profile.
+var profileSections = map[Provider]string{
+	AWS:      "aws",
+	Azure:    "azure",
+	Okta:     "okta",
+	Keycloak: "keycloak",
+}
+
+func profileKey(s setting) string {
+	return profileSections[s.provider] + "." + s.key
+}
+
+func resolvePath(dir, path string) string {
+	if dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Export copies settings resolved from the .env file or profile into the
+// process environment, so terraform and provider SDKs started by the tests
+// see the same credentials. Variables already in the environment win.
+func (c *Config) Export() error {
+	for _, s := range settings {
+		v := c.Get(s.env)
+		if v.Source != SourceDotEnv && v.Source != SourceProfile {
+			continue
+		}
+		if err := os.Setenv(s.env, v.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func envFrom(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, ".env", `
+# comment
+export ARM_TENANT_ID="tenant-from-dotenv"
+OKTA_ORG_NAME='dev-123'
+`)
+	writeFile(t, dir, DefaultProfileFile, `
+profiles:
+  default:
+    azure:
+      tenant_id: tenant-from-profile
+      client_id: client-from-profile
+    keycloak:
+      url: http://keycloak.internal:8080/
+`)
+
+	cfg, err := Load(Options{
+		Dir:       dir,
+		LookupEnv: envFrom(map[string]string{"OKTA_ORG_NAME": "org-from-env"}),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, Value{"org-from-env", SourceEnv}, cfg.Get("OKTA_ORG_NAME"))
+	assert.Equal(t, Value{"tenant-from-dotenv", SourceDotEnv}, cfg.Get("ARM_TENANT_ID"))
+	assert.Equal(t, Value{"client-from-profile", SourceProfile}, cfg.Get("ARM_CLIENT_ID"))
+	assert.Equal(t, Value{"okta.com", SourceDefault}, cfg.Get("OKTA_BASE_URL"))
+	assert.Equal(t, SourceUnset, cfg.Get("OKTA_API_TOKEN").Source)
+
+	assert.Equal(t, "http://keycloak.internal:8080", cfg.Keycloak().URL)
+	assert.Equal(t, "https://org-from-env.okta.com", cfg.Okta().OrgURL())
+	assert.Equal(t, DefaultProfile, cfg.Profile)
+}
+
+func TestLoadNamedProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "profiles.yaml", `
+profiles:
+  ci:
+    aws:
+      region: eu-west-1
+      profile: terratest
+`)
+
+	cfg, err := Load(Options{
+		Dir:       dir,
+		LookupEnv: envFrom(map[string]string{ProfileEnv: "ci", ProfileFileEnv: "profiles.yaml"}),
+	})
+	require.NoError(t, err)
+
+	aws := cfg.AWS()
+	assert.Equal(t, "eu-west-1", aws.Region)
+	assert.Equal(t, "terratest", aws.Profile)
+	assert.Empty(t, cfg.Missing(AWS))
+
+	_, err = Load(Options{Dir: dir, ProfileFile: "profiles.yaml", Profile: "staging", LookupEnv: envFrom(nil)})
+	assert.ErrorContains(t, err, `profile "staging" not found`)
+}
+
+func TestLoadWithoutFiles(t *testing.T) {
+	cfg, err := Load(Options{Dir: t.TempDir(), LookupEnv: envFrom(nil)})
+	require.NoError(t, err)
+
+	assert.Empty(t, cfg.Profile)
+	assert.Empty(t, cfg.DotEnvFile)
+	assert.Equal(t, "us-east-1", cfg.AWS().Region)
+	assert.Equal(t, "admin", cfg.Keycloak().Username)
+
+	_, err = Load(Options{Dir: t.TempDir(), DotEnvFile: "missing.env", LookupEnv: envFrom(nil)})
+	assert.Error(t, err)
+}
+
+func TestMissing(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, ".env", "OKTA_ORG_NAME=dev-123\n")
+
+	cfg, err := Load(Options{Dir: dir, LookupEnv: envFrom(nil)})
+	require.NoError(t, err)
+
+	reason := cfg.Missing(Okta)
+	assert.True(t, strings.HasPrefix(reason, "OKTA_API_TOKEN not set"), reason)
+	assert.Contains(t, reason, filepath.Join(dir, ".env"))
+
+	assert.Contains(t, cfg.Missing(AWS), "AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY not set")
+	assert.Contains(t, cfg.Missing(Azure), "ARM_TENANT_ID not set")
+	assert.Empty(t, cfg.Missing(Keycloak))
+}
+
+func TestDotEnvRejectsMalformedLines(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, ".env", "ARM_TENANT_ID\n")
+
+	_, err := Load(Options{Dir: dir, LookupEnv: envFrom(nil)})
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestSkipLog(t *testing.T) {
+	var log SkipLog
+	log.Record("TestOktaMinimalConfig", Okta, "OKTA_ORG_NAME not set")
+	log.Record("TestAzureADValidation", Azure, "ARM_TENANT_ID not set")
+	log.Record("TestOktaValidation", Okta, "OKTA_ORG_NAME not set")
+
+	skips := log.Skips()
+	require.Len(t, skips, 3)
+	assert.Equal(t, Azure, skips[0].Provider)
+	assert.Equal(t, "TestOktaMinimalConfig", skips[1].Test)
+
+	var summary strings.Builder
+	log.WriteSummary(&summary)
+	assert.Contains(t, summary.String(), "2 test(s): OKTA_ORG_NAME not set")
+
+	path := filepath.Join(t.TempDir(), "skips.json")
+	require.NoError(t, log.WriteJSON(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"provider": "azure-ad"`)
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readDotEnv parses a dotenv file of KEY=VALUE lines. Blank lines, comments
+// and an optional "export " prefix are accepted; matching single or double
+// quotes around the value are removed.
+func readDotEnv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// profileFile is the layout of the YAML profile file:
+//
+//	profiles:
+//	  ci:
+//	    aws:
+//	      region: us-west-2
+//	    keycloak:
+//	      url: http://keycloak:8080
+type profileFile struct {
+	Profiles map[string]map[string]map[string]string `yaml:"profiles"`
+}
+
+// readProfiles returns every profile in the file, flattened to
+// "section.key" entries.
+func readProfiles(path string) (map[string]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file profileFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]map[string]string, len(file.Profiles))
+	for name, sections := range file.Profiles {
+		flat := map[string]string{}
+		for section, values := range sections {
+			for key, value := range values {
+				flat[section+"."+key] = value
+			}
+		}
+		profiles[name] = flat
+	}
+	return profiles, nil
+}
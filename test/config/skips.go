@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Skip records why a test did not run.
+type Skip struct {
+	Test     string   `json:"test"`
+	Provider Provider `json:"provider"`
+	Reason   string   `json:"reason"`
+}
+
+// SkipLog collects skips from parallel tests so they can be summarised once
+// the run finishes.
+type SkipLog struct {
+	mu    sync.Mutex
+	skips []Skip
+}
+
+// Record adds a skip to the log.
+func (l *SkipLog) Record(test string, provider Provider, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.skips = append(l.skips, Skip{Test: test, Provider: provider, Reason: reason})
+}
+
+// Skips returns the recorded skips ordered by provider and test name.
+func (l *SkipLog) Skips() []Skip {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	skips := append([]Skip{}, l.skips...)
+	sort.Slice(skips, func(i, j int) bool {
+		if skips[i].Provider != skips[j].Provider {
+			return skips[i].Provider < skips[j].Provider
+		}
+		return skips[i].Test < skips[j].Test
+	})
+	return skips
+}
+
+// WriteSummary prints one line per provider and reason with the number of
+// tests it skipped.
+func (l *SkipLog) WriteSummary(w io.Writer) {
+	skips := l.Skips()
+	if len(skips) == 0 {
+		return
+	}
+
+	type group struct {
+		provider Provider
+		reason   string
+	}
+	counts := map[group]int{}
+	var order []group
+	for _, s := range skips {
+		g := group{s.Provider, s.Reason}
+		if counts[g] == 0 {
+			order = append(order, g)
+		}
+		counts[g]++
+	}
+
+	fmt.Fprintln(w, "Skipped providers:")
+	for _, g := range order {
+		fmt.Fprintf(w, "  %-12s %d test(s): %s\n", g.provider, counts[g], g.reason)
+	}
+}
+
+// WriteJSON writes the recorded skips to path as a JSON array.
+func (l *SkipLog) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(l.Skips(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
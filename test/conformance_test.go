@@ -0,0 +1,320 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/idp"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/oidc"
+)
+
+// oidcProfile declares what the OpenID provider of a service is expected
+// to do, so that the conformance suite checks every provider alike and
+// the differences between them are stated here rather than left out of
+// one provider's checks.
+type oidcProfile struct {
+	// Scopes must all appear in scopes_supported.
+	Scopes []string
+	// SigningAlgs are the algorithms ID tokens may be signed with. They
+	// must all appear in id_token_signing_alg_values_supported.
+	SigningAlgs []string
+	// AllowLoopbackHTTP tolerates plain http endpoints on loopback.
+	AllowLoopbackHTTP bool
+	// AuthorizationPath, TokenPath and JWKSPath end the paths of the
+	// endpoints discovery publishes.
+	AuthorizationPath, TokenPath, JWKSPath string
+	// VerifiableAccessTokens means access tokens are JWTs signed with the
+	// keys of the key set, rather than opaque to the client.
+	VerifiableAccessTokens bool
+	// UserInfo means the userinfo endpoint answers the access tokens a
+	// signed in user gets.
+	UserInfo bool
+	// EndSession means discovery publishes an end_session_endpoint for
+	// RP-initiated logout. Without it the document must not publish one.
+	EndSession bool
+}
+
+// oidcProfiles are the profiles of the deployed providers. The mock
+// provider flavors are held to the same profiles. When a provider
+// legitimately differs, change its profile rather than the checks.
+var oidcProfiles = map[config.Provider]oidcProfile{
+	// The discovery document and key set are served by cognito-idp, the
+	// OAuth endpoints by the hosted UI domain. Its /logout endpoint is not
+	// published, and the userinfo endpoint only answers access tokens with
+	// the openid scope, which tokens from InitiateAuth do not have.
+	config.AWS: {
+		Scopes:                 []string{"profile", "email"},
+		SigningAlgs:            []string{"RS256"},
+		AuthorizationPath:      "/oauth2/authorize",
+		TokenPath:              "/oauth2/token",
+		JWKSPath:               "/.well-known/jwks.json",
+		VerifiableAccessTokens: true,
+		UserInfo:               false,
+		EndSession:             false,
+	},
+	// Access tokens for Microsoft Graph, the audience of tokens requested
+	// for the default scopes, are signed for Graph alone and cannot be
+	// verified by clients.
+	config.Azure: {
+		Scopes:                 []string{"profile", "email"},
+		SigningAlgs:            []string{"RS256"},
+		AuthorizationPath:      "/oauth2/v2.0/authorize",
+		TokenPath:              "/oauth2/v2.0/token",
+		JWKSPath:               "/discovery/v2.0/keys",
+		VerifiableAccessTokens: false,
+		UserInfo:               true,
+		EndSession:             true,
+	},
+	// A local Keycloak started with docker run serves plain http.
+	config.Keycloak: {
+		Scopes:                 []string{"profile", "email"},
+		SigningAlgs:            []string{"RS256"},
+		AllowLoopbackHTTP:      true,
+		AuthorizationPath:      "/protocol/openid-connect/auth",
+		TokenPath:              "/protocol/openid-connect/token",
+		JWKSPath:               "/protocol/openid-connect/certs",
+		VerifiableAccessTokens: true,
+		UserInfo:               true,
+		EndSession:             true,
+	},
+	// The default custom authorization server serves everything under /v1.
+	config.Okta: {
+		Scopes:                 []string{"profile", "email"},
+		SigningAlgs:            []string{"RS256"},
+		AuthorizationPath:      "/v1/authorize",
+		TokenPath:              "/v1/token",
+		JWKSPath:               "/v1/keys",
+		VerifiableAccessTokens: true,
+		UserInfo:               true,
+		EndSession:             true,
+	},
+}
+
+// oidcTokens are the tokens a user got signing in to a client.
+type oidcTokens struct {
+	ClientID    string
+	IDToken     string
+	AccessToken string
+}
+
+// oidcTokenSource signs a user in to a client of the provider under test.
+type oidcTokenSource func(ctx context.Context) (*oidcTokens, error)
+
+// oidcConformanceChecks are the subtests of the conformance suite, in the
+// order they run. Later checks use what earlier ones fetched and skip
+// when it is missing.
+var oidcConformanceChecks = []struct {
+	name  string
+	check func(c *oidcConformance, t *testing.T)
+}{
+	{"discovery", (*oidcConformance).discovery},
+	{"jwks", (*oidcConformance).jwks},
+	{"token signature", (*oidcConformance).tokenSignature},
+	{"userinfo", (*oidcConformance).userInfo},
+	{"logout", (*oidcConformance).logout},
+}
+
+// testOIDCConformance runs the conformance suite against the OpenID
+// provider p describes, holding it to the profile of its service. Without
+// tokens, the checks that need a signed in user are skipped.
+func testOIDCConformance(t *testing.T, client *http.Client, p idp.IdentityProvider, tokens oidcTokenSource) {
+	t.Helper()
+	profile, ok := oidcProfiles[p.Provider()]
+	require.True(t, ok, "no OpenID Connect profile for %s", p.Provider())
+	require.NotEmpty(t, p.Issuer(), "the outputs of %s name no issuer", p.Provider())
+
+	c := &oidcConformance{client: client, p: p, profile: profile, tokens: tokens}
+	for _, check := range oidcConformanceChecks {
+		t.Run(check.name, func(t *testing.T) { check.check(c, t) })
+	}
+}
+
+// oidcConformance is the state the checks of one suite run share.
+type oidcConformance struct {
+	client  *http.Client
+	p       idp.IdentityProvider
+	profile oidcProfile
+	tokens  oidcTokenSource
+
+	doc      *oidc.Discovery
+	keys     *oidc.JWKS
+	signedIn bool
+	signIn   *oidcTokens
+}
+
+// discovery validates the discovery document against the profile and
+// checks that the endpoints the outputs name are the ones it publishes,
+// so clients configured from the outputs talk to the endpoints the
+// tokens and keys come from.
+func (c *oidcConformance) discovery(t *testing.T) {
+	doc := validateDiscovery(t, c.client, c.p.DiscoveryURL(), oidc.Options{
+		Issuer:            c.p.Issuer(),
+		SigningAlgs:       c.profile.SigningAlgs,
+		Scopes:            c.profile.Scopes,
+		AllowLoopbackHTTP: c.profile.AllowLoopbackHTTP,
+	})
+	c.doc = doc
+
+	for name, endpoint := range map[string][2]string{
+		"authorization_endpoint": {doc.AuthorizationEndpoint, c.profile.AuthorizationPath},
+		"token_endpoint":         {doc.TokenEndpoint, c.profile.TokenPath},
+		"jwks_uri":               {doc.JWKSURI, c.profile.JWKSPath},
+	} {
+		u, err := url.Parse(endpoint[0])
+		if assert.NoError(t, err, name) {
+			assert.True(t, strings.HasSuffix(u.Path, endpoint[1]), "%s %s does not end with %s", name, endpoint[0], endpoint[1])
+		}
+	}
+	assert.NotEmpty(t, doc.UserInfoEndpoint, "userinfo_endpoint")
+	if c.profile.EndSession {
+		assert.NotEmpty(t, doc.EndSessionEndpoint, "end_session_endpoint")
+	} else {
+		assert.Empty(t, doc.EndSessionEndpoint, "end_session_endpoint, which %s is not expected to publish", c.p.Provider())
+	}
+
+	assert.Equal(t, doc.Issuer, c.p.Issuer(), "issuer")
+	for name, endpoint := range map[string][2]string{
+		"authorization_endpoint": {doc.AuthorizationEndpoint, c.p.AuthorizationEndpoint()},
+		"token_endpoint":         {doc.TokenEndpoint, c.p.TokenEndpoint()},
+		"userinfo_endpoint":      {doc.UserInfoEndpoint, c.p.UserInfoEndpoint()},
+		"jwks_uri":               {doc.JWKSURI, c.p.JWKSURI()},
+	} {
+		if endpoint[1] != "" {
+			assert.Equal(t, endpoint[0], endpoint[1], "%s in the outputs", name)
+		}
+	}
+}
+
+// jwks validates the key set discovery publishes.
+func (c *oidcConformance) jwks(t *testing.T) {
+	c.needDiscovery(t)
+	c.keys = validateJWKS(t, c.client, c.doc.JWKSURI)
+}
+
+// tokenSignature verifies the ID token of a signed in user, and its
+// access token where the profile says clients can.
+func (c *oidcConformance) tokenSignature(t *testing.T) {
+	if c.keys == nil {
+		t.Skip("no key set to verify tokens with")
+	}
+	tokens := c.signedInTokens(t)
+
+	id, err := c.verify(tokens.IDToken)
+	if assert.NoError(t, err, "ID token") {
+		aud, err := id.GetAudience()
+		assert.NoError(t, err)
+		assert.Contains(t, aud, tokens.ClientID, "audience of the ID token")
+	}
+	if c.profile.VerifiableAccessTokens {
+		_, err := c.verify(tokens.AccessToken)
+		assert.NoError(t, err, "access token")
+	}
+}
+
+// verify checks the signature of raw against the key set and that it is
+// an unexpired token issued by the provider. It returns the claims.
+func (c *oidcConformance) verify(raw string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, c.keys.Keyfunc, oidc.ParserOptions(c.p.Issuer(), c.profile.SigningAlgs...)...)
+	return claims, err
+}
+
+// userInfo asks the userinfo endpoint about the signed in user, who must
+// be the subject of the ID token.
+func (c *oidcConformance) userInfo(t *testing.T) {
+	c.needDiscovery(t)
+	if !c.profile.UserInfo {
+		t.Skipf("the userinfo endpoint of %s does not answer the tokens of a sign-in", c.p.Provider())
+	}
+	tokens := c.signedInTokens(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.doc.UserInfoEndpoint, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, err := c.client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "userinfo")
+
+	var info struct {
+		Subject string `json:"sub"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	id, _, err := jwt.NewParser().ParseUnverified(tokens.IDToken, jwt.MapClaims{})
+	require.NoError(t, err)
+	sub, err := id.Claims.GetSubject()
+	require.NoError(t, err)
+	assert.Equal(t, sub, info.Subject, "sub of userinfo")
+}
+
+// logout ends the session of the signed in user at the end session
+// endpoint with the ID token as a hint.
+func (c *oidcConformance) logout(t *testing.T) {
+	c.needDiscovery(t)
+	if !c.profile.EndSession {
+		t.Skipf("%s does not publish RP-initiated logout", c.p.Provider())
+	}
+	tokens := c.signedInTokens(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	logout, err := url.Parse(c.doc.EndSessionEndpoint)
+	require.NoError(t, err)
+	q := logout.Query()
+	q.Set("id_token_hint", tokens.IDToken)
+	q.Set("client_id", tokens.ClientID)
+	logout.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logout.String(), nil)
+	require.NoError(t, err)
+
+	// The provider may redirect to a confirmation page, which is enough.
+	client := *c.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Less(t, resp.StatusCode, http.StatusBadRequest, "logout")
+}
+
+// needDiscovery skips checks that need the discovery document when the
+// discovery check did not get one.
+func (c *oidcConformance) needDiscovery(t *testing.T) {
+	t.Helper()
+	if c.doc == nil {
+		t.Skip("no discovery document")
+	}
+}
+
+// signedInTokens signs a user in the first time it is called and returns
+// the tokens. It skips without a token source, or when signing in failed
+// in an earlier check.
+func (c *oidcConformance) signedInTokens(t *testing.T) *oidcTokens {
+	t.Helper()
+	if c.tokens == nil {
+		t.Skipf("no user signs in to %s", c.p.Provider())
+	}
+	if !c.signedIn {
+		c.signedIn = true
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		tokens, err := c.tokens(ctx)
+		require.NoError(t, err, "signing in")
+		c.signIn = tokens
+	}
+	if c.signIn == nil {
+		t.Skip("signing in failed")
+	}
+	return c.signIn
+}
@@ -0,0 +1,371 @@
+// Package contract declares what consumers of a configuration may rely on
+// in its outputs: the name, type, sensitivity and value pattern of each.
+// A contract is checked statically against the output blocks of the
+// configuration and, after apply, against `terraform output -json`, so a
+// renamed or retyped output fails a test instead of a downstream
+// consumer.
+//
+// The suites keep one contract per module and example under
+// test/testdata/contracts, named after its directory. When an output is
+// meant to change for consumers, update the contract in the same change.
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/idp"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/tfconfig"
+)
+
+// Patterns are the named value patterns a contract can refer to instead
+// of spelling out a regular expression.
+var Patterns = map[string]*regexp.Regexp{
+	// arn is an AWS resource name; IAM names have no region.
+	"arn": regexp.MustCompile(`^arn:aws[a-z-]*:[a-z0-9-]+:[a-z0-9-]*:[0-9]{12}:.+$`),
+	// guid is an Azure object, application or tenant ID.
+	"guid": regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`),
+	// url is an absolute http or https URL.
+	"url": regexp.MustCompile(`^https?://[^\s/]+(/\S*)?$`),
+}
+
+// placeholder is a reference to another output in a template, such as
+// {issuer} or {realm_urls.issuer}.
+var placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// Contract is the contract of one configuration.
+type Contract struct {
+	Outputs []*Output `json:"outputs"`
+}
+
+// Output is the contract of one output.
+type Output struct {
+	Name string `json:"name"`
+	// TypeExpr is the type as a terraform type constraint, such as
+	// map(object({id = string})). Type is what it parses to.
+	TypeExpr  string   `json:"type"`
+	Type      cty.Type `json:"-"`
+	Sensitive bool     `json:"sensitive,omitempty"`
+	// Value constrains a string value, or every element of a map or list
+	// of strings.
+	Value
+	// Attributes constrain the attributes of an object value, or of every
+	// element of a map or list of objects.
+	Attributes map[string]Value `json:"attributes,omitempty"`
+}
+
+// Value constrains a string. Null values always pass.
+type Value struct {
+	// Pattern is the name of one of Patterns or a regular expression the
+	// value must match.
+	Pattern string `json:"pattern,omitempty"`
+	// Template is what the value must be with each {path} replaced by the
+	// string at path in the other outputs, as idp.Outputs.String reads it.
+	Template string `json:"template,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Load reads the contract at path and checks it is well formed: every
+// type parses and every pattern compiles, and values are only constrained
+// where the type holds strings.
+func Load(path string) (*Contract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Contract
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	seen := map[string]bool{}
+	for _, o := range c.Outputs {
+		if seen[o.Name] {
+			return nil, fmt.Errorf("%s: output %s is declared twice", path, o.Name)
+		}
+		seen[o.Name] = true
+		if err := o.compile(); err != nil {
+			return nil, fmt.Errorf("%s: output %s: %w", path, o.Name, err)
+		}
+	}
+	return &c, nil
+}
+
+// Output returns the contract of the named output, or nil.
+func (c *Contract) Output(name string) *Output {
+	for _, o := range c.Outputs {
+		if o.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+func (o *Output) compile() error {
+	expr, diags := hclsyntax.ParseExpression([]byte(o.TypeExpr), o.Name, hcl.InitialPos)
+	if diags.HasErrors() {
+		return diags
+	}
+	o.Type, diags = typeexpr.TypeConstraint(expr)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	// Constraints apply to the value or to each element of a collection.
+	ty := o.Type
+	if ty.IsMapType() || ty.IsListType() || ty.IsSetType() {
+		ty = ty.ElementType()
+	}
+	if o.Value != (Value{}) {
+		if ty != cty.String {
+			return fmt.Errorf("a %s value cannot have a pattern or template", o.TypeExpr)
+		}
+		if err := o.Value.compile(); err != nil {
+			return err
+		}
+	}
+	for name, v := range o.Attributes {
+		if !ty.IsObjectType() || !ty.HasAttribute(name) || ty.AttributeType(name) != cty.String {
+			return fmt.Errorf("attribute %s is not a string attribute of %s", name, o.TypeExpr)
+		}
+		if err := v.compile(); err != nil {
+			return fmt.Errorf("attribute %s: %w", name, err)
+		}
+		o.Attributes[name] = v
+	}
+	return nil
+}
+
+func (v *Value) compile() error {
+	if v.Pattern == "" {
+		return nil
+	}
+	if re, ok := Patterns[v.Pattern]; ok {
+		v.pattern = re
+		return nil
+	}
+	re, err := regexp.Compile(v.Pattern)
+	if err != nil {
+		return fmt.Errorf("pattern: %w", err)
+	}
+	v.pattern = re
+	return nil
+}
+
+// CheckModule compares the contract with the output blocks of m: the
+// names, the sensitivity and, as far as the syntax tells, the types. It
+// also reports outputs referring to outputs of called modules that do not
+// exist, which terraform rejects.
+func (c *Contract) CheckModule(m *tfconfig.Module) []string {
+	var diffs []string
+	for _, o := range c.Outputs {
+		decl := m.Output(o.Name)
+		if decl == nil {
+			diffs = append(diffs, o.Name+": in the contract, not declared")
+			continue
+		}
+		if decl.Sensitive != o.Sensitive {
+			diffs = append(diffs, fmt.Sprintf("%s: sensitive is %t, %t in the contract", o.Name, decl.Sensitive, o.Sensitive))
+		}
+		diffs = append(diffs, m.CheckOutputType(o.Name, o.Type)...)
+	}
+	for _, decl := range m.Outputs {
+		if c.Output(decl.Name) == nil {
+			diffs = append(diffs, decl.Name+": declared, not in the contract")
+		}
+	}
+	return append(diffs, m.CheckModuleRefs()...)
+}
+
+// CheckOutputs compares the contract with the outputs of an applied
+// configuration. terraform leaves null outputs out, so outputs missing
+// from outputs are not reported; CheckModule catches undeclared ones.
+func (c *Contract) CheckOutputs(outputs idp.Outputs) []string {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var diffs []string
+	for _, name := range names {
+		out := outputs[name]
+		o := c.Output(name)
+		if o == nil {
+			diffs = append(diffs, name+": output, not in the contract")
+			continue
+		}
+		if out.Sensitive != o.Sensitive {
+			diffs = append(diffs, fmt.Sprintf("%s: sensitive is %t, %t in the contract", name, out.Sensitive, o.Sensitive))
+		}
+		got, err := ctyjson.UnmarshalType(out.Type)
+		if err != nil {
+			diffs = append(diffs, fmt.Sprintf("%s: type: %v", name, err))
+			continue
+		}
+		typeDiffs := conforms(got, o.Type, name)
+		diffs = append(diffs, typeDiffs...)
+		if len(typeDiffs) == 0 {
+			diffs = append(diffs, o.checkValue(out.Value, outputs)...)
+		}
+	}
+	return diffs
+}
+
+// conforms compares the type terraform reports for an output with the
+// type want. Objects built by for expressions are reported as objects
+// with one attribute per key, and conform to maps of their element type.
+func conforms(got, want cty.Type, path string) []string {
+	mismatch := []string{fmt.Sprintf("%s: %s, %s in the contract", path, tfconfig.TypeName(got), tfconfig.TypeName(want))}
+	switch {
+	case got == cty.DynamicPseudoType || want == cty.DynamicPseudoType:
+		// Null, or anything goes.
+		return nil
+	case want.IsPrimitiveType():
+		if got != want {
+			return mismatch
+		}
+		return nil
+	case want.IsObjectType():
+		if !got.IsObjectType() {
+			return mismatch
+		}
+		var diffs []string
+		for _, name := range attributeNames(want, got) {
+			switch {
+			case !got.HasAttribute(name):
+				diffs = append(diffs, fmt.Sprintf("%s.%s: in the contract, not output", path, name))
+			case !want.HasAttribute(name):
+				diffs = append(diffs, fmt.Sprintf("%s.%s: output, not in the contract", path, name))
+			default:
+				diffs = append(diffs, conforms(got.AttributeType(name), want.AttributeType(name), path+"."+name)...)
+			}
+		}
+		return diffs
+	case want.IsMapType():
+		switch {
+		case got.IsMapType():
+			return conforms(got.ElementType(), want.ElementType(), path+".*")
+		case got.IsObjectType():
+			var diffs []string
+			for _, name := range attributeNames(got) {
+				diffs = append(diffs, conforms(got.AttributeType(name), want.ElementType(), path+"."+name)...)
+			}
+			return diffs
+		}
+	case want.IsListType() || want.IsSetType():
+		switch {
+		case got.IsListType() || got.IsSetType():
+			return conforms(got.ElementType(), want.ElementType(), path+"[*]")
+		case got.IsTupleType():
+			var diffs []string
+			for i, elem := range got.TupleElementTypes() {
+				diffs = append(diffs, conforms(elem, want.ElementType(), fmt.Sprintf("%s[%d]", path, i))...)
+			}
+			return diffs
+		}
+	}
+	return mismatch
+}
+
+// attributeNames returns the attribute names of the object types, sorted
+// and without duplicates.
+func attributeNames(types ...cty.Type) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, ty := range types {
+		for name := range ty.AttributeTypes() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkValue checks value, which conforms to the output's type, against
+// its constraints.
+func (o *Output) checkValue(value interface{}, outputs idp.Outputs) []string {
+	elements := map[string]interface{}{o.Name: value}
+	if o.Type.IsMapType() || o.Type.IsListType() || o.Type.IsSetType() {
+		elements = map[string]interface{}{}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			for k, v := range value {
+				elements[o.Name+"."+k] = v
+			}
+		case []interface{}:
+			for i, v := range value {
+				elements[fmt.Sprintf("%s[%d]", o.Name, i)] = v
+			}
+		}
+	}
+
+	var diffs []string
+	for path, v := range elements {
+		if err := o.Value.check(v, outputs); err != nil {
+			diffs = append(diffs, fmt.Sprintf("%s: %v", path, err))
+		}
+		attrs, _ := v.(map[string]interface{})
+		for name, c := range o.Attributes {
+			if err := c.check(attrs[name], outputs); err != nil {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: %v", path, name, err))
+			}
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+// check checks a string value, or nil, against v.
+func (v Value) check(value interface{}, outputs idp.Outputs) error {
+	if value == nil || v.pattern == nil && v.Template == "" {
+		return nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("%v is not a string", value)
+	}
+	if v.pattern != nil && !v.pattern.MatchString(s) {
+		return fmt.Errorf("%q does not match %s", s, v.Pattern)
+	}
+	if v.Template != "" {
+		want, err := expand(v.Template, outputs)
+		if err != nil {
+			return err
+		}
+		if s != want {
+			return fmt.Errorf("%q is not %s, %q", s, v.Template, want)
+		}
+	}
+	return nil
+}
+
+// expand replaces the placeholders of template with the strings they
+// refer to in outputs.
+func expand(template string, outputs idp.Outputs) (string, error) {
+	var err error
+	s := placeholder.ReplaceAllStringFunc(template, func(ref string) string {
+		path := ref[1 : len(ref)-1]
+		v := outputs.String(path)
+		if v == "" && err == nil {
+			err = fmt.Errorf("%s refers to %s, which is not output", template, path)
+		}
+		return v
+	})
+	return s, err
+}
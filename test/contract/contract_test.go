@@ -0,0 +1,160 @@
+package contract
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/idp"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/tfconfig"
+)
+
+const endpoints = `{
+  "outputs": [
+    {"name": "tenant_id", "type": "string", "pattern": "guid"},
+    {"name": "issuer", "type": "string", "template": "https://login.example.com/{tenant_id}/v2.0"},
+    {"name": "secret", "type": "string", "sensitive": true},
+    {"name": "group_ids", "type": "map(string)", "pattern": "guid"},
+    {"name": "urls", "type": "object({token = string, userinfo = string})", "attributes": {
+      "token": {"template": "{issuer}/token"},
+      "userinfo": {"pattern": "url"}
+    }},
+    {"name": "summary", "type": "object({groups_count = number})"}
+  ]
+}`
+
+func write(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func load(t *testing.T) *Contract {
+	t.Helper()
+	c, err := Load(write(t, "contract.json", endpoints))
+	require.NoError(t, err)
+	return c
+}
+
+func TestLoadRejects(t *testing.T) {
+	for name, content := range map[string]string{
+		"type":               `{"outputs": [{"name": "id", "type": "strin"}]}`,
+		"pattern on number":  `{"outputs": [{"name": "count", "type": "number", "pattern": "guid"}]}`,
+		"unknown attribute":  `{"outputs": [{"name": "urls", "type": "object({token = string})", "attributes": {"jwks": {"pattern": "url"}}}]}`,
+		"regular expression": `{"outputs": [{"name": "id", "type": "string", "pattern": "(["}]}`,
+		"duplicate":          `{"outputs": [{"name": "id", "type": "string"}, {"name": "id", "type": "string"}]}`,
+		"unknown field":      `{"outputs": [{"name": "id", "type": "string", "sensitve": true}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(write(t, "contract.json", content))
+			assert.Error(t, err)
+		})
+	}
+}
+
+const outputs = `{
+  "tenant_id": {"sensitive": false, "type": "string", "value": "00000000-0000-0000-0000-000000000000"},
+  "issuer": {"sensitive": false, "type": "string", "value": "https://login.example.com/00000000-0000-0000-0000-000000000000/v2.0"},
+  "secret": {"sensitive": true, "type": "string", "value": "s3cret"},
+  "group_ids": {"sensitive": false, "type": ["object", {"admins": "string"}], "value": {"admins": "11111111-1111-1111-1111-111111111111"}},
+  "urls": {"sensitive": false, "type": ["object", {"token": "string", "userinfo": "string"}], "value": {
+    "token": "https://login.example.com/00000000-0000-0000-0000-000000000000/v2.0/token",
+    "userinfo": "https://graph.example.com/oidc/userinfo"
+  }},
+  "summary": {"sensitive": false, "type": "dynamic", "value": null}
+}`
+
+func parse(t *testing.T, data string) idp.Outputs {
+	t.Helper()
+	o, err := idp.ParseOutputs([]byte(data))
+	require.NoError(t, err)
+	return o
+}
+
+func TestCheckOutputs(t *testing.T) {
+	c := load(t)
+	assert.Empty(t, c.CheckOutputs(parse(t, outputs)))
+	// Null outputs are left out
+	assert.Empty(t, c.CheckOutputs(parse(t, `{}`)))
+
+	assert.Equal(t, []string{
+		`group_ids.admins: "admins" does not match guid`,
+		`issuer: "https://login.example.com/tenant/v2.0" is not https://login.example.com/{tenant_id}/v2.0, "https://login.example.com/00000000-0000-0000-0000-000000000000/v2.0"`,
+		"renamed: output, not in the contract",
+		"secret: sensitive is false, true in the contract",
+		"summary.groups_count: string, number in the contract",
+		"urls.jwks: output, not in the contract",
+		"urls.userinfo: in the contract, not output",
+	}, c.CheckOutputs(parse(t, `{
+  "tenant_id": {"sensitive": false, "type": "string", "value": "00000000-0000-0000-0000-000000000000"},
+  "issuer": {"sensitive": false, "type": "string", "value": "https://login.example.com/tenant/v2.0"},
+  "secret": {"sensitive": false, "type": "string", "value": "s3cret"},
+  "group_ids": {"sensitive": false, "type": ["map", "string"], "value": {"admins": "admins"}},
+  "urls": {"sensitive": false, "type": ["object", {"token": "string", "jwks": "string"}], "value": {}},
+  "summary": {"sensitive": false, "type": ["object", {"groups_count": "string"}], "value": {"groups_count": "1"}},
+  "renamed": {"sensitive": false, "type": "string", "value": ""}
+}`)))
+}
+
+func TestCheckOutputsTemplateWithoutReference(t *testing.T) {
+	diffs := load(t).CheckOutputs(parse(t, `{
+  "issuer": {"sensitive": false, "type": "string", "value": "https://login.example.com//v2.0"}
+}`))
+	assert.Equal(t, []string{"issuer: https://login.example.com/{tenant_id}/v2.0 refers to tenant_id, which is not output"}, diffs)
+}
+
+func TestCheckModule(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "outputs.tf"), []byte(`
+variable "tenant_id" {
+  type = string
+}
+
+output "tenant_id" {
+  value = var.tenant_id
+}
+
+output "issuer" {
+  value = "https://login.example.com/${var.tenant_id}/v2.0"
+}
+
+output "secret" {
+  value = "s3cret"
+}
+
+output "group_ids" {
+  value = { for k, v in azuread_group.main : k => v.object_id }
+}
+
+output "urls" {
+  value = {
+    token = "https://login.example.com/${var.tenant_id}/v2.0/token"
+    jwks  = "https://login.example.com/${var.tenant_id}/discovery/v2.0/keys"
+  }
+}
+
+output "summary" {
+  value = {
+    groups_count = length(azuread_group.main)
+  }
+}
+
+output "application_id" {
+  value = module.app.client_id
+}
+`), 0o644))
+	m, err := tfconfig.Load(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"secret: sensitive is false, true in the contract",
+		"urls.jwks: built by the configuration, not in the contract",
+		"urls.userinfo: in the contract, not built by the configuration",
+		"application_id: declared, not in the contract",
+		"application_id: refers to module.app.client_id, but module app is not called",
+	}, load(t).CheckModule(m))
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/idp"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/oidc"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/wait"
+)
+
+// convergenceTimeout bounds how long the endpoint helpers wait for objects
+// created by the last apply to be served.
+const convergenceTimeout = 2 * time.Minute
+
+// waitReady polls url until every predicate accepts the response, failing
+// the test when it does not converge within convergenceTimeout. How long
+// convergence took is logged.
+func waitReady(t *testing.T, client *http.Client, url string, preds ...wait.Predicate) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), convergenceTimeout)
+	defer cancel()
+
+	res, err := wait.Until(ctx, wait.Backoff{}, wait.URL(client, url, preds...))
+	require.NoError(t, err, "waiting for %s", url)
+	t.Logf("%s ready after %s (%d attempts)", url, res.Elapsed.Round(time.Millisecond), res.Attempts)
+}
+
+// waitMatches polls diff until it reports no differences between what the
+// provider API serves for what and the inputs, since new objects and their
+// assignments are not read back consistently for a while after apply. It
+// fails the test with the remaining differences after convergenceTimeout.
+func waitMatches(t *testing.T, what string, diff func(ctx context.Context) ([]string, error)) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), convergenceTimeout)
+	defer cancel()
+
+	res, err := wait.Until(ctx, wait.Backoff{}, func(ctx context.Context) error {
+		diffs, err := diff(ctx)
+		if err != nil {
+			return err
+		}
+		if len(diffs) > 0 {
+			return fmt.Errorf("%s differs from its inputs:\n%s", what, strings.Join(diffs, "\n"))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	t.Logf("%s matches its inputs after %s (%d attempts)", what, res.Elapsed.Round(time.Millisecond), res.Attempts)
+}
+
+// validateDiscovery waits for the discovery document at discoveryURL to be
+// served and fails the test on any OpenID Connect Discovery 1.0 violation.
+// Warnings are only logged. The document is returned for provider specific
+// assertions.
+func validateDiscovery(t *testing.T, client *http.Client, discoveryURL string, opts oidc.Options) *oidc.Discovery {
+	t.Helper()
+	waitReady(t, client, discoveryURL, wait.Status(http.StatusOK), wait.JSONField("jwks_uri"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	doc, err := oidc.Fetch(ctx, client, discoveryURL)
+	require.NoError(t, err)
+
+	opts.DiscoveryURL = discoveryURL
+	findings := oidc.Validate(doc, opts)
+	for _, f := range findings {
+		if f.Severity == oidc.Warning {
+			t.Logf("%s: %s", discoveryURL, f)
+		}
+	}
+	assert.Empty(t, findings.Errors(), "discovery document at %s:\n%s", discoveryURL, findings.Errors())
+	return doc
+}
+
+// validateJWKS waits for the key set at jwksURI and fails the test on any
+// problem oidc.ValidateJWKS reports. Warnings, such as certificates close to
+// expiry, are only logged.
+func validateJWKS(t *testing.T, client *http.Client, jwksURI string) *oidc.JWKS {
+	t.Helper()
+	waitReady(t, client, jwksURI, wait.Status(http.StatusOK), wait.JWKSKid(""))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	set, err := oidc.FetchJWKS(ctx, client, jwksURI)
+	require.NoError(t, err)
+
+	findings := oidc.ValidateJWKS(set, oidc.JWKSOptions{})
+	for _, f := range findings {
+		if f.Severity == oidc.Warning {
+			t.Logf("%s: %s", jwksURI, f)
+		}
+	}
+	assert.Empty(t, findings.Errors(), "key set at %s:\n%s", jwksURI, findings.Errors())
+	return set
+}
+
+// validateSAMLMetadata waits for the identity provider metadata at
+// metadataURL and fails the test on any problem saml.Validate reports
+// against opts, including signing certificates that expire within 30 days.
+func validateSAMLMetadata(t *testing.T, client *http.Client, metadataURL string, opts saml.Options) *saml.EntityDescriptor {
+	t.Helper()
+	waitReady(t, client, metadataURL, wait.Status(http.StatusOK))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	metadata, err := saml.Fetch(ctx, client, metadataURL)
+	require.NoError(t, err)
+
+	findings := saml.Validate(metadata, opts)
+	for _, f := range findings {
+		if f.Severity == saml.Warning {
+			t.Logf("%s: %s", metadataURL, f)
+		}
+	}
+	assert.Empty(t, findings.Errors(), "SAML metadata at %s:\n%s", metadataURL, findings.Errors())
+	return metadata
+}
+
+// outputIdentityProvider reads the outputs of the configuration
+// terraformOptions applied as the identity provider of provider.
+func outputIdentityProvider(t *testing.T, provider config.Provider, terraformOptions *terraform.Options) idp.IdentityProvider {
+	t.Helper()
+
+	outputs, err := idp.ParseOutputs([]byte(terraform.OutputJson(t, terraformOptions, "")))
+	require.NoError(t, err)
+	p, err := idp.New(provider, outputs)
+	require.NoError(t, err)
+	return p
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+)
+
+// skipReportEnv names a file the skip log is written to as JSON.
+const skipReportEnv = "IDP_TEST_SKIP_REPORT"
+
+var (
+	testConfig *config.Config
+	skipLog    config.SkipLog
+)
+
+func TestMain(m *testing.M) {
+	cfg, err := config.Load(config.Options{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loading test configuration: %v\n", err)
+		os.Exit(1)
+	}
+	if err := cfg.Export(); err != nil {
+		fmt.Fprintf(os.Stderr, "exporting test configuration: %v\n", err)
+		os.Exit(1)
+	}
+	testConfig = cfg
+
+	code := m.Run()
+
+	skipLog.WriteSummary(os.Stdout)
+	if path := os.Getenv(skipReportEnv); path != "" {
+		if err := skipLog.WriteJSON(path); err != nil {
+			fmt.Fprintf(os.Stderr, "writing skip report: %v\n", err)
+		}
+	}
+	os.Exit(code)
+}
+
+// skipUnlessConfigured skips the test when the provider's credentials are
+// missing, its server is unreachable or terraform is not installed. The
+// reason is recorded in the skip log.
+func skipUnlessConfigured(t *testing.T, provider config.Provider) {
+	t.Helper()
+
+	reason := testConfig.Missing(provider)
+	if reason == "" && provider == config.Keycloak {
+		reason = keycloakUnreachable(testConfig.Keycloak().URL)
+	}
+	if reason != "" {
+		skip(t, provider, reason)
+	}
+	skipUnlessTerraform(t, provider)
+}
+
+// skipUnlessTerraform skips the test when the terraform binary is missing.
+func skipUnlessTerraform(t *testing.T, provider config.Provider) {
+	t.Helper()
+
+	if _, err := exec.LookPath("terraform"); err != nil {
+		skip(t, provider, "terraform binary not found on PATH")
+	}
+}
+
+// skipUnlessCognitoEmulator skips Cognito tests that only run against a
+// local stand-in, such as the moto server run-tests.sh aws-cognito-local
+// starts. They sign up and enrol throwaway users, which the emulator drops
+// with its container.
+func skipUnlessCognitoEmulator(t *testing.T) {
+	t.Helper()
+
+	if testConfig.AWS().EndpointURL == "" {
+		skip(t, config.AWS, "AWS_ENDPOINT_URL is not set; run ./run-tests.sh aws-cognito-local")
+	}
+}
+
+func skip(t *testing.T, provider config.Provider, reason string) {
+	t.Helper()
+	skipLog.Record(t.Name(), provider, reason)
+	t.Skipf("%s: %s", provider, reason)
+}
+
+var (
+	keycloakProbeOnce   sync.Once
+	keycloakProbeReason string
+)
+
+// keycloakUnreachable probes the Keycloak server once per run and returns a
+// skip reason when it does not answer.
+func keycloakUnreachable(url string) string {
+	keycloakProbeOnce.Do(func() {
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Get(url)
+		if err != nil {
+			keycloakProbeReason = fmt.Sprintf("Keycloak at %s (KEYCLOAK_URL from %s) is unreachable: %v",
+				url, testConfig.Get("KEYCLOAK_URL").Source, err)
+			return
+		}
+		resp.Body.Close()
+	})
+	return keycloakProbeReason
+}
+
+// liveHTTPClient is the client endpoint helpers use against deployed
+// providers; offline tests pass the mock provider's client instead.
+func liveHTTPClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second}
+}
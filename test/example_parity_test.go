@@ -0,0 +1,127 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/tfconfig"
+)
+
+// updateParityEnv makes TestUnitExampleModuleParity rewrite the accepted
+// findings under testdata/parity instead of comparing against them.
+const updateParityEnv = "IDP_TEST_UPDATE_PARITY"
+
+// TestUnitExampleModuleParity compares each example with the interface of
+// the module it wraps. Variables the example leaves unused and module
+// inputs and outputs it leaves unexposed are listed in
+// testdata/parity/<example>.txt; the test fails on any new one, and on any
+// listed one that no longer occurs so the list only shrinks. Every other
+// finding fails the test whatever the list says.
+func TestUnitExampleModuleParity(t *testing.T) {
+	t.Parallel()
+
+	examples, err := filepath.Glob(filepath.Join("..", "examples", "*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, examples)
+
+	for _, dir := range examples {
+		dir := dir
+		name := filepath.Base(dir)
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			example := loadModuleConfig(t, filepath.ToSlash(filepath.Join("examples", name)))
+			var got []string
+			for _, call := range example.ModuleCalls {
+				if !strings.HasPrefix(call.Source, "../../modules/") {
+					continue
+				}
+				module, err := tfconfig.Load(filepath.Join(dir, call.Source))
+				require.NoError(t, err, "module %s", call.Name)
+				for _, f := range tfconfig.CheckParity(example, call, module) {
+					finding := fmt.Sprintf("module.%s %s", call.Name, f)
+					switch {
+					case f.Kind.Accepted():
+						got = append(got, finding)
+					case f.Kind == tfconfig.UndeclaredInput || f.Kind == tfconfig.UndeclaredOutput:
+						t.Errorf("%s: %s; terraform refuses to plan examples/%s", f.Range, finding, name)
+					default:
+						t.Errorf("%s: %s", f.Range, finding)
+					}
+				}
+			}
+
+			path := filepath.Join("testdata", "parity", name+".txt")
+			if os.Getenv(updateParityEnv) != "" {
+				writeParityFindings(t, path, name, got)
+			}
+			accepted := readParityFindings(t, path)
+			for _, f := range accepted {
+				if kind := parityFindingKind(f); !kind.Accepted() {
+					t.Errorf("%s lists %q; %s findings cannot be accepted, fix the example", path, f, kind)
+				}
+			}
+
+			for _, f := range got {
+				assert.Contains(t, accepted, f, "new interface drift in examples/%s; fix it or rerun with %s=1", name, updateParityEnv)
+			}
+			for _, f := range accepted {
+				assert.Contains(t, got, f, "examples/%s no longer has this drift; rerun with %s=1", name, updateParityEnv)
+			}
+		})
+	}
+}
+
+// parityFindingKind returns the kind of a finding as listed in
+// testdata/parity: "module.<name> <kind> <name>[: <detail>]".
+func parityFindingKind(finding string) tfconfig.FindingKind {
+	fields := strings.Fields(finding)
+	if len(fields) < 2 {
+		return ""
+	}
+	return tfconfig.FindingKind(fields[1])
+}
+
+func readParityFindings(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+
+	var findings []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			findings = append(findings, line)
+		}
+	}
+	return findings
+}
+
+func writeParityFindings(t *testing.T, path, example string, findings []string) {
+	t.Helper()
+	if len(findings) == 0 {
+		require.NoError(t, os.RemoveAll(path))
+		return
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Unused variables and unexposed module inputs and outputs of examples/%s.\n", example)
+	fmt.Fprintf(&buf, "# Regenerate with %s=1 go test -run TestUnitExampleModuleParity.\n", updateParityEnv)
+	for _, f := range findings {
+		fmt.Fprintln(&buf, f)
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+}
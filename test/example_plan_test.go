@@ -0,0 +1,262 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/plan"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/retryable"
+)
+
+// recordPlansEnv makes examplePlan run terraform plan against the live
+// provider and rewrite the fixture instead of loading it.
+const recordPlansEnv = "IDP_TEST_RECORD_PLANS"
+
+// examplePlanFixtures are the examples whose plan can be recorded under
+// testdata/plans. Plans are recorded with the example defaults plus the
+// provider settings the example requires. Only check in plans terraform
+// produced; the tests treat them as ground truth.
+var examplePlanFixtures = map[string]struct {
+	provider config.Provider
+	vars     func(t *testing.T) map[string]interface{}
+}{
+	"aws-cognito-basic": {
+		provider: config.AWS,
+		vars: func(t *testing.T) map[string]interface{} {
+			return map[string]interface{}{"aws_region": getAWSRegionFromEnv(t)}
+		},
+	},
+	"azure-ad-sso": {
+		provider: config.Azure,
+		vars: func(t *testing.T) map[string]interface{} {
+			return map[string]interface{}{"tenant_id": getTenantIDFromEnv(t)}
+		},
+	},
+	"keycloak-setup": {
+		provider: config.Keycloak,
+		vars: func(t *testing.T) map[string]interface{} {
+			return map[string]interface{}{
+				"keycloak_url":      getKeycloakURLFromEnv(t),
+				"keycloak_username": getKeycloakUsernameFromEnv(t),
+				"keycloak_password": getKeycloakPasswordFromEnv(t),
+			}
+		},
+	},
+	"okta-integration": {
+		provider: config.Okta,
+		vars: func(t *testing.T) map[string]interface{} {
+			return map[string]interface{}{
+				"okta_org_name":  getOktaOrgFromEnv(t),
+				"okta_base_url":  getOktaBaseURLFromEnv(t),
+				"okta_api_token": getOktaTokenFromEnv(t),
+			}
+		},
+	},
+}
+
+// examplePlan returns the recorded plan of an example. With
+// IDP_TEST_RECORD_PLANS set it plans the example first and rewrites the
+// fixture, skipping when the provider is not configured. Without it a
+// missing plan fails the test: the TestUnit*Plan tests are the offline
+// check of module behaviour and must not pass vacuously.
+func examplePlan(t *testing.T, example string) *plan.Plan {
+	t.Helper()
+
+	fixture, ok := examplePlanFixtures[example]
+	require.True(t, ok, "no plan fixture for example %s", example)
+	path := filepath.Join("testdata", "plans", example+".json")
+
+	if os.Getenv(recordPlansEnv) != "" {
+		skipUnlessConfigured(t, fixture.provider)
+		terraformOptions := &terraform.Options{
+			TerraformDir:             filepath.Join("..", "examples", example),
+			Vars:                     fixture.vars(t),
+			PlanFilePath:             filepath.Join(t.TempDir(), "tfplan"),
+			NoColor:                  true,
+			MaxRetries:               defaultMaxRetries,
+			TimeBetweenRetries:       defaultTimeBetweenRetries,
+			RetryableTerraformErrors: retryable.Errors(fixture.provider),
+		}
+		data, err := plan.Fixture([]byte(terraform.InitAndPlanAndShow(t, terraformOptions)))
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+	} else if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("no plan recorded for %s; record one with %s=1 against a configured %s", example, recordPlansEnv, fixture.provider)
+	}
+
+	p, err := plan.Load(path)
+	require.NoError(t, err)
+	return p
+}
+
+// plannedValue returns the planned value at path, failing the test when it
+// is absent or unknown.
+func plannedValue(t *testing.T, c *plan.ResourceChange, path string) interface{} {
+	t.Helper()
+	v, ok := c.Attribute(path)
+	require.True(t, ok, "%s: %s is not set in the plan", c.Address, path)
+	return v
+}
+
+func TestUnitCognitoBasicPlan(t *testing.T) {
+	t.Parallel()
+	p := examplePlan(t, "aws-cognito-basic")
+
+	// Without domain_name and create_identity_pool only the pool and its
+	// client are created.
+	assert.ElementsMatch(t, []string{
+		"module.cognito.aws_cognito_user_pool.main",
+		"module.cognito.aws_cognito_user_pool_client.main",
+	}, p.Addresses(plan.WithAction(plan.Create)))
+	assert.Equal(t, plan.Summary{Add: 2}, p.Summary())
+
+	pool := p.Resource("module.cognito.aws_cognito_user_pool.main")
+	require.NotNil(t, pool)
+	policy := p.Variables["password_policy"].(map[string]interface{})
+	for _, field := range []string{"minimum_length", "require_lowercase", "require_numbers", "require_symbols", "require_uppercase"} {
+		assert.Equal(t, policy[field], plannedValue(t, pool, "password_policy.0."+field), "password_policy.%s", field)
+	}
+	assert.Equal(t, p.Variables["advanced_security_mode"], plannedValue(t, pool, "user_pool_add_ons.0.advanced_security_mode"))
+	assert.Equal(t, []interface{}{"email"}, plannedValue(t, pool, "auto_verified_attributes"))
+	for key, value := range p.Variables["tags"].(map[string]interface{}) {
+		assert.Equal(t, value, plannedValue(t, pool, "tags_all."+key), "tag %s", key)
+	}
+
+	client := p.Resource("module.cognito.aws_cognito_user_pool_client.main")
+	require.NotNil(t, client)
+	assert.Equal(t, p.Variables["callback_urls"], plannedValue(t, client, "callback_urls"))
+	assert.Equal(t, p.Variables["logout_urls"], plannedValue(t, client, "logout_urls"))
+	assert.Equal(t, []interface{}{"COGNITO"}, plannedValue(t, client, "supported_identity_providers"))
+	assert.Equal(t, true, plannedValue(t, client, "allowed_oauth_flows_user_pool_client"))
+	assert.True(t, client.Unknown("client_secret"))
+	assert.True(t, client.Sensitive("client_secret"))
+
+	assert.True(t, p.Output("user_pool_client_secret").Sensitive)
+	assert.True(t, p.Output("issuer").Unknown)
+}
+
+func TestUnitAzureADSSOPlan(t *testing.T) {
+	t.Parallel()
+	p := examplePlan(t, "azure-ad-sso")
+
+	app := p.Resource("module.azure_ad.azuread_application.main")
+	require.NotNil(t, app)
+	assert.Equal(t, p.Variables["application_name"], plannedValue(t, app, "display_name"))
+	assert.Equal(t, p.Variables["sign_in_audience"], plannedValue(t, app, "sign_in_audience"))
+	web := p.Variables["web_settings"].(map[string]interface{})
+	assert.Equal(t, web["redirect_uris"], plannedValue(t, app, "web.0.redirect_uris"))
+	assert.Equal(t, web["logout_url"], plannedValue(t, app, "web.0.logout_url"))
+
+	var roles []interface{}
+	for _, role := range p.Variables["app_roles"].([]interface{}) {
+		roles = append(roles, role.(map[string]interface{})["value"])
+	}
+	var planned []interface{}
+	for _, role := range plannedValue(t, app, "app_role").([]interface{}) {
+		planned = append(planned, role.(map[string]interface{})["value"])
+	}
+	assert.ElementsMatch(t, roles, planned)
+	assert.Equal(t, p.Variables["required_resource_access"], plannedValue(t, app, "required_resource_access"))
+
+	assert.NotNil(t, p.Resource("module.azure_ad.azuread_service_principal.main"))
+	// The example pins create_application_secret to output client_secret
+	assert.NotNil(t, p.Resource("module.azure_ad.azuread_application_password.main[0]"))
+	assert.True(t, p.Output("client_secret").Sensitive)
+
+	groups := p.Variables["groups"].(map[string]interface{})
+	assert.Len(t, p.Select(plan.Address("module.azure_ad.azuread_group.main[*]")), len(groups))
+	for key, g := range groups {
+		group := p.Resource(`module.azure_ad.azuread_group.main["` + key + `"]`)
+		if assert.NotNil(t, group, "group %s", key) {
+			assert.Equal(t, g.(map[string]interface{})["display_name"], plannedValue(t, group, "display_name"))
+			assert.Equal(t, true, plannedValue(t, group, "security_enabled"))
+		}
+	}
+
+	tenant := p.Variables["tenant_id"].(string)
+	assert.Equal(t, "https://login.microsoftonline.com/"+tenant+"/v2.0", p.Output("issuer").After)
+}
+
+func TestUnitKeycloakSetupPlan(t *testing.T) {
+	t.Parallel()
+	p := examplePlan(t, "keycloak-setup")
+
+	realm := p.Resource("module.keycloak.keycloak_realm.main")
+	require.NotNil(t, realm)
+	assert.Equal(t, p.Variables["realm_name"], plannedValue(t, realm, "realm"))
+	assert.Equal(t, p.Variables["realm_display_name"], plannedValue(t, realm, "display_name"))
+	assert.Equal(t, p.Variables["realm_enabled"], plannedValue(t, realm, "enabled"))
+	assert.Equal(t, "external", plannedValue(t, realm, "ssl_required"))
+
+	for variable, resourceType := range map[string]string{
+		"groups":      "keycloak_group",
+		"users":       "keycloak_user",
+		"realm_roles": "keycloak_realm_role",
+	} {
+		keys := p.Variables[variable].(map[string]interface{})
+		var want []string
+		for key := range keys {
+			want = append(want, "module.keycloak."+resourceType+`.main["`+key+`"]`)
+		}
+		assert.ElementsMatch(t, want, p.Addresses(plan.Type(resourceType)), variable)
+	}
+	assert.Empty(t, p.Select(plan.Type("keycloak_saml_identity_provider")))
+
+	user := p.Resource(`module.keycloak.keycloak_user.main["testuser"]`)
+	require.NotNil(t, user)
+	assert.True(t, user.Sensitive("initial_password"))
+
+	issuer := p.Variables["keycloak_url"].(string) + "/realms/" + p.Variables["realm_name"].(string)
+	assert.Equal(t, issuer, p.Output("issuer").After)
+	assert.Equal(t, issuer+"/protocol/saml/descriptor", p.Output("saml_descriptor_url").After)
+	assert.Equal(t, plan.Redacted, p.Variables["keycloak_password"])
+}
+
+func TestUnitOktaIntegrationPlan(t *testing.T) {
+	t.Parallel()
+	p := examplePlan(t, "okta-integration")
+
+	// create_saml_app is on and create_oauth_app off by default.
+	app := p.Resource("module.okta.okta_app_saml.main[0]")
+	require.NotNil(t, app)
+	assert.Empty(t, p.Select(plan.Type("okta_app_oauth")))
+
+	for _, field := range []string{"sso_url", "audience", "destination"} {
+		assert.Equal(t, p.Variables[field], plannedValue(t, app, field), field)
+	}
+	assert.Equal(t, p.Variables["app_name"], plannedValue(t, app, "label"))
+	assert.Equal(t, "RSA_SHA256", plannedValue(t, app, "signature_algorithm"))
+	assert.Equal(t, true, plannedValue(t, app, "response_signed"))
+	assert.Equal(t, true, plannedValue(t, app, "assertion_signed"))
+
+	statements := p.Variables["attribute_statements"].([]interface{})
+	planned := plannedValue(t, app, "attribute_statements").([]interface{})
+	require.Len(t, planned, len(statements))
+	for i, s := range statements {
+		s := s.(map[string]interface{})
+		for _, field := range []string{"name", "namespace", "values"} {
+			assert.Equal(t, s[field], planned[i].(map[string]interface{})[field], "attribute_statements.%d.%s", i, field)
+		}
+	}
+
+	groups := p.Variables["groups"].(map[string]interface{})
+	assert.Len(t, p.Select(plan.Type("okta_group")), len(groups))
+	for key, g := range groups {
+		assert.Len(t, p.Select(
+			plan.Address(`module.okta.okta_group.main["`+key+`"]`),
+			plan.AttributeEquals("name", g.(map[string]interface{})["name"]),
+		), 1, "group %s", key)
+	}
+
+	assert.True(t, p.Output("saml_sso_url").Unknown)
+	assert.True(t, p.Output("oauth_client_secret").Sensitive)
+	assert.Nil(t, p.Output("oauth_client_id").After)
+}
@@ -0,0 +1,231 @@
+// Package graph reads the Azure AD objects the azure-ad module manages,
+// applications, their service principals and app role assignments,
+// through Microsoft Graph, so the suites can compare the directory with
+// the inputs they applied.
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/apierror"
+)
+
+const (
+	// DefaultURL is the Graph API root of the public cloud.
+	DefaultURL = "https://graph.microsoft.com"
+	// DefaultLoginURL is the Azure AD login endpoint of the public cloud.
+	DefaultLoginURL = "https://login.microsoftonline.com"
+)
+
+// Application is an application registration.
+type Application struct {
+	ID                     string                   `json:"id"`
+	AppID                  string                   `json:"appId"`
+	DisplayName            string                   `json:"displayName"`
+	Description            string                   `json:"description"`
+	SignInAudience         string                   `json:"signInAudience"`
+	IdentifierURIs         []string                 `json:"identifierUris"`
+	AppRoles               []AppRole                `json:"appRoles"`
+	RequiredResourceAccess []RequiredResourceAccess `json:"requiredResourceAccess"`
+	Web                    Web                      `json:"web"`
+	SPA                    RedirectURIs             `json:"spa"`
+	PublicClient           RedirectURIs             `json:"publicClient"`
+	Tags                   []string                 `json:"tags"`
+}
+
+// AppRole is a role an application defines.
+type AppRole struct {
+	ID                 string   `json:"id"`
+	DisplayName        string   `json:"displayName"`
+	Description        string   `json:"description"`
+	Value              string   `json:"value"`
+	AllowedMemberTypes []string `json:"allowedMemberTypes"`
+	IsEnabled          bool     `json:"isEnabled"`
+}
+
+// RequiredResourceAccess are the permissions an application requests on
+// one API.
+type RequiredResourceAccess struct {
+	ResourceAppID  string           `json:"resourceAppId"`
+	ResourceAccess []ResourceAccess `json:"resourceAccess"`
+}
+
+// ResourceAccess is a delegated permission, of type Scope, or an
+// application permission, of type Role.
+type ResourceAccess struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// Web holds the settings of a web application.
+type Web struct {
+	RedirectURIs []string `json:"redirectUris"`
+	LogoutURL    string   `json:"logoutUrl"`
+	HomePageURL  string   `json:"homePageUrl"`
+}
+
+// RedirectURIs holds the settings of a single page or public client
+// application.
+type RedirectURIs struct {
+	RedirectURIs []string `json:"redirectUris"`
+}
+
+// ServicePrincipal is the instance of an application in the tenant.
+type ServicePrincipal struct {
+	ID                        string   `json:"id"`
+	AppID                     string   `json:"appId"`
+	DisplayName               string   `json:"displayName"`
+	AppRoleAssignmentRequired bool     `json:"appRoleAssignmentRequired"`
+	Tags                      []string `json:"tags"`
+}
+
+// AppRoleAssignment grants an app role of a service principal to a user,
+// group or other service principal.
+type AppRoleAssignment struct {
+	ID                   string `json:"id"`
+	AppRoleID            string `json:"appRoleId"`
+	PrincipalID          string `json:"principalId"`
+	PrincipalType        string `json:"principalType"`
+	PrincipalDisplayName string `json:"principalDisplayName"`
+	ResourceID           string `json:"resourceId"`
+}
+
+// Client reads directory objects.
+type Client struct {
+	// URL is the Graph API root.
+	URL string
+	// HTTP sends authenticated Graph requests.
+	HTTP *http.Client
+}
+
+// New returns a Client authenticating with the client credentials in
+// creds. Empty loginURL and graphURL select the public cloud endpoints.
+func New(ctx context.Context, creds config.AzureCredentials, loginURL, graphURL string) *Client {
+	if loginURL == "" {
+		loginURL = DefaultLoginURL
+	}
+	if graphURL == "" {
+		graphURL = DefaultURL
+	}
+	graphURL = strings.TrimRight(graphURL, "/")
+	cc := clientcredentials.Config{
+		ClientID:     creds.ClientID,
+		ClientSecret: creds.ClientSecret,
+		TokenURL:     fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimRight(loginURL, "/"), creds.TenantID),
+		Scopes:       []string{graphURL + "/.default"},
+	}
+	return &Client{URL: graphURL, HTTP: cc.Client(ctx)}
+}
+
+// Application returns the application with the client ID appID.
+func (c *Client) Application(ctx context.Context, appID string) (*Application, error) {
+	var app Application
+	if err := c.get(ctx, "/v1.0/applications(appId='"+url.PathEscape(appID)+"')", &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// ServicePrincipal returns the service principal of the application with
+// the client ID appID.
+func (c *Client) ServicePrincipal(ctx context.Context, appID string) (*ServicePrincipal, error) {
+	var sp ServicePrincipal
+	if err := c.get(ctx, "/v1.0/servicePrincipals(appId='"+url.PathEscape(appID)+"')", &sp); err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+// AppRoleAssignments returns the assignments of the app roles of the
+// service principal with the object ID servicePrincipalID.
+func (c *Client) AppRoleAssignments(ctx context.Context, servicePrincipalID string) ([]AppRoleAssignment, error) {
+	var assignments []AppRoleAssignment
+	next := c.URL + "/v1.0/servicePrincipals/" + url.PathEscape(servicePrincipalID) + "/appRoleAssignedTo"
+	for next != "" {
+		var page struct {
+			Value    []AppRoleAssignment `json:"value"`
+			NextLink string              `json:"@odata.nextLink"`
+		}
+		if err := c.getURL(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, page.Value...)
+		next = page.NextLink
+	}
+	return assignments, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	return c.getURL(ctx, c.URL+path, out)
+}
+
+func (c *Client) getURL(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s: %w", u, err)
+	}
+	return nil
+}
+
+// Error is an error response from Graph.
+type Error struct {
+	URL        string
+	StatusCode int
+	// Code is the Graph error code, such as Request_ResourceNotFound.
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("GET %s: %d %s: %s", e.URL, e.StatusCode, e.Code, e.Message)
+}
+
+// HTTPStatus returns the status code of the response.
+func (e *Error) HTTPStatus() int {
+	return e.StatusCode
+}
+
+func readError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	e := &Error{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+	var doc struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &doc) == nil && doc.Error.Code != "" {
+		e.Code, e.Message = doc.Error.Code, doc.Error.Message
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+// IsNotFound reports whether err is a 404 response, which Graph also
+// returns for objects created moments ago that have not replicated yet.
+func IsNotFound(err error) bool {
+	return apierror.IsNotFound(err)
+}
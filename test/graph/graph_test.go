@@ -0,0 +1,174 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/graph"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mockgraph"
+)
+
+const (
+	adminRole = "3c4f2b8e-1d6a-4f7e-9b0c-2a5d8e1f4c7b"
+	userRole  = "8b1e5d2a-7c3f-4e9b-a6d0-1f2c3b4a5e6d"
+)
+
+// seed registers an application shaped like the one the azure-ad-sso
+// example creates, with two groups assigned its roles and one user.
+func seed(s *mockgraph.Server) (graph.Application, graph.ServicePrincipal) {
+	app, sp := s.AddApplication(graph.Application{
+		DisplayName:    "test-app-abc123",
+		SignInAudience: "AzureADMyOrg",
+		AppRoles: []graph.AppRole{
+			{ID: adminRole, DisplayName: "Administrator", Description: "Application administrators", Value: "Admin", AllowedMemberTypes: []string{"User"}, IsEnabled: true},
+			{ID: userRole, DisplayName: "User", Description: "Standard users", Value: "User", AllowedMemberTypes: []string{"User", "Application"}, IsEnabled: true},
+		},
+		RequiredResourceAccess: []graph.RequiredResourceAccess{{
+			ResourceAppID: "00000003-0000-0000-c000-000000000000",
+			ResourceAccess: []graph.ResourceAccess{
+				{ID: "e1fe6dd8-ba31-4d61-89e7-88639da4683d", Type: "Scope"},
+				{ID: "b340eb25-3456-403f-be2f-af7a0d370277", Type: "Scope"},
+			},
+		}},
+		Web: graph.Web{
+			RedirectURIs: []string{"https://test.example.com/auth/callback", "https://localhost:3000/auth/callback"},
+			LogoutURL:    "https://test.example.com/logout",
+			HomePageURL:  "https://test.example.com",
+		},
+	}, graph.ServicePrincipal{AppRoleAssignmentRequired: true})
+
+	s.AddAppRoleAssignment(graph.AppRoleAssignment{AppRoleID: adminRole, PrincipalID: "group-admins", PrincipalType: "Group", ResourceID: sp.ID})
+	s.AddAppRoleAssignment(graph.AppRoleAssignment{AppRoleID: userRole, PrincipalID: "group-users", PrincipalType: "Group", ResourceID: sp.ID})
+	s.AddAppRoleAssignment(graph.AppRoleAssignment{AppRoleID: userRole, PrincipalID: "user-1", PrincipalType: "User", ResourceID: sp.ID})
+	return app, sp
+}
+
+func TestApplicationAndServicePrincipal(t *testing.T) {
+	s := mockgraph.Start(t, mockgraph.Options{})
+	app, sp := seed(s)
+	ctx := context.Background()
+	client := graph.New(ctx, s.Credentials(), s.URL, s.URL)
+
+	got, err := client.Application(ctx, app.AppID)
+	require.NoError(t, err)
+	assert.Equal(t, app, *got)
+
+	gotSP, err := client.ServicePrincipal(ctx, app.AppID)
+	require.NoError(t, err)
+	assert.Equal(t, sp, *gotSP)
+}
+
+func TestAppRoleAssignmentsFollowsPages(t *testing.T) {
+	s := mockgraph.Start(t, mockgraph.Options{PageSize: 2})
+	_, sp := seed(s)
+	ctx := context.Background()
+
+	assignments, err := graph.New(ctx, s.Credentials(), s.URL, s.URL).AppRoleAssignments(ctx, sp.ID)
+	require.NoError(t, err)
+	var principals []string
+	for _, a := range assignments {
+		principals = append(principals, a.PrincipalID)
+	}
+	assert.Equal(t, []string{"group-admins", "group-users", "user-1"}, principals)
+}
+
+func TestNotFound(t *testing.T) {
+	s := mockgraph.Start(t, mockgraph.Options{})
+	ctx := context.Background()
+
+	_, err := graph.New(ctx, s.Credentials(), s.URL, s.URL).Application(ctx, "00000000-0000-0000-0000-000000000000")
+	require.Error(t, err)
+	assert.True(t, graph.IsNotFound(err))
+	var gerr *graph.Error
+	require.True(t, errors.As(err, &gerr))
+	assert.Equal(t, "Request_ResourceNotFound", gerr.Code)
+}
+
+func TestReplicationLag(t *testing.T) {
+	s := mockgraph.Start(t, mockgraph.Options{Lag: 2})
+	app, _ := seed(s)
+	ctx := context.Background()
+	client := graph.New(ctx, s.Credentials(), s.URL, s.URL)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Application(ctx, app.AppID)
+		assert.True(t, graph.IsNotFound(err), "read %d: %v", i+1, err)
+	}
+	_, err := client.Application(ctx, app.AppID)
+	assert.NoError(t, err)
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	s := mockgraph.Start(t, mockgraph.Options{})
+	app, _ := seed(s)
+	ctx := context.Background()
+	creds := s.Credentials()
+	creds.ClientSecret = "wrong"
+
+	_, err := graph.New(ctx, creds, s.URL, s.URL).Application(ctx, app.AppID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_client")
+	assert.False(t, graph.IsNotFound(err))
+}
+
+func TestInspect(t *testing.T) {
+	s := mockgraph.Start(t, mockgraph.Options{PageSize: 1})
+	app, _ := seed(s)
+	ctx := context.Background()
+
+	got, err := graph.New(ctx, s.Credentials(), s.URL, s.URL).Inspect(ctx, app.AppID)
+	require.NoError(t, err)
+
+	enabled := false
+	want := graph.Config{
+		ApplicationName: "test-app-abc123",
+		SignInAudience:  "AzureADMyOrg",
+		WebSettings: graph.WebSettings{
+			RedirectURIs: []string{"https://localhost:3000/auth/callback", "https://test.example.com/auth/callback"},
+			LogoutURL:    "https://test.example.com/logout",
+			HomepageURL:  "https://test.example.com",
+		},
+		AppRoles: []graph.AppRoleInput{
+			{DisplayName: "Administrator", Description: "Application administrators", Value: "Admin", AllowedMemberTypes: []string{"User"}, ID: adminRole},
+			{DisplayName: "User", Description: "Standard users", Value: "User", AllowedMemberTypes: []string{"Application", "User"}},
+		},
+		RequiredResourceAccess: []graph.RequiredResourceAccessInput{{
+			ResourceAppID: "00000003-0000-0000-c000-000000000000",
+			ResourceAccess: []graph.ResourceAccess{
+				{ID: "b340eb25-3456-403f-be2f-af7a0d370277", Type: "Scope"},
+				{ID: "e1fe6dd8-ba31-4d61-89e7-88639da4683d", Type: "Scope"},
+			},
+		}},
+		AppRoleAssignmentRequired: true,
+		GroupAppRoleAssignments: map[string]graph.GroupAppRoleAssignment{
+			"admins": {AppRoleID: adminRole, GroupKey: "app-admins"},
+			"users":  {AppRoleID: userRole, GroupKey: "app-users"},
+		},
+	}
+	require.NoError(t, want.ResolveGroups(map[string]string{"app-admins": "group-admins", "app-users": "group-users"}))
+	assert.Empty(t, got.Diff(want))
+
+	want.SignInAudience = "AzureADMultipleOrgs"
+	want.AppRoles[0].ID = userRole
+	want.AppRoles[1].Enabled = &enabled
+	want.AppRoles = append(want.AppRoles, graph.AppRoleInput{Value: "Reader"})
+	want.GroupAppRoleAssignments["users"] = graph.GroupAppRoleAssignment{AppRoleID: adminRole, GroupID: "group-users"}
+	assert.Equal(t, []string{
+		"sign_in_audience: got AzureADMyOrg, want AzureADMultipleOrgs",
+		"group_app_role_assignments: got [group-admins -> " + adminRole + " group-users -> " + userRole + "], want [group-admins -> " + adminRole + " group-users -> " + adminRole + "]",
+		"app_roles[Admin].id: got " + adminRole + ", want " + userRole,
+		"app_roles[User].enabled: got true, want false",
+		"app_roles[Reader]: missing",
+	}, got.Diff(want))
+}
+
+func TestResolveGroupsUnknownKey(t *testing.T) {
+	c := graph.Config{GroupAppRoleAssignments: map[string]graph.GroupAppRoleAssignment{
+		"admins": {AppRoleID: adminRole, GroupKey: "app-admins"},
+	}}
+	assert.EqualError(t, c.ResolveGroups(map[string]string{}), `group_app_role_assignments[admins]: no group "app-admins"`)
+}
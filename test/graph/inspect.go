@@ -0,0 +1,209 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/compare"
+)
+
+// Config is the part of an application registration, its service
+// principal and app role assignments the azure-ad module inputs control.
+// Fields carry the names of the module's variables. Inspect fills them
+// from Graph; group assignments name groups by object ID, so expectations
+// need ResolveGroups first.
+type Config struct {
+	ApplicationName           string                            `json:"application_name"`
+	SignInAudience            string                            `json:"sign_in_audience"`
+	IdentifierURIs            []string                          `json:"identifier_uris"`
+	WebSettings               WebSettings                       `json:"web_settings"`
+	AppRoles                  []AppRoleInput                    `json:"app_roles"`
+	RequiredResourceAccess    []RequiredResourceAccessInput     `json:"required_resource_access"`
+	AppRoleAssignmentRequired bool                              `json:"app_role_assignment_required"`
+	GroupAppRoleAssignments   map[string]GroupAppRoleAssignment `json:"group_app_role_assignments"`
+}
+
+// WebSettings is the module's web_settings input.
+type WebSettings struct {
+	RedirectURIs []string `json:"redirect_uris"`
+	LogoutURL    string   `json:"logout_url"`
+	HomepageURL  string   `json:"homepage_url"`
+}
+
+// AppRoleInput is an element of the module's app_roles input. Roles are
+// matched by value; ID is only compared when set and a nil Enabled means
+// enabled.
+type AppRoleInput struct {
+	AllowedMemberTypes []string `json:"allowed_member_types"`
+	Description        string   `json:"description"`
+	DisplayName        string   `json:"display_name"`
+	Enabled            *bool    `json:"enabled"`
+	ID                 string   `json:"id"`
+	Value              string   `json:"value"`
+}
+
+// RequiredResourceAccessInput is an element of the module's
+// required_resource_access input.
+type RequiredResourceAccessInput struct {
+	ResourceAppID  string           `json:"resource_app_id"`
+	ResourceAccess []ResourceAccess `json:"resource_access"`
+}
+
+// GroupAppRoleAssignment is an element of the module's
+// group_app_role_assignments input. GroupID is the object ID of the group,
+// which Inspect reports and ResolveGroups fills in from GroupKey.
+type GroupAppRoleAssignment struct {
+	AppRoleID string `json:"app_role_id"`
+	GroupKey  string `json:"group_key"`
+	GroupID   string `json:"-"`
+}
+
+// ResolveGroups sets the GroupID of every group assignment of c from
+// objectIDs, the module's group_object_ids output.
+func (c *Config) ResolveGroups(objectIDs map[string]string) error {
+	for key, a := range c.GroupAppRoleAssignments {
+		id, ok := objectIDs[a.GroupKey]
+		if !ok {
+			return fmt.Errorf("group_app_role_assignments[%s]: no group %q", key, a.GroupKey)
+		}
+		a.GroupID = id
+		c.GroupAppRoleAssignments[key] = a
+	}
+	return nil
+}
+
+// Inspect returns the configuration of the application with the client ID
+// appID. Group assignments are keyed by assignment ID and carry no
+// GroupKey.
+func (c *Client) Inspect(ctx context.Context, appID string) (Config, error) {
+	app, err := c.Application(ctx, appID)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading application %s: %w", appID, err)
+	}
+	sp, err := c.ServicePrincipal(ctx, appID)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading service principal of application %s: %w", appID, err)
+	}
+	assignments, err := c.AppRoleAssignments(ctx, sp.ID)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading app role assignments of service principal %s: %w", sp.ID, err)
+	}
+
+	cfg := Config{
+		ApplicationName: app.DisplayName,
+		SignInAudience:  app.SignInAudience,
+		IdentifierURIs:  app.IdentifierURIs,
+		WebSettings: WebSettings{
+			RedirectURIs: app.Web.RedirectURIs,
+			LogoutURL:    app.Web.LogoutURL,
+			HomepageURL:  app.Web.HomePageURL,
+		},
+		AppRoleAssignmentRequired: sp.AppRoleAssignmentRequired,
+		GroupAppRoleAssignments:   map[string]GroupAppRoleAssignment{},
+	}
+	for _, r := range app.RequiredResourceAccess {
+		cfg.RequiredResourceAccess = append(cfg.RequiredResourceAccess, RequiredResourceAccessInput(r))
+	}
+	for _, r := range app.AppRoles {
+		enabled := r.IsEnabled
+		cfg.AppRoles = append(cfg.AppRoles, AppRoleInput{
+			AllowedMemberTypes: r.AllowedMemberTypes,
+			Description:        r.Description,
+			DisplayName:        r.DisplayName,
+			Enabled:            &enabled,
+			ID:                 r.ID,
+			Value:              r.Value,
+		})
+	}
+	for _, a := range assignments {
+		if a.PrincipalType == "Group" {
+			cfg.GroupAppRoleAssignments[a.ID] = GroupAppRoleAssignment{AppRoleID: a.AppRoleID, GroupID: a.PrincipalID}
+		}
+	}
+	return cfg, nil
+}
+
+// Diff lists the settings in which c differs from want, one line per
+// setting named after the module input. URL lists, member types, API
+// permissions and group assignments are compared as sets, since Graph does
+// not keep their order.
+func (c Config) Diff(want Config) []string {
+	var diffs []string
+	add := func(input string, got, want interface{}) {
+		if !reflect.DeepEqual(got, want) {
+			diffs = append(diffs, fmt.Sprintf("%s: got %v, want %v", input, got, want))
+		}
+	}
+
+	add("application_name", c.ApplicationName, want.ApplicationName)
+	add("sign_in_audience", c.SignInAudience, want.SignInAudience)
+	add("identifier_uris", compare.Set(c.IdentifierURIs), compare.Set(want.IdentifierURIs))
+	add("web_settings.redirect_uris", compare.Set(c.WebSettings.RedirectURIs), compare.Set(want.WebSettings.RedirectURIs))
+	add("web_settings.logout_url", c.WebSettings.LogoutURL, want.WebSettings.LogoutURL)
+	add("web_settings.homepage_url", c.WebSettings.HomepageURL, want.WebSettings.HomepageURL)
+	add("required_resource_access", permissions(c.RequiredResourceAccess), permissions(want.RequiredResourceAccess))
+	add("app_role_assignment_required", c.AppRoleAssignmentRequired, want.AppRoleAssignmentRequired)
+	add("group_app_role_assignments", groupAssignments(c.GroupAppRoleAssignments), groupAssignments(want.GroupAppRoleAssignments))
+
+	got := map[string]AppRoleInput{}
+	for _, r := range c.AppRoles {
+		got[r.Value] = r
+	}
+	for _, w := range want.AppRoles {
+		r, ok := got[w.Value]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("app_roles[%s]: missing", w.Value))
+			continue
+		}
+		delete(got, w.Value)
+		input := "app_roles[" + w.Value + "]."
+		add(input+"display_name", r.DisplayName, w.DisplayName)
+		add(input+"description", r.Description, w.Description)
+		add(input+"allowed_member_types", compare.Set(r.AllowedMemberTypes), compare.Set(w.AllowedMemberTypes))
+		add(input+"enabled", enabled(r.Enabled), enabled(w.Enabled))
+		if w.ID != "" {
+			add(input+"id", r.ID, w.ID)
+		}
+	}
+	for _, value := range sortedKeys(got) {
+		diffs = append(diffs, fmt.Sprintf("app_roles[%s]: unexpected", value))
+	}
+	return diffs
+}
+
+func enabled(b *bool) bool {
+	return b == nil || *b
+}
+
+// permissions flattens required resource access into sorted
+// "resource/permission type" entries.
+func permissions(rra []RequiredResourceAccessInput) []string {
+	var out []string
+	for _, r := range rra {
+		for _, a := range r.ResourceAccess {
+			out = append(out, r.ResourceAppID+"/"+a.ID+" "+a.Type)
+		}
+	}
+	return compare.Set(out)
+}
+
+// groupAssignments flattens group assignments into sorted
+// "group -> app role" entries, ignoring the keys.
+func groupAssignments(m map[string]GroupAppRoleAssignment) []string {
+	var out []string
+	for _, a := range m {
+		out = append(out, a.GroupID+" -> "+a.AppRoleID)
+	}
+	return compare.Set(out)
+}
+
+func sortedKeys(m map[string]AppRoleInput) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
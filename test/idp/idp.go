@@ -0,0 +1,116 @@
+// Package idp normalizes the outputs of the identity provider modules, and
+// of the examples that wrap them, into one IdentityProvider, so checks
+// shared between providers read the issuer, endpoints and clients without
+// knowing which outputs each configuration names them in.
+//
+// When a module or example adds or renames an output that names an
+// endpoint or a client, update its adapter and its synthetic outputs under
+// testdata.
+package idp
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/oidc"
+)
+
+// IdentityProvider is a deployed identity provider as its outputs describe
+// it. Methods return "" for what the outputs do not name and cannot be
+// derived from what they do, such as the token endpoint of a user pool
+// without a domain.
+type IdentityProvider interface {
+	// Provider is the service the configuration deploys to.
+	Provider() config.Provider
+	// Issuer is the OpenID Connect issuer identifier.
+	Issuer() string
+	// DiscoveryURL is the URL of the OpenID Provider metadata.
+	DiscoveryURL() string
+	AuthorizationEndpoint() string
+	TokenEndpoint() string
+	UserInfoEndpoint() string
+	JWKSURI() string
+	// Clients are the OAuth clients the configuration registers, sorted
+	// by key.
+	Clients() []Client
+	// SAMLMetadataURL is the URL of the SAML identity provider metadata.
+	SAMLMetadataURL() string
+}
+
+// Client is an OAuth client registered with an identity provider.
+type Client struct {
+	// Key identifies the client within the configuration: the key of its
+	// input map, or the name of the output holding its ID.
+	Key string
+	// ID is the client ID.
+	ID string
+	// Secret is the client secret, "" for public clients and for
+	// configurations that do not output it.
+	Secret string
+}
+
+// adapters build an IdentityProvider from the outputs of the module of
+// each provider or of its example.
+var adapters = map[config.Provider]func(Outputs) (IdentityProvider, error){
+	config.AWS:      Cognito,
+	config.Azure:    AzureAD,
+	config.Okta:     Okta,
+	config.Keycloak: Keycloak,
+}
+
+// New builds the IdentityProvider of provider from outputs.
+func New(provider config.Provider, outputs Outputs) (IdentityProvider, error) {
+	adapt, ok := adapters[provider]
+	if !ok {
+		return nil, fmt.Errorf("no adapter for provider %q", provider)
+	}
+	return adapt(outputs)
+}
+
+// endpoints is the IdentityProvider every adapter fills in.
+type endpoints struct {
+	provider      config.Provider
+	issuer        string
+	discovery     string
+	authorization string
+	token         string
+	userInfo      string
+	jwks          string
+	clients       []Client
+	samlMetadata  string
+}
+
+func (e *endpoints) Provider() config.Provider     { return e.provider }
+func (e *endpoints) Issuer() string                { return e.issuer }
+func (e *endpoints) DiscoveryURL() string          { return e.discovery }
+func (e *endpoints) AuthorizationEndpoint() string { return e.authorization }
+func (e *endpoints) TokenEndpoint() string         { return e.token }
+func (e *endpoints) UserInfoEndpoint() string      { return e.userInfo }
+func (e *endpoints) JWKSURI() string               { return e.jwks }
+func (e *endpoints) SAMLMetadataURL() string       { return e.samlMetadata }
+
+func (e *endpoints) Clients() []Client {
+	return append([]Client(nil), e.clients...)
+}
+
+// complete fills in the discovery URL from the issuer, sorts the clients
+// and checks the outputs described an identity provider at all.
+func (e *endpoints) complete() (IdentityProvider, error) {
+	if e.issuer == "" && e.samlMetadata == "" {
+		return nil, fmt.Errorf("%s: the outputs name neither an issuer nor SAML metadata", e.provider)
+	}
+	if e.discovery == "" && e.issuer != "" {
+		e.discovery = e.issuer + oidc.WellKnownPath
+	}
+	sort.Slice(e.clients, func(i, j int) bool { return e.clients[i].Key < e.clients[j].Key })
+	return e, nil
+}
+
+// under returns base+path, or "" without a base.
+func under(base, path string) string {
+	if base == "" {
+		return ""
+	}
+	return base + path
+}
@@ -0,0 +1,192 @@
+package idp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/tfconfig"
+)
+
+// view is what an IdentityProvider reports, for comparing in one assert.
+type view struct {
+	Issuer, Discovery, Authorization, Token, UserInfo, JWKS, SAMLMetadata string
+	Clients                                                               []Client
+}
+
+func viewOf(p IdentityProvider) view {
+	return view{
+		Issuer:        p.Issuer(),
+		Discovery:     p.DiscoveryURL(),
+		Authorization: p.AuthorizationEndpoint(),
+		Token:         p.TokenEndpoint(),
+		UserInfo:      p.UserInfoEndpoint(),
+		JWKS:          p.JWKSURI(),
+		SAMLMetadata:  p.SAMLMetadataURL(),
+		Clients:       p.Clients(),
+	}
+}
+
+// load reads the synthetic outputs of the configuration in dir, such as
+// modules/okta, from testdata.
+func load(t *testing.T, dir string) Outputs {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", strings.ReplaceAll(dir, "/", "-")+".json"))
+	require.NoError(t, err)
+	outputs, err := ParseOutputs(data)
+	require.NoError(t, err)
+	return outputs
+}
+
+const (
+	cognitoIssuer = "https://cognito-idp.us-east-1.amazonaws.com/us-east-1_AbC123dEf"
+	cognitoDomain = "https://test-pool-abc123.auth.us-east-1.amazoncognito.com"
+	azureTenant   = "https://login.microsoftonline.com/00000000-0000-0000-0000-000000000000"
+	realm         = "http://localhost:8080/realms/test-realm-abc123"
+	oktaIssuer    = "https://dev-000000.okta.com/oauth2/default"
+)
+
+var configurations = []struct {
+	dir      string
+	provider config.Provider
+	want     view
+}{
+	{"modules/aws-cognito", config.AWS, view{
+		Issuer:        cognitoIssuer,
+		Discovery:     cognitoIssuer + "/.well-known/openid-configuration",
+		Authorization: cognitoDomain + "/oauth2/authorize",
+		Token:         cognitoDomain + "/oauth2/token",
+		UserInfo:      cognitoDomain + "/oauth2/userInfo",
+		JWKS:          cognitoIssuer + "/.well-known/jwks.json",
+		Clients:       []Client{{Key: "user_pool_client", ID: "4l2k3j4h5g6f7d8s9a0p1o2i3u", Secret: "cognito-client-secret"}},
+	}},
+	// Without a domain there are no OAuth endpoints, and the client has
+	// no secret
+	{"examples/aws-cognito-basic", config.AWS, view{
+		Issuer:    cognitoIssuer,
+		Discovery: cognitoIssuer + "/.well-known/openid-configuration",
+		JWKS:      cognitoIssuer + "/.well-known/jwks.json",
+		Clients:   []Client{{Key: "user_pool_client", ID: "4l2k3j4h5g6f7d8s9a0p1o2i3u"}},
+	}},
+	{"modules/azure-ad", config.Azure, view{
+		Issuer:        azureTenant + "/v2.0",
+		Discovery:     azureTenant + "/v2.0/.well-known/openid-configuration",
+		Authorization: azureTenant + "/oauth2/v2.0/authorize",
+		Token:         azureTenant + "/oauth2/v2.0/token",
+		UserInfo:      "https://graph.microsoft.com/oidc/userinfo",
+		JWKS:          azureTenant + "/discovery/v2.0/keys",
+		SAMLMetadata:  azureTenant + "/federationmetadata/2007-06/federationmetadata.xml",
+		Clients:       []Client{{Key: "application", ID: "11111111-1111-1111-1111-111111111111", Secret: "azure-client-secret"}},
+	}},
+	{"examples/azure-ad-sso", config.Azure, view{
+		Issuer:        azureTenant + "/v2.0",
+		Discovery:     azureTenant + "/v2.0/.well-known/openid-configuration",
+		Authorization: azureTenant + "/oauth2/v2.0/authorize",
+		Token:         azureTenant + "/oauth2/v2.0/token",
+		UserInfo:      "https://graph.microsoft.com/oidc/userinfo",
+		JWKS:          azureTenant + "/discovery/v2.0/keys",
+		SAMLMetadata:  azureTenant + "/federationmetadata/2007-06/federationmetadata.xml",
+		Clients:       []Client{{Key: "application", ID: "11111111-1111-1111-1111-111111111111", Secret: "azure-client-secret"}},
+	}},
+	{"modules/keycloak", config.Keycloak, view{
+		Issuer:        realm,
+		Discovery:     realm + "/.well-known/openid-configuration",
+		Authorization: realm + "/protocol/openid-connect/auth",
+		Token:         realm + "/protocol/openid-connect/token",
+		UserInfo:      realm + "/protocol/openid-connect/userinfo",
+		JWKS:          realm + "/protocol/openid-connect/certs",
+		SAMLMetadata:  realm + "/protocol/saml/descriptor",
+		Clients: []Client{
+			{Key: "mobile", ID: "test-mobile-abc123"},
+			{Key: "webapp", ID: "test-webapp-abc123"},
+		},
+	}},
+	{"examples/keycloak-setup", config.Keycloak, view{
+		Issuer:        realm,
+		Discovery:     realm + "/.well-known/openid-configuration",
+		Authorization: realm + "/protocol/openid-connect/auth",
+		Token:         realm + "/protocol/openid-connect/token",
+		UserInfo:      realm + "/protocol/openid-connect/userinfo",
+		JWKS:          realm + "/protocol/openid-connect/certs",
+		SAMLMetadata:  realm + "/protocol/saml/descriptor",
+		Clients:       []Client{{Key: "webapp", ID: "test-webapp-abc123", Secret: "keycloak-client-secret"}},
+	}},
+	{"modules/okta", config.Okta, view{
+		Issuer:        oktaIssuer,
+		Discovery:     oktaIssuer + "/.well-known/openid-configuration",
+		Authorization: oktaIssuer + "/v1/authorize",
+		Token:         oktaIssuer + "/v1/token",
+		UserInfo:      oktaIssuer + "/v1/userinfo",
+		JWKS:          oktaIssuer + "/v1/keys",
+		Clients:       []Client{{Key: "oauth_app", ID: "0oa1b2c3d4e5f6g7h8i9", Secret: "okta-client-secret"}},
+	}},
+	// Only the SAML app was created
+	{"examples/okta-integration", config.Okta, view{
+		Issuer:        oktaIssuer,
+		Discovery:     oktaIssuer + "/.well-known/openid-configuration",
+		Authorization: oktaIssuer + "/v1/authorize",
+		Token:         oktaIssuer + "/v1/token",
+		UserInfo:      oktaIssuer + "/v1/userinfo",
+		JWKS:          oktaIssuer + "/v1/keys",
+		SAMLMetadata:  "https://dev-000000.okta.com/app/0oa9z8y7x6w5v4u3t2s1/sso/saml/metadata",
+	}},
+}
+
+func TestNew(t *testing.T) {
+	for _, c := range configurations {
+		t.Run(c.dir, func(t *testing.T) {
+			p, err := New(c.provider, load(t, c.dir))
+			require.NoError(t, err)
+			assert.Equal(t, c.provider, p.Provider())
+			assert.Equal(t, c.want, viewOf(p))
+		})
+	}
+}
+
+// The fixtures only hold outputs the configurations declare, so the
+// adapters are tested against the names they will meet.
+func TestFixturesMatchConfigurations(t *testing.T) {
+	for _, c := range configurations {
+		t.Run(c.dir, func(t *testing.T) {
+			m, err := tfconfig.Load(filepath.Join("..", "..", c.dir))
+			require.NoError(t, err)
+			for name, out := range load(t, c.dir) {
+				decl := m.Output(name)
+				if assert.NotNil(t, decl, "output %s", name) {
+					assert.Equal(t, decl.Sensitive, out.Sensitive, "sensitivity of output %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestNewWithoutIdentityProvider(t *testing.T) {
+	_, err := New(config.Okta, Outputs{"oauth_client_id": {Value: nil}})
+	assert.ErrorContains(t, err, "okta: the outputs name neither an issuer nor SAML metadata")
+
+	_, err = New("ping", Outputs{})
+	assert.ErrorContains(t, err, `no adapter for provider "ping"`)
+}
+
+func TestClientsAreCopied(t *testing.T) {
+	p, err := Keycloak(load(t, "examples/keycloak-setup"))
+	require.NoError(t, err)
+	p.Clients()[0].Secret = ""
+	assert.Equal(t, "keycloak-client-secret", p.Clients()[0].Secret)
+}
+
+func TestParseOutputs(t *testing.T) {
+	_, err := ParseOutputs([]byte("No outputs found"))
+	assert.ErrorContains(t, err, "parsing outputs")
+
+	outputs, err := ParseOutputs([]byte(`{"urls":{"sensitive":false,"type":["object",{"token":"string"}],"value":{"token":"https://idp.example.com/token"}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.example.com/token", outputs.String("missing", "urls.missing", "urls.token"))
+	assert.Empty(t, outputs.String("urls"))
+	assert.Nil(t, outputs.StringMap("urls.token"))
+}
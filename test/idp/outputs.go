@@ -0,0 +1,68 @@
+package idp
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/plan"
+)
+
+// Outputs are the outputs of a root module by name, as
+// `terraform output -json` prints them. Sensitive values are included.
+type Outputs map[string]Output
+
+// Output is one of Outputs.
+type Output struct {
+	Sensitive bool            `json:"sensitive"`
+	Type      json.RawMessage `json:"type"`
+	Value     interface{}     `json:"value"`
+}
+
+// ParseOutputs parses the output of `terraform output -json`.
+func ParseOutputs(data []byte) (Outputs, error) {
+	var outputs Outputs
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, fmt.Errorf("parsing outputs: %w", err)
+	}
+	return outputs, nil
+}
+
+// lookup returns the value at path, the name of an output followed by a
+// path into its value as plan.Lookup takes it, such as
+// oauth_urls.token_endpoint.
+func (o Outputs) lookup(path string) (interface{}, bool) {
+	values := make(map[string]interface{}, len(o))
+	for name, out := range o {
+		values[name] = out.Value
+	}
+	return plan.Lookup(values, path)
+}
+
+// String returns the first non-empty string found at paths, "" if none.
+func (o Outputs) String(paths ...string) string {
+	for _, path := range paths {
+		v, _ := o.lookup(path)
+		if s, ok := v.(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// StringMap returns the strings of the first map found at paths, skipping
+// null elements. It returns nil if there is none.
+func (o Outputs) StringMap(paths ...string) map[string]string {
+	for _, path := range paths {
+		m, _ := o.lookup(path)
+		if m, ok := m.(map[string]interface{}); ok {
+			strings := make(map[string]string, len(m))
+			for k, v := range m {
+				if s, ok := v.(string); ok {
+					strings[k] = s
+				}
+			}
+			return strings
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package idp
+
+import (
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+)
+
+// Each adapter reads the outputs of the module first and falls back on
+// the names the example gives them, then derives what neither outputs
+// from the issuer or tenant the way the provider lays out its endpoints.
+
+// Cognito builds the IdentityProvider of a user pool from the outputs of
+// modules/aws-cognito or examples/aws-cognito-basic. The OAuth endpoints
+// are only output when the pool has a domain; the key set is served
+// either way.
+func Cognito(o Outputs) (IdentityProvider, error) {
+	e := &endpoints{
+		provider:      config.AWS,
+		issuer:        o.String("issuer"),
+		discovery:     o.String("openid_configuration_url"),
+		authorization: o.String("oauth_urls.authorization_endpoint", "oauth_endpoints.authorization_endpoint"),
+		token:         o.String("oauth_urls.token_endpoint", "oauth_endpoints.token_endpoint"),
+		userInfo:      o.String("oauth_urls.userinfo_endpoint", "oauth_endpoints.userinfo_endpoint"),
+		jwks:          o.String("oauth_urls.jwks_uri", "oauth_endpoints.jwks_uri"),
+	}
+	if e.jwks == "" {
+		e.jwks = under(e.issuer, "/.well-known/jwks.json")
+	}
+	if id := o.String("user_pool_client_id"); id != "" {
+		e.clients = []Client{{Key: "user_pool_client", ID: id, Secret: o.String("user_pool_client_secret")}}
+	}
+	return e.complete()
+}
+
+// azureLogin is the Microsoft identity platform endpoint of the public
+// cloud.
+const azureLogin = "https://login.microsoftonline.com/"
+
+// AzureAD builds the IdentityProvider of an application registration from
+// the outputs of modules/azure-ad or examples/azure-ad-sso. The endpoints
+// belong to the tenant, so what the outputs leave out follows from
+// tenant_id.
+func AzureAD(o Outputs) (IdentityProvider, error) {
+	tenant := under(azureLogin, o.String("tenant_id"))
+	e := &endpoints{
+		provider:      config.Azure,
+		issuer:        o.String("issuer", "oauth_endpoints.issuer"),
+		discovery:     o.String("openid_configuration_url"),
+		authorization: o.String("oauth2_authorization_url", "oauth_endpoints.authorization_endpoint"),
+		token:         o.String("oauth2_token_url", "oauth_endpoints.token_endpoint"),
+		userInfo:      o.String("oauth_endpoints.userinfo_endpoint"),
+		jwks:          o.String("oauth_endpoints.jwks_uri"),
+		samlMetadata:  o.String("saml_metadata_url"),
+	}
+	if e.issuer == "" {
+		e.issuer = under(tenant, "/v2.0")
+	}
+	if e.authorization == "" {
+		e.authorization = under(tenant, "/oauth2/v2.0/authorize")
+	}
+	if e.token == "" {
+		e.token = under(tenant, "/oauth2/v2.0/token")
+	}
+	if e.userInfo == "" && e.issuer != "" {
+		e.userInfo = "https://graph.microsoft.com/oidc/userinfo"
+	}
+	if e.jwks == "" {
+		e.jwks = under(tenant, "/discovery/v2.0/keys")
+	}
+	if e.samlMetadata == "" {
+		e.samlMetadata = under(tenant, "/federationmetadata/2007-06/federationmetadata.xml")
+	}
+	if id := o.String("application_id"); id != "" {
+		e.clients = []Client{{Key: "application", ID: id, Secret: o.String("client_secret", "application_secret_value")}}
+	}
+	return e.complete()
+}
+
+// Keycloak builds the IdentityProvider of a realm from the outputs of
+// modules/keycloak or examples/keycloak-setup. Every realm is an OpenID
+// provider and a SAML identity provider. The module does not output client
+// secrets.
+func Keycloak(o Outputs) (IdentityProvider, error) {
+	e := &endpoints{
+		provider:      config.Keycloak,
+		issuer:        o.String("issuer", "realm_urls.issuer"),
+		discovery:     o.String("openid_configuration_url"),
+		authorization: o.String("authorization_endpoint"),
+		token:         o.String("token_endpoint", "realm_urls.token_url"),
+		userInfo:      o.String("userinfo_endpoint", "realm_urls.userinfo_url"),
+		jwks:          o.String("jwks_uri", "realm_urls.jwks_url"),
+		samlMetadata:  o.String("saml_descriptor_url"),
+	}
+	if e.authorization == "" {
+		e.authorization = under(e.issuer, "/protocol/openid-connect/auth")
+	}
+	if e.samlMetadata == "" {
+		e.samlMetadata = under(e.issuer, "/protocol/saml/descriptor")
+	}
+	secrets := o.StringMap("client_secrets", "openid_client_secrets")
+	for key, id := range o.StringMap("client_ids", "openid_client_ids") {
+		e.clients = append(e.clients, Client{Key: key, ID: id, Secret: secrets[key]})
+	}
+	return e.complete()
+}
+
+// Okta builds the IdentityProvider of an organization's default
+// authorization server and apps from the outputs of modules/okta or
+// examples/okta-integration. The module only outputs the endpoints when it
+// creates the OAuth app, and the SAML metadata when it creates the SAML
+// app.
+func Okta(o Outputs) (IdentityProvider, error) {
+	e := &endpoints{
+		provider:      config.Okta,
+		issuer:        o.String("issuer", "oauth_app_urls.issuer"),
+		discovery:     o.String("openid_configuration_url"),
+		authorization: o.String("oauth_authorization_url", "oauth_app_urls.authorization_url"),
+		token:         o.String("oauth_token_url", "oauth_app_urls.token_url"),
+		userInfo:      o.String("oauth_userinfo_url", "oauth_app_urls.userinfo_url"),
+		jwks:          o.String("oauth_app_urls.jwks_url"),
+		samlMetadata:  o.String("saml_metadata_url", "saml_app_urls.metadata_url"),
+	}
+	if e.jwks == "" {
+		e.jwks = under(e.issuer, "/v1/keys")
+	}
+	if id := o.String("oauth_client_id", "oauth_app_urls.client_id"); id != "" {
+		e.clients = []Client{{Key: "oauth_app", ID: id, Secret: o.String("oauth_client_secret")}}
+	}
+	return e.complete()
+}
@@ -0,0 +1,20 @@
+// Package apierror holds the checks the provider API clients share on
+// their error responses.
+package apierror
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Status is implemented by the error responses of the API clients.
+type Status interface {
+	error
+	HTTPStatus() int
+}
+
+// IsNotFound reports whether err wraps an error response with status 404.
+func IsNotFound(err error) bool {
+	var e Status
+	return errors.As(err, &e) && e.HTTPStatus() == http.StatusNotFound
+}
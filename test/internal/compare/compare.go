@@ -0,0 +1,52 @@
+// Package compare holds the helpers the inspect packages use to compare
+// what a provider reports with the inputs a configuration applied.
+package compare
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Set returns the distinct values of s sorted, so lists compare equal
+// whatever order and repetition the provider returns them in. It never
+// returns nil, so an empty set compares equal to another empty set.
+func Set(s []string) []string {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Keys returns the sorted keys present in both got and want, and reports
+// the others in diffs as missing or unexpected, in key order.
+func Keys[T any](got, want map[string]T, diffs *[]string, input string) []string {
+	var both, missing, unexpected []string
+	for key := range want {
+		if _, ok := got[key]; ok {
+			both = append(both, key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	for key := range got {
+		if _, ok := want[key]; !ok {
+			unexpected = append(unexpected, key)
+		}
+	}
+	sort.Strings(both)
+	sort.Strings(missing)
+	sort.Strings(unexpected)
+	for _, key := range missing {
+		*diffs = append(*diffs, fmt.Sprintf("%s[%s]: missing", input, key))
+	}
+	for _, key := range unexpected {
+		*diffs = append(*diffs, fmt.Sprintf("%s[%s]: unexpected", input, key))
+	}
+	return both
+}
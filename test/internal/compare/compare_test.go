@@ -0,0 +1,22 @@
+package compare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, Set([]string{"b", "a", "b"}))
+	assert.Equal(t, []string{}, Set(nil))
+}
+
+func TestKeys(t *testing.T) {
+	var diffs []string
+	both := Keys(
+		map[string]int{"admins": 1, "users": 2, "extra": 3},
+		map[string]int{"users": 2, "admins": 1, "owners": 4, "guests": 5},
+		&diffs, "groups")
+	assert.Equal(t, []string{"admins", "users"}, both)
+	assert.Equal(t, []string{"groups[guests]: missing", "groups[owners]: missing", "groups[extra]: unexpected"}, diffs)
+}
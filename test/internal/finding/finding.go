@@ -0,0 +1,85 @@
+// Package finding holds the result type the oidc and saml validators
+// report problems with, and the helpers both use to check documents.
+package finding
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Severity grades a finding. Errors are violations of a MUST in the
+// specification and fail the test; warnings cover RECOMMENDED members and
+// SHOULDs and are logged.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// Finding is one problem with a document.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	// Field is the part of the document the finding is about, such as a
+	// metadata member or an element.
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s %s", f.Severity, f.Field, f.Message)
+}
+
+// Findings is the result of validating a document.
+type Findings []Finding
+
+// Errors returns only the findings with Error severity.
+func (fs Findings) Errors() Findings {
+	var errs Findings
+	for _, f := range fs {
+		if f.Severity == Error {
+			errs = append(errs, f)
+		}
+	}
+	return errs
+}
+
+// Field returns the findings about one part of the document.
+func (fs Findings) Field(name string) Findings {
+	var out Findings
+	for _, f := range fs {
+		if f.Field == name {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func (fs Findings) String() string {
+	lines := make([]string, len(fs))
+	for i, f := range fs {
+		lines[i] = f.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// IsLoopback reports whether host names this machine, where plain http is
+// acceptable for a local stand-in.
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ContainsString reports whether want is one of values.
+func ContainsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
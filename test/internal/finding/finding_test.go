@@ -0,0 +1,33 @@
+package finding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindings(t *testing.T) {
+	fs := Findings{
+		{Severity: Warning, Field: "issuer", Message: "is recommended"},
+		{Severity: Error, Field: "issuer", Message: "is required"},
+		{Severity: Error, Field: "jwks_uri", Message: "is required"},
+	}
+
+	assert.Equal(t, Findings{fs[1], fs[2]}, fs.Errors())
+	assert.Equal(t, Findings{fs[0], fs[1]}, fs.Field("issuer"))
+	assert.Empty(t, fs.Field("token_endpoint"))
+	assert.Equal(t, "warning: issuer is recommended\nerror: issuer is required\nerror: jwks_uri is required", fs.String())
+}
+
+func TestIsLoopback(t *testing.T) {
+	for host, want := range map[string]bool{
+		"localhost":        true,
+		"127.0.0.1":        true,
+		"::1":              true,
+		"idp.example.com":  false,
+		"10.0.0.1":         false,
+		"localhost.domain": false,
+	} {
+		assert.Equal(t, want, IsLoopback(host), host)
+	}
+}
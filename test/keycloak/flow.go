@@ -0,0 +1,458 @@
+package keycloak
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/oidc"
+)
+
+// RealmURL returns the URL of realm on the server serverURL, which is
+// also the issuer of the realm's tokens.
+func RealmURL(serverURL, realm string) string {
+	return strings.TrimRight(serverURL, "/") + "/realms/" + url.PathEscape(realm)
+}
+
+// Tokens are the result of a successful flow. Client credentials only
+// yield an access token.
+type Tokens struct {
+	IDToken      string
+	AccessToken  string
+	RefreshToken string
+	// Nonce is the nonce the authorization code flow sent, which the ID
+	// token must carry.
+	Nonce string
+}
+
+// Flow gets tokens from a realm client the way an application does: the
+// authorization code flow through the realm's login page, the resource
+// owner password flow and client credentials.
+type Flow struct {
+	// RealmURL is the URL of the realm, see RealmURL.
+	RealmURL     string
+	ClientID     string
+	ClientSecret string
+	// RedirectURI is where the authorization code flow returns. It is
+	// never requested, so it need not be served.
+	RedirectURI string
+	// HTTP sends the requests; http.DefaultClient when nil.
+	HTTP *http.Client
+}
+
+// NewFlow returns a Flow for the client clientID of the realm at
+// realmURL. Pass the client's secret when it is confidential.
+func NewFlow(realmURL, clientID, clientSecret, redirectURI string) *Flow {
+	return &Flow{
+		RealmURL:     strings.TrimRight(realmURL, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURI:  redirectURI,
+	}
+}
+
+func (f *Flow) endpoint(name string) string {
+	return f.RealmURL + "/protocol/openid-connect/" + name
+}
+
+func (f *Flow) httpClient() *http.Client {
+	if f.HTTP != nil {
+		return f.HTTP
+	}
+	return http.DefaultClient
+}
+
+func (f *Flow) config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     f.ClientID,
+		ClientSecret: f.ClientSecret,
+		RedirectURL:  f.RedirectURI,
+		Scopes:       []string{"openid", "profile", "email"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   f.endpoint("auth"),
+			TokenURL:  f.endpoint("token"),
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// Keys fetches the signing keys of the realm.
+func (f *Flow) Keys(ctx context.Context) (*oidc.JWKS, error) {
+	return oidc.FetchJWKS(ctx, f.httpClient(), f.endpoint("certs"))
+}
+
+// maxForms bounds the forms a login submits before it gives up.
+const maxForms = 10
+
+// AuthorizationCode signs username in through the login page of the
+// realm, standing in for the browser, and redeems the code the realm
+// returns to RedirectURI.
+func (f *Flow) AuthorizationCode(ctx context.Context, username, password string) (*Tokens, error) {
+	return f.Login(ctx, nil, SignIn(username, password))
+}
+
+// Broker signs in through the identity provider alias, which Keycloak
+// sends the browser to right away, and redeems the code the realm returns
+// once the steps got through the provider's login page and Keycloak's
+// first broker login pages.
+func (f *Flow) Broker(ctx context.Context, alias string, steps ...Step) (*Tokens, error) {
+	return f.Login(ctx, map[string]string{"kc_idp_hint": alias}, steps...)
+}
+
+// Login runs the authorization code flow with extra parameters in the
+// authorization request, standing in for the browser: it follows the
+// redirects and submits each form on the way to RedirectURI with the
+// first unused step that answers it. It uses state, a nonce and PKCE like
+// a careful application would.
+func (f *Flow) Login(ctx context.Context, params map[string]string, steps ...Step) (*Tokens, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	client := *f.httpClient()
+	client.Jar = jar
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if f.isCallback(req.URL) {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+
+	state, nonce, verifier := randomString(), randomString(), randomString()
+	challenge := sha256.Sum256([]byte(verifier))
+	conf := f.config()
+	opts := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	for k, v := range params {
+		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+	}
+
+	resp, page, err := send(ctx, &client, http.MethodGet, conf.AuthCodeURL(state, opts...), nil)
+	if err != nil {
+		return nil, err
+	}
+	used := make([]bool, len(steps))
+	for forms := 0; !f.isRedirect(resp); forms++ {
+		form := answer(readForms(resp.Request.URL, page), steps, used)
+		if form == nil || forms == maxForms {
+			msg := pageError(page)
+			if msg == "" {
+				msg = "no step answers the page"
+			}
+			return nil, fmt.Errorf("signing in to %s: %s: %d: %s", f.ClientID, resp.Request.URL.Path, resp.StatusCode, msg)
+		}
+		resp, page, err = send(ctx, &client, http.MethodPost, form.action, form.Values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	callback, err := resp.Location()
+	if err != nil {
+		return nil, err
+	}
+	q := callback.Query()
+	if e := q.Get("error"); e != "" {
+		return nil, fmt.Errorf("authorization request for %s: %s: %s", f.ClientID, e, q.Get("error_description"))
+	}
+	if q.Get("state") != state {
+		return nil, fmt.Errorf("authorization response for %s: state is %q, want %q", f.ClientID, q.Get("state"), state)
+	}
+	tok, err := conf.Exchange(f.context(ctx), q.Get("code"), oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, fmt.Errorf("redeeming the code of %s: %w", f.ClientID, err)
+	}
+	tokens := tokensOf(tok)
+	tokens.Nonce = nonce
+	return tokens, nil
+}
+
+// Password signs username in with the resource owner password flow, which
+// the client allows when its direct access grants are enabled.
+func (f *Flow) Password(ctx context.Context, username, password string) (*Tokens, error) {
+	tok, err := f.config().PasswordCredentialsToken(f.context(ctx), username, password)
+	if err != nil {
+		return nil, fmt.Errorf("signing in %s to %s: %w", username, f.ClientID, err)
+	}
+	return tokensOf(tok), nil
+}
+
+// ClientCredentials gets a token for the service account of the client,
+// which the client has when its service accounts are enabled.
+func (f *Flow) ClientCredentials(ctx context.Context) (*Tokens, error) {
+	conf := clientcredentials.Config{
+		ClientID:     f.ClientID,
+		ClientSecret: f.ClientSecret,
+		TokenURL:     f.endpoint("token"),
+		AuthStyle:    oauth2.AuthStyleInParams,
+	}
+	tok, err := conf.Token(f.context(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("client credentials of %s: %w", f.ClientID, err)
+	}
+	return tokensOf(tok), nil
+}
+
+// context makes the oauth2 package send its requests with f.HTTP.
+func (f *Flow) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, f.httpClient())
+}
+
+// isCallback reports whether u is RedirectURI, whatever its query.
+func (f *Flow) isCallback(u *url.URL) bool {
+	r, err := url.Parse(f.RedirectURI)
+	return err == nil && u.Scheme == r.Scheme && u.Host == r.Host && u.Path == r.Path
+}
+
+func (f *Flow) isRedirect(resp *http.Response) bool {
+	loc, err := resp.Location()
+	return err == nil && resp.StatusCode/100 == 3 && f.isCallback(loc)
+}
+
+func tokensOf(tok *oauth2.Token) *Tokens {
+	id, _ := tok.Extra("id_token").(string)
+	return &Tokens{IDToken: id, AccessToken: tok.AccessToken, RefreshToken: tok.RefreshToken}
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// send sends a request and reads the response page.
+func send(ctx context.Context, client *http.Client, method, rawURL string, form url.Values) (*http.Response, []byte, error) {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	page, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, page, nil
+}
+
+var (
+	htmlForm      = regexp.MustCompile(`(?is)<form\b([^>]*)>(.*?)</form>`)
+	htmlInput     = regexp.MustCompile(`(?is)<(input|button)\b[^>]*>`)
+	htmlAttribute = regexp.MustCompile(`(?is)\b(action|id|name|type|value)="([^"]*)"`)
+	htmlTag       = regexp.MustCompile(`(?s)<[^>]*>`)
+	// The error of the login page: input-error in Keycloak 22 and later,
+	// kc-feedback-text before, and the error paragraph of mockoidc.
+	htmlError = regexp.MustCompile(`(?is)<(span|p|div)\b[^>]*(?:id="input-error[^"]*"|class="(?:[^"]*\s)?(?:kc-feedback-text|error)(?:\s[^"]*)?")[^>]*>(.*?)</(?:span|p|div)>`)
+)
+
+// Form is a form on a page a login meets on its way to RedirectURI.
+type Form struct {
+	// ID is the id of the form.
+	ID string
+	// Page is the URL of the page the form is on.
+	Page *url.URL
+	// Values are the fields the form submits, prefilled as on the page.
+	Values url.Values
+	// Password reports whether the form has a password field.
+	Password bool
+	// Buttons are the values of the named submit buttons by name. None is
+	// submitted unless a step sets it in Values.
+	Buttons map[string][]string
+
+	action string
+}
+
+// A Step fills in a form a login meets. It reports whether it answered
+// the form. Each step answers one form.
+type Step func(form *Form) bool
+
+// SignIn answers a login form with username and password. It only fills
+// in the username when the form asks for it: Keycloak already knows who
+// signs in again to link an account.
+func SignIn(username, password string) Step {
+	return func(form *Form) bool {
+		if !form.Password {
+			return false
+		}
+		if _, ok := form.Values["username"]; ok {
+			form.Values.Set("username", username)
+		}
+		form.Values.Set("password", password)
+		return true
+	}
+}
+
+// ReviewProfile submits the profile Keycloak asks a user to review on
+// their first broker login as the identity provider filled it in.
+func ReviewProfile() Step {
+	return func(form *Form) bool {
+		return form.ID == "kc-idp-review-profile-form" || form.ID == "kc-update-profile-form"
+	}
+}
+
+// LinkAccount answers the page Keycloak shows when the first broker login
+// finds an account with the same email or username: it adds the identity
+// to the existing account, which the user then signs in to again.
+func LinkAccount() Step {
+	return func(form *Form) bool {
+		for _, v := range form.Buttons["submitAction"] {
+			if v == "linkAccount" {
+				form.Values.Set("submitAction", v)
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// answer fills in the first form an unused step answers and marks the
+// step used.
+func answer(forms []*Form, steps []Step, used []bool) *Form {
+	for _, form := range forms {
+		for i, step := range steps {
+			if !used[i] && step(form) {
+				used[i] = true
+				return form
+			}
+		}
+	}
+	return nil
+}
+
+// readForms returns the forms of page, which was served from base.
+func readForms(base *url.URL, page []byte) []*Form {
+	var forms []*Form
+	for _, m := range htmlForm.FindAllSubmatch(page, -1) {
+		attrs := attributes(m[1])
+		action, err := base.Parse(attrs["action"])
+		if err != nil {
+			continue
+		}
+		form := &Form{ID: attrs["id"], Page: base, Values: url.Values{}, Buttons: map[string][]string{}, action: action.String()}
+		for _, input := range htmlInput.FindAllSubmatch(m[2], -1) {
+			attrs := attributes(input[0])
+			button := strings.EqualFold(string(input[1]), "button")
+			switch {
+			case attrs["name"] == "":
+			case button && (attrs["type"] == "" || attrs["type"] == "submit"), attrs["type"] == "submit":
+				form.Buttons[attrs["name"]] = append(form.Buttons[attrs["name"]], attrs["value"])
+			case button, attrs["type"] == "checkbox", attrs["type"] == "radio":
+			case attrs["type"] == "password":
+				form.Password = true
+			default:
+				form.Values.Set(attrs["name"], attrs["value"])
+			}
+		}
+		forms = append(forms, form)
+	}
+	return forms
+}
+
+func attributes(tag []byte) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range htmlAttribute.FindAllSubmatch(tag, -1) {
+		attrs[strings.ToLower(string(m[1]))] = html.UnescapeString(string(m[2]))
+	}
+	return attrs
+}
+
+// pageError returns the error message a login page shows.
+func pageError(page []byte) string {
+	m := htmlError.FindSubmatch(page)
+	if m == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(htmlTag.ReplaceAll(m[2], nil)))), " ")
+}
+
+// Token types, the typ claim.
+const (
+	TypeID     = "ID"
+	TypeAccess = "Bearer"
+)
+
+// Claims are the claims of the tokens of a realm the suites assert.
+// Realm roles are only there when the client's scopes map them, and
+// groups claims, under the name their mapper gives them, only for clients
+// with a group membership mapper.
+type Claims struct {
+	jwt.RegisteredClaims
+	Type              string `json:"typ"`
+	AuthorizedParty   string `json:"azp"`
+	Nonce             string `json:"nonce"`
+	PreferredUsername string `json:"preferred_username"`
+	Email             string `json:"email"`
+	RealmAccess       struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+
+	all jwt.MapClaims
+}
+
+// Strings returns the claim name as a list of strings, nil when the
+// token does not have it.
+func (c *Claims) Strings(name string) []string {
+	var values []string
+	switch v := c.all[name].(type) {
+	case string:
+		values = append(values, v)
+	case []interface{}:
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	return values
+}
+
+// VerifyToken checks the signature of raw against keys and that it is an
+// unexpired token of type typ issued by issuer. It returns the token's
+// claims.
+func VerifyToken(keys *oidc.JWKS, raw, issuer, typ string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(raw, claims, keys.Keyfunc, oidc.ParserOptions(issuer, "RS256")...)
+	if err != nil {
+		return nil, fmt.Errorf("%s token: %w", typ, err)
+	}
+	if claims.Type != typ {
+		return nil, fmt.Errorf("%s token: typ is %q", typ, claims.Type)
+	}
+	claims.all = jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, claims.all); err != nil {
+		return nil, fmt.Errorf("%s token: %w", typ, err)
+	}
+	return claims, nil
+}
@@ -0,0 +1,318 @@
+package keycloak_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/keycloak"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mockoidc"
+)
+
+const (
+	flowClientID = "test-webapp"
+	flowSecret   = "webapp-secret"
+	flowCallback = "https://app.example.com/auth/callback"
+)
+
+func startRealm(t *testing.T) (*mockoidc.Provider, *keycloak.Flow) {
+	p := mockoidc.Start(t, mockoidc.Options{
+		Flavor: mockoidc.Keycloak,
+		Tenant: "test",
+		Users: []mockoidc.User{{
+			Username: "alice",
+			Password: "S3cret!",
+			Email:    "alice@example.com",
+			Groups:   []string{"/Employees/Developers"},
+			Roles:    []string{"admin", "user"},
+		}},
+		Clients: []mockoidc.Client{{ID: flowClientID, Secret: flowSecret, RedirectURIs: []string{flowCallback}}},
+	})
+	flow := keycloak.NewFlow(p.Issuer(), flowClientID, flowSecret, flowCallback)
+	flow.HTTP = p.HTTPClient()
+	return p, flow
+}
+
+func TestRealmURL(t *testing.T) {
+	assert.Equal(t, "http://localhost:8080/realms/my%20realm", keycloak.RealmURL("http://localhost:8080/", "my realm"))
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	p, flow := startRealm(t)
+	ctx := context.Background()
+
+	tokens, err := flow.AuthorizationCode(ctx, "alice", "S3cret!")
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	keys, err := flow.Keys(ctx)
+	require.NoError(t, err)
+	id, err := keycloak.VerifyToken(keys, tokens.IDToken, p.Issuer(), keycloak.TypeID)
+	require.NoError(t, err)
+	assert.Equal(t, tokens.Nonce, id.Nonce)
+	assert.Equal(t, []string{flowClientID}, []string(id.Audience))
+	assert.Equal(t, flowClientID, id.AuthorizedParty)
+	assert.Equal(t, "alice", id.PreferredUsername)
+	assert.Equal(t, []string{"/Employees/Developers"}, id.Strings("groups"))
+	assert.Equal(t, []string{"alice"}, id.Strings("preferred_username"))
+	assert.Nil(t, id.Strings("missing"))
+
+	access, err := keycloak.VerifyToken(keys, tokens.AccessToken, p.Issuer(), keycloak.TypeAccess)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"account"}, []string(access.Audience))
+	assert.Equal(t, flowClientID, access.AuthorizedParty)
+	assert.ElementsMatch(t, []string{"admin", "user"}, access.RealmAccess.Roles)
+
+	// The tokens are of one type only
+	_, err = keycloak.VerifyToken(keys, tokens.AccessToken, p.Issuer(), keycloak.TypeID)
+	assert.ErrorContains(t, err, `typ is "Bearer"`)
+	_, err = keycloak.VerifyToken(keys, tokens.IDToken, "https://other.example.com/realms/test", keycloak.TypeID)
+	assert.Error(t, err)
+}
+
+func TestAuthorizationCodeWrongPassword(t *testing.T) {
+	_, flow := startRealm(t)
+
+	_, err := flow.AuthorizationCode(context.Background(), "alice", "wrong")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid username or password.")
+}
+
+func TestPassword(t *testing.T) {
+	p, flow := startRealm(t)
+	ctx := context.Background()
+
+	tokens, err := flow.Password(ctx, "alice", "S3cret!")
+	require.NoError(t, err)
+	keys, err := flow.Keys(ctx)
+	require.NoError(t, err)
+	id, err := keycloak.VerifyToken(keys, tokens.IDToken, p.Issuer(), keycloak.TypeID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", id.Email)
+
+	_, err = flow.Password(ctx, "alice", "wrong")
+	assert.ErrorContains(t, err, "invalid_grant")
+}
+
+func TestClientCredentials(t *testing.T) {
+	p, flow := startRealm(t)
+	ctx := context.Background()
+
+	tokens, err := flow.ClientCredentials(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, tokens.IDToken)
+	keys, err := flow.Keys(ctx)
+	require.NoError(t, err)
+	access, err := keycloak.VerifyToken(keys, tokens.AccessToken, p.Issuer(), keycloak.TypeAccess)
+	require.NoError(t, err)
+	assert.Equal(t, flowClientID, access.AuthorizedParty)
+	assert.Empty(t, access.RealmAccess.Roles)
+
+	flow.ClientSecret = "wrong"
+	_, err = flow.ClientCredentials(ctx)
+	assert.ErrorContains(t, err, "invalid_client")
+}
+
+// keycloakLogin is the login page of the Keycloak theme, trimmed to the
+// markup the flow reads.
+const keycloakLogin = `<!DOCTYPE html>
+<html><body>
+<form id="kc-select-try-another-way-form" action="/other" method="post"><input type="hidden" name="tryAnotherWay" value="on"/></form>
+%s
+<form id="kc-form-login" onsubmit="login.disabled = true; return true;" action="/realms/test/login-actions/authenticate?session_code=abc&amp;execution=def&amp;client_id=test-webapp&amp;tab_id=ghi" method="post">
+  <input tabindex="1" id="username" class="pf-c-form-control" name="username" value="" type="text" autofocus autocomplete="off"/>
+  <input tabindex="2" id="password" class="pf-c-form-control" name="password" type="password" autocomplete="off"/>
+  <input tabindex="3" id="rememberMe" name="rememberMe" type="checkbox"> Remember me
+  <input type="hidden" id="id-hidden-input" name="credentialId"/>
+  <input tabindex="4" class="pf-c-button" name="login" id="kc-login" type="submit" value="Sign In"/>
+</form>
+</body></html>`
+
+func TestAuthorizationCodeKeycloakLoginPage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/realms/test/protocol/openid-connect/auth", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "AUTH_SESSION_ID", Value: "session", Path: "/realms/test/"})
+		_, _ = w.Write([]byte(fmt.Sprintf(keycloakLogin, "")))
+	})
+	mux.HandleFunc("/realms/test/login-actions/authenticate", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		cookie, err := r.Cookie("AUTH_SESSION_ID")
+		if err != nil || q.Get("session_code") != "abc" || q.Get("tab_id") != "ghi" || r.PostFormValue("password") != "S3cret!" ||
+			r.PostFormValue("rememberMe") != "" || cookie.Value != "session" {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(fmt.Sprintf(keycloakLogin,
+				`<span id="input-error" class="pf-c-form__helper-text" aria-live="polite">
+					Invalid username or password.
+				</span>`)))
+			return
+		}
+		http.Redirect(w, r, flowCallback+"?error=access_denied&error_description=stopped+here", http.StatusFound)
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	flow := keycloak.NewFlow(keycloak.RealmURL(s.URL, "test"), flowClientID, flowSecret, flowCallback)
+
+	// The form was submitted: the error comes from the callback
+	_, err := flow.AuthorizationCode(context.Background(), "alice", "S3cret!")
+	assert.ErrorContains(t, err, "access_denied: stopped here")
+
+	_, err = flow.AuthorizationCode(context.Background(), "alice", "wrong")
+	assert.ErrorContains(t, err, "200: Invalid username or password.")
+}
+
+// Pages of the first broker login of the Keycloak theme, trimmed to the
+// markup the flow reads.
+const (
+	keycloakLinkConfirm = `<form id="kc-register-form" action="/realms/test/login-actions/first-broker-login?session_code=abc" method="post">
+  <button type="submit" class="pf-c-button" name="submitAction" id="updateProfile" value="updateProfile">Review profile</button>
+  <button type="submit" class="pf-c-button" name="submitAction" id="linkAccount" value="linkAccount">Add to existing account</button>
+</form>`
+	keycloakReviewProfile = `<form id="kc-idp-review-profile-form" action="/realms/test/login-actions/first-broker-login?session_code=abc" method="post">
+  <input type="text" id="email" name="email" value="%s"/>
+  <input type="text" id="firstName" name="firstName" value="Bob"/>
+  <input class="pf-c-button" type="submit" value="Submit"/>
+</form>`
+	keycloakReauthenticate = `<form id="kc-form-login" action="/realms/test/login-actions/authenticate?session_code=abc" method="post">
+  <input tabindex="2" id="password" class="pf-c-form-control" name="password" type="password" autocomplete="off"/>
+  <input tabindex="4" class="pf-c-button" name="login" id="kc-login" type="submit" value="Sign In"/>
+</form>`
+)
+
+// startBroker starts a realm that brokers sign-in to an upstream provider
+// under the alias upstream the way Keycloak does: a user whose email
+// matches alice@example.com links the upstream account to theirs after
+// signing in again with the password L0cal!, others review the profile
+// the upstream provider filled in. The tokens the realm issues name the
+// upstream user in the access token.
+func startBroker(t *testing.T) *keycloak.Flow {
+	var (
+		upstream       *mockoidc.Provider
+		brokerEndpoint string
+
+		mu       sync.Mutex
+		sessions = map[string]url.Values{}
+		brokered = map[string]string{}
+	)
+	redirect := func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("AUTH_SESSION_ID")
+		mu.Lock()
+		params, username := sessions[cookie.Value], brokered[cookie.Value]
+		mu.Unlock()
+		http.Redirect(w, r, params.Get("redirect_uri")+"?"+url.Values{"code": {username}, "state": {params.Get("state")}}.Encode(), http.StatusFound)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/realms/test/protocol/openid-connect/auth", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("kc_idp_hint") != "upstream" {
+			http.Error(w, "no kc_idp_hint", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		session := fmt.Sprint(len(sessions))
+		sessions[session] = r.Form
+		mu.Unlock()
+		http.SetCookie(w, &http.Cookie{Name: "AUTH_SESSION_ID", Value: session, Path: "/realms/test/"})
+		http.Redirect(w, r, upstream.Endpoints().Authorization+"?"+url.Values{
+			"client_id":     {"keycloak-broker"},
+			"redirect_uri":  {brokerEndpoint},
+			"response_type": {"code"},
+			"scope":         {"openid email"},
+			"state":         {session},
+		}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("/realms/test/broker/upstream/endpoint", func(w http.ResponseWriter, r *http.Request) {
+		conf := oauth2.Config{ClientID: "keycloak-broker", ClientSecret: "broker-secret", RedirectURL: brokerEndpoint,
+			Endpoint: oauth2.Endpoint{TokenURL: upstream.Endpoints().Token}}
+		tok, err := conf.Exchange(r.Context(), r.FormValue("code"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		var claims jwt.MapClaims
+		idToken, _ := tok.Extra("id_token").(string)
+		if _, _, err := jwt.NewParser().ParseUnverified(idToken, &claims); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		mu.Lock()
+		brokered[r.FormValue("state")] = claims["preferred_username"].(string)
+		mu.Unlock()
+		if claims["email"] == "alice@example.com" {
+			_, _ = w.Write([]byte(keycloakLinkConfirm))
+			return
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf(keycloakReviewProfile, claims["email"])))
+	})
+	mux.HandleFunc("/realms/test/login-actions/first-broker-login", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.PostFormValue("submitAction") == "linkAccount":
+			_, _ = w.Write([]byte(keycloakReauthenticate))
+		case r.PostFormValue("email") == "bob@example.com" && r.PostFormValue("firstName") == "Bob":
+			redirect(w, r)
+		default:
+			http.Error(w, "unexpected form", http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("/realms/test/login-actions/authenticate", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("username") != "" || r.PostFormValue("password") != "L0cal!" {
+			http.Error(w, "Invalid password.", http.StatusBadRequest)
+			return
+		}
+		redirect(w, r)
+	})
+	mux.HandleFunc("/realms/test/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"` + r.PostFormValue("code") + `","token_type":"Bearer"}`))
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	realmURL := keycloak.RealmURL(s.URL, "test")
+	brokerEndpoint = realmURL + "/broker/upstream/endpoint"
+	upstream = mockoidc.Start(t, mockoidc.Options{
+		PlainHTTP: true,
+		Users: []mockoidc.User{
+			{Username: "alice.upstream", Password: "Upstr3am!", Email: "alice@example.com"},
+			{Username: "bob.upstream", Password: "Upstr3am!", Email: "bob@example.com"},
+		},
+		Clients: []mockoidc.Client{{ID: "keycloak-broker", Secret: "broker-secret", RedirectURIs: []string{brokerEndpoint}}},
+	})
+	return keycloak.NewFlow(realmURL, flowClientID, flowSecret, flowCallback)
+}
+
+func TestBrokerLinksAccount(t *testing.T) {
+	flow := startBroker(t)
+
+	tokens, err := flow.Broker(context.Background(), "upstream",
+		keycloak.SignIn("alice.upstream", "Upstr3am!"), keycloak.ReviewProfile(), keycloak.LinkAccount(), keycloak.SignIn("alice", "L0cal!"))
+	require.NoError(t, err)
+	assert.Equal(t, "alice.upstream", tokens.AccessToken)
+}
+
+func TestBrokerReviewsProfile(t *testing.T) {
+	flow := startBroker(t)
+
+	tokens, err := flow.Broker(context.Background(), "upstream",
+		keycloak.SignIn("bob.upstream", "Upstr3am!"), keycloak.ReviewProfile(), keycloak.LinkAccount(), keycloak.SignIn("bob", "L0cal!"))
+	require.NoError(t, err)
+	assert.Equal(t, "bob.upstream", tokens.AccessToken)
+}
+
+func TestBrokerUnansweredPage(t *testing.T) {
+	flow := startBroker(t)
+
+	// Nothing answers the page that asks to link the accounts
+	_, err := flow.Broker(context.Background(), "upstream", keycloak.SignIn("alice.upstream", "Upstr3am!"), keycloak.ReviewProfile())
+	assert.ErrorContains(t, err, "/realms/test/broker/upstream/endpoint: 200: no step answers the page")
+
+	_, err = flow.Broker(context.Background(), "upstream", keycloak.SignIn("alice.upstream", "wrong"))
+	assert.ErrorContains(t, err, "401: Invalid username or password.")
+}
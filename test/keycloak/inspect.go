@@ -0,0 +1,539 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/compare"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+)
+
+// Config is the part of a realm the keycloak-setup example inputs control,
+// tagged with the example's variable names so the suites build the
+// expected realm from the options they applied. Inspect reads the realm
+// into the same shape. Memberships and role mappings refer to users,
+// groups and roles by their keys in the inputs.
+type Config struct {
+	RealmName        string `json:"realm_name"`
+	RealmDisplayName string `json:"realm_display_name"`
+	RealmEnabled     bool   `json:"realm_enabled"`
+
+	OIDCClients map[string]ClientInput `json:"oidc_clients"`
+	Users       map[string]UserInput   `json:"users"`
+	Groups      map[string]GroupInput  `json:"groups"`
+	RealmRoles  map[string]RoleInput   `json:"realm_roles"`
+
+	UserGroupMemberships  map[string]GroupMembershipInput `json:"user_group_memberships"`
+	UserRealmRoleMappings map[string]RoleMappingInput     `json:"user_realm_role_mappings"`
+
+	// GroupMembershipMappers put groups claims in the tokens of a client.
+	// Inspect leaves them out; the tokens themselves show them.
+	GroupMembershipMappers map[string]GroupMembershipMapperInput `json:"group_membership_mappers"`
+
+	SAMLIdentityProviders map[string]SAMLIdentityProviderInput `json:"saml_identity_providers"`
+	OIDCIdentityProviders map[string]OIDCIdentityProviderInput `json:"oidc_identity_providers"`
+
+	// OIDCIdentityProviderMappers import claims of the OIDC identity
+	// providers into the users they create. Inspect leaves them out; the
+	// brokered users themselves show them.
+	OIDCIdentityProviderMappers map[string]OIDCIdentityProviderMapperInput `json:"oidc_identity_provider_mappers"`
+}
+
+// ClientInput is an element of the oidc_clients input. The access type
+// is CONFIDENTIAL, PUBLIC or BEARER-ONLY.
+type ClientInput struct {
+	ClientID                  string   `json:"client_id"`
+	Name                      string   `json:"name"`
+	Description               string   `json:"description"`
+	Enabled                   bool     `json:"enabled"`
+	AccessType                string   `json:"access_type"`
+	StandardFlowEnabled       bool     `json:"standard_flow_enabled"`
+	DirectAccessGrantsEnabled bool     `json:"direct_access_grants_enabled"`
+	ServiceAccountsEnabled    bool     `json:"service_accounts_enabled"`
+	RedirectURIs              []string `json:"redirect_uris"`
+	WebOrigins                []string `json:"web_origins"`
+}
+
+// UserInput is an element of the users input.
+type UserInput struct {
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// GroupInput is an element of the groups input. The path places the
+// group in the hierarchy: /Employees/Developers is a subgroup of the
+// top-level group Employees.
+type GroupInput struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// RoleInput is an element of the realm_roles input.
+type RoleInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// GroupMembershipInput is an element of the user_group_memberships input.
+type GroupMembershipInput struct {
+	UserKey   string   `json:"user_key"`
+	GroupKeys []string `json:"group_keys"`
+}
+
+// RoleMappingInput is an element of the user_realm_role_mappings input.
+type RoleMappingInput struct {
+	UserKey  string   `json:"user_key"`
+	RoleKeys []string `json:"role_keys"`
+}
+
+// GroupMembershipMapperInput is an element of the group_membership_mappers
+// input. The claim holds group paths when FullPath is set, names
+// otherwise.
+type GroupMembershipMapperInput struct {
+	ClientKey        string `json:"client_key"`
+	Name             string `json:"name"`
+	ClaimName        string `json:"claim_name"`
+	FullPath         bool   `json:"full_path"`
+	AddToIDToken     bool   `json:"add_to_id_token"`
+	AddToAccessToken bool   `json:"add_to_access_token"`
+	AddToUserinfo    bool   `json:"add_to_userinfo"`
+}
+
+// SAMLIdentityProviderInput is an element of the saml_identity_providers
+// input.
+type SAMLIdentityProviderInput struct {
+	Alias                     string `json:"alias"`
+	DisplayName               string `json:"display_name"`
+	Enabled                   bool   `json:"enabled"`
+	StoreToken                bool   `json:"store_token"`
+	TrustEmail                bool   `json:"trust_email"`
+	LinkOnly                  bool   `json:"link_only"`
+	FirstBrokerLoginFlowAlias string `json:"first_broker_login_flow_alias"`
+	SingleSignOnServiceURL    string `json:"single_sign_on_service_url"`
+	SingleLogoutServiceURL    string `json:"single_logout_service_url"`
+	NameIDPolicyFormat        string `json:"name_id_policy_format"`
+	PostBindingResponse       bool   `json:"post_binding_response"`
+	PostBindingAuthnRequest   bool   `json:"post_binding_authn_request"`
+	PostBindingLogout         bool   `json:"post_binding_logout"`
+	WantAssertionsSigned      bool   `json:"want_assertions_signed"`
+	WantAssertionsEncrypted   bool   `json:"want_assertions_encrypted"`
+	ForceAuthn                bool   `json:"force_authn"`
+	ValidateSignature         bool   `json:"validate_signature"`
+	SigningCertificate        string `json:"signing_certificate"`
+	SignatureAlgorithm        string `json:"signature_algorithm"`
+}
+
+// OIDCIdentityProviderInput is an element of the oidc_identity_providers
+// input. The client secret is not read back, since Keycloak masks it.
+type OIDCIdentityProviderInput struct {
+	Alias                     string `json:"alias"`
+	DisplayName               string `json:"display_name"`
+	Enabled                   bool   `json:"enabled"`
+	StoreToken                bool   `json:"store_token"`
+	TrustEmail                bool   `json:"trust_email"`
+	LinkOnly                  bool   `json:"link_only"`
+	FirstBrokerLoginFlowAlias string `json:"first_broker_login_flow_alias"`
+	AuthorizationURL          string `json:"authorization_url"`
+	TokenURL                  string `json:"token_url"`
+	UserInfoURL               string `json:"user_info_url"`
+	JWKSURL                   string `json:"jwks_url"`
+	ClientID                  string `json:"client_id"`
+	DefaultScopes             string `json:"default_scopes"`
+	ValidateSignature         bool   `json:"validate_signature"`
+	UseJWKSURL                bool   `json:"use_jwks_url"`
+	PKCEEnabled               bool   `json:"pkce_enabled"`
+}
+
+// OIDCIdentityProviderMapperInput is an element of the
+// oidc_identity_provider_mappers input. The sync mode is IMPORT, FORCE,
+// LEGACY or INHERIT.
+type OIDCIdentityProviderMapperInput struct {
+	IdentityProviderKey string `json:"identity_provider_key"`
+	Name                string `json:"name"`
+	ClaimName           string `json:"claim_name"`
+	UserAttribute       string `json:"user_attribute"`
+	SyncMode            string `json:"sync_mode"`
+}
+
+// NameIDFormats maps the name_id_policy_format values of the keycloak
+// provider to the NameID format URIs Keycloak stores.
+var NameIDFormats = map[string]string{
+	"Persistent":         saml.NameIDFormatPersistent,
+	"Transient":          saml.NameIDFormatTransient,
+	"Email":              saml.NameIDFormatEmailAddress,
+	"Unspecified":        saml.NameIDFormatUnspecified,
+	"X.509 Subject Name": saml.NameIDFormatX509Subject,
+}
+
+// builtinClients are the clients Keycloak creates with every realm.
+var builtinClients = map[string]bool{
+	"account":                true,
+	"account-console":        true,
+	"admin-cli":              true,
+	"broker":                 true,
+	"realm-management":       true,
+	"security-admin-console": true,
+}
+
+// builtinRole reports whether Keycloak creates the role name with every
+// realm and grants it to every user.
+func builtinRole(realm, name string) bool {
+	return name == "offline_access" || name == "uma_authorization" || name == "default-roles-"+strings.ToLower(realm)
+}
+
+// Inspect returns the configuration of realm. Objects are keyed as in
+// keys, matching clients by client ID, users by username, groups by path
+// and then by name, roles by name and identity providers by alias. The
+// objects that match none of keys are keyed by those identifiers instead.
+// Objects Keycloak creates with every realm are left out.
+func (c *Client) Inspect(ctx context.Context, realm string, keys Config) (Config, error) {
+	r, err := c.Realm(ctx, realm)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading realm %s: %w", realm, err)
+	}
+	cfg := Config{
+		RealmName:             r.Realm,
+		RealmDisplayName:      r.DisplayName,
+		RealmEnabled:          r.Enabled,
+		OIDCClients:           map[string]ClientInput{},
+		Users:                 map[string]UserInput{},
+		Groups:                map[string]GroupInput{},
+		RealmRoles:            map[string]RoleInput{},
+		UserGroupMemberships:  map[string]GroupMembershipInput{},
+		UserRealmRoleMappings: map[string]RoleMappingInput{},
+		SAMLIdentityProviders: map[string]SAMLIdentityProviderInput{},
+		OIDCIdentityProviders: map[string]OIDCIdentityProviderInput{},
+	}
+
+	clientKeys := map[string]string{}
+	for key, in := range keys.OIDCClients {
+		clientKeys[in.ClientID] = key
+	}
+	clients, err := c.Clients(ctx, realm)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading clients of %s: %w", realm, err)
+	}
+	for _, cl := range clients {
+		if builtinClients[cl.ClientID] || cl.Protocol == "saml" {
+			continue
+		}
+		accessType := "CONFIDENTIAL"
+		switch {
+		case cl.BearerOnly:
+			accessType = "BEARER-ONLY"
+		case cl.PublicClient:
+			accessType = "PUBLIC"
+		}
+		cfg.OIDCClients[keyOf(clientKeys, cl.ClientID)] = ClientInput{
+			ClientID:                  cl.ClientID,
+			Name:                      cl.Name,
+			Description:               cl.Description,
+			Enabled:                   cl.Enabled,
+			AccessType:                accessType,
+			StandardFlowEnabled:       cl.StandardFlowEnabled,
+			DirectAccessGrantsEnabled: cl.DirectAccessGrantsEnabled,
+			ServiceAccountsEnabled:    cl.ServiceAccountsEnabled,
+			RedirectURIs:              cl.RedirectURIs,
+			WebOrigins:                cl.WebOrigins,
+		}
+	}
+
+	groups, err := c.Groups(ctx, realm)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading groups of %s: %w", realm, err)
+	}
+	all := flatten(groups)
+	groupKeys := matchGroups(all, keys.Groups)
+	for _, g := range all {
+		cfg.Groups[groupKeys[g.Path]] = GroupInput{Name: g.Name, Path: g.Path}
+	}
+
+	roleKeys := map[string]string{}
+	for key, in := range keys.RealmRoles {
+		roleKeys[in.Name] = key
+	}
+	roles, err := c.Roles(ctx, realm)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading roles of %s: %w", realm, err)
+	}
+	for _, role := range roles {
+		if !builtinRole(realm, role.Name) {
+			cfg.RealmRoles[keyOf(roleKeys, role.Name)] = RoleInput{Name: role.Name, Description: role.Description}
+		}
+	}
+
+	userKeys := map[string]string{}
+	for key, in := range keys.Users {
+		userKeys[strings.ToLower(in.Username)] = key
+	}
+	users, err := c.Users(ctx, realm)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading users of %s: %w", realm, err)
+	}
+	for _, u := range users {
+		key := keyOf(userKeys, u.Username)
+		cfg.Users[key] = UserInput{
+			Username:  u.Username,
+			Email:     u.Email,
+			FirstName: u.FirstName,
+			LastName:  u.LastName,
+			Enabled:   u.Enabled,
+		}
+
+		memberOf, err := c.UserGroups(ctx, realm, u.ID)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading groups of user %s: %w", u.Username, err)
+		}
+		if len(memberOf) > 0 {
+			m := GroupMembershipInput{UserKey: key}
+			for _, g := range memberOf {
+				m.GroupKeys = append(m.GroupKeys, keyOf(groupKeys, g.Path))
+			}
+			cfg.UserGroupMemberships[key] = m
+		}
+
+		granted, err := c.UserRealmRoles(ctx, realm, u.ID)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading realm roles of user %s: %w", u.Username, err)
+		}
+		m := RoleMappingInput{UserKey: key}
+		for _, role := range granted {
+			if !builtinRole(realm, role.Name) {
+				m.RoleKeys = append(m.RoleKeys, keyOf(roleKeys, role.Name))
+			}
+		}
+		if len(m.RoleKeys) > 0 {
+			cfg.UserRealmRoleMappings[key] = m
+		}
+	}
+
+	samlKeys := map[string]string{}
+	for key, in := range keys.SAMLIdentityProviders {
+		samlKeys[in.Alias] = key
+	}
+	oidcKeys := map[string]string{}
+	for key, in := range keys.OIDCIdentityProviders {
+		oidcKeys[in.Alias] = key
+	}
+	idps, err := c.IdentityProviders(ctx, realm)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading identity providers of %s: %w", realm, err)
+	}
+	for _, idp := range idps {
+		if idp.ProviderID != "saml" {
+			cfg.OIDCIdentityProviders[keyOf(oidcKeys, idp.Alias)] = OIDCIdentityProviderInput{
+				Alias:                     idp.Alias,
+				DisplayName:               idp.DisplayName,
+				Enabled:                   idp.Enabled,
+				StoreToken:                idp.StoreToken,
+				TrustEmail:                idp.TrustEmail,
+				LinkOnly:                  idp.LinkOnly,
+				FirstBrokerLoginFlowAlias: idp.FirstBrokerLoginFlowAlias,
+				AuthorizationURL:          idp.Config["authorizationUrl"],
+				TokenURL:                  idp.Config["tokenUrl"],
+				UserInfoURL:               idp.Config["userInfoUrl"],
+				JWKSURL:                   idp.Config["jwksUrl"],
+				ClientID:                  idp.Config["clientId"],
+				DefaultScopes:             idp.Config["defaultScope"],
+				ValidateSignature:         idp.Config["validateSignature"] == "true",
+				UseJWKSURL:                idp.Config["useJwksUrl"] == "true",
+				PKCEEnabled:               idp.Config["pkceEnabled"] == "true",
+			}
+			continue
+		}
+		format := idp.Config["nameIDPolicyFormat"]
+		for name, uri := range NameIDFormats {
+			if uri == format {
+				format = name
+			}
+		}
+		cfg.SAMLIdentityProviders[keyOf(samlKeys, idp.Alias)] = SAMLIdentityProviderInput{
+			Alias:                     idp.Alias,
+			DisplayName:               idp.DisplayName,
+			Enabled:                   idp.Enabled,
+			StoreToken:                idp.StoreToken,
+			TrustEmail:                idp.TrustEmail,
+			LinkOnly:                  idp.LinkOnly,
+			FirstBrokerLoginFlowAlias: idp.FirstBrokerLoginFlowAlias,
+			SingleSignOnServiceURL:    idp.Config["singleSignOnServiceUrl"],
+			SingleLogoutServiceURL:    idp.Config["singleLogoutServiceUrl"],
+			NameIDPolicyFormat:        format,
+			PostBindingResponse:       idp.Config["postBindingResponse"] == "true",
+			PostBindingAuthnRequest:   idp.Config["postBindingAuthnRequest"] == "true",
+			PostBindingLogout:         idp.Config["postBindingLogout"] == "true",
+			WantAssertionsSigned:      idp.Config["wantAssertionsSigned"] == "true",
+			WantAssertionsEncrypted:   idp.Config["wantAssertionsEncrypted"] == "true",
+			ForceAuthn:                idp.Config["forceAuthn"] == "true",
+			ValidateSignature:         idp.Config["validateSignature"] == "true",
+			SigningCertificate:        idp.Config["signingCertificate"],
+			SignatureAlgorithm:        idp.Config["signatureAlgorithm"],
+		}
+	}
+	return cfg, nil
+}
+
+// keyOf returns the key of the object id, or id when it has none.
+func keyOf(keys map[string]string, id string) string {
+	if key, ok := keys[id]; ok {
+		return key
+	}
+	return id
+}
+
+// flatten returns groups and their subgroups in a single list.
+func flatten(groups []Group) []Group {
+	var out []Group
+	for _, g := range groups {
+		out = append(out, g)
+		out = append(out, flatten(g.SubGroups)...)
+	}
+	return out
+}
+
+// matchGroups maps the paths of groups to their keys in want. A group
+// matches the want group with its path, or else the only want group with
+// its name that nothing else matched, so a group created in the wrong
+// place is reported as misplaced rather than as missing. Groups that
+// match nothing are keyed by their paths.
+func matchGroups(groups []Group, want map[string]GroupInput) map[string]string {
+	byPath := map[string]string{}
+	byName := map[string][]string{}
+	for key, in := range want {
+		byPath[in.Path] = key
+		byName[in.Name] = append(byName[in.Name], key)
+	}
+	matched := map[string]string{}
+	taken := map[string]bool{}
+	var rest []Group
+	for _, g := range groups {
+		if key, ok := byPath[g.Path]; ok {
+			matched[g.Path] = key
+			taken[key] = true
+		} else {
+			rest = append(rest, g)
+		}
+	}
+	for _, g := range rest {
+		keys := byName[g.Name]
+		if len(keys) == 1 && !taken[keys[0]] {
+			matched[g.Path] = keys[0]
+			taken[keys[0]] = true
+		} else {
+			matched[g.Path] = g.Path
+		}
+	}
+	return matched
+}
+
+// Diff lists the settings in which c differs from want, one line per
+// setting named after the input. Lists are compared as sets. Usernames
+// and email addresses are compared in lower case, the way Keycloak stores
+// them, and certificates without PEM armor and line breaks.
+func (c Config) Diff(want Config) []string {
+	var diffs []string
+	add := func(input string, got, want interface{}) {
+		if !reflect.DeepEqual(got, want) {
+			diffs = append(diffs, fmt.Sprintf("%s: got %v, want %v", input, got, want))
+		}
+	}
+
+	add("realm_name", c.RealmName, want.RealmName)
+	add("realm_display_name", c.RealmDisplayName, want.RealmDisplayName)
+	add("realm_enabled", c.RealmEnabled, want.RealmEnabled)
+
+	for _, key := range compare.Keys(c.OIDCClients, want.OIDCClients, &diffs, "oidc_clients") {
+		got, want := c.OIDCClients[key], want.OIDCClients[key]
+		input := "oidc_clients[" + key + "]."
+		add(input+"client_id", got.ClientID, want.ClientID)
+		add(input+"name", got.Name, want.Name)
+		add(input+"description", got.Description, want.Description)
+		add(input+"enabled", got.Enabled, want.Enabled)
+		add(input+"access_type", got.AccessType, want.AccessType)
+		add(input+"standard_flow_enabled", got.StandardFlowEnabled, want.StandardFlowEnabled)
+		add(input+"direct_access_grants_enabled", got.DirectAccessGrantsEnabled, want.DirectAccessGrantsEnabled)
+		add(input+"service_accounts_enabled", got.ServiceAccountsEnabled, want.ServiceAccountsEnabled)
+		add(input+"redirect_uris", compare.Set(got.RedirectURIs), compare.Set(want.RedirectURIs))
+		add(input+"web_origins", compare.Set(got.WebOrigins), compare.Set(want.WebOrigins))
+	}
+	for _, key := range compare.Keys(c.Users, want.Users, &diffs, "users") {
+		got, want := c.Users[key], want.Users[key]
+		input := "users[" + key + "]."
+		add(input+"username", strings.ToLower(got.Username), strings.ToLower(want.Username))
+		add(input+"email", strings.ToLower(got.Email), strings.ToLower(want.Email))
+		add(input+"first_name", got.FirstName, want.FirstName)
+		add(input+"last_name", got.LastName, want.LastName)
+		add(input+"enabled", got.Enabled, want.Enabled)
+	}
+	for _, key := range compare.Keys(c.Groups, want.Groups, &diffs, "groups") {
+		got, want := c.Groups[key], want.Groups[key]
+		input := "groups[" + key + "]."
+		add(input+"name", got.Name, want.Name)
+		add(input+"path", got.Path, want.Path)
+	}
+	for _, key := range compare.Keys(c.RealmRoles, want.RealmRoles, &diffs, "realm_roles") {
+		got, want := c.RealmRoles[key], want.RealmRoles[key]
+		input := "realm_roles[" + key + "]."
+		add(input+"name", got.Name, want.Name)
+		add(input+"description", got.Description, want.Description)
+	}
+
+	add("user_group_memberships", memberships(c.UserGroupMemberships), memberships(want.UserGroupMemberships))
+	add("user_realm_role_mappings", roleMappings(c.UserRealmRoleMappings), roleMappings(want.UserRealmRoleMappings))
+
+	for _, key := range compare.Keys(c.SAMLIdentityProviders, want.SAMLIdentityProviders, &diffs, "saml_identity_providers") {
+		got, want := c.SAMLIdentityProviders[key], want.SAMLIdentityProviders[key]
+		got.SigningCertificate = certificate(got.SigningCertificate)
+		want.SigningCertificate = certificate(want.SigningCertificate)
+		fields("saml_identity_providers["+key+"]", got, want, add)
+	}
+	for _, key := range compare.Keys(c.OIDCIdentityProviders, want.OIDCIdentityProviders, &diffs, "oidc_identity_providers") {
+		fields("oidc_identity_providers["+key+"]", c.OIDCIdentityProviders[key], want.OIDCIdentityProviders[key], add)
+	}
+	return diffs
+}
+
+// fields compares each field of the input structs got and want, naming
+// the differences after the fields' JSON names.
+func fields(input string, got, want interface{}, add func(field string, got, want interface{})) {
+	gv, wv := reflect.ValueOf(got), reflect.ValueOf(want)
+	for i := 0; i < gv.NumField(); i++ {
+		name := gv.Type().Field(i).Tag.Get("json")
+		add(input+"."+name, gv.Field(i).Interface(), wv.Field(i).Interface())
+	}
+}
+
+// memberships flattens group memberships into sorted "user -> group"
+// entries, so they compare equal however the inputs group them.
+func memberships(m map[string]GroupMembershipInput) []string {
+	var out []string
+	for _, in := range m {
+		for _, group := range in.GroupKeys {
+			out = append(out, in.UserKey+" -> "+group)
+		}
+	}
+	return compare.Set(out)
+}
+
+// roleMappings flattens role mappings into sorted "user -> role" entries.
+func roleMappings(m map[string]RoleMappingInput) []string {
+	var out []string
+	for _, in := range m {
+		for _, role := range in.RoleKeys {
+			out = append(out, in.UserKey+" -> "+role)
+		}
+	}
+	return compare.Set(out)
+}
+
+// certificate strips the PEM armor and line breaks from a certificate,
+// leaving the base64 encoded DER Keycloak stores.
+func certificate(s string) string {
+	s = strings.ReplaceAll(s, "-----BEGIN CERTIFICATE-----", "")
+	s = strings.ReplaceAll(s, "-----END CERTIFICATE-----", "")
+	return strings.Join(strings.Fields(s), "")
+}
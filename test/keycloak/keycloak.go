@@ -0,0 +1,381 @@
+// Package keycloak reads the objects the keycloak module manages, the
+// realm with its clients, groups, roles, users and identity providers,
+// through the Keycloak Admin REST API, so the suites can compare a realm
+// with the inputs they applied. The client signs in to the master realm
+// with the admin credentials of the test configuration.
+package keycloak
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/apierror"
+)
+
+// pageSize is the number of objects requested per page of a listing.
+const pageSize = 100
+
+// Realm is a realm.
+type Realm struct {
+	ID          string `json:"id"`
+	Realm       string `json:"realm"`
+	DisplayName string `json:"displayName"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// RealmClient is a client of a realm, such as an OpenID Connect
+// application. Public clients have no secret, and bearer-only clients
+// only accept tokens.
+type RealmClient struct {
+	ID                        string   `json:"id"`
+	ClientID                  string   `json:"clientId"`
+	Name                      string   `json:"name"`
+	Description               string   `json:"description"`
+	Enabled                   bool     `json:"enabled"`
+	Protocol                  string   `json:"protocol"`
+	PublicClient              bool     `json:"publicClient"`
+	BearerOnly                bool     `json:"bearerOnly"`
+	StandardFlowEnabled       bool     `json:"standardFlowEnabled"`
+	DirectAccessGrantsEnabled bool     `json:"directAccessGrantsEnabled"`
+	ServiceAccountsEnabled    bool     `json:"serviceAccountsEnabled"`
+	RedirectURIs              []string `json:"redirectUris"`
+	WebOrigins                []string `json:"webOrigins"`
+}
+
+// Group is a group of users. Groups returns the subgroups of each group,
+// whichever version of Keycloak serves them.
+type Group struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	Path          string  `json:"path"`
+	SubGroupCount int     `json:"subGroupCount"`
+	SubGroups     []Group `json:"subGroups"`
+}
+
+// Role is a realm role.
+type Role struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Composite   bool   `json:"composite"`
+}
+
+// User is a user of a realm. Keycloak stores usernames and email
+// addresses in lower case.
+type User struct {
+	ID         string              `json:"id"`
+	Username   string              `json:"username"`
+	Email      string              `json:"email"`
+	FirstName  string              `json:"firstName"`
+	LastName   string              `json:"lastName"`
+	Enabled    bool                `json:"enabled"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// FederatedIdentity links a user to their account at an identity provider
+// the realm brokers sign-in to.
+type FederatedIdentity struct {
+	IdentityProvider string `json:"identityProvider"`
+	UserID           string `json:"userId"`
+	UserName         string `json:"userName"`
+}
+
+// IdentityProvider is an identity provider the realm brokers sign-in to.
+// Config holds the provider type's settings as strings, with booleans
+// spelled "true" and "false" and secrets masked.
+type IdentityProvider struct {
+	Alias                     string            `json:"alias"`
+	ProviderID                string            `json:"providerId"`
+	DisplayName               string            `json:"displayName"`
+	Enabled                   bool              `json:"enabled"`
+	TrustEmail                bool              `json:"trustEmail"`
+	StoreToken                bool              `json:"storeToken"`
+	LinkOnly                  bool              `json:"linkOnly"`
+	FirstBrokerLoginFlowAlias string            `json:"firstBrokerLoginFlowAlias"`
+	Config                    map[string]string `json:"config"`
+}
+
+// Client reads realm objects.
+type Client struct {
+	// URL is the server URL, such as http://localhost:8080.
+	URL  string
+	HTTP *http.Client
+}
+
+// New returns a Client for the server in creds, or for serverURL when it
+// is not empty. The client gets its tokens with the password grant of the
+// creds client, admin-cli by default, in the master realm, and signs in
+// again when they expire.
+func New(ctx context.Context, creds config.KeycloakCredentials, serverURL string) *Client {
+	if serverURL == "" {
+		serverURL = creds.URL
+	}
+	serverURL = strings.TrimRight(serverURL, "/")
+	clientID := creds.ClientID
+	if clientID == "" {
+		clientID = "admin-cli"
+	}
+	src := &passwordSource{
+		ctx: ctx,
+		conf: oauth2.Config{
+			ClientID: clientID,
+			Endpoint: oauth2.Endpoint{
+				TokenURL:  serverURL + "/realms/master/protocol/openid-connect/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+		username: creds.Username,
+		password: creds.Password,
+	}
+	return &Client{URL: serverURL, HTTP: oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, src))}
+}
+
+// passwordSource signs in with the resource owner password grant. Admin
+// tokens are short lived, and signing in again is simpler than keeping
+// track of the refresh token.
+type passwordSource struct {
+	ctx                context.Context
+	conf               oauth2.Config
+	username, password string
+}
+
+func (s *passwordSource) Token() (*oauth2.Token, error) {
+	tok, err := s.conf.PasswordCredentialsToken(s.ctx, s.username, s.password)
+	if err != nil {
+		return nil, fmt.Errorf("signing in to %s as %s: %w", s.conf.Endpoint.TokenURL, s.username, err)
+	}
+	return tok, nil
+}
+
+// Realm returns the realm realm.
+func (c *Client) Realm(ctx context.Context, realm string) (*Realm, error) {
+	var r Realm
+	if err := c.get(ctx, realmPath(realm), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Clients returns the clients of realm, including the ones Keycloak
+// creates with every realm.
+func (c *Client) Clients(ctx context.Context, realm string) ([]RealmClient, error) {
+	return list[RealmClient](ctx, c, realmPath(realm)+"/clients")
+}
+
+// Groups returns the top-level groups of realm with their subgroups.
+func (c *Client) Groups(ctx context.Context, realm string) ([]Group, error) {
+	groups, err := list[Group](ctx, c, realmPath(realm)+"/groups?briefRepresentation=false")
+	if err != nil {
+		return nil, err
+	}
+	if err := c.subGroups(ctx, realm, groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// subGroups fills in the subgroups of groups. Keycloak 23 and later only
+// count them, and serve them from the children of each group instead.
+func (c *Client) subGroups(ctx context.Context, realm string, groups []Group) error {
+	for i := range groups {
+		g := &groups[i]
+		if len(g.SubGroups) == 0 && g.SubGroupCount > 0 {
+			children, err := list[Group](ctx, c, realmPath(realm)+"/groups/"+url.PathEscape(g.ID)+"/children?briefRepresentation=false")
+			if err != nil {
+				return err
+			}
+			g.SubGroups = children
+		}
+		if err := c.subGroups(ctx, realm, g.SubGroups); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Roles returns the realm roles of realm, including the ones Keycloak
+// creates with every realm.
+func (c *Client) Roles(ctx context.Context, realm string) ([]Role, error) {
+	return list[Role](ctx, c, realmPath(realm)+"/roles")
+}
+
+// Users returns the users of realm.
+func (c *Client) Users(ctx context.Context, realm string) ([]User, error) {
+	return list[User](ctx, c, realmPath(realm)+"/users?briefRepresentation=false")
+}
+
+// FindUser returns the user of realm with the given username, nil when
+// there is none.
+func (c *Client) FindUser(ctx context.Context, realm, username string) (*User, error) {
+	var users []User
+	if err := c.get(ctx, realmPath(realm)+"/users?exact=true&username="+url.QueryEscape(username), &users); err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if strings.EqualFold(u.Username, username) {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+// SetPassword sets a permanent password for userID, so the user can sign
+// in without updating it first. The keycloak module creates users without
+// credentials.
+func (c *Client) SetPassword(ctx context.Context, realm, userID, password string) error {
+	credential := map[string]interface{}{"type": "password", "value": password, "temporary": false}
+	return c.put(ctx, realmPath(realm)+"/users/"+url.PathEscape(userID)+"/reset-password", credential)
+}
+
+// FederatedIdentities returns the identity provider accounts linked to
+// userID.
+func (c *Client) FederatedIdentities(ctx context.Context, realm, userID string) ([]FederatedIdentity, error) {
+	var links []FederatedIdentity
+	if err := c.get(ctx, realmPath(realm)+"/users/"+url.PathEscape(userID)+"/federated-identity", &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// UserGroups returns the groups userID is a direct member of.
+func (c *Client) UserGroups(ctx context.Context, realm, userID string) ([]Group, error) {
+	return list[Group](ctx, c, realmPath(realm)+"/users/"+url.PathEscape(userID)+"/groups")
+}
+
+// UserRealmRoles returns the realm roles granted to userID directly,
+// including the realm's default roles.
+func (c *Client) UserRealmRoles(ctx context.Context, realm, userID string) ([]Role, error) {
+	var roles []Role
+	if err := c.get(ctx, realmPath(realm)+"/users/"+url.PathEscape(userID)+"/role-mappings/realm", &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// IdentityProviders returns the identity providers of realm.
+func (c *Client) IdentityProviders(ctx context.Context, realm string) ([]IdentityProvider, error) {
+	var idps []IdentityProvider
+	if err := c.get(ctx, realmPath(realm)+"/identity-provider/instances", &idps); err != nil {
+		return nil, err
+	}
+	return idps, nil
+}
+
+func realmPath(realm string) string {
+	return "/admin/realms/" + url.PathEscape(realm)
+}
+
+// list reads every page of a listing.
+func list[T any](ctx context.Context, c *Client, path string) ([]T, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	var all []T
+	for first := 0; ; first += pageSize {
+		var page []T
+		if err := c.get(ctx, path+sep+"first="+strconv.Itoa(first)+"&max="+strconv.Itoa(pageSize), &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) < pageSize {
+			return all, nil
+		}
+	}
+}
+
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	u := c.URL + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s: %w", u, err)
+	}
+	return nil
+}
+
+// put replaces the object at path with in. The API answers with no
+// content.
+func (c *Client) put(ctx context.Context, path string, in interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return readError(resp)
+	}
+	return nil
+}
+
+// Error is an error response from the Admin REST API.
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %d: %s", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+// HTTPStatus returns the status code of the response.
+func (e *Error) HTTPStatus() int {
+	return e.StatusCode
+}
+
+// readError reads the error of a response. Keycloak answers with an
+// "error" or an "errorMessage" member depending on the endpoint.
+func readError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	e := &Error{Method: resp.Request.Method, URL: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+	var doc struct {
+		Error        string `json:"error"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	switch {
+	case json.Unmarshal(body, &doc) != nil:
+		e.Message = strings.TrimSpace(string(body))
+	case doc.ErrorMessage != "":
+		e.Message = doc.ErrorMessage
+	default:
+		e.Message = doc.Error
+	}
+	return e
+}
+
+// IsNotFound reports whether err is a 404 response.
+func IsNotFound(err error) bool {
+	return apierror.IsNotFound(err)
+}
@@ -0,0 +1,274 @@
+package keycloak_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/keycloak"
+)
+
+var creds = config.KeycloakCredentials{ClientID: "admin-cli", Username: "admin", Password: "admin"}
+
+// server serves the admin token endpoint and the Admin REST responses of
+// a fixture, keyed by method and request URI. It records the bodies of
+// the PUT requests it answers.
+type server struct {
+	*httptest.Server
+	signIns atomic.Int32
+
+	mu   sync.Mutex
+	puts map[string]string
+}
+
+func startServer(t *testing.T, fixture string) *server {
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	require.NoError(t, err)
+	var responses map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &responses))
+
+	s := &server{puts: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/realms/master/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostFormValue("grant_type") != "password" || r.PostFormValue("client_id") != creds.ClientID ||
+			r.PostFormValue("username") != creds.Username || r.PostFormValue("password") != creds.Password {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant","error_description":"Invalid user credentials"}`))
+			return
+		}
+		s.signIns.Add(1)
+		_, _ = w.Write([]byte(`{"access_token":"admin-token","token_type":"Bearer","expires_in":60}`))
+	})
+	mux.HandleFunc("/admin/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer admin-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"HTTP 401 Unauthorized"}`))
+			return
+		}
+		body, ok := responses[r.Method+" "+r.RequestURI]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"Realm not found."}`))
+			return
+		}
+		if r.Method == http.MethodPut {
+			data, _ := io.ReadAll(r.Body)
+			s.mu.Lock()
+			s.puts[r.RequestURI] = string(data)
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = w.Write(body)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// put returns the body of the last PUT request to uri.
+func (s *server) put(uri string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.puts[uri]
+}
+
+func realmConfig() keycloak.Config {
+	return keycloak.Config{
+		RealmName:        "test",
+		RealmDisplayName: "Test Realm",
+		RealmEnabled:     true,
+		OIDCClients: map[string]keycloak.ClientInput{
+			"webapp": {
+				ClientID:                  "test-webapp",
+				Name:                      "Test Web App",
+				Description:               "Test web application",
+				Enabled:                   true,
+				AccessType:                "CONFIDENTIAL",
+				StandardFlowEnabled:       true,
+				DirectAccessGrantsEnabled: true,
+				ServiceAccountsEnabled:    true,
+				RedirectURIs:              []string{"https://test.example.com/auth/callback", "https://localhost:3000/auth/callback"},
+				WebOrigins:                []string{"https://test.example.com", "https://localhost:3000"},
+			},
+		},
+		Users: map[string]keycloak.UserInput{
+			"alice": {Username: "Alice-abc123", Email: "Alice-abc123@example.com", FirstName: "Alice", LastName: "Developer", Enabled: true},
+		},
+		Groups: map[string]keycloak.GroupInput{
+			"employees":  {Name: "Employees", Path: "/Employees"},
+			"managers":   {Name: "Managers", Path: "/Managers"},
+			"developers": {Name: "Developers", Path: "/Employees/Developers"},
+		},
+		RealmRoles: map[string]keycloak.RoleInput{
+			"user":  {Name: "user", Description: "Standard user role"},
+			"admin": {Name: "admin", Description: "Administrator role"},
+		},
+		UserGroupMemberships: map[string]keycloak.GroupMembershipInput{
+			"alice": {UserKey: "alice", GroupKeys: []string{"developers"}},
+		},
+		UserRealmRoleMappings: map[string]keycloak.RoleMappingInput{
+			"alice": {UserKey: "alice", RoleKeys: []string{"admin"}},
+		},
+		SAMLIdentityProviders: map[string]keycloak.SAMLIdentityProviderInput{
+			"mock": {
+				Alias:                     "mock-saml",
+				DisplayName:               "Mock SAML",
+				Enabled:                   true,
+				TrustEmail:                true,
+				FirstBrokerLoginFlowAlias: "first broker login",
+				SingleSignOnServiceURL:    "http://127.0.0.1:41234/sso",
+				SingleLogoutServiceURL:    "http://127.0.0.1:41234/slo",
+				NameIDPolicyFormat:        "Persistent",
+				PostBindingResponse:       true,
+				WantAssertionsSigned:      true,
+				ValidateSignature:         true,
+				SigningCertificate: "-----BEGIN CERTIFICATE-----\n" +
+					"MIIBdTCCARugAwIBAgIBATAKBggqhkjOPQQDAjAUMRIwEAYDVQQDEwltb2Nrc2Ft\n" +
+					"bDAeFw0yNTAxMDEwMDAwMDBaFw0zNTAxMDEwMDAwMDBa\n" +
+					"-----END CERTIFICATE-----\n",
+				SignatureAlgorithm: "RSA_SHA256",
+			},
+		},
+		OIDCIdentityProviders: map[string]keycloak.OIDCIdentityProviderInput{
+			"upstream": {
+				Alias:                     "upstream",
+				DisplayName:               "Upstream",
+				Enabled:                   true,
+				FirstBrokerLoginFlowAlias: "first broker login",
+				AuthorizationURL:          "http://127.0.0.1:41235/authorize",
+				TokenURL:                  "http://host.docker.internal:41235/token",
+				UserInfoURL:               "http://host.docker.internal:41235/userinfo",
+				JWKSURL:                   "http://host.docker.internal:41235/jwks",
+				ClientID:                  "keycloak-broker",
+				DefaultScopes:             "openid profile email",
+				ValidateSignature:         true,
+				UseJWKSURL:                true,
+				PKCEEnabled:               true,
+			},
+		},
+	}
+}
+
+func TestInspect(t *testing.T) {
+	s := startServer(t, "realm.json")
+	client := keycloak.New(context.Background(), creds, s.URL)
+
+	got, err := client.Inspect(context.Background(), "test", realmConfig())
+	require.NoError(t, err)
+	assert.Empty(t, got.Diff(realmConfig()))
+
+	// Developers is only listed among the children of Employees
+	assert.Equal(t, keycloak.GroupInput{Name: "Developers", Path: "/Employees/Developers"}, got.Groups["developers"])
+	// The admin token is reused until it expires
+	assert.EqualValues(t, 1, s.signIns.Load())
+}
+
+func TestInspectUnknownObjects(t *testing.T) {
+	client := keycloak.New(context.Background(), creds, startServer(t, "realm.json").URL)
+
+	// Objects nothing refers to are keyed by their identifiers
+	got, err := client.Inspect(context.Background(), "test", keycloak.Config{})
+	require.NoError(t, err)
+	assert.Contains(t, got.OIDCClients, "test-webapp")
+	assert.NotContains(t, got.OIDCClients, "account")
+	assert.Contains(t, got.Groups, "/Employees/Developers")
+	assert.Equal(t, keycloak.RoleMappingInput{UserKey: "alice-abc123", RoleKeys: []string{"admin"}}, got.UserRealmRoleMappings["alice-abc123"])
+	assert.Contains(t, got.SAMLIdentityProviders, "mock-saml")
+	assert.Contains(t, got.OIDCIdentityProviders, "upstream")
+	assert.Len(t, got.RealmRoles, 2)
+}
+
+func TestNotFound(t *testing.T) {
+	client := keycloak.New(context.Background(), creds, startServer(t, "realm.json").URL)
+
+	_, err := client.Realm(context.Background(), "missing")
+	require.Error(t, err)
+	assert.True(t, keycloak.IsNotFound(err))
+	assert.Contains(t, err.Error(), "Realm not found.")
+}
+
+func TestSetPassword(t *testing.T) {
+	s := startServer(t, "realm.json")
+	client := keycloak.New(context.Background(), creds, s.URL)
+
+	u, err := client.FindUser(context.Background(), "test", "Alice-abc123")
+	require.NoError(t, err)
+	require.NotNil(t, u)
+	require.NoError(t, client.SetPassword(context.Background(), "test", u.ID, "S3cret!"))
+	assert.JSONEq(t, `{"type":"password","value":"S3cret!","temporary":false}`,
+		s.put("/admin/realms/test/users/c6d7e8f9-a0b1-4c2d-3e4f-5a6b7c8d9e01/reset-password"))
+
+	err = client.SetPassword(context.Background(), "test", "missing", "S3cret!")
+	require.Error(t, err)
+	assert.True(t, keycloak.IsNotFound(err))
+	assert.Contains(t, err.Error(), "PUT ")
+}
+
+func TestFederatedIdentities(t *testing.T) {
+	client := keycloak.New(context.Background(), creds, startServer(t, "realm.json").URL)
+
+	links, err := client.FederatedIdentities(context.Background(), "test", "c6d7e8f9-a0b1-4c2d-3e4f-5a6b7c8d9e01")
+	require.NoError(t, err)
+	assert.Equal(t, []keycloak.FederatedIdentity{{IdentityProvider: "upstream", UserID: "b1c2d3e4", UserName: "alice.upstream"}}, links)
+}
+
+func TestInvalidCredentials(t *testing.T) {
+	bad := creds
+	bad.Password = "wrong"
+	client := keycloak.New(context.Background(), bad, startServer(t, "realm.json").URL)
+
+	_, err := client.Realm(context.Background(), "test")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "signing in")
+	assert.Contains(t, err.Error(), "invalid_grant")
+}
+
+func TestDiff(t *testing.T) {
+	want := realmConfig()
+	got := realmConfig()
+	webapp := got.OIDCClients["webapp"]
+	webapp.RedirectURIs = []string{"https://test.example.com/auth/callback"}
+	webapp.WebOrigins = []string{"https://localhost:3000", "https://test.example.com"}
+	webapp.ServiceAccountsEnabled = false
+	got.OIDCClients["webapp"] = webapp
+	// Developers was created at the top level
+	got.Groups["developers"] = keycloak.GroupInput{Name: "Developers", Path: "/Developers"}
+	got.RealmRoles["admin"] = keycloak.RoleInput{Name: "admin"}
+	got.UserGroupMemberships = nil
+	saml := got.SAMLIdentityProviders["mock"]
+	saml.WantAssertionsSigned = false
+	got.SAMLIdentityProviders["mock"] = saml
+	upstream := got.OIDCIdentityProviders["upstream"]
+	upstream.TokenURL = "http://127.0.0.1:41235/token"
+	got.OIDCIdentityProviders["upstream"] = upstream
+	// Keycloak stores usernames in lower case
+	alice := got.Users["alice"]
+	alice.Username = strings.ToLower(alice.Username)
+	got.Users["alice"] = alice
+
+	assert.Equal(t, []string{
+		"oidc_clients[webapp].service_accounts_enabled: got false, want true",
+		"oidc_clients[webapp].redirect_uris: got [https://test.example.com/auth/callback], " +
+			"want [https://localhost:3000/auth/callback https://test.example.com/auth/callback]",
+		"groups[developers].path: got /Developers, want /Employees/Developers",
+		"realm_roles[admin].description: got , want Administrator role",
+		"user_group_memberships: got [], want [alice -> developers]",
+		"saml_identity_providers[mock].want_assertions_signed: got false, want true",
+		"oidc_identity_providers[upstream].token_url: got http://127.0.0.1:41235/token, want http://host.docker.internal:41235/token",
+	}, got.Diff(want))
+}
@@ -1,40 +1,47 @@
 package test
 
 import (
+	"context"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/keycloak"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mockoidc"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mocksaml"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/oidc"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
 )
 
 func TestKeycloakSetupExample(t *testing.T) {
 	t.Parallel()
 
-	// Generate unique names to avoid conflicts
-	uniqueID := random.UniqueId()
-	realmName := fmt.Sprintf("test-realm-%s", uniqueID)
-
-	// Configure Terraform options
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/keycloak-setup",
-		Vars: map[string]interface{}{
-			"keycloak_url":      getKeycloakURLFromEnv(t),
-			"keycloak_username": getKeycloakUsernameFromEnv(t),
-			"keycloak_password": getKeycloakPasswordFromEnv(t),
-			"realm_name":        realmName,
-			"realm_display_name": fmt.Sprintf("Test Realm %s", uniqueID),
-			"realm_enabled":     true,
+	runStages(t, config.Keycloak, func() *terraform.Options {
+		b := KeycloakExample(t)
+		return b.Vars(map[string]interface{}{
+			"realm_display_name": fmt.Sprintf("Test Realm %s", b.ID()),
+			"realm_enabled":      true,
 			"oidc_clients": map[string]interface{}{
 				"webapp": map[string]interface{}{
-					"client_id":     fmt.Sprintf("test-webapp-%s", uniqueID),
-					"name":          fmt.Sprintf("Test Web App %s", uniqueID),
-					"description":   "Test web application",
-					"enabled":       true,
+					"client_id":   b.Name("webapp"),
+					"name":        fmt.Sprintf("Test Web App %s", b.ID()),
+					"description": "Test web application",
+					"enabled":     true,
+					"access_type": "CONFIDENTIAL",
+
+					"standard_flow_enabled":        true,
+					"direct_access_grants_enabled": true,
+					"service_accounts_enabled":     false,
 					"redirect_uris": []string{
 						"https://test.example.com/auth/callback",
 						"https://localhost:3000/auth/callback",
@@ -47,99 +54,95 @@ func TestKeycloakSetupExample(t *testing.T) {
 			},
 			"users": map[string]interface{}{
 				"testuser": map[string]interface{}{
-					"username":   fmt.Sprintf("testuser-%s", uniqueID),
-					"email":      fmt.Sprintf("test-%s@example.com", uniqueID),
+					"username":   fmt.Sprintf("testuser-%s", b.ID()),
+					"email":      fmt.Sprintf("test-%s@example.com", b.ID()),
 					"first_name": "Test",
 					"last_name":  "User",
 					"enabled":    true,
 				},
 			},
-			"tags": map[string]string{
-				"Environment": "test",
-				"Project":     "terratest",
-				"ManagedBy":   "terraform",
-			},
-		},
-	}
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Test outputs
+		testKeycloakOutputs(t, terraformOptions)
 
-	// Clean up resources after test
-	defer terraform.Destroy(t, terraformOptions)
+		// Hold the outputs to their contract
+		testOutputContract(t, "examples/keycloak-setup", terraformOptions)
 
-	// Deploy the infrastructure
-	terraform.InitAndApply(t, terraformOptions)
+		// Test realm functionality
+		testKeycloakRealm(t, terraformOptions)
 
-	// Test outputs
-	testKeycloakOutputs(t, terraformOptions)
+		// Hold the realm to the OpenID Connect profile of Keycloak
+		testOIDCConformance(t, liveHTTPClient(), outputIdentityProvider(t, config.Keycloak, terraformOptions),
+			keycloakSignIn(t, terraformOptions))
 
-	// Test realm functionality
-	testKeycloakRealm(t, terraformOptions)
+		// Test the realm's SAML identity provider metadata
+		testKeycloakSAMLDescriptor(t, liveHTTPClient(),
+			terraform.Output(t, terraformOptions, "saml_descriptor_url"),
+			terraform.Output(t, terraformOptions, "issuer"))
 
-	// Test OIDC endpoints
-	testKeycloakOIDCEndpoints(t, terraformOptions)
+		// Test the realm objects
+		testKeycloakConfiguration(t, terraformOptions)
 
-	// Test client configuration
-	testKeycloakClients(t, terraformOptions)
+		// Sign the user in to the web application
+		testKeycloakTokens(t, terraformOptions)
+	})
 }
 
 func TestKeycloakMultipleClients(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	realmName := fmt.Sprintf("test-multi-%s", uniqueID)
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/keycloak-setup",
-		Vars: map[string]interface{}{
-			"keycloak_url":      getKeycloakURLFromEnv(t),
-			"keycloak_username": getKeycloakUsernameFromEnv(t),
-			"keycloak_password": getKeycloakPasswordFromEnv(t),
-			"realm_name":        realmName,
-			"realm_display_name": fmt.Sprintf("Multi-Client Realm %s", uniqueID),
+	runStages(t, config.Keycloak, func() *terraform.Options {
+		b := KeycloakExample(t)
+		return b.Vars(map[string]interface{}{
+			"realm_name":         b.Name("multi"),
+			"realm_display_name": fmt.Sprintf("Multi-Client Realm %s", b.ID()),
 			"oidc_clients": map[string]interface{}{
 				"webapp": map[string]interface{}{
-					"client_id":     fmt.Sprintf("webapp-%s", uniqueID),
+					"client_id":     fmt.Sprintf("webapp-%s", b.ID()),
 					"name":          "Web Application",
 					"description":   "Web application client",
 					"enabled":       true,
+					"access_type":   "CONFIDENTIAL",
 					"redirect_uris": []string{"https://webapp.example.com/callback"},
 					"web_origins":   []string{"https://webapp.example.com"},
+
+					"standard_flow_enabled":        true,
+					"direct_access_grants_enabled": false,
+					"service_accounts_enabled":     true,
 				},
 				"mobile": map[string]interface{}{
-					"client_id":     fmt.Sprintf("mobile-%s", uniqueID),
+					"client_id":     fmt.Sprintf("mobile-%s", b.ID()),
 					"name":          "Mobile Application",
 					"description":   "Mobile application client",
 					"enabled":       true,
+					"access_type":   "PUBLIC",
 					"redirect_uris": []string{"com.example.app://callback"},
 					"web_origins":   []string{},
+
+					"standard_flow_enabled":        true,
+					"direct_access_grants_enabled": false,
+					"service_accounts_enabled":     false,
 				},
 			},
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Verify multiple clients were created
-	clientIDs := terraform.OutputMap(t, terraformOptions, "client_ids")
-	assert.NotEmpty(t, clientIDs)
-	assert.Contains(t, clientIDs, "webapp")
-	assert.Contains(t, clientIDs, "mobile")
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Verify both clients with their redirect URIs and web origins
+		testKeycloakConfiguration(t, terraformOptions)
+
+		// The public client redeems its codes without a secret
+		testKeycloakTokens(t, terraformOptions)
+	})
 }
 
 func TestKeycloakWithGroups(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	realmName := fmt.Sprintf("test-groups-%s", uniqueID)
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/keycloak-setup",
-		Vars: map[string]interface{}{
-			"keycloak_url":      getKeycloakURLFromEnv(t),
-			"keycloak_username": getKeycloakUsernameFromEnv(t),
-			"keycloak_password": getKeycloakPasswordFromEnv(t),
-			"realm_name":        realmName,
-			"realm_display_name": fmt.Sprintf("Groups Realm %s", uniqueID),
+	runStages(t, config.Keycloak, func() *terraform.Options {
+		b := KeycloakExample(t)
+		return b.Vars(map[string]interface{}{
+			"realm_name":         b.Name("groups"),
+			"realm_display_name": fmt.Sprintf("Groups Realm %s", b.ID()),
 			"groups": map[string]interface{}{
 				"employees": map[string]interface{}{
 					"name": "Employees",
@@ -164,58 +167,254 @@ func TestKeycloakWithGroups(t *testing.T) {
 					"description": "Administrator role",
 				},
 			},
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Verify groups and roles were created
-	groupIDs := terraform.OutputMap(t, terraformOptions, "group_ids")
-	assert.NotEmpty(t, groupIDs)
-	assert.Contains(t, groupIDs, "employees")
-	assert.Contains(t, groupIDs, "managers")
-	assert.Contains(t, groupIDs, "developers")
+			"users": map[string]interface{}{
+				"developer": map[string]interface{}{
+					"username":   fmt.Sprintf("developer-%s", b.ID()),
+					"email":      fmt.Sprintf("developer-%s@example.com", b.ID()),
+					"first_name": "Dev",
+					"last_name":  "Eloper",
+					"enabled":    true,
+				},
+				"manager": map[string]interface{}{
+					"username":   fmt.Sprintf("manager-%s", b.ID()),
+					"email":      fmt.Sprintf("manager-%s@example.com", b.ID()),
+					"first_name": "Man",
+					"last_name":  "Ager",
+					"enabled":    true,
+				},
+			},
+			"user_group_memberships": map[string]interface{}{
+				"developer": map[string]interface{}{"user_key": "developer", "group_keys": []string{"developers"}},
+				"manager":   map[string]interface{}{"user_key": "manager", "group_keys": []string{"employees", "managers"}},
+			},
+			"user_realm_role_mappings": map[string]interface{}{
+				"developer": map[string]interface{}{"user_key": "developer", "role_keys": []string{"user"}},
+				"manager":   map[string]interface{}{"user_key": "manager", "role_keys": []string{"user", "admin"}},
+			},
+			"oidc_clients": map[string]interface{}{
+				"webapp": map[string]interface{}{
+					"client_id":     b.Name("webapp"),
+					"name":          "Groups Web App",
+					"description":   "Web application reading group claims",
+					"enabled":       true,
+					"access_type":   "CONFIDENTIAL",
+					"redirect_uris": []string{"https://groups.example.com/callback"},
+					"web_origins":   []string{"https://groups.example.com"},
 
-	roleIDs := terraform.OutputMap(t, terraformOptions, "realm_role_ids")
-	assert.NotEmpty(t, roleIDs)
-	assert.Contains(t, roleIDs, "user")
-	assert.Contains(t, roleIDs, "admin")
+					"standard_flow_enabled":        true,
+					"direct_access_grants_enabled": true,
+					"service_accounts_enabled":     true,
+				},
+			},
+			"group_membership_mappers": map[string]interface{}{
+				"groups": map[string]interface{}{
+					"client_key":          "webapp",
+					"name":                "groups",
+					"claim_name":          "groups",
+					"full_path":           true,
+					"add_to_id_token":     true,
+					"add_to_access_token": true,
+					"add_to_userinfo":     true,
+				},
+			},
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Verify the group hierarchy, the role descriptions and what each
+		// user was granted
+		testKeycloakConfiguration(t, terraformOptions)
+
+		// The tokens carry the realm roles and group paths of each user
+		testKeycloakTokens(t, terraformOptions)
+	})
 }
 
 func TestKeycloakWithIdentityProviders(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	realmName := fmt.Sprintf("test-idp-%s", uniqueID)
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/keycloak-setup",
-		Vars: map[string]interface{}{
-			"keycloak_url":      getKeycloakURLFromEnv(t),
-			"keycloak_username": getKeycloakUsernameFromEnv(t),
-			"keycloak_password": getKeycloakPasswordFromEnv(t),
-			"realm_name":        realmName,
-			"realm_display_name": fmt.Sprintf("IdP Realm %s", uniqueID),
-			"identity_providers": map[string]interface{}{
+	runStages(t, config.Keycloak, func() *terraform.Options {
+		b := KeycloakExample(t)
+		return b.Vars(map[string]interface{}{
+			"realm_name":         b.Name("idp"),
+			"realm_display_name": fmt.Sprintf("IdP Realm %s", b.ID()),
+			"oidc_identity_providers": map[string]interface{}{
 				"google": map[string]interface{}{
-					"provider_id":   "google",
-					"display_name":  "Google",
+					"alias":                         "google",
+					"display_name":                  "Google",
+					"enabled":                       true,
+					"store_token":                   false,
+					"add_read_token_role_on_create": false,
+					"trust_email":                   true,
+					"link_only":                     false,
+					"first_broker_login_flow_alias": "first broker login",
+					"authorization_url":             "https://accounts.google.com/o/oauth2/v2/auth",
+					"token_url":                     "https://oauth2.googleapis.com/token",
+					"user_info_url":                 "https://openidconnect.googleapis.com/v1/userinfo",
+					"jwks_url":                      "https://www.googleapis.com/oauth2/v3/certs",
+					"logout_url":                    nil,
+					"client_id":                     "fake-google-client-id",
+					"client_secret":                 "fake-google-client-secret",
+					"default_scopes":                "openid profile email",
+					"validate_signature":            true,
+					"use_jwks_url":                  true,
+					"pkce_enabled":                  true,
+					"extra_config":                  map[string]string{},
+				},
+			},
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Verify identity providers were created
+		idpIDs := terraform.OutputMap(t, terraformOptions, "identity_provider_ids")
+		assert.NotEmpty(t, idpIDs)
+		assert.Contains(t, idpIDs, "google")
+
+		testKeycloakConfiguration(t, terraformOptions)
+	})
+}
+
+// TestKeycloakIdentityBrokering brokers sign-in to a mockoidc provider
+// running in the test process. Keycloak redeems codes at the mock's token
+// endpoint, so a Keycloak server in Docker needs KEYCLOAK_BROKER_HOST set
+// to the name it reaches this machine at. The mock only lives as long as
+// the process that set the test up, so a validate stage run on its own
+// skips the sign-ins.
+func TestKeycloakIdentityBrokering(t *testing.T) {
+	t.Parallel()
+
+	var accounts []mockoidc.User
+	runStages(t, config.Keycloak, func() *terraform.Options {
+		b := KeycloakExample(t)
+		realmName := b.Name("broker")
+		creds := testConfig.Keycloak()
+
+		// Keycloak redeems the codes at the mock's token endpoint, so the
+		// mock serves plain http on every interface when Keycloak runs in a
+		// container. The mock only lives as long as this process.
+		opts := mockoidc.Options{
+			PlainHTTP: true,
+			Users: []mockoidc.User{
+				// Has the email of the realm user local
+				{
+					Username: "linked-" + b.ID(),
+					Password: "Upstream-" + random.UniqueId(),
+					Subject:  random.UniqueId(),
+					Email:    fmt.Sprintf("local-%s@example.com", b.ID()),
+					Claims:   map[string]interface{}{"givenName": "Upstream", "sn": "Linked"},
+				},
+				{
+					Username: "newcomer-" + b.ID(),
+					Password: "Upstream-" + random.UniqueId(),
+					Subject:  random.UniqueId(),
+					Email:    fmt.Sprintf("newcomer-%s@example.com", b.ID()),
+					Claims:   map[string]interface{}{"givenName": "New", "sn": "Comer"},
+				},
+			},
+			Clients: []mockoidc.Client{{
+				ID:           "keycloak-broker",
+				Secret:       random.UniqueId(),
+				RedirectURIs: []string{keycloakBrokerEndpoint(keycloak.RealmURL(creds.URL, realmName), "upstream")},
+			}},
+		}
+		if creds.BrokerHost != "" {
+			opts.Addr = ":0"
+		}
+		upstream := mockoidc.Start(t, opts)
+		accounts = opts.Users
+
+		return b.Vars(map[string]interface{}{
+			"realm_name":         realmName,
+			"realm_display_name": fmt.Sprintf("Brokering Realm %s", b.ID()),
+			"users": map[string]interface{}{
+				"local": map[string]interface{}{
+					"username":   fmt.Sprintf("local-%s", b.ID()),
+					"email":      fmt.Sprintf("local-%s@example.com", b.ID()),
+					"first_name": "Local",
+					"last_name":  "User",
+					"enabled":    true,
+				},
+			},
+			"oidc_clients": map[string]interface{}{
+				"webapp": map[string]interface{}{
+					"client_id":     b.Name("webapp"),
+					"name":          "Brokering Web App",
+					"description":   "Web application signing in through the upstream provider",
 					"enabled":       true,
-					"client_id":     "fake-google-client-id",
-					"client_secret": "fake-google-client-secret",
+					"access_type":   "CONFIDENTIAL",
+					"redirect_uris": []string{"https://broker.example.com/callback"},
+					"web_origins":   []string{"https://broker.example.com"},
+
+					"standard_flow_enabled":        true,
+					"direct_access_grants_enabled": false,
+					"service_accounts_enabled":     false,
 				},
 			},
-		},
-	}
+			"oidc_identity_providers": map[string]interface{}{
+				"upstream": keycloakOIDCIdentityProvider("upstream", upstream, opts.Clients[0], creds.BrokerHost),
+			},
+			// The upstream provider names users in non-standard claims
+			"oidc_identity_provider_mappers": map[string]interface{}{
+				"first-name": map[string]interface{}{
+					"identity_provider_key": "upstream",
+					"name":                  "first name",
+					"claim_name":            "givenName",
+					"user_attribute":        "firstName",
+					"sync_mode":             "IMPORT",
+				},
+				"last-name": map[string]interface{}{
+					"identity_provider_key": "upstream",
+					"name":                  "last name",
+					"claim_name":            "sn",
+					"user_attribute":        "lastName",
+					"sync_mode":             "IMPORT",
+				},
+			},
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		providers := terraform.OutputMapOfObjects(t, terraformOptions, "oidc_identity_providers")
+		assert.Contains(t, providers, "upstream")
+		testKeycloakConfiguration(t, terraformOptions)
+
+		if accounts == nil {
+			t.Skip("the upstream provider only runs in the process that sets the test up; run the setup and validate stages together")
+		}
+		testKeycloakBrokering(t, terraformOptions, accounts)
+	})
+}
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+func TestKeycloakWithSAMLIdentityProvider(t *testing.T) {
+	t.Parallel()
 
-	// Verify identity providers were created
-	idpIDs := terraform.OutputMap(t, terraformOptions, "identity_provider_ids")
-	assert.NotEmpty(t, idpIDs)
-	assert.Contains(t, idpIDs, "google")
+	runStages(t, config.Keycloak, func() *terraform.Options {
+		// Keycloak only stores the identity provider's URLs and certificate, so
+		// the mock does not have to be reachable from the Keycloak server.
+		idp := mocksaml.Start(t, mocksaml.Options{NameIDFormat: saml.NameIDFormatPersistent})
+
+		b := KeycloakExample(t)
+		return b.Vars(map[string]interface{}{
+			"realm_name":         b.Name("saml-idp"),
+			"realm_display_name": fmt.Sprintf("SAML IdP Realm %s", b.ID()),
+			"saml_identity_providers": map[string]interface{}{
+				"mock-saml": keycloakSAMLIdentityProvider("mock-saml", idp),
+			},
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		providers := terraform.OutputMapOfObjects(t, terraformOptions, "saml_identity_providers")
+		assert.Contains(t, providers, "mock-saml")
+		testKeycloakConfiguration(t, terraformOptions)
+
+		// The broker's service provider metadata must name the assertion
+		// consumer service testKeycloakSAMLIdentityProvider posts to.
+		realmURL := terraform.Output(t, terraformOptions, "issuer")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		metadata, err := saml.Fetch(ctx, liveHTTPClient(), realmURL+"/broker/mock-saml/endpoint/descriptor")
+		require.NoError(t, err)
+		require.NotEmpty(t, metadata.SPSSODescriptors)
+		var acsURLs []string
+		for _, acs := range metadata.SPSSODescriptors[0].AssertionConsumerServices {
+			acsURLs = append(acsURLs, acs.Location)
+		}
+		assert.Contains(t, acsURLs, keycloakBrokerEndpoint(realmURL, "mock-saml"))
+	})
 }
 
 func testKeycloakOutputs(t *testing.T, terraformOptions *terraform.Options) {
@@ -242,12 +441,15 @@ func testKeycloakOutputs(t *testing.T, terraformOptions *terraform.Options) {
 	jwksURI := terraform.Output(t, terraformOptions, "jwks_uri")
 	issuer := terraform.Output(t, terraformOptions, "issuer")
 
-	assert.Contains(t, oidcConfigURL, "/.well-known/openid_configuration")
+	assert.Contains(t, oidcConfigURL, "/.well-known/openid-configuration")
 	assert.Contains(t, tokenEndpoint, "/token")
 	assert.Contains(t, authEndpoint, "/auth")
 	assert.Contains(t, userinfoEndpoint, "/userinfo")
 	assert.Contains(t, jwksURI, "/certs")
 	assert.Contains(t, issuer, realmName)
+
+	// The jwks_uri output must serve the realm keys
+	validateJWKS(t, liveHTTPClient(), jwksURI)
 }
 
 func testKeycloakRealm(t *testing.T, terraformOptions *terraform.Options) {
@@ -273,70 +475,466 @@ func testKeycloakRealm(t *testing.T, terraformOptions *terraform.Options) {
 	assert.Equal(t, true, realmInfo["enabled"])
 }
 
-func testKeycloakOIDCEndpoints(t *testing.T, terraformOptions *terraform.Options) {
-	// Test OpenID Connect configuration endpoint
-	oidcConfigURL := terraform.Output(t, terraformOptions, "openid_configuration_url")
-	
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(oidcConfigURL)
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	defer resp.Body.Close()
+func testKeycloakSAMLDescriptor(t *testing.T, client *http.Client, descriptorURL, issuer string) {
+	// Keycloak uses the realm URL as the entity ID and serves every SAML
+	// binding from a single protocol endpoint.
+	metadata := validateSAMLMetadata(t, client, descriptorURL, saml.Options{
+		EntityID:          issuer,
+		SSOURL:            issuer + "/protocol/saml",
+		NameIDFormat:      saml.NameIDFormatPersistent,
+		AllowLoopbackHTTP: true,
+	})
+	idp := metadata.IDPSSODescriptor()
+	require.NotNil(t, idp)
+	assert.NotEmpty(t, idp.SingleLogoutServices)
+}
 
-	// Parse OpenID configuration
-	var oidcConfig map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&oidcConfig)
-	assert.NoError(t, err)
+// keycloakSAMLIdentityProvider returns a saml_identity_providers entry that
+// brokers sign-in to idp.
+func keycloakSAMLIdentityProvider(alias string, idp *mocksaml.IdP) map[string]interface{} {
+	return map[string]interface{}{
+		"alias":                         alias,
+		"display_name":                  "Mock SAML",
+		"enabled":                       true,
+		"store_token":                   false,
+		"add_read_token_role_on_create": false,
+		"trust_email":                   true,
+		"link_only":                     false,
+		"first_broker_login_flow_alias": "first broker login",
+		"single_sign_on_service_url":    idp.SSOURL(),
+		"single_logout_service_url":     idp.SLOURL(),
+		"backchannel_supported":         false,
+		"name_id_policy_format":         "Persistent",
+		"post_binding_response":         true,
+		"post_binding_authn_request":    false,
+		"post_binding_logout":           false,
+		"want_assertions_signed":        true,
+		"want_assertions_encrypted":     false,
+		"force_authn":                   false,
+		"validate_signature":            true,
+		"signing_certificate":           idp.Certificate(),
+		"signature_algorithm":           "RSA_SHA256",
+		"extra_config":                  map[string]string{},
+	}
+}
+
+// keycloakBrokerEndpoint is where a brokered identity provider posts its
+// responses.
+func keycloakBrokerEndpoint(realmURL, alias string) string {
+	return realmURL + "/broker/" + alias + "/endpoint"
+}
+
+// keycloakOIDCIdentityProvider returns an oidc_identity_providers entry that
+// brokers sign-in to the client of p. Keycloak calls the back-channel
+// endpoints at brokerHost, while the browser follows the authorization
+// endpoint to the loopback address.
+func keycloakOIDCIdentityProvider(alias string, p *mockoidc.Provider, client mockoidc.Client, brokerHost string) map[string]interface{} {
+	backChannel := p.EndpointsAt(brokerHost)
+	return map[string]interface{}{
+		"alias":                         alias,
+		"display_name":                  "Mock OIDC",
+		"enabled":                       true,
+		"store_token":                   false,
+		"add_read_token_role_on_create": false,
+		"trust_email":                   false,
+		"link_only":                     false,
+		"first_broker_login_flow_alias": "first broker login",
+		"authorization_url":             p.Endpoints().Authorization,
+		"token_url":                     backChannel.Token,
+		"user_info_url":                 backChannel.UserInfo,
+		"jwks_url":                      backChannel.JWKS,
+		"logout_url":                    nil,
+		"client_id":                     client.ID,
+		"client_secret":                 client.Secret,
+		"default_scopes":                "openid profile email",
+		"validate_signature":            true,
+		"use_jwks_url":                  true,
+		"pkce_enabled":                  true,
+		"extra_config":                  map[string]string{},
+	}
+}
+
+// testKeycloakBrokering signs each of accounts in to the first client of
+// the realm with the standard flow, through the first identity provider
+// of oidc_identity_providers, which brokers sign-in to upstream. An
+// account whose email belongs to a user of the realm is linked to that
+// user on its first broker login, after signing in to the realm again;
+// the others get a new realm user the attribute importer mappers fill in
+// from their claims. Either way the realm user ends up with a federated
+// identity naming the upstream account.
+func testKeycloakBrokering(t *testing.T, terraformOptions *terraform.Options, accounts []mockoidc.User) {
+	want := expectedKeycloakConfig(t, terraformOptions)
+	issuer := terraform.Output(t, terraformOptions, "issuer")
+	secrets := terraform.OutputMap(t, terraformOptions, "client_secrets")
+	keys := validateJWKS(t, liveHTTPClient(), terraform.Output(t, terraformOptions, "jwks_uri"))
+
+	var alias string
+	for _, idp := range want.OIDCIdentityProviders {
+		alias = idp.Alias
+	}
+	require.NotEmpty(t, alias, "oidc_identity_providers")
+	var flow *keycloak.Flow
+	for key, client := range want.OIDCClients {
+		if client.Enabled && client.StandardFlowEnabled && len(client.RedirectURIs) > 0 {
+			flow = keycloak.NewFlow(issuer, client.ClientID, secrets[key], client.RedirectURIs[0])
+			flow.HTTP = liveHTTPClient()
+			break
+		}
+	}
+	require.NotNil(t, flow, "no client allows the standard flow")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	admin := keycloak.New(ctx, testConfig.Keycloak(), "")
+	passwords := setKeycloakPasswords(ctx, t, want)
+	local := map[string]string{}
+	for key, u := range want.Users {
+		local[strings.ToLower(u.Email)] = key
+	}
 
-	// Verify required OIDC endpoints
-	assert.Contains(t, oidcConfig, "issuer")
-	assert.Contains(t, oidcConfig, "authorization_endpoint")
-	assert.Contains(t, oidcConfig, "token_endpoint")
-	assert.Contains(t, oidcConfig, "userinfo_endpoint")
-	assert.Contains(t, oidcConfig, "jwks_uri")
-	assert.Contains(t, oidcConfig, "end_session_endpoint")
-
-	// Verify supported scopes
-	scopesSupported, ok := oidcConfig["scopes_supported"].([]interface{})
-	assert.True(t, ok)
-	assert.Contains(t, scopesSupported, "openid")
-	assert.Contains(t, scopesSupported, "profile")
-	assert.Contains(t, scopesSupported, "email")
-
-	// Verify supported response types
-	responseTypes, ok := oidcConfig["response_types_supported"].([]interface{})
-	assert.True(t, ok)
-	assert.Contains(t, responseTypes, "code")
+	for _, account := range accounts {
+		steps := []keycloak.Step{keycloak.SignIn(account.Username, account.Password), keycloak.ReviewProfile()}
+		username := account.Username
+		userKey, linked := local[strings.ToLower(account.Email)]
+		if linked {
+			username = want.Users[userKey].Username
+			steps = append(steps, keycloak.LinkAccount(), keycloak.SignIn(username, passwords[userKey]))
+		}
+		tokens, err := flow.Broker(ctx, alias, steps...)
+		if !assert.NoError(t, err, "brokered sign-in of %s", account.Username) {
+			continue
+		}
+		id, err := keycloak.VerifyToken(keys, tokens.IDToken, issuer, keycloak.TypeID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tokens.Nonce, id.Nonce)
+			assert.Equal(t, strings.ToLower(username), id.PreferredUsername)
+			assert.Equal(t, strings.ToLower(account.Email), id.Email)
+		}
+
+		user, err := admin.FindUser(ctx, want.RealmName, username)
+		require.NoError(t, err)
+		require.NotNil(t, user, "user %s", username)
+		assert.Equal(t, strings.ToLower(account.Email), user.Email)
+		for key, m := range want.OIDCIdentityProviderMappers {
+			// Linked users keep their attributes unless the mapper
+			// overwrites them on every sign-in
+			if linked && m.SyncMode != "FORCE" {
+				continue
+			}
+			assert.Equal(t, account.Claims[m.ClaimName], keycloakUserAttribute(user, m.UserAttribute), "oidc_identity_provider_mappers[%s]", key)
+		}
+		if linked {
+			assert.Equal(t, want.Users[userKey].FirstName, user.FirstName)
+			assert.Equal(t, want.Users[userKey].LastName, user.LastName)
+		}
+
+		links, err := admin.FederatedIdentities(ctx, want.RealmName, user.ID)
+		require.NoError(t, err)
+		if assert.Len(t, links, 1, "federated identities of %s", username) {
+			assert.Equal(t, alias, links[0].IdentityProvider)
+			assert.Equal(t, account.Subject, links[0].UserID)
+			assert.True(t, strings.EqualFold(account.Username, links[0].UserName), "federated username %s, want %s", links[0].UserName, account.Username)
+		}
+	}
+}
+
+// keycloakUserAttribute returns the value of a user attribute, built-in or
+// custom.
+func keycloakUserAttribute(user *keycloak.User, name string) interface{} {
+	switch name {
+	case "username":
+		return user.Username
+	case "email":
+		return user.Email
+	case "firstName":
+		return user.FirstName
+	case "lastName":
+		return user.LastName
+	}
+	if values := user.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// testKeycloakSAMLIdentityProvider signs in through a saml_identity_providers
+// entry the way the realm's broker does and checks the signed assertion
+// against the entry's signature and NameID settings.
+func testKeycloakSAMLIdentityProvider(t *testing.T, client *http.Client, realmURL string, provider map[string]interface{}) *saml.Assertion {
+	require.True(t, provider["validate_signature"].(bool), "validate_signature must be enabled")
+	require.True(t, provider["post_binding_response"].(bool), "the mock identity provider only answers with HTTP-POST")
+
+	cert, err := saml.ParseCertificate(provider["signing_certificate"].(string))
+	require.NoError(t, err)
+	format, ok := keycloak.NameIDFormats[provider["name_id_policy_format"].(string)]
+	require.True(t, ok, "unknown name_id_policy_format %q", provider["name_id_policy_format"])
+
+	return testSAMLSignIn(t, client, samlServiceProvider{
+		EntityID:             realmURL,
+		ACSURL:               keycloakBrokerEndpoint(realmURL, provider["alias"].(string)),
+		SSOURL:               provider["single_sign_on_service_url"].(string),
+		Certificates:         []*x509.Certificate{cert},
+		NameIDFormat:         format,
+		WantAssertionsSigned: provider["want_assertions_signed"].(bool),
+	})
+}
+
+// testKeycloakConfiguration compares the realm's clients, groups, roles,
+// users and identity providers, as the Admin REST API reports them, with
+// the inputs the test applied.
+func testKeycloakConfiguration(t *testing.T, terraformOptions *terraform.Options) {
+	want := expectedKeycloakConfig(t, terraformOptions)
+
+	client := keycloak.New(context.Background(), testConfig.Keycloak(), "")
+	waitMatches(t, "keycloak configuration", func(ctx context.Context) ([]string, error) {
+		got, err := client.Inspect(ctx, want.RealmName, want)
+		if err != nil {
+			return nil, err
+		}
+		return got.Diff(want), nil
+	})
 }
 
-func testKeycloakClients(t *testing.T, terraformOptions *terraform.Options) {
+// testKeycloakTokens signs the users of the realm in to each enabled client
+// with the flows the client allows, the authorization code flow through
+// the login page and the password flow, and gets a service account token
+// with client credentials. It checks the issuer, audience and authorized
+// party of every token, the realm roles mapped to each user and the
+// groups claims of the clients with a group membership mapper. The module
+// creates users without credentials, so each gets a password first.
+func testKeycloakTokens(t *testing.T, terraformOptions *terraform.Options) {
+	want := expectedKeycloakConfig(t, terraformOptions)
+	issuer := terraform.Output(t, terraformOptions, "issuer")
 	clientIDs := terraform.OutputMap(t, terraformOptions, "client_ids")
-	assert.NotEmpty(t, clientIDs)
+	secrets := terraform.OutputMap(t, terraformOptions, "client_secrets")
+	keys := validateJWKS(t, liveHTTPClient(), terraform.Output(t, terraformOptions, "jwks_uri"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	passwords := setKeycloakPasswords(ctx, t, want)
+
+	for key, client := range want.OIDCClients {
+		if !client.Enabled {
+			continue
+		}
+		require.Equal(t, client.ClientID, clientIDs[key], "client_ids[%s]", key)
+		secret := secrets[key]
+		if client.AccessType == "CONFIDENTIAL" {
+			require.NotEmpty(t, secret, "client_secrets[%s]", key)
+		}
+		redirectURI := ""
+		if len(client.RedirectURIs) > 0 {
+			redirectURI = client.RedirectURIs[0]
+		}
+		flow := keycloak.NewFlow(issuer, client.ClientID, secret, redirectURI)
+		flow.HTTP = liveHTTPClient()
+
+		for userKey, password := range passwords {
+			username := want.Users[userKey].Username
+			if client.StandardFlowEnabled && redirectURI != "" {
+				tokens, err := flow.AuthorizationCode(ctx, username, password)
+				if assert.NoError(t, err, "authorization code flow of %s", key) {
+					testKeycloakUserTokens(t, want, keys, issuer, key, userKey, tokens)
+				}
+			}
+			if client.DirectAccessGrantsEnabled {
+				tokens, err := flow.Password(ctx, username, password)
+				if assert.NoError(t, err, "password flow of %s", key) {
+					testKeycloakUserTokens(t, want, keys, issuer, key, userKey, tokens)
+				}
+			}
+		}
+
+		if client.ServiceAccountsEnabled {
+			tokens, err := flow.ClientCredentials(ctx)
+			if assert.NoError(t, err, "client credentials of %s", key) {
+				assert.Empty(t, tokens.IDToken)
+				access, err := keycloak.VerifyToken(keys, tokens.AccessToken, issuer, keycloak.TypeAccess)
+				if assert.NoError(t, err) {
+					assert.Equal(t, client.ClientID, access.AuthorizedParty)
+					assert.Equal(t, "service-account-"+strings.ToLower(client.ClientID), access.PreferredUsername)
+				}
+			}
+		}
+	}
+}
 
-	// Verify client secrets are available
-	clientSecrets := terraform.OutputMap(t, terraformOptions, "client_secrets")
-	assert.NotEmpty(t, clientSecrets)
+// keycloakSignIn returns a token source that signs an enabled user of the
+// realm in to the first enabled client allowing the password flow. The
+// passwords are set up front. It returns nil when no client allows the
+// flow.
+func keycloakSignIn(t *testing.T, terraformOptions *terraform.Options) oidcTokenSource {
+	want := expectedKeycloakConfig(t, terraformOptions)
+	var clientKey string
+	for key, client := range want.OIDCClients {
+		if client.Enabled && client.DirectAccessGrantsEnabled && (clientKey == "" || key < clientKey) {
+			clientKey = key
+		}
+	}
+	if clientKey == "" {
+		return nil
+	}
 
-	// Each client should have a corresponding secret
-	for clientKey := range clientIDs {
-		assert.Contains(t, clientSecrets, clientKey)
-		assert.NotEmpty(t, clientSecrets[clientKey])
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	clientID := want.OIDCClients[clientKey].ClientID
+	flow := keycloak.NewFlow(terraform.Output(t, terraformOptions, "issuer"), clientID,
+		terraform.OutputMap(t, terraformOptions, "client_secrets")[clientKey], "")
+	flow.HTTP = liveHTTPClient()
+	for userKey, password := range setKeycloakPasswords(ctx, t, want) {
+		username := want.Users[userKey].Username
+		return func(ctx context.Context) (*oidcTokens, error) {
+			tokens, err := flow.Password(ctx, username, password)
+			if err != nil {
+				return nil, err
+			}
+			return &oidcTokens{ClientID: clientID, IDToken: tokens.IDToken, AccessToken: tokens.AccessToken}, nil
+		}
 	}
+	return nil
+}
+
+// setKeycloakPasswords gives each enabled user of want a new password
+// through the Admin REST API and returns the passwords by user key.
+func setKeycloakPasswords(ctx context.Context, t *testing.T, want keycloak.Config) map[string]string {
+	t.Helper()
+
+	admin := keycloak.New(ctx, testConfig.Keycloak(), "")
+	passwords := map[string]string{}
+	for key, u := range want.Users {
+		if !u.Enabled {
+			continue
+		}
+		user, err := admin.FindUser(ctx, want.RealmName, u.Username)
+		require.NoError(t, err)
+		require.NotNil(t, user, "user %s", u.Username)
+		password := "Pw-" + random.UniqueId() + "-1a"
+		require.NoError(t, admin.SetPassword(ctx, want.RealmName, user.ID, password))
+		passwords[key] = password
+	}
+	return passwords
+}
+
+// testKeycloakUserTokens checks the ID and access tokens userKey got from
+// the client clientKey.
+func testKeycloakUserTokens(t *testing.T, want keycloak.Config, keys *oidc.JWKS, issuer, clientKey, userKey string, tokens *keycloak.Tokens) {
+	t.Helper()
+	clientID := want.OIDCClients[clientKey].ClientID
+
+	id, err := keycloak.VerifyToken(keys, tokens.IDToken, issuer, keycloak.TypeID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{clientID}, []string(id.Audience))
+	assert.Equal(t, clientID, id.AuthorizedParty)
+	assert.Equal(t, tokens.Nonce, id.Nonce)
+	assert.Equal(t, strings.ToLower(want.Users[userKey].Username), id.PreferredUsername)
+
+	access, err := keycloak.VerifyToken(keys, tokens.AccessToken, issuer, keycloak.TypeAccess)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, clientID, access.AuthorizedParty)
+	// The default roles grant the account client's roles
+	assert.Contains(t, []string(access.Audience), "account")
+
+	mapped := map[string]bool{}
+	for _, m := range want.UserRealmRoleMappings {
+		if m.UserKey == userKey {
+			for _, role := range m.RoleKeys {
+				mapped[role] = true
+			}
+		}
+	}
+	for roleKey, role := range want.RealmRoles {
+		if mapped[roleKey] {
+			assert.Contains(t, access.RealmAccess.Roles, role.Name, "realm roles of %s", userKey)
+		} else {
+			assert.NotContains(t, access.RealmAccess.Roles, role.Name, "realm roles of %s", userKey)
+		}
+	}
+
+	for _, mapper := range want.GroupMembershipMappers {
+		if mapper.ClientKey != clientKey {
+			continue
+		}
+		var groups []string
+		for _, m := range want.UserGroupMemberships {
+			if m.UserKey != userKey {
+				continue
+			}
+			for _, groupKey := range m.GroupKeys {
+				if mapper.FullPath {
+					groups = append(groups, want.Groups[groupKey].Path)
+				} else {
+					groups = append(groups, want.Groups[groupKey].Name)
+				}
+			}
+		}
+		if mapper.AddToIDToken {
+			assert.ElementsMatch(t, groups, id.Strings(mapper.ClaimName), "%s claim of the ID token of %s", mapper.ClaimName, userKey)
+		}
+		if mapper.AddToAccessToken {
+			assert.ElementsMatch(t, groups, access.Strings(mapper.ClaimName), "%s claim of the access token of %s", mapper.ClaimName, userKey)
+		}
+	}
+}
+
+// expectedKeycloakConfig returns the realm configuration the inputs of
+// terraformOptions ask for.
+func expectedKeycloakConfig(t *testing.T, terraformOptions *terraform.Options) keycloak.Config {
+	t.Helper()
+
+	var want keycloak.Config
+	decodeInputs(t, terraformOptions, "modules/keycloak", &want)
+	return want
+}
+
+func TestUnitExpectedKeycloakConfig(t *testing.T) {
+	t.Parallel()
+
+	example := newOptionsBuilder(config.Keycloak, "../examples/keycloak-setup").Vars(map[string]interface{}{
+		"realm_name": "terratest-groups-abc123",
+		"groups": map[string]interface{}{
+			"developers": map[string]interface{}{"name": "Developers", "path": "/Employees/Developers"},
+		},
+		"user_group_memberships": map[string]interface{}{
+			"testuser": map[string]interface{}{"user_key": "testuser", "group_keys": []string{"developers"}},
+		},
+	}).Build()
+	want := expectedKeycloakConfig(t, example)
+	assert.Equal(t, "terratest-groups-abc123", want.RealmName)
+	assert.Equal(t, "Example Realm", want.RealmDisplayName)
+	assert.True(t, want.RealmEnabled)
+	assert.Equal(t, []string{"https://example.com/auth/callback", "https://localhost:3000/auth/callback"}, want.OIDCClients["webapp"].RedirectURIs)
+	assert.Equal(t, []string{"https://example.com", "https://localhost:3000"}, want.OIDCClients["webapp"].WebOrigins)
+	assert.Equal(t, "CONFIDENTIAL", want.OIDCClients["webapp"].AccessType)
+	assert.True(t, want.OIDCClients["webapp"].StandardFlowEnabled)
+	assert.False(t, want.OIDCClients["webapp"].DirectAccessGrantsEnabled)
+	assert.Equal(t, "Administrator role", want.RealmRoles["admin"].Description)
+	assert.Equal(t, "testuser", want.Users["testuser"].Username)
+	assert.Equal(t, map[string]keycloak.GroupInput{
+		"developers": {Name: "Developers", Path: "/Employees/Developers"},
+	}, want.Groups)
+	assert.Equal(t, []string{"developers"}, want.UserGroupMemberships["testuser"].GroupKeys)
+	assert.Empty(t, want.UserRealmRoleMappings)
+	assert.Empty(t, want.GroupMembershipMappers)
+	assert.Empty(t, want.OIDCIdentityProviders)
+	assert.Empty(t, want.OIDCIdentityProviderMappers)
 }
 
 func TestKeycloakValidation(t *testing.T) {
 	t.Parallel()
+	skipUnlessTerraform(t, config.Keycloak)
 
 	// Test with invalid Keycloak URL
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/keycloak-setup",
-		Vars: map[string]interface{}{
-			"keycloak_url":      "invalid-url",
-			"keycloak_username": "admin",
-			"keycloak_password": "admin",
-			"realm_name":        "test-validation",
-		},
-	}
+	b := newOptionsBuilder(config.Keycloak, "../examples/keycloak-setup")
+	terraformOptions := b.Vars(map[string]interface{}{
+		"keycloak_url":      "invalid-url",
+		"keycloak_username": "admin",
+		"keycloak_password": "admin",
+		"realm_name":        b.Name("realm"),
+	}).Build()
 
 	// This should fail during apply due to invalid URL
 	_, err := terraform.InitAndPlanE(t, terraformOptions)
@@ -350,31 +948,21 @@ func TestKeycloakValidation(t *testing.T) {
 func TestKeycloakMinimalConfig(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	realmName := fmt.Sprintf("test-minimal-%s", uniqueID)
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/keycloak-setup",
-		Vars: map[string]interface{}{
-			"keycloak_url":      getKeycloakURLFromEnv(t),
-			"keycloak_username": getKeycloakUsernameFromEnv(t),
-			"keycloak_password": getKeycloakPasswordFromEnv(t),
-			"realm_name":        realmName,
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Verify minimal configuration works
-	realmID := terraform.Output(t, terraformOptions, "realm_id")
-	assert.NotEmpty(t, realmID)
+	runStages(t, config.Keycloak, func() *terraform.Options {
+		b := KeycloakExample(t)
+		return b.Var("realm_name", b.Name("minimal")).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Verify minimal configuration works
+		realmID := terraform.Output(t, terraformOptions, "realm_id")
+		assert.NotEmpty(t, realmID)
+		testKeycloakConfiguration(t, terraformOptions)
+	})
 }
 
 func TestKeycloakHealthCheck(t *testing.T) {
 	t.Parallel()
 
-	keycloakURL := getKeycloakURLFromEnv(t)
+	keycloakURL := testConfig.Keycloak().URL
 	
 	// Test Keycloak health endpoint
 	healthURL := fmt.Sprintf("%s/health", keycloakURL)
@@ -393,16 +981,16 @@ func TestKeycloakHealthCheck(t *testing.T) {
 
 // Helper functions
 func getKeycloakURLFromEnv(t *testing.T) string {
-	url := getEnvVar(t, "KEYCLOAK_URL", "http://localhost:8080")
-	return url
+	skipUnlessConfigured(t, config.Keycloak)
+	return testConfig.Keycloak().URL
 }
 
 func getKeycloakUsernameFromEnv(t *testing.T) string {
-	username := getEnvVar(t, "KEYCLOAK_USERNAME", "admin")
-	return username
+	skipUnlessConfigured(t, config.Keycloak)
+	return testConfig.Keycloak().Username
 }
 
 func getKeycloakPasswordFromEnv(t *testing.T) string {
-	password := getEnvVar(t, "KEYCLOAK_PASSWORD", "admin")
-	return password
-} 
\ No newline at end of file
+	skipUnlessConfigured(t, config.Keycloak)
+	return testConfig.Keycloak().Password
+}
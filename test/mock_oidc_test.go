@@ -0,0 +1,74 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/idp"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mockoidc"
+)
+
+// The conformance suite normally runs against the identity provider
+// terraform outputs describe after a deployment. This test points it at
+// an in-process provider of each flavor, held to the profile of the
+// service it mimics, so it also runs without credentials or network
+// access.
+
+func TestUnitOIDCConformance(t *testing.T) {
+	t.Parallel()
+
+	for flavor, provider := range map[mockoidc.Flavor]config.Provider{
+		mockoidc.Cognito:  config.AWS,
+		mockoidc.AzureAD:  config.Azure,
+		mockoidc.Keycloak: config.Keycloak,
+		mockoidc.Okta:     config.Okta,
+	} {
+		flavor, provider := flavor, provider
+		t.Run(string(flavor), func(t *testing.T) {
+			t.Parallel()
+
+			mock := mockoidc.Start(t, mockoidc.Options{Flavor: flavor})
+			p := mockIdentityProvider{mock: mock, provider: provider}
+			testOIDCConformance(t, mock.HTTPClient(), p, func(ctx context.Context) (*oidcTokens, error) {
+				conf := &oauth2.Config{
+					ClientID:     "conformance",
+					ClientSecret: "secret",
+					Scopes:       []string{"openid", "profile", "email"},
+					Endpoint:     oauth2.Endpoint{TokenURL: mock.Endpoints().Token, AuthStyle: oauth2.AuthStyleInParams},
+				}
+				tok, err := conf.PasswordCredentialsToken(context.WithValue(ctx, oauth2.HTTPClient, mock.HTTPClient()), "testuser", "password")
+				if err != nil {
+					return nil, err
+				}
+				id, _ := tok.Extra("id_token").(string)
+				return &oidcTokens{ClientID: conf.ClientID, IDToken: id, AccessToken: tok.AccessToken}, nil
+			})
+
+			if oidcProfiles[provider].EndSession {
+				user, _ := mock.User("testuser")
+				assert.Equal(t, []string{user.Subject}, mock.Logouts())
+			}
+		})
+	}
+}
+
+// mockIdentityProvider describes a mock provider the way the outputs of
+// a deployment of provider would.
+type mockIdentityProvider struct {
+	mock     *mockoidc.Provider
+	provider config.Provider
+}
+
+func (m mockIdentityProvider) Provider() config.Provider     { return m.provider }
+func (m mockIdentityProvider) Issuer() string                { return m.mock.Issuer() }
+func (m mockIdentityProvider) DiscoveryURL() string          { return m.mock.DiscoveryURL() }
+func (m mockIdentityProvider) AuthorizationEndpoint() string { return m.mock.Endpoints().Authorization }
+func (m mockIdentityProvider) TokenEndpoint() string         { return m.mock.Endpoints().Token }
+func (m mockIdentityProvider) UserInfoEndpoint() string      { return m.mock.Endpoints().UserInfo }
+func (m mockIdentityProvider) JWKSURI() string               { return m.mock.Endpoints().JWKS }
+func (m mockIdentityProvider) SAMLMetadataURL() string       { return "" }
+func (m mockIdentityProvider) Clients() []idp.Client         { return nil }
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/keycloak"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mocksaml"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+)
+
+// These tests sign in through the SAML settings the suites pass to the
+// modules, with an in-process identity provider standing in for the real
+// one, so a mapping that names an attribute the assertion never carries
+// fails without a deployment.
+
+func TestUnitCognitoSAMLProvider(t *testing.T) {
+	t.Parallel()
+
+	idp := mocksaml.Start(t, mocksaml.Options{
+		Attributes: mocksaml.AttributesFromMapping(cognitoSAMLAttributeMapping),
+		AutoLogin:  "testuser",
+	})
+	provider := cognitoSAMLProvider("MockSAML", idp.MetadataURL(), idp.SSOURL(), idp.SLOURL())
+	testCognitoSAMLProvider(t, idp.HTTPClient(), provider,
+		"us-east-1_TestPool1", "test-domain.auth.us-east-1.amazoncognito.com")
+}
+
+func TestUnitOktaSAMLAttributeStatements(t *testing.T) {
+	t.Parallel()
+
+	for name, statements := range map[string][]map[string]interface{}{
+		"profile": oktaProfileAttributeStatements,
+		"roles":   oktaRoleAttributeStatements,
+	} {
+		name, statements := name, statements
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			attributes, err := mocksaml.AttributesFromStatements(statements)
+			require.NoError(t, err)
+			idp := mocksaml.Start(t, mocksaml.Options{Attributes: attributes, AutoLogin: "admin"})
+			idp.AddUser(mocksaml.User{
+				Username:  "admin",
+				Email:     "admin@example.com",
+				FirstName: "Ada",
+				LastName:  "Admin",
+				Groups:    []string{"Administrators"},
+			})
+
+			assertion := testOktaSAMLAssertion(t, idp.HTTPClient(), samlServiceProvider{
+				EntityID:             "https://test.example.com",
+				ACSURL:               "https://test.example.com/saml/acs",
+				SSOURL:               idp.SSOURL(),
+				Certificates:         []*x509.Certificate{idp.Key().Certificate},
+				WantAssertionsSigned: true,
+			}, statements)
+			assert.Equal(t, []string{"admin@example.com"}, assertion.Attribute("email"))
+			if name == "roles" {
+				assert.Equal(t, []string{"admin"}, assertion.Attribute("roles"))
+			}
+		})
+	}
+}
+
+func TestUnitKeycloakSAMLIdentityProvider(t *testing.T) {
+	t.Parallel()
+
+	idp := mocksaml.Start(t, mocksaml.Options{NameIDFormat: saml.NameIDFormatPersistent, AutoLogin: "testuser"})
+	provider := keycloakSAMLIdentityProvider("mock-saml", idp)
+
+	validateSAMLMetadata(t, idp.HTTPClient(), idp.MetadataURL(), saml.Options{
+		SSOURL:             provider["single_sign_on_service_url"].(string),
+		NameIDFormat:       keycloak.NameIDFormats[provider["name_id_policy_format"].(string)],
+		Certificate:        provider["signing_certificate"].(string),
+		SignatureAlgorithm: provider["signature_algorithm"].(string),
+	})
+	assertion := testKeycloakSAMLIdentityProvider(t, idp.HTTPClient(), "https://keycloak.example.com/realms/test-realm", provider)
+	assert.Equal(t, saml.NameIDFormatPersistent, assertion.Subject.NameID.Format)
+}
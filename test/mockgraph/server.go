@@ -0,0 +1,258 @@
+// Package mockgraph is an in-process stand-in for Microsoft Graph and the
+// Azure AD token endpoint, for offline tests of the graph package and the
+// Azure AD checks built on it. It serves the applications, service
+// principals and app role assignments it is seeded with, pages
+// collections, answers with Graph error documents and can report new
+// objects missing for a while the way Azure AD replication does.
+package mockgraph
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/graph"
+)
+
+// Options configures a Server.
+type Options struct {
+	// Tenant is the tenant ID of the token endpoint, "tenant-id" by
+	// default.
+	Tenant string
+	// ClientID and ClientSecret are the credentials the token endpoint
+	// accepts, "client-id" and "client-secret" by default.
+	ClientID     string
+	ClientSecret string
+	// PageSize is the number of app role assignments per page, 100 by
+	// default.
+	PageSize int
+	// Lag is the number of reads for which every seeded object is reported
+	// missing before it is served.
+	Lag int
+}
+
+// Server is a running stand-in.
+type Server struct {
+	*httptest.Server
+
+	opts  Options
+	token string
+
+	mu          sync.Mutex
+	apps        map[string]graph.Application
+	sps         map[string]graph.ServicePrincipal
+	assignments map[string][]graph.AppRoleAssignment
+	reads       map[string]int
+}
+
+// Start starts a stand-in and closes it when the test finishes.
+func Start(t testing.TB, opts Options) *Server {
+	t.Helper()
+	if opts.Tenant == "" {
+		opts.Tenant = "tenant-id"
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = "client-id"
+	}
+	if opts.ClientSecret == "" {
+		opts.ClientSecret = "client-secret"
+	}
+	if opts.PageSize == 0 {
+		opts.PageSize = 100
+	}
+	s := &Server{
+		opts:        opts,
+		token:       randomID(),
+		apps:        map[string]graph.Application{},
+		sps:         map[string]graph.ServicePrincipal{},
+		assignments: map[string][]graph.AppRoleAssignment{},
+		reads:       map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Credentials returns the credentials the token endpoint accepts.
+func (s *Server) Credentials() config.AzureCredentials {
+	return config.AzureCredentials{
+		TenantID:     s.opts.Tenant,
+		ClientID:     s.opts.ClientID,
+		ClientSecret: s.opts.ClientSecret,
+	}
+}
+
+// AddApplication registers app and a service principal for it, and
+// returns both. Empty object and client IDs are generated.
+func (s *Server) AddApplication(app graph.Application, sp graph.ServicePrincipal) (graph.Application, graph.ServicePrincipal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if app.ID == "" {
+		app.ID = randomUUID()
+	}
+	if app.AppID == "" {
+		app.AppID = randomUUID()
+	}
+	if sp.ID == "" {
+		sp.ID = randomUUID()
+	}
+	sp.AppID = app.AppID
+	if sp.DisplayName == "" {
+		sp.DisplayName = app.DisplayName
+	}
+	s.apps[app.AppID] = app
+	s.sps[app.AppID] = sp
+	return app, sp
+}
+
+// AddAppRoleAssignment assigns an app role of the service principal
+// a.ResourceID and returns the assignment. An empty ID is generated.
+func (s *Server) AddAppRoleAssignment(a graph.AppRoleAssignment) graph.AppRoleAssignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.ID == "" {
+		a.ID = randomID()
+	}
+	s.assignments[a.ResourceID] = append(s.assignments[a.ResourceID], a)
+	return a
+}
+
+var (
+	tokenPath       = regexp.MustCompile(`^/([^/]+)/oauth2/v2\.0/token$`)
+	applicationPath = regexp.MustCompile(`^/v1\.0/applications\(appId='([^']+)'\)$`)
+	principalPath   = regexp.MustCompile(`^/v1\.0/servicePrincipals\(appId='([^']+)'\)$`)
+	assignedToPath  = regexp.MustCompile(`^/v1\.0/servicePrincipals/([^/]+)/appRoleAssignedTo$`)
+)
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if m := tokenPath.FindStringSubmatch(r.URL.Path); m != nil {
+		s.issueToken(w, r, m[1])
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		writeError(w, http.StatusUnauthorized, "InvalidAuthenticationToken", "Access token is empty or invalid.")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Request_BadRequest", "The stand-in is read-only.")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case applicationPath.MatchString(r.URL.Path):
+		appID := applicationPath.FindStringSubmatch(r.URL.Path)[1]
+		app, ok := s.apps[appID]
+		s.serveObject(w, r, ok, app)
+	case principalPath.MatchString(r.URL.Path):
+		appID := principalPath.FindStringSubmatch(r.URL.Path)[1]
+		sp, ok := s.sps[appID]
+		s.serveObject(w, r, ok, sp)
+	case assignedToPath.MatchString(r.URL.Path):
+		s.serveAssignments(w, r, assignedToPath.FindStringSubmatch(r.URL.Path)[1])
+	default:
+		writeError(w, http.StatusBadRequest, "BadRequest", "Unsupported request: "+r.URL.Path)
+	}
+}
+
+func (s *Server) issueToken(w http.ResponseWriter, r *http.Request, tenant string) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	switch {
+	case tenant != s.opts.Tenant:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request", "error_description": "AADSTS90002: Tenant not found."})
+	case r.PostFormValue("grant_type") != "client_credentials":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+	case clientID != s.opts.ClientID || secret != s.opts.ClientSecret:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client", "error_description": "AADSTS7000215: Invalid client secret provided."})
+	case r.PostFormValue("scope") != s.URL+"/.default":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_scope"})
+	default:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token": s.token,
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}
+}
+
+// visible counts a read of the object at path and reports whether it has
+// replicated.
+func (s *Server) visible(path string) bool {
+	s.reads[path]++
+	return s.reads[path] > s.opts.Lag
+}
+
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, ok bool, v interface{}) {
+	if !ok || !s.visible(r.URL.Path) {
+		notFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) serveAssignments(w http.ResponseWriter, r *http.Request, spID string) {
+	found := false
+	for _, sp := range s.sps {
+		found = found || sp.ID == spID
+	}
+	if !found || !s.visible(r.URL.Path) {
+		notFound(w, r)
+		return
+	}
+
+	all := s.assignments[spID]
+	start, _ := strconv.Atoi(r.URL.Query().Get("$skiptoken"))
+	if start > len(all) {
+		start = len(all)
+	}
+	end := start + s.opts.PageSize
+	if end > len(all) {
+		end = len(all)
+	}
+	page := map[string]interface{}{"value": append([]graph.AppRoleAssignment{}, all[start:end]...)}
+	if end < len(all) {
+		next := url.URL{Path: r.URL.Path, RawQuery: url.Values{"$skiptoken": {strconv.Itoa(end)}}.Encode()}
+		page["@odata.nextLink"] = s.URL + next.String()
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "Request_ResourceNotFound",
+		"Resource '"+r.URL.Path+"' does not exist or one of its queried reference-property objects are not present.")
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"code": code, "message": message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func randomUUID() string {
+	id := randomID()
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:32]
+}
@@ -0,0 +1,240 @@
+package mockoidc
+
+import (
+	"strings"
+)
+
+// Flavor shapes the URL layout, discovery document and token claims after
+// one of the identity providers the modules configure.
+type Flavor string
+
+const (
+	// Generic serves everything from the server root.
+	Generic Flavor = "generic"
+	// AzureAD mimics the Microsoft identity platform v2.0 endpoints.
+	AzureAD Flavor = "azure-ad"
+	// Okta mimics the Okta "default" custom authorization server.
+	Okta Flavor = "okta"
+	// Keycloak mimics a Keycloak realm.
+	Keycloak Flavor = "keycloak"
+	// Cognito mimics a Cognito user pool and its hosted UI domain, which
+	// real deployments serve from two different hosts.
+	Cognito Flavor = "aws-cognito"
+)
+
+// Endpoints are the absolute URLs served by the mock provider.
+type Endpoints struct {
+	Issuer        string
+	Discovery     string
+	Authorization string
+	Token         string
+	UserInfo      string
+	JWKS          string
+	EndSession    string
+}
+
+// paths are the flavor specific paths, relative to the server URL.
+type paths struct {
+	issuer, authorize, token, userinfo, jwks, endSession string
+}
+
+func (f Flavor) paths(tenant string) paths {
+	switch f {
+	case AzureAD:
+		return paths{
+			issuer:     "/" + tenant + "/v2.0",
+			authorize:  "/" + tenant + "/oauth2/v2.0/authorize",
+			token:      "/" + tenant + "/oauth2/v2.0/token",
+			userinfo:   "/oidc/userinfo",
+			jwks:       "/" + tenant + "/discovery/v2.0/keys",
+			endSession: "/" + tenant + "/oauth2/v2.0/logout",
+		}
+	case Okta:
+		base := "/oauth2/" + tenant
+		return paths{
+			issuer:     base,
+			authorize:  base + "/v1/authorize",
+			token:      base + "/v1/token",
+			userinfo:   base + "/v1/userinfo",
+			jwks:       base + "/v1/keys",
+			endSession: base + "/v1/logout",
+		}
+	case Keycloak:
+		base := "/realms/" + tenant
+		return paths{
+			issuer:     base,
+			authorize:  base + "/protocol/openid-connect/auth",
+			token:      base + "/protocol/openid-connect/token",
+			userinfo:   base + "/protocol/openid-connect/userinfo",
+			jwks:       base + "/protocol/openid-connect/certs",
+			endSession: base + "/protocol/openid-connect/logout",
+		}
+	case Cognito:
+		return paths{
+			issuer:     "/" + tenant,
+			authorize:  "/oauth2/authorize",
+			token:      "/oauth2/token",
+			userinfo:   "/oauth2/userInfo",
+			jwks:       "/" + tenant + "/.well-known/jwks.json",
+			endSession: "/logout",
+		}
+	default:
+		return paths{
+			issuer:     "",
+			authorize:  "/authorize",
+			token:      "/token",
+			userinfo:   "/userinfo",
+			jwks:       "/jwks",
+			endSession: "/logout",
+		}
+	}
+}
+
+// defaultTenant is the tenant ID, authorization server or realm used when
+// none is configured.
+func (f Flavor) defaultTenant() string {
+	switch f {
+	case AzureAD:
+		return "00000000-0000-0000-0000-000000000000"
+	case Okta:
+		return "default"
+	case Keycloak:
+		return "test-realm"
+	case Cognito:
+		return "us-east-1_TestPool1"
+	default:
+		return ""
+	}
+}
+
+// discovery builds the flavor's discovery document.
+func (f Flavor) discovery(e Endpoints) map[string]interface{} {
+	doc := map[string]interface{}{
+		"issuer":                                e.Issuer,
+		"authorization_endpoint":                e.Authorization,
+		"token_endpoint":                        e.Token,
+		"userinfo_endpoint":                     e.UserInfo,
+		"jwks_uri":                              e.JWKS,
+		"end_session_endpoint":                  e.EndSession,
+		"response_types_supported":              []string{"code", "id_token", "code id_token", "id_token token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "profile", "email", "offline_access"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials", "password"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "name", "email", "preferred_username"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+	}
+
+	switch f {
+	case AzureAD:
+		doc["subject_types_supported"] = []string{"pairwise"}
+		doc["token_endpoint_auth_methods_supported"] = []string{"client_secret_post", "private_key_jwt", "client_secret_basic"}
+		doc["response_modes_supported"] = []string{"query", "fragment", "form_post"}
+		doc["claims_supported"] = []string{"sub", "iss", "cloud_instance_name", "aud", "exp", "iat", "auth_time", "acr", "nonce", "preferred_username", "name", "tid", "ver", "at_hash", "c_hash", "email"}
+		doc["tenant_region_scope"] = "NA"
+		doc["cloud_instance_name"] = "microsoftonline.com"
+		doc["frontchannel_logout_supported"] = true
+		doc["http_logout_supported"] = true
+		doc["request_uri_parameter_supported"] = false
+		doc["kerberos_endpoint"] = strings.Replace(e.Authorization, "/oauth2/v2.0/authorize", "/kerberos", 1)
+		doc["device_authorization_endpoint"] = strings.Replace(e.Authorization, "/authorize", "/devicecode", 1)
+		delete(doc, "grant_types_supported")
+		delete(doc, "code_challenge_methods_supported")
+	case Okta:
+		base := strings.TrimSuffix(e.Token, "/token")
+		doc["introspection_endpoint"] = base + "/introspect"
+		doc["revocation_endpoint"] = base + "/revoke"
+		doc["registration_endpoint"] = strings.Split(e.Issuer, "/oauth2/")[0] + "/oauth2/v1/clients"
+		doc["response_modes_supported"] = []string{"query", "fragment", "form_post", "okta_post_message"}
+		doc["scopes_supported"] = []string{"openid", "profile", "email", "address", "phone", "offline_access", "groups"}
+		doc["request_parameter_supported"] = true
+	case Keycloak:
+		base := strings.TrimSuffix(e.Token, "/token")
+		doc["introspection_endpoint"] = base + "/token/introspect"
+		doc["check_session_iframe"] = base + "/login-status-iframe.html"
+		doc["frontchannel_logout_supported"] = true
+		doc["backchannel_logout_supported"] = true
+		doc["response_modes_supported"] = []string{"query", "fragment", "form_post", "query.jwt", "fragment.jwt", "form_post.jwt", "jwt"}
+		doc["scopes_supported"] = []string{"openid", "profile", "email", "roles", "web-origins", "offline_access", "microprofile-jwt", "phone", "address", "acr"}
+		doc["subject_types_supported"] = []string{"public", "pairwise"}
+		doc["id_token_signing_alg_values_supported"] = []string{"RS256", "PS256", "ES256"}
+	case Cognito:
+		doc["response_types_supported"] = []string{"code", "token"}
+		doc["scopes_supported"] = []string{"openid", "email", "phone", "profile"}
+		delete(doc, "end_session_endpoint")
+		delete(doc, "grant_types_supported")
+		delete(doc, "claims_supported")
+		delete(doc, "code_challenge_methods_supported")
+	}
+
+	return doc
+}
+
+// decorate adds the flavor specific claims to an ID or access token.
+func (f Flavor) decorate(claims map[string]interface{}, kind tokenKind, tenant, clientID string, user *User) {
+	switch f {
+	case AzureAD:
+		claims["tid"] = tenant
+		claims["ver"] = "2.0"
+		if user != nil {
+			claims["oid"] = user.Subject
+			claims["preferred_username"] = user.Username
+		}
+		if kind == accessToken {
+			claims["azp"] = clientID
+			claims["scp"] = "openid profile email"
+		}
+	case Okta:
+		claims["ver"] = 1
+		if kind == accessToken {
+			claims["cid"] = clientID
+			claims["scp"] = []string{"openid", "profile", "email"}
+			if user != nil {
+				claims["uid"] = user.Subject
+			}
+		}
+		if user != nil && len(user.Groups) > 0 {
+			claims["groups"] = user.Groups
+		}
+	case Cognito:
+		if kind == accessToken {
+			// Cognito access tokens carry client_id instead of aud.
+			delete(claims, "aud")
+			claims["token_use"] = "access"
+			claims["scope"] = "openid email profile"
+			if user != nil {
+				claims["username"] = user.Username
+			}
+		} else {
+			claims["token_use"] = "id"
+			if user != nil {
+				claims["cognito:username"] = user.Username
+			}
+		}
+		if user != nil && len(user.Groups) > 0 {
+			claims["cognito:groups"] = user.Groups
+		}
+	case Keycloak:
+		claims["azp"] = clientID
+		claims["typ"] = "ID"
+		if kind == accessToken {
+			claims["typ"] = "Bearer"
+			claims["scope"] = "openid profile email"
+		}
+		if user != nil {
+			claims["preferred_username"] = user.Username
+			claims["realm_access"] = map[string]interface{}{"roles": nonNil(user.Roles)}
+			if len(user.Groups) > 0 {
+				claims["groups"] = user.Groups
+			}
+		}
+	}
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,373 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func (p *Provider) routes() http.Handler {
+	mux := http.NewServeMux()
+	paths := p.flavor.paths(p.tenant)
+
+	mux.HandleFunc(paths.issuer+"/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc(paths.jwks, p.handleJWKS)
+	mux.HandleFunc(paths.authorize, p.handleAuthorize)
+	mux.HandleFunc(paths.token, p.handleToken)
+	mux.HandleFunc(paths.userinfo, p.handleUserInfo)
+	mux.HandleFunc(paths.endSession, p.handleEndSession)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an RFC 6749 section 5.2 error response.
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.flavor.discovery(p.endpoints))
+}
+
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	keys := p.Keys()
+	set := struct {
+		Keys []JWK `json:"keys"`
+	}{Keys: make([]JWK, 0, len(keys))}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, k.JWK())
+	}
+	writeJSON(w, http.StatusOK, set)
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in</title></head>
+<body>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form id="login-form" method="post" action="{{.Action}}">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{$v}}">
+{{end}}<input type="text" id="username" name="username">
+<input type="password" id="password" name="password">
+<input type="submit" value="Sign In">
+</form>
+</body>
+</html>
+`))
+
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := r.Form
+
+	clientID := params.Get("client_id")
+	redirectURI := params.Get("redirect_uri")
+	if clientID == "" || redirectURI == "" {
+		http.Error(w, "client_id and redirect_uri are required", http.StatusBadRequest)
+		return
+	}
+	if !p.redirectAllowed(clientID, redirectURI) {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if params.Get("response_type") != "code" {
+		redirectError(w, r, redirectURI, params.Get("state"), "unsupported_response_type")
+		return
+	}
+
+	var user *User
+	switch {
+	case p.autoLogin != "":
+		user = p.lookupUser(p.autoLogin)
+	case r.Method == http.MethodPost:
+		user = p.authenticate(params.Get("username"), params.Get("password"))
+		if user == nil {
+			p.renderLogin(w, r, http.StatusUnauthorized, "Invalid username or password.")
+			return
+		}
+	default:
+		p.renderLogin(w, r, http.StatusOK, "")
+		return
+	}
+	if user == nil {
+		http.Error(w, "auto-login user not found", http.StatusInternalServerError)
+		return
+	}
+
+	code := randomID()
+	p.mu.Lock()
+	p.codes[code] = &grant{
+		clientID:            clientID,
+		redirectURI:         redirectURI,
+		nonce:               params.Get("nonce"),
+		scope:               params.Get("scope"),
+		codeChallenge:       params.Get("code_challenge"),
+		codeChallengeMethod: params.Get("code_challenge_method"),
+		user:                user,
+		expires:             time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	target, _ := url.Parse(redirectURI)
+	q := target.Query()
+	q.Set("code", code)
+	if state := params.Get("state"); state != "" {
+		q.Set("state", state)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (p *Provider) renderLogin(w http.ResponseWriter, r *http.Request, status int, message string) {
+	hidden := map[string]string{}
+	for k := range r.Form {
+		if k != "username" && k != "password" {
+			hidden[k] = r.Form.Get(k)
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = loginForm.Execute(w, map[string]interface{}{
+		"Action": r.URL.Path,
+		"Params": hidden,
+		"Error":  message,
+	})
+}
+
+func redirectError(w http.ResponseWriter, r *http.Request, redirectURI, state, code string) {
+	target, _ := url.Parse(redirectURI)
+	q := target.Query()
+	q.Set("error", code)
+	if state != "" {
+		q.Set("state", state)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if !p.clientAuthenticated(clientID, secret) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	var (
+		user  *User
+		nonce string
+		scope = r.PostForm.Get("scope")
+	)
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		g := p.redeem(p.codes, r.PostForm.Get("code"))
+		if g == nil || g.clientID != clientID {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "unknown or expired authorization code")
+			return
+		}
+		if g.redirectURI != r.PostForm.Get("redirect_uri") {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri mismatch")
+			return
+		}
+		if err := g.verifyPKCE(r.PostForm.Get("code_verifier")); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+			return
+		}
+		user, nonce, scope = g.user, g.nonce, g.scope
+	case "refresh_token":
+		g := p.redeem(p.refresh, r.PostForm.Get("refresh_token"))
+		if g == nil || g.clientID != clientID {
+			writeError(w, http.StatusBadRequest, "invalid_grant", "unknown refresh token")
+			return
+		}
+		user, scope = g.user, g.scope
+	case "password":
+		user = p.authenticate(r.PostForm.Get("username"), r.PostForm.Get("password"))
+		if user == nil {
+			writeError(w, http.StatusUnauthorized, "invalid_grant", "Invalid user credentials")
+			return
+		}
+	case "client_credentials":
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", r.PostForm.Get("grant_type"))
+		return
+	}
+
+	access, err := p.issue(accessToken, clientID, user, "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	resp := map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   int(p.ttl.Seconds()),
+	}
+	if scope != "" {
+		resp["scope"] = scope
+	}
+	if user != nil {
+		id, err := p.issue(idToken, clientID, user, nonce)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		resp["id_token"] = id
+
+		refresh := randomID()
+		p.mu.Lock()
+		p.refresh[refresh] = &grant{clientID: clientID, scope: scope, user: user, expires: time.Now().Add(24 * time.Hour)}
+		p.mu.Unlock()
+		resp["refresh_token"] = refresh
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (p *Provider) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if raw == "" || raw == r.Header.Get("Authorization") {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+	claims, err := p.Verify(raw)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	username, _ := claims["preferred_username"].(string)
+	user := p.lookupUser(username)
+	if user == nil {
+		writeError(w, http.StatusForbidden, "insufficient_scope", "token was not issued to a user")
+		return
+	}
+	info := userClaims(user)
+	if len(user.Groups) > 0 {
+		info["groups"] = user.Groups
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (p *Provider) handleEndSession(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if hint := r.Form.Get("id_token_hint"); hint != "" {
+		claims, err := p.Verify(hint)
+		if err != nil {
+			http.Error(w, "invalid id_token_hint", http.StatusBadRequest)
+			return
+		}
+		sub, _ := claims["sub"].(string)
+		p.mu.Lock()
+		p.logouts = append(p.logouts, sub)
+		p.mu.Unlock()
+	}
+
+	redirect := r.Form.Get("post_logout_redirect_uri")
+	if redirect == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("You have been signed out.\n"))
+		return
+	}
+	target, err := url.Parse(redirect)
+	if err != nil {
+		http.Error(w, "invalid post_logout_redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if state := r.Form.Get("state"); state != "" {
+		q := target.Query()
+		q.Set("state", state)
+		target.RawQuery = q.Encode()
+	}
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func (p *Provider) lookupUser(username string) *User {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.users[username]
+}
+
+func (p *Provider) authenticate(username, password string) *User {
+	u := p.lookupUser(username)
+	if u == nil || u.Password != password {
+		return nil
+	}
+	return u
+}
+
+// redeem removes and returns an unexpired single-use grant.
+func (p *Provider) redeem(store map[string]*grant, key string) *grant {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := store[key]
+	if !ok {
+		return nil
+	}
+	delete(store, key)
+	if time.Now().After(g.expires) {
+		return nil
+	}
+	return g
+}
+
+func (p *Provider) clientAuthenticated(clientID, secret string) bool {
+	if clientID == "" {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.clients) == 0 {
+		return true
+	}
+	c, ok := p.clients[clientID]
+	return ok && c.Secret == secret
+}
+
+func (p *Provider) redirectAllowed(clientID, redirectURI string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.clients) == 0 {
+		return true
+	}
+	c, ok := p.clients[clientID]
+	if !ok {
+		return false
+	}
+	for _, u := range c.RedirectURIs {
+		if u == redirectURI {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package mockoidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// DefaultKeySize is the RSA modulus size used when keys are generated.
+const DefaultKeySize = 2048
+
+// SigningKey is an RSA key published in the JWKS.
+type SigningKey struct {
+	ID          string
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+// NewSigningKey wraps key with a self-signed certificate valid for the given
+// period. The key ID is derived from the public key so it is stable.
+func NewSigningKey(key *rsa.PrivateKey, subject string, validity time.Duration) (*SigningKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	kid := base64.RawURLEncoding.EncodeToString(sum[:16])
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          new(big.Int).SetBytes(sum[:8]),
+		Subject:               pkix.Name{CommonName: subject},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{ID: kid, Key: key, Certificate: cert}, nil
+}
+
+// GenerateSigningKey creates a fresh RSA signing key.
+func GenerateSigningKey(bits int, subject string, validity time.Duration) (*SigningKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigningKey(key, subject, validity)
+}
+
+// JWK is the JSON Web Key representation of a signing key.
+type JWK struct {
+	Kid string   `json:"kid"`
+	Kty string   `json:"kty"`
+	Use string   `json:"use"`
+	Alg string   `json:"alg"`
+	N   string   `json:"n"`
+	E   string   `json:"e"`
+	X5c []string `json:"x5c,omitempty"`
+	X5t string   `json:"x5t,omitempty"`
+}
+
+// JWK returns the public half of the key as a JWK.
+func (k *SigningKey) JWK() JWK {
+	pub := k.Key.PublicKey
+	thumb := sha1.Sum(k.Certificate.Raw)
+	return JWK{
+		Kid: k.ID,
+		Kty: "RSA",
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		X5c: []string{base64.StdEncoding.EncodeToString(k.Certificate.Raw)},
+		X5t: base64.RawURLEncoding.EncodeToString(thumb[:]),
+	}
+}
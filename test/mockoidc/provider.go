@@ -0,0 +1,280 @@
+// Package mockoidc is an in-process OpenID Connect provider for offline
+// tests. It serves discovery, JWKS, authorize, token, userinfo and
+// end_session endpoints over TLS, or plain HTTP, with a configurable
+// issuer and signing keys, and shapes its URLs and claims after Azure AD
+// v2.0, the Okta default authorization server, a Keycloak realm or a
+// Cognito user pool.
+package mockoidc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// User is an account that can sign in to the mock provider.
+type User struct {
+	Username string
+	Password string
+	Subject  string
+	Email    string
+	Name     string
+	Groups   []string
+	Roles    []string
+	// Claims are merged into ID tokens and userinfo responses.
+	Claims map[string]interface{}
+}
+
+// Client is a registered relying party. When no clients are registered the
+// provider accepts any client ID and secret.
+type Client struct {
+	ID           string
+	Secret       string
+	RedirectURIs []string
+}
+
+// Options configures a Provider.
+type Options struct {
+	Flavor Flavor
+	// Tenant is the Azure tenant ID, Okta authorization server ID,
+	// Keycloak realm name or Cognito user pool ID, depending on the flavor.
+	Tenant string
+	// Keys are the signing keys; the first one signs new tokens. A 2048-bit
+	// key is generated when empty.
+	Keys []*SigningKey
+	// Users that may sign in. A single "testuser" with password "password"
+	// is created when empty.
+	Users []User
+	// Clients that may request tokens.
+	Clients []Client
+	// AutoLogin signs the named user in without showing the login form.
+	AutoLogin string
+	// TokenTTL is the lifetime of issued tokens, one hour by default.
+	TokenTTL time.Duration
+	// Addr is the address to listen on, a loopback port by default. Listen
+	// on every interface, such as ":0", when a server in a container has to
+	// reach the provider; the endpoints still name the loopback address.
+	Addr string
+	// PlainHTTP serves http instead of https, for relying parties that do
+	// not trust the provider's self-signed certificate.
+	PlainHTTP bool
+}
+
+// Provider is a running mock OpenID Connect provider.
+type Provider struct {
+	Server *httptest.Server
+
+	flavor    Flavor
+	tenant    string
+	ttl       time.Duration
+	autoLogin string
+	endpoints Endpoints
+
+	mu      sync.Mutex
+	keys    []*SigningKey
+	users   map[string]*User
+	clients map[string]Client
+	codes   map[string]*grant
+	refresh map[string]*grant
+	logouts []string
+}
+
+// New starts a TLS mock provider. Call Close when done.
+func New(opts Options) (*Provider, error) {
+	if opts.Flavor == "" {
+		opts.Flavor = Generic
+	}
+	if opts.Tenant == "" {
+		opts.Tenant = opts.Flavor.defaultTenant()
+	}
+	if opts.TokenTTL == 0 {
+		opts.TokenTTL = time.Hour
+	}
+	if len(opts.Keys) == 0 {
+		key, err := GenerateSigningKey(DefaultKeySize, "mockoidc", 24*time.Hour)
+		if err != nil {
+			return nil, fmt.Errorf("generating signing key: %w", err)
+		}
+		opts.Keys = []*SigningKey{key}
+	}
+	if len(opts.Users) == 0 {
+		opts.Users = []User{{Username: "testuser", Password: "password", Email: "testuser@example.com", Name: "Test User"}}
+	}
+
+	p := &Provider{
+		flavor:    opts.Flavor,
+		tenant:    opts.Tenant,
+		ttl:       opts.TokenTTL,
+		autoLogin: opts.AutoLogin,
+		keys:      append([]*SigningKey(nil), opts.Keys...),
+		users:     map[string]*User{},
+		clients:   map[string]Client{},
+		codes:     map[string]*grant{},
+		refresh:   map[string]*grant{},
+	}
+	for i := range opts.Users {
+		u := opts.Users[i]
+		if u.Subject == "" {
+			u.Subject = randomID()
+		}
+		p.users[u.Username] = &u
+	}
+	for _, c := range opts.Clients {
+		p.clients[c.ID] = c
+	}
+
+	p.Server = httptest.NewUnstartedServer(p.routes())
+	if opts.Addr != "" {
+		ln, err := net.Listen("tcp", opts.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("listening on %s: %w", opts.Addr, err)
+		}
+		p.Server.Listener.Close()
+		p.Server.Listener = ln
+	}
+	if opts.PlainHTTP {
+		p.Server.Start()
+	} else {
+		p.Server.StartTLS()
+	}
+	if addr := p.Server.Listener.Addr().(*net.TCPAddr); addr.IP.IsUnspecified() {
+		p.Server.URL = strings.Replace(p.Server.URL, addr.String(), net.JoinHostPort("127.0.0.1", strconv.Itoa(addr.Port)), 1)
+	}
+
+	base := p.Server.URL
+	paths := p.flavor.paths(p.tenant)
+	p.endpoints = Endpoints{
+		Issuer:        base + paths.issuer,
+		Discovery:     base + paths.issuer + "/.well-known/openid-configuration",
+		Authorization: base + paths.authorize,
+		Token:         base + paths.token,
+		UserInfo:      base + paths.userinfo,
+		JWKS:          base + paths.jwks,
+		EndSession:    base + paths.endSession,
+	}
+
+	return p, nil
+}
+
+// Start starts a provider and closes it when the test finishes.
+func Start(t testing.TB, opts Options) *Provider {
+	t.Helper()
+	p, err := New(opts)
+	if err != nil {
+		t.Fatalf("starting mock OIDC provider: %v", err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+// Close shuts the server down.
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// Flavor returns the provider flavor.
+func (p *Provider) Flavor() Flavor {
+	return p.flavor
+}
+
+// Tenant returns the tenant ID, authorization server or realm.
+func (p *Provider) Tenant() string {
+	return p.tenant
+}
+
+// Issuer returns the issuer identifier.
+func (p *Provider) Issuer() string {
+	return p.endpoints.Issuer
+}
+
+// DiscoveryURL returns the URL of the discovery document.
+func (p *Provider) DiscoveryURL() string {
+	return p.endpoints.Discovery
+}
+
+// Endpoints returns every endpoint URL.
+func (p *Provider) Endpoints() Endpoints {
+	return p.endpoints
+}
+
+// EndpointsAt returns the endpoint URLs with host in place of the loopback
+// address, for a relying party that reaches the provider under another
+// name, such as host.docker.internal. The issuer is left alone, since it
+// identifies the provider rather than locating it.
+func (p *Provider) EndpointsAt(host string) Endpoints {
+	e := p.endpoints
+	if host == "" {
+		return e
+	}
+	port := strconv.Itoa(p.Server.Listener.Addr().(*net.TCPAddr).Port)
+	base := strings.SplitN(p.Server.URL, "://", 2)[0] + "://" + net.JoinHostPort(host, port)
+	for _, u := range []*string{&e.Discovery, &e.Authorization, &e.Token, &e.UserInfo, &e.JWKS, &e.EndSession} {
+		*u = base + strings.TrimPrefix(*u, p.Server.URL)
+	}
+	return e
+}
+
+// HTTPClient returns a client that trusts the provider's TLS certificate.
+func (p *Provider) HTTPClient() *http.Client {
+	return p.Server.Client()
+}
+
+// Keys returns the published signing keys; the first one is active.
+func (p *Provider) Keys() []*SigningKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*SigningKey(nil), p.keys...)
+}
+
+// RotateKey makes key the active signing key. Previous keys stay in the
+// JWKS so tokens they signed still verify.
+func (p *Provider) RotateKey(key *SigningKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append([]*SigningKey{key}, p.keys...)
+}
+
+// AddUser registers another user.
+func (p *Provider) AddUser(u User) {
+	if u.Subject == "" {
+		u.Subject = randomID()
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.users[u.Username] = &u
+}
+
+// User returns the registered user with the given name.
+func (p *Provider) User(username string) (User, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u, ok := p.users[username]
+	if !ok {
+		return User{}, false
+	}
+	return *u, true
+}
+
+// Logouts returns the subjects whose sessions were ended through the
+// end_session endpoint.
+func (p *Provider) Logouts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.logouts...)
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,352 @@
+package mockoidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getJSON(t *testing.T, client *http.Client, rawURL string, v interface{}) {
+	t.Helper()
+	resp, err := client.Get(rawURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+}
+
+func postForm(t *testing.T, client *http.Client, rawURL string, form url.Values) (int, map[string]interface{}) {
+	t.Helper()
+	resp, err := client.PostForm(rawURL, form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+// noRedirects returns a copy of the provider's client that stops at redirects.
+func noRedirects(p *Provider) *http.Client {
+	client := *p.HTTPClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &client
+}
+
+func TestDiscoveryPerFlavor(t *testing.T) {
+	cases := []struct {
+		flavor     Flavor
+		tenant     string
+		issuerPath string
+		jwksSuffix string
+	}{
+		{AzureAD, "11111111-2222-3333-4444-555555555555", "/11111111-2222-3333-4444-555555555555/v2.0", "/discovery/v2.0/keys"},
+		{Okta, "default", "/oauth2/default", "/oauth2/default/v1/keys"},
+		{Keycloak, "my-realm", "/realms/my-realm", "/protocol/openid-connect/certs"},
+		{Cognito, "eu-west-1_AbCdEf123", "/eu-west-1_AbCdEf123", "/eu-west-1_AbCdEf123/.well-known/jwks.json"},
+		{Generic, "", "", "/jwks"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(string(tc.flavor), func(t *testing.T) {
+			t.Parallel()
+			p := Start(t, Options{Flavor: tc.flavor, Tenant: tc.tenant})
+
+			var doc map[string]interface{}
+			getJSON(t, p.HTTPClient(), p.DiscoveryURL(), &doc)
+
+			assert.Equal(t, p.Server.URL+tc.issuerPath, doc["issuer"])
+			assert.Equal(t, p.Issuer(), doc["issuer"])
+			assert.True(t, strings.HasSuffix(doc["jwks_uri"].(string), tc.jwksSuffix), doc["jwks_uri"])
+			for _, field := range []string{"authorization_endpoint", "token_endpoint", "userinfo_endpoint", "end_session_endpoint"} {
+				if field == "end_session_endpoint" && tc.flavor == Cognito {
+					assert.NotContains(t, doc, field, "Cognito does not advertise its logout endpoint")
+					continue
+				}
+				assert.True(t, strings.HasPrefix(doc[field].(string), "https://"), field)
+			}
+		})
+	}
+}
+
+func TestJWKSPublishesKeys(t *testing.T) {
+	p := Start(t, Options{Flavor: Keycloak})
+
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	getJSON(t, p.HTTPClient(), p.Endpoints().JWKS, &set)
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, p.Keys()[0].ID, set.Keys[0].Kid)
+	assert.Equal(t, "RSA", set.Keys[0].Kty)
+	assert.Equal(t, "RS256", set.Keys[0].Alg)
+	assert.Len(t, set.Keys[0].X5c, 1)
+
+	next, err := GenerateSigningKey(DefaultKeySize, "rotated", time.Hour)
+	require.NoError(t, err)
+	old, err := p.Sign(map[string]interface{}{"iss": p.Issuer(), "sub": "before-rotation"})
+	require.NoError(t, err)
+	p.RotateKey(next)
+
+	getJSON(t, p.HTTPClient(), p.Endpoints().JWKS, &set)
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, next.ID, set.Keys[0].Kid)
+
+	claims, err := p.Verify(old)
+	require.NoError(t, err, "tokens signed before rotation still verify")
+	assert.Equal(t, "before-rotation", claims["sub"])
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	p := Start(t, Options{
+		Flavor:  Okta,
+		Users:   []User{{Username: "alice", Password: "s3cret", Email: "alice@example.com", Groups: []string{"Everyone"}}},
+		Clients: []Client{{ID: "web", Secret: "web-secret", RedirectURIs: []string{"https://app.example.com/callback"}}},
+	})
+	client := noRedirects(p)
+
+	verifier := "a-sufficiently-long-code-verifier-for-the-test-0123456789"
+	sum := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"client_id":             {"web"},
+		"redirect_uri":          {"https://app.example.com/callback"},
+		"response_type":         {"code"},
+		"scope":                 {"openid profile email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	resp, err := client.Get(p.Endpoints().Authorization + "?" + query.Encode())
+	require.NoError(t, err)
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(page), `name="password"`)
+
+	bad := url.Values{"username": {"alice"}, "password": {"wrong"}}
+	for k, v := range query {
+		bad[k] = v
+	}
+	resp, err = client.PostForm(p.Endpoints().Authorization, bad)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	login := url.Values{"username": {"alice"}, "password": {"s3cret"}}
+	for k, v := range query {
+		login[k] = v
+	}
+	resp, err = client.PostForm(p.Endpoints().Authorization, login)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "xyz", location.Query().Get("state"))
+	code := location.Query().Get("code")
+	require.NotEmpty(t, code)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"client_id":     {"web"},
+		"client_secret": {"web-secret"},
+		"code_verifier": {"wrong-verifier"},
+	}
+	status, body := postForm(t, client, p.Endpoints().Token, exchange)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+
+	// A failed exchange consumes the code, so start a new authorization.
+	resp, err = client.PostForm(p.Endpoints().Authorization, login)
+	require.NoError(t, err)
+	resp.Body.Close()
+	location, _ = url.Parse(resp.Header.Get("Location"))
+	exchange.Set("code", location.Query().Get("code"))
+	exchange.Set("code_verifier", verifier)
+
+	status, body = postForm(t, client, p.Endpoints().Token, exchange)
+	require.Equal(t, http.StatusOK, status, body)
+	assert.Equal(t, "Bearer", body["token_type"])
+	assert.NotEmpty(t, body["refresh_token"])
+
+	idClaims, err := p.Verify(body["id_token"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "web", idClaims["aud"])
+	assert.Equal(t, "n-0S6", idClaims["nonce"])
+	assert.Equal(t, "alice@example.com", idClaims["email"])
+
+	accessClaims, err := p.Verify(body["access_token"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "api://default", accessClaims["aud"])
+	assert.Equal(t, "web", accessClaims["cid"])
+
+	status, body = postForm(t, client, p.Endpoints().Token, exchange)
+	assert.Equal(t, http.StatusBadRequest, status, "codes are single use")
+	assert.Equal(t, "invalid_grant", body["error"])
+}
+
+func TestAuthorizeRejectsUnregisteredRedirect(t *testing.T) {
+	p := Start(t, Options{Clients: []Client{{ID: "web", RedirectURIs: []string{"https://app.example.com/callback"}}}})
+
+	query := url.Values{"client_id": {"web"}, "redirect_uri": {"https://evil.example.com/"}, "response_type": {"code"}}
+	resp, err := noRedirects(p).Get(p.Endpoints().Authorization + "?" + query.Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestPasswordGrantAndUserInfo(t *testing.T) {
+	p := Start(t, Options{
+		Flavor: Keycloak,
+		Users:  []User{{Username: "bob", Password: "pw", Name: "Bob", Roles: []string{"admin"}, Groups: []string{"/staff"}}},
+	})
+	client := p.HTTPClient()
+
+	status, body := postForm(t, client, p.Endpoints().Token, url.Values{
+		"grant_type": {"password"}, "client_id": {"cli"}, "username": {"bob"}, "password": {"nope"},
+	})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "invalid_grant", body["error"])
+
+	status, body = postForm(t, client, p.Endpoints().Token, url.Values{
+		"grant_type": {"password"}, "client_id": {"cli"}, "username": {"bob"}, "password": {"pw"}, "scope": {"openid"},
+	})
+	require.Equal(t, http.StatusOK, status, body)
+
+	claims, err := p.Verify(body["access_token"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "cli", claims["azp"])
+	assert.Equal(t, "Bearer", claims["typ"])
+	assert.Equal(t, map[string]interface{}{"roles": []interface{}{"admin"}}, claims["realm_access"])
+
+	req, _ := http.NewRequest(http.MethodGet, p.Endpoints().UserInfo, nil)
+	req.Header.Set("Authorization", "Bearer "+body["access_token"].(string))
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var info map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, "bob", info["preferred_username"])
+	assert.Equal(t, "Bob", info["name"])
+
+	req, _ = http.NewRequest(http.MethodGet, p.Endpoints().UserInfo, nil)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestClientCredentialsAndRefresh(t *testing.T) {
+	p := Start(t, Options{Flavor: AzureAD, Clients: []Client{{ID: "daemon", Secret: "secret"}}})
+	client := p.HTTPClient()
+
+	status, body := postForm(t, client, p.Endpoints().Token, url.Values{
+		"grant_type": {"client_credentials"}, "client_id": {"daemon"}, "client_secret": {"wrong"},
+	})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "invalid_client", body["error"])
+
+	status, body = postForm(t, client, p.Endpoints().Token, url.Values{
+		"grant_type": {"client_credentials"}, "client_id": {"daemon"}, "client_secret": {"secret"},
+	})
+	require.Equal(t, http.StatusOK, status, body)
+	assert.NotContains(t, body, "id_token")
+	assert.NotContains(t, body, "refresh_token")
+	claims, err := p.Verify(body["access_token"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, p.Tenant(), claims["tid"])
+
+	status, body = postForm(t, client, p.Endpoints().Token, url.Values{
+		"grant_type": {"password"}, "client_id": {"daemon"}, "client_secret": {"secret"},
+		"username": {"testuser"}, "password": {"password"},
+	})
+	require.Equal(t, http.StatusOK, status, body)
+
+	status, body = postForm(t, client, p.Endpoints().Token, url.Values{
+		"grant_type": {"refresh_token"}, "client_id": {"daemon"}, "client_secret": {"secret"},
+		"refresh_token": {body["refresh_token"].(string)},
+	})
+	require.Equal(t, http.StatusOK, status, body)
+	assert.NotEmpty(t, body["id_token"])
+}
+
+func TestPlainHTTPOnEveryInterface(t *testing.T) {
+	p := Start(t, Options{Flavor: Generic, Addr: ":0", PlainHTTP: true})
+
+	assert.True(t, strings.HasPrefix(p.Issuer(), "http://127.0.0.1:"), p.Issuer())
+	resp, err := http.Get(p.DiscoveryURL())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	at := p.EndpointsAt("host.docker.internal")
+	assert.Equal(t, p.Issuer(), at.Issuer)
+	assert.Equal(t, strings.Replace(p.Endpoints().Token, "127.0.0.1", "host.docker.internal", 1), at.Token)
+	assert.Equal(t, p.Endpoints(), p.EndpointsAt(""))
+}
+
+func TestEndSession(t *testing.T) {
+	p := Start(t, Options{Flavor: Keycloak, AutoLogin: "testuser"})
+	client := noRedirects(p)
+
+	status, body := postForm(t, client, p.Endpoints().Token, url.Values{
+		"grant_type": {"password"}, "client_id": {"app"}, "username": {"testuser"}, "password": {"password"},
+	})
+	require.Equal(t, http.StatusOK, status, body)
+
+	query := url.Values{
+		"id_token_hint":            {body["id_token"].(string)},
+		"post_logout_redirect_uri": {"https://app.example.com/signed-out"},
+		"state":                    {"abc"},
+	}
+	resp, err := client.Get(p.Endpoints().EndSession + "?" + query.Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "https://app.example.com/signed-out?state=abc", resp.Header.Get("Location"))
+
+	user, ok := p.User("testuser")
+	require.True(t, ok)
+	assert.Equal(t, []string{user.Subject}, p.Logouts())
+}
+
+func TestCognitoTokenClaims(t *testing.T) {
+	p := Start(t, Options{
+		Flavor: Cognito,
+		Users:  []User{{Username: "carol", Password: "pw", Groups: []string{"admins"}}},
+	})
+
+	status, body := postForm(t, p.HTTPClient(), p.Endpoints().Token, url.Values{
+		"grant_type": {"password"}, "client_id": {"app-client"}, "username": {"carol"}, "password": {"pw"},
+	})
+	require.Equal(t, http.StatusOK, status, body)
+
+	idClaims, err := p.Verify(body["id_token"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "id", idClaims["token_use"])
+	assert.Equal(t, "carol", idClaims["cognito:username"])
+	assert.Equal(t, "app-client", idClaims["aud"])
+	assert.Equal(t, []interface{}{"admins"}, idClaims["cognito:groups"])
+
+	accessClaims, err := p.Verify(body["access_token"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "access", accessClaims["token_use"])
+	assert.Equal(t, "app-client", accessClaims["client_id"])
+	assert.NotContains(t, accessClaims, "aud")
+}
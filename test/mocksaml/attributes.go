@@ -0,0 +1,153 @@
+package mocksaml
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+)
+
+// Attribute is an attribute added to every assertion. Values are
+// expressions evaluated against the signed-in user:
+//
+//	user.email                                   the user's email
+//	user.groups                                  one value per group
+//	isMemberOfGroupName("Admins") ? "a" : "b"    a conditional literal
+//	"literal"                                    a quoted literal
+//
+// Anything else is used verbatim. Attributes whose values all resolve to
+// nothing are left out, as Okta does.
+type Attribute struct {
+	Name       string
+	NameFormat string
+	Values     []string
+}
+
+// AttributesFromMapping turns a Cognito attribute_mapping, which maps user
+// pool attributes to SAML attribute names, into the attributes an identity
+// provider has to send for every mapped user pool attribute to be filled.
+func AttributesFromMapping(mapping map[string]string) []Attribute {
+	poolAttrs := make([]string, 0, len(mapping))
+	for k := range mapping {
+		poolAttrs = append(poolAttrs, k)
+	}
+	sort.Strings(poolAttrs)
+
+	attrs := make([]Attribute, 0, len(mapping))
+	for _, poolAttr := range poolAttrs {
+		name := mapping[poolAttr]
+		format := saml.AttrNameFormatBasic
+		if strings.Contains(name, ":") {
+			format = saml.AttrNameFormatURI
+		}
+		attrs = append(attrs, Attribute{Name: name, NameFormat: format, Values: []string{"user." + poolAttr}})
+	}
+	return attrs
+}
+
+// AttributesFromStatements converts an Okta attribute_statements value, as
+// passed in terraform.Options.Vars, into attributes. Only EXPRESSION
+// statements are supported; group statements need a filter the mock does
+// not evaluate.
+func AttributesFromStatements(statements []map[string]interface{}) ([]Attribute, error) {
+	attrs := make([]Attribute, 0, len(statements))
+	for i, s := range statements {
+		if typ, _ := s["type"].(string); typ != "" && typ != "EXPRESSION" {
+			return nil, fmt.Errorf("attribute_statements[%d]: type %q is not supported", i, typ)
+		}
+		name, _ := s["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("attribute_statements[%d]: name is required", i)
+		}
+		format, _ := s["namespace"].(string)
+		if format == "" {
+			format = saml.AttrNameFormatUnspecified
+		}
+
+		var values []string
+		switch v := s["values"].(type) {
+		case []string:
+			values = v
+		case []interface{}:
+			for _, e := range v {
+				str, ok := e.(string)
+				if !ok {
+					return nil, fmt.Errorf("attribute_statements[%d]: values must be strings", i)
+				}
+				values = append(values, str)
+			}
+		default:
+			return nil, fmt.Errorf("attribute_statements[%d]: values must be a list of strings", i)
+		}
+		attrs = append(attrs, Attribute{Name: name, NameFormat: format, Values: values})
+	}
+	return attrs, nil
+}
+
+var (
+	userExpr        = regexp.MustCompile(`^(?:app)?user\.([A-Za-z0-9_:.-]+)$`)
+	conditionalExpr = regexp.MustCompile(`^isMemberOfGroupName\("([^"]*)"\)\s*\?\s*"([^"]*)"\s*:\s*"([^"]*)"$`)
+	literalExpr     = regexp.MustCompile(`^"([^"]*)"$`)
+)
+
+// resolve evaluates the attribute's expressions for u.
+func (a Attribute) resolve(u *User) []string {
+	var values []string
+	for _, expr := range a.Values {
+		expr = strings.TrimSpace(expr)
+		switch {
+		case userExpr.MatchString(expr):
+			values = append(values, u.lookup(userExpr.FindStringSubmatch(expr)[1])...)
+		case conditionalExpr.MatchString(expr):
+			m := conditionalExpr.FindStringSubmatch(expr)
+			if u.memberOf(m[1]) {
+				values = append(values, m[2])
+			} else {
+				values = append(values, m[3])
+			}
+		case literalExpr.MatchString(expr):
+			values = append(values, literalExpr.FindStringSubmatch(expr)[1])
+		default:
+			values = append(values, expr)
+		}
+	}
+	return values
+}
+
+// lookup returns the values of a user attribute under its Okta profile,
+// OIDC or Cognito name.
+func (u *User) lookup(name string) []string {
+	if v, ok := u.Attributes[name]; ok {
+		return v
+	}
+	var value string
+	switch name {
+	case "email":
+		value = u.Email
+	case "firstName", "given_name":
+		value = u.FirstName
+	case "lastName", "family_name":
+		value = u.LastName
+	case "login", "username", "preferred_username":
+		value = u.Username
+	case "displayName", "name":
+		value = strings.TrimSpace(u.FirstName + " " + u.LastName)
+	case "groups":
+		return u.Groups
+	}
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+func (u *User) memberOf(group string) bool {
+	for _, g := range u.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package mocksaml
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"html"
+	"html/template"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+)
+
+func (p *IdP) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(MetadataPath, p.handleMetadata)
+	mux.HandleFunc(SSOPath, p.handleSSO)
+	mux.HandleFunc(SLOPath, p.handleSLO)
+	return mux
+}
+
+func (p *IdP) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := p.Metadata()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(data)
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in</title></head>
+<body>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form id="login-form" method="post" action="{{.Action}}">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{$v}}">
+{{end}}<input type="text" id="username" name="username">
+<input type="password" id="password" name="password">
+<input type="submit" value="Sign In">
+</form>
+</body>
+</html>
+`))
+
+// postForm delivers a Response with the HTTP-POST binding (SAML 2.0
+// Bindings section 3.5).
+var postForm = template.Must(template.New("post").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Signing in</title></head>
+<body onload="document.forms[0].submit()">
+<form id="saml-response" method="post" action="{{.ACSURL}}">
+<input type="hidden" name="SAMLResponse" value="{{.SAMLResponse}}">
+{{if .RelayState}}<input type="hidden" name="RelayState" value="{{.RelayState}}">
+{{end}}<noscript><input type="submit" value="Continue"></noscript>
+</form>
+</body>
+</html>
+`))
+
+// handleSSO answers an AuthnRequest sent with the HTTP-Redirect or HTTP-POST
+// binding, or starts IdP initiated sign-in for the registered service
+// provider named by the sp parameter.
+func (p *IdP) handleSSO(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req saml.AuthnRequest
+	switch encoded := r.Form.Get("SAMLRequest"); {
+	case encoded != "":
+		// Only the HTTP-Redirect binding deflates the message.
+		deflated := r.Method == http.MethodGet
+		if err := saml.DecodeMessage(encoded, deflated, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case r.Form.Get("sp") != "":
+		req.Issuer = r.Form.Get("sp")
+	default:
+		http.Error(w, "SAMLRequest is required", http.StatusBadRequest)
+		return
+	}
+
+	acsURL, err := p.acsURL(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	relayState := r.Form.Get("RelayState")
+
+	if policy := req.NameIDPolicy; policy != nil && policy.Format != "" &&
+		policy.Format != saml.NameIDFormatUnspecified && policy.Format != p.nameIDFormat {
+		p.postError(w, &req, acsURL, relayState, "NameIDPolicy format "+policy.Format+" is not supported")
+		return
+	}
+
+	var user *User
+	switch {
+	case p.autoLogin != "":
+		user = p.lookupUser(p.autoLogin)
+	case r.Method == http.MethodPost && r.PostForm.Has("username"):
+		user = p.authenticate(r.PostForm.Get("username"), r.PostForm.Get("password"))
+		if user == nil {
+			p.renderLogin(w, r, &req, http.StatusUnauthorized, "Invalid username or password.")
+			return
+		}
+	default:
+		p.renderLogin(w, r, &req, http.StatusOK, "")
+		return
+	}
+	if user == nil {
+		http.Error(w, "auto-login user not found", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := p.Response(ResponseRequest{
+		Username:     user.Username,
+		SPEntityID:   req.Issuer,
+		ACSURL:       acsURL,
+		InResponseTo: req.ID,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.post(w, acsURL, data, relayState)
+}
+
+// acsURL returns where the response to req is posted. Registered service
+// providers may only use their own assertion consumer service.
+func (p *IdP) acsURL(req *saml.AuthnRequest) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.sps) == 0 {
+		if req.AssertionConsumerServiceURL == "" {
+			return "", errors.New("AssertionConsumerServiceURL is required")
+		}
+		return req.AssertionConsumerServiceURL, nil
+	}
+	sp, ok := p.sps[req.Issuer]
+	switch {
+	case !ok:
+		return "", errors.New("unknown service provider " + req.Issuer)
+	case req.AssertionConsumerServiceURL == "":
+		return sp.ACSURL, nil
+	case req.AssertionConsumerServiceURL != sp.ACSURL:
+		return "", errors.New("invalid AssertionConsumerServiceURL " + req.AssertionConsumerServiceURL)
+	}
+	return sp.ACSURL, nil
+}
+
+func (p *IdP) renderLogin(w http.ResponseWriter, r *http.Request, req *saml.AuthnRequest, status int, message string) {
+	hidden := map[string]string{}
+	if req.ID != "" {
+		// The form always posts, so the request is re-encoded for the
+		// HTTP-POST binding.
+		data, err := xml.Marshal(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		hidden["SAMLRequest"] = base64.StdEncoding.EncodeToString(data)
+	} else {
+		hidden["sp"] = req.Issuer
+	}
+	if relayState := r.Form.Get("RelayState"); relayState != "" {
+		hidden["RelayState"] = relayState
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = loginForm.Execute(w, map[string]interface{}{
+		"Action": r.URL.Path,
+		"Params": hidden,
+		"Error":  message,
+	})
+}
+
+func (p *IdP) post(w http.ResponseWriter, acsURL string, response []byte, relayState string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = postForm.Execute(w, map[string]string{
+		"ACSURL":       acsURL,
+		"SAMLResponse": base64.StdEncoding.EncodeToString(response),
+		"RelayState":   relayState,
+	})
+}
+
+// postError posts an unsigned Response with a Requester status.
+func (p *IdP) postError(w http.ResponseWriter, req *saml.AuthnRequest, acsURL, relayState, message string) {
+	data, err := xml.Marshal(saml.Response{
+		ID:           saml.NewID(),
+		InResponseTo: req.ID,
+		Version:      "2.0",
+		IssueInstant: time.Now().UTC(),
+		Destination:  acsURL,
+		Issuer:       p.entityID,
+		Status: saml.Status{
+			StatusCode:    saml.StatusCode{Value: saml.StatusRequester},
+			StatusMessage: message,
+		},
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p.post(w, acsURL, data, relayState)
+}
+
+// handleSLO ends the session of the NameID in a LogoutRequest.
+func (p *IdP) handleSLO(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req saml.LogoutRequest
+	if err := saml.DecodeMessage(r.Form.Get("SAMLRequest"), r.Method == http.MethodGet, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	p.logouts = append(p.logouts, req.NameID.Value)
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, "Signed out.\n")
+}
+
+func (p *IdP) lookupUser(username string) *User {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.users[username]
+}
+
+func (p *IdP) authenticate(username, password string) *User {
+	u := p.lookupUser(username)
+	if u == nil || u.Password != password {
+		return nil
+	}
+	return u
+}
+
+// PostedResponse is a Response delivered by the SSO endpoint's auto-submit
+// form.
+type PostedResponse struct {
+	ACSURL     string
+	RelayState string
+	// XML is the decoded SAMLResponse.
+	XML []byte
+}
+
+var (
+	formAction = regexp.MustCompile(`<form id="saml-response" method="post" action="([^"]*)">`)
+	formInput  = regexp.MustCompile(`<input type="hidden" name="(SAMLResponse|RelayState)" value="([^"]*)">`)
+)
+
+// ReadPostedResponse extracts the Response from the HTML the SSO endpoint
+// returns, standing in for the browser that would submit it.
+func ReadPostedResponse(body []byte) (*PostedResponse, error) {
+	m := formAction.FindSubmatch(body)
+	if m == nil {
+		return nil, errors.New("no SAML response form in page")
+	}
+	posted := &PostedResponse{ACSURL: html.UnescapeString(string(m[1]))}
+	for _, input := range formInput.FindAllSubmatch(body, -1) {
+		value := html.UnescapeString(string(input[2]))
+		switch string(input[1]) {
+		case "SAMLResponse":
+			data, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return nil, err
+			}
+			posted.XML = data
+		case "RelayState":
+			posted.RelayState = value
+		}
+	}
+	if posted.XML == nil {
+		return nil, errors.New("no SAMLResponse in form")
+	}
+	return posted, nil
+}
@@ -0,0 +1,288 @@
+// Package mocksaml is an in-process SAML 2.0 identity provider for offline
+// tests. It serves metadata, single sign-on over the HTTP-Redirect and
+// HTTP-POST bindings and single logout over TLS, and issues signed
+// Responses whose attributes come from the same attribute_mapping and
+// attribute_statements values the Terraform modules are given.
+package mocksaml
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mockoidc"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+)
+
+// Paths the identity provider serves.
+const (
+	MetadataPath = "/metadata"
+	SSOPath      = "/sso"
+	SLOPath      = "/slo"
+)
+
+// User is an account that can sign in to the mock identity provider.
+type User struct {
+	Username  string
+	Password  string
+	Email     string
+	FirstName string
+	LastName  string
+	Groups    []string
+	// Attributes are looked up by attribute expressions before the fields
+	// above, so they can also override them.
+	Attributes map[string][]string
+}
+
+// ServiceProvider is a registered service provider. When none are
+// registered the identity provider answers any AuthnRequest that names an
+// assertion consumer service URL.
+type ServiceProvider struct {
+	EntityID string
+	ACSURL   string
+}
+
+// Signing selects which elements of a Response are signed.
+type Signing string
+
+const (
+	// SignAssertion signs each Assertion, as Okta and Keycloak do by
+	// default.
+	SignAssertion Signing = "assertion"
+	// SignResponse signs only the Response element.
+	SignResponse Signing = "response"
+	// SignBoth signs the Assertions and then the Response.
+	SignBoth Signing = "both"
+)
+
+// Options configures an IdP.
+type Options struct {
+	// EntityID is the identity provider's entity ID, the metadata URL by
+	// default.
+	EntityID string
+	// Key signs responses. A 2048-bit key is generated when nil.
+	Key *mockoidc.SigningKey
+	// SignatureAlgorithm is a signature_algorithm value such as RSA_SHA256,
+	// the default, or an algorithm URI.
+	SignatureAlgorithm string
+	// Signing selects the signed elements, SignAssertion by default.
+	Signing Signing
+	// NameIDFormat is the format of issued NameIDs, emailAddress by default.
+	NameIDFormat string
+	// Attributes are added to every assertion. See AttributesFromMapping
+	// and AttributesFromStatements.
+	Attributes []Attribute
+	// Users that may sign in. A single "testuser" with password "password"
+	// is created when empty.
+	Users []User
+	// ServiceProviders that may request assertions.
+	ServiceProviders []ServiceProvider
+	// AutoLogin signs the named user in without showing the login form.
+	AutoLogin string
+	// AssertionTTL is how long assertions are valid, five minutes by
+	// default.
+	AssertionTTL time.Duration
+}
+
+// IdP is a running mock SAML identity provider.
+type IdP struct {
+	Server *httptest.Server
+
+	entityID     string
+	key          *mockoidc.SigningKey
+	sigAlg       string
+	signing      Signing
+	nameIDFormat string
+	attributes   []Attribute
+	ttl          time.Duration
+	autoLogin    string
+
+	mu      sync.Mutex
+	users   map[string]*User
+	sps     map[string]ServiceProvider
+	logouts []string
+}
+
+// New starts a TLS mock identity provider. Call Close when done.
+func New(opts Options) (*IdP, error) {
+	if opts.SignatureAlgorithm == "" {
+		opts.SignatureAlgorithm = "RSA_SHA256"
+	}
+	sigAlg, ok := saml.SignatureAlgorithmURI(opts.SignatureAlgorithm)
+	if !ok {
+		return nil, fmt.Errorf("unknown signature algorithm %q", opts.SignatureAlgorithm)
+	}
+	if opts.Signing == "" {
+		opts.Signing = SignAssertion
+	}
+	if opts.NameIDFormat == "" {
+		opts.NameIDFormat = saml.NameIDFormatEmailAddress
+	}
+	if opts.AssertionTTL == 0 {
+		opts.AssertionTTL = 5 * time.Minute
+	}
+	if opts.Key == nil {
+		// Metadata validation fails certificates close to expiry, so the
+		// generated one lasts as long as a real identity provider's.
+		key, err := mockoidc.GenerateSigningKey(mockoidc.DefaultKeySize, "mocksaml", 365*24*time.Hour)
+		if err != nil {
+			return nil, fmt.Errorf("generating signing key: %w", err)
+		}
+		opts.Key = key
+	}
+	if len(opts.Users) == 0 {
+		opts.Users = []User{{Username: "testuser", Password: "password", Email: "testuser@example.com", FirstName: "Test", LastName: "User"}}
+	}
+
+	p := &IdP{
+		key:          opts.Key,
+		sigAlg:       sigAlg,
+		signing:      opts.Signing,
+		nameIDFormat: opts.NameIDFormat,
+		attributes:   append([]Attribute(nil), opts.Attributes...),
+		ttl:          opts.AssertionTTL,
+		autoLogin:    opts.AutoLogin,
+		users:        map[string]*User{},
+		sps:          map[string]ServiceProvider{},
+	}
+	for i := range opts.Users {
+		u := opts.Users[i]
+		p.users[u.Username] = &u
+	}
+	for _, sp := range opts.ServiceProviders {
+		p.sps[sp.EntityID] = sp
+	}
+
+	p.Server = httptest.NewUnstartedServer(p.routes())
+	p.Server.StartTLS()
+
+	p.entityID = opts.EntityID
+	if p.entityID == "" {
+		p.entityID = p.MetadataURL()
+	}
+	return p, nil
+}
+
+// Start starts an identity provider and closes it when the test finishes.
+func Start(t testing.TB, opts Options) *IdP {
+	t.Helper()
+	p, err := New(opts)
+	if err != nil {
+		t.Fatalf("starting mock SAML identity provider: %v", err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+// Close shuts the server down.
+func (p *IdP) Close() {
+	p.Server.Close()
+}
+
+// EntityID returns the identity provider's entity ID.
+func (p *IdP) EntityID() string {
+	return p.entityID
+}
+
+// MetadataURL returns the URL of the metadata document, the value for a
+// metadata_url input.
+func (p *IdP) MetadataURL() string {
+	return p.Server.URL + MetadataPath
+}
+
+// SSOURL returns the single sign-on URL for both bindings.
+func (p *IdP) SSOURL() string {
+	return p.Server.URL + SSOPath
+}
+
+// SLOURL returns the single logout URL.
+func (p *IdP) SLOURL() string {
+	return p.Server.URL + SLOPath
+}
+
+// HTTPClient returns a client that trusts the identity provider's TLS
+// certificate.
+func (p *IdP) HTTPClient() *http.Client {
+	return p.Server.Client()
+}
+
+// Key returns the signing key.
+func (p *IdP) Key() *mockoidc.SigningKey {
+	return p.key
+}
+
+// Certificate returns the signing certificate as bare base64 DER, the
+// encoding of a signing_certificate input.
+func (p *IdP) Certificate() string {
+	return base64.StdEncoding.EncodeToString(p.key.Certificate.Raw)
+}
+
+// SignatureAlgorithm returns the signature algorithm URI.
+func (p *IdP) SignatureAlgorithm() string {
+	return p.sigAlg
+}
+
+// Metadata returns the identity provider's metadata document.
+func (p *IdP) Metadata() ([]byte, error) {
+	endpoints := []saml.Endpoint{
+		{Binding: saml.HTTPRedirectBinding, Location: p.SSOURL()},
+		{Binding: saml.HTTPPostBinding, Location: p.SSOURL()},
+	}
+	wantSigned := false
+	data, err := xml.MarshalIndent(saml.EntityDescriptor{
+		EntityID: p.entityID,
+		IDPSSODescriptors: []saml.IDPSSODescriptor{{
+			ProtocolSupportEnumeration: saml.ProtocolNS,
+			WantAuthnRequestsSigned:    &wantSigned,
+			Extensions: &saml.Extensions{
+				SigningMethods: []saml.AlgorithmRef{{Algorithm: p.sigAlg}},
+			},
+			KeyDescriptors: []saml.KeyDescriptor{{
+				Use: "signing",
+				KeyInfo: saml.KeyInfo{
+					X509Data: saml.X509Data{X509Certificates: []string{p.Certificate()}},
+				},
+			}},
+			SingleLogoutServices: []saml.Endpoint{
+				{Binding: saml.HTTPRedirectBinding, Location: p.SLOURL()},
+			},
+			NameIDFormats:        []string{p.nameIDFormat},
+			SingleSignOnServices: endpoints,
+		}},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// AddUser registers another user.
+func (p *IdP) AddUser(u User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.users[u.Username] = &u
+}
+
+// User returns the registered user with the given name.
+func (p *IdP) User(username string) (User, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u, ok := p.users[username]
+	if !ok {
+		return User{}, false
+	}
+	return *u, true
+}
+
+// Logouts returns the NameIDs whose sessions were ended through the single
+// logout endpoint.
+func (p *IdP) Logouts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.logouts...)
+}
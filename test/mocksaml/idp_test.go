@@ -0,0 +1,340 @@
+package mocksaml
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+)
+
+const (
+	spEntityID = "urn:amazon:cognito:sp:us-east-1_TestPool1"
+	acsURL     = "https://test.auth.us-east-1.amazoncognito.com/saml2/idpresponse"
+)
+
+// noRedirects keeps the client on the identity provider, whose pages the
+// tests inspect.
+func noRedirects(p *IdP) *http.Client {
+	client := *p.HTTPClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return &client
+}
+
+func get(t *testing.T, p *IdP, target string) (int, []byte) {
+	t.Helper()
+	resp, err := noRedirects(p).Get(target)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, body
+}
+
+func submitForm(t *testing.T, p *IdP, target string, form url.Values) (int, []byte) {
+	t.Helper()
+	resp, err := noRedirects(p).PostForm(target, form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, body
+}
+
+// signingCertificates fetches the metadata the way a service provider
+// configured with metadata_url does.
+func signingCertificates(t *testing.T, p *IdP) []*x509.Certificate {
+	t.Helper()
+	md, err := saml.Fetch(context.Background(), p.HTTPClient(), p.MetadataURL())
+	require.NoError(t, err)
+	certs, err := md.IDPSSODescriptor().SigningCertificates()
+	require.NoError(t, err)
+	return certs
+}
+
+// signIn runs SP initiated sign-in over the HTTP-Redirect binding and
+// returns the verified response.
+func signIn(t *testing.T, p *IdP, relayState string) (*saml.AuthnRequest, *saml.Response) {
+	t.Helper()
+	req := saml.NewAuthnRequest(spEntityID, acsURL, p.SSOURL())
+	target, err := req.RedirectURL(p.SSOURL(), relayState)
+	require.NoError(t, err)
+
+	status, body := get(t, p, target)
+	require.Equal(t, http.StatusOK, status, string(body))
+	posted, err := ReadPostedResponse(body)
+	require.NoError(t, err)
+	assert.Equal(t, acsURL, posted.ACSURL)
+	assert.Equal(t, relayState, posted.RelayState)
+
+	resp, err := saml.VerifyResponse(posted.XML, signingCertificates(t, p))
+	require.NoError(t, err)
+	return req, resp
+}
+
+func TestMetadata(t *testing.T) {
+	p := Start(t, Options{SignatureAlgorithm: "RSA_SHA512"})
+
+	md, err := saml.Fetch(context.Background(), p.HTTPClient(), p.MetadataURL())
+	require.NoError(t, err)
+	assert.Equal(t, p.MetadataURL(), md.EntityID)
+
+	findings := saml.Validate(md, saml.Options{
+		EntityID:           p.EntityID(),
+		SSOURL:             p.SSOURL(),
+		NameIDFormat:       saml.NameIDFormatEmailAddress,
+		Certificate:        p.Certificate(),
+		SignatureAlgorithm: "RSA_SHA512",
+	})
+	// The generated certificate is valid for a day.
+	for _, f := range findings {
+		assert.Contains(t, f.Message, "expires on", f.String())
+	}
+	assert.Empty(t, saml.Validate(md, saml.Options{ExpiryWarning: -1, SignatureAlgorithm: "RSA_SHA512"}))
+	assert.NotEmpty(t, saml.Validate(md, saml.Options{ExpiryWarning: -1, SignatureAlgorithm: "RSA_SHA256"}).Errors())
+}
+
+func TestRedirectBindingRoundTrip(t *testing.T) {
+	p := Start(t, Options{
+		AutoLogin: "jdoe",
+		Users: []User{{
+			Username:  "jdoe",
+			Email:     "jdoe@example.com",
+			FirstName: "Jane",
+			LastName:  "Doe",
+			Groups:    []string{"Administrators", "Users"},
+		}},
+		Attributes: AttributesFromMapping(map[string]string{
+			"email":       "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+			"given_name":  "firstName",
+			"family_name": "lastName",
+		}),
+	})
+
+	req, resp := signIn(t, p, "state-123")
+	findings := saml.ValidateResponse(resp, saml.ResponseOptions{
+		Issuer:                  p.EntityID(),
+		Audience:                spEntityID,
+		Recipient:               acsURL,
+		InResponseTo:            req.ID,
+		NameIDFormat:            saml.NameIDFormatEmailAddress,
+		RequireSignedAssertions: true,
+	})
+	assert.Empty(t, findings, findings.String())
+
+	require.Len(t, resp.Assertions, 1)
+	a := resp.Assertions[0]
+	assert.True(t, a.Signed)
+	assert.False(t, resp.Signed)
+	assert.Equal(t, "jdoe@example.com", a.Subject.NameID.Value)
+	assert.Equal(t, map[string][]string{
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": {"jdoe@example.com"},
+		"firstName": {"Jane"},
+		"lastName":  {"Doe"},
+	}, a.Attributes())
+	assert.Equal(t, saml.AttrNameFormatURI, a.AttributeStatements[0].Attributes[0].NameFormat)
+}
+
+func TestLoginForm(t *testing.T) {
+	p := Start(t, Options{})
+	req := saml.NewAuthnRequest(spEntityID, acsURL, p.SSOURL())
+	target, err := req.RedirectURL(p.SSOURL(), "")
+	require.NoError(t, err)
+
+	status, body := get(t, p, target)
+	require.Equal(t, http.StatusOK, status)
+	assert.Contains(t, string(body), `id="login-form"`)
+
+	// The form re-posts the request with the HTTP-POST binding.
+	encoded, err := encodePost(req)
+	require.NoError(t, err)
+	form := url.Values{"SAMLRequest": {encoded}, "username": {"testuser"}, "password": {"wrong"}}
+	status, body = submitForm(t, p, p.SSOURL(), form)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Contains(t, string(body), "Invalid username or password.")
+
+	form.Set("password", "password")
+	status, body = submitForm(t, p, p.SSOURL(), form)
+	require.Equal(t, http.StatusOK, status, string(body))
+	posted, err := ReadPostedResponse(body)
+	require.NoError(t, err)
+
+	resp, err := saml.VerifyResponse(posted.XML, signingCertificates(t, p))
+	require.NoError(t, err)
+	assert.Equal(t, req.ID, resp.InResponseTo)
+	assert.Equal(t, "testuser@example.com", resp.Assertions[0].Subject.NameID.Value)
+}
+
+// encodePost encodes a message for the HTTP-POST binding.
+func encodePost(msg interface{}) (string, error) {
+	data, err := xml.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func TestSigningModes(t *testing.T) {
+	for _, tc := range []struct {
+		signing                    Signing
+		responseSigned, assertions bool
+	}{
+		{SignAssertion, false, true},
+		{SignResponse, true, false},
+		{SignBoth, true, true},
+	} {
+		t.Run(string(tc.signing), func(t *testing.T) {
+			p := Start(t, Options{AutoLogin: "testuser", Signing: tc.signing})
+			req, resp := signIn(t, p, "")
+			assert.Equal(t, tc.responseSigned, resp.Signed)
+			assert.Equal(t, tc.assertions, resp.Assertions[0].Signed)
+
+			findings := saml.ValidateResponse(resp, saml.ResponseOptions{
+				InResponseTo:            req.ID,
+				RequireSignedAssertions: true,
+			})
+			if tc.assertions {
+				assert.Empty(t, findings)
+			} else {
+				assert.Equal(t, saml.Findings{{Severity: saml.Error, Field: "Assertion[0]", Message: "is not signed"}}, findings)
+			}
+		})
+	}
+}
+
+func TestTamperedResponseFailsVerification(t *testing.T) {
+	p := Start(t, Options{Attributes: []Attribute{{Name: "role", Values: []string{`"user"`}}}})
+	data, err := p.Response(ResponseRequest{Username: "testuser", SPEntityID: spEntityID, ACSURL: acsURL})
+	require.NoError(t, err)
+	certs := signingCertificates(t, p)
+
+	_, err = saml.VerifyResponse(data, certs)
+	require.NoError(t, err)
+
+	tampered := bytes.Replace(data, []byte(">user<"), []byte(">admin<"), 1)
+	require.NotEqual(t, data, tampered)
+	_, err = saml.VerifyResponse(tampered, certs)
+	assert.ErrorContains(t, err, "verifying Assertion")
+
+	other := Start(t, Options{})
+	_, err = saml.VerifyResponse(data, signingCertificates(t, other))
+	assert.Error(t, err)
+}
+
+func TestRegisteredServiceProviders(t *testing.T) {
+	p := Start(t, Options{
+		AutoLogin:        "testuser",
+		ServiceProviders: []ServiceProvider{{EntityID: spEntityID, ACSURL: acsURL}},
+	})
+
+	// IdP initiated sign-in has no request to respond to.
+	status, body := get(t, p, p.SSOURL()+"?sp="+url.QueryEscape(spEntityID))
+	require.Equal(t, http.StatusOK, status, string(body))
+	posted, err := ReadPostedResponse(body)
+	require.NoError(t, err)
+	resp, err := saml.VerifyResponse(posted.XML, signingCertificates(t, p))
+	require.NoError(t, err)
+	assert.Empty(t, saml.ValidateResponse(resp, saml.ResponseOptions{Audience: spEntityID, Recipient: acsURL}))
+
+	req := saml.NewAuthnRequest(spEntityID, "https://evil.example.com/acs", p.SSOURL())
+	target, err := req.RedirectURL(p.SSOURL(), "")
+	require.NoError(t, err)
+	status, body = get(t, p, target)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, string(body), "invalid AssertionConsumerServiceURL")
+
+	status, body = get(t, p, p.SSOURL()+"?sp=unknown")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, string(body), "unknown service provider")
+}
+
+func TestNameIDPolicy(t *testing.T) {
+	p := Start(t, Options{AutoLogin: "testuser", NameIDFormat: saml.NameIDFormatPersistent})
+	req := saml.NewAuthnRequest(spEntityID, acsURL, p.SSOURL())
+	req.NameIDPolicy = &saml.NameIDPolicy{Format: saml.NameIDFormatEmailAddress}
+	target, err := req.RedirectURL(p.SSOURL(), "")
+	require.NoError(t, err)
+
+	_, body := get(t, p, target)
+	posted, err := ReadPostedResponse(body)
+	require.NoError(t, err)
+	var resp saml.Response
+	require.NoError(t, xml.Unmarshal(posted.XML, &resp))
+	findings := saml.ValidateResponse(&resp, saml.ResponseOptions{InResponseTo: req.ID})
+	require.Len(t, findings, 1)
+	assert.Equal(t, "Response.Status", findings[0].Field)
+	assert.Contains(t, findings[0].Message, saml.StatusRequester)
+
+	// A persistent NameID is stable across sign-ins.
+	_, first := signIn(t, p, "")
+	_, second := signIn(t, p, "")
+	assert.Equal(t, first.Assertions[0].Subject.NameID.Value, second.Assertions[0].Subject.NameID.Value)
+	assert.NotContains(t, first.Assertions[0].Subject.NameID.Value, "testuser")
+}
+
+func TestAttributesFromStatements(t *testing.T) {
+	attrs, err := AttributesFromStatements([]map[string]interface{}{
+		{"type": "EXPRESSION", "name": "email", "namespace": saml.AttrNameFormatBasic, "values": []string{"user.email"}},
+		{"type": "EXPRESSION", "name": "roles", "namespace": saml.AttrNameFormatBasic,
+			"values": []interface{}{`isMemberOfGroupName("Administrators") ? "admin" : "user"`}},
+		{"name": "groups", "values": []string{"user.groups"}},
+		{"name": "department", "values": []string{"user.department"}},
+	})
+	require.NoError(t, err)
+
+	p := Start(t, Options{
+		Attributes: attrs,
+		Users: []User{
+			{Username: "admin", Email: "admin@example.com", Groups: []string{"Administrators", "Everyone"}},
+			{Username: "user", Email: "user@example.com", Attributes: map[string][]string{"department": {"Sales"}}},
+		},
+	})
+
+	assertion := func(username string) map[string][]string {
+		data, err := p.Response(ResponseRequest{Username: username, SPEntityID: spEntityID, ACSURL: acsURL})
+		require.NoError(t, err)
+		resp, err := saml.VerifyResponse(data, signingCertificates(t, p))
+		require.NoError(t, err)
+		return resp.Assertions[0].Attributes()
+	}
+	assert.Equal(t, map[string][]string{
+		"email":  {"admin@example.com"},
+		"roles":  {"admin"},
+		"groups": {"Administrators", "Everyone"},
+	}, assertion("admin"))
+	assert.Equal(t, map[string][]string{
+		"email":      {"user@example.com"},
+		"roles":      {"user"},
+		"department": {"Sales"},
+	}, assertion("user"))
+
+	_, err = AttributesFromStatements([]map[string]interface{}{{"type": "GROUP", "name": "groups"}})
+	assert.ErrorContains(t, err, `type "GROUP" is not supported`)
+}
+
+func TestSingleLogout(t *testing.T) {
+	p := Start(t, Options{})
+	req := saml.LogoutRequest{
+		ID:      saml.NewID(),
+		Version: "2.0",
+		Issuer:  spEntityID,
+		NameID:  saml.NameID{Format: saml.NameIDFormatEmailAddress, Value: "testuser@example.com"},
+	}
+	encoded, err := encodePost(&req)
+	require.NoError(t, err)
+
+	status, body := submitForm(t, p, p.SLOURL(), url.Values{"SAMLRequest": {encoded}})
+	require.Equal(t, http.StatusOK, status, string(body))
+	assert.True(t, strings.HasPrefix(string(body), "Signed out."))
+	assert.Equal(t, []string{"testuser@example.com"}, p.Logouts())
+}
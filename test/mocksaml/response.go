@@ -0,0 +1,168 @@
+package mocksaml
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+)
+
+// ResponseRequest describes a Response to issue.
+type ResponseRequest struct {
+	// Username is the signed-in user.
+	Username string
+	// SPEntityID is the audience of the assertion.
+	SPEntityID string
+	// ACSURL is the assertion consumer service URL the response is posted
+	// to; it is the Destination and the bearer confirmation Recipient.
+	ACSURL string
+	// InResponseTo is the AuthnRequest ID, empty for IdP initiated sign-in.
+	InResponseTo string
+}
+
+// Response returns a signed Response for req as XML. The SSO endpoint posts
+// the same document; tests can also call Response directly to feed a
+// service provider an assertion without a browser.
+func (p *IdP) Response(req ResponseRequest) ([]byte, error) {
+	u := p.lookupUser(req.Username)
+	if u == nil {
+		return nil, fmt.Errorf("unknown user %q", req.Username)
+	}
+
+	now := time.Now().UTC()
+	notBefore := now.Add(-time.Minute)
+	notOnOrAfter := now.Add(p.ttl)
+
+	assertion := saml.Assertion{
+		ID:           saml.NewID(),
+		Version:      "2.0",
+		IssueInstant: now,
+		Issuer:       p.entityID,
+		Subject: saml.Subject{
+			NameID: saml.NameID{Format: p.nameIDFormat, Value: p.nameID(u)},
+			SubjectConfirmations: []saml.SubjectConfirmation{{
+				Method: saml.BearerConfirmation,
+				Data: saml.SubjectConfirmationData{
+					InResponseTo: req.InResponseTo,
+					NotOnOrAfter: &notOnOrAfter,
+					Recipient:    req.ACSURL,
+				},
+			}},
+		},
+		Conditions: &saml.Conditions{
+			NotBefore:    &notBefore,
+			NotOnOrAfter: &notOnOrAfter,
+			AudienceRestrictions: []saml.AudienceRestriction{{
+				Audiences: []string{req.SPEntityID},
+			}},
+		},
+		AuthnStatements: []saml.AuthnStatement{{
+			AuthnInstant: now,
+			SessionIndex: saml.NewID(),
+			AuthnContext: saml.AuthnContext{AuthnContextClassRef: saml.PasswordProtectedTransport},
+		}},
+	}
+	var attrs []saml.Attribute
+	for _, a := range p.attributes {
+		if values := a.resolve(u); len(values) > 0 {
+			attrs = append(attrs, saml.Attribute{Name: a.Name, NameFormat: a.NameFormat, Values: values})
+		}
+	}
+	if len(attrs) > 0 {
+		assertion.AttributeStatements = []saml.AttributeStatement{{Attributes: attrs}}
+	}
+
+	assertionEl, err := toElement(assertion)
+	if err != nil {
+		return nil, err
+	}
+	if p.signing != SignResponse {
+		if err := p.sign(assertionEl); err != nil {
+			return nil, fmt.Errorf("signing assertion: %w", err)
+		}
+	}
+
+	responseEl, err := toElement(saml.Response{
+		ID:           saml.NewID(),
+		InResponseTo: req.InResponseTo,
+		Version:      "2.0",
+		IssueInstant: now,
+		Destination:  req.ACSURL,
+		Issuer:       p.entityID,
+		Status:       saml.Status{StatusCode: saml.StatusCode{Value: saml.StatusSuccess}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	responseEl.AddChild(assertionEl)
+	if p.signing != SignAssertion {
+		if err := p.sign(responseEl); err != nil {
+			return nil, fmt.Errorf("signing response: %w", err)
+		}
+	}
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	doc.SetRoot(responseEl)
+	return doc.WriteToBytes()
+}
+
+// nameID returns the user's identifier in the configured format.
+func (p *IdP) nameID(u *User) string {
+	switch p.nameIDFormat {
+	case saml.NameIDFormatEmailAddress:
+		if u.Email != "" {
+			return u.Email
+		}
+	case saml.NameIDFormatPersistent:
+		sum := sha256.Sum256([]byte(p.entityID + "|" + u.Username))
+		return hex.EncodeToString(sum[:16])
+	case saml.NameIDFormatTransient:
+		return saml.NewID()
+	}
+	return u.Username
+}
+
+// sign adds an enveloped signature to el, placed right after its Issuer as
+// the SAML schema requires.
+func (p *IdP) sign(el *etree.Element) error {
+	ctx, err := dsig.NewSigningContext(p.key.Key, [][]byte{p.key.Certificate.Raw})
+	if err != nil {
+		return err
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	if err := ctx.SetSignatureMethod(p.sigAlg); err != nil {
+		return err
+	}
+	sig, err := ctx.ConstructSignature(el, true)
+	if err != nil {
+		return err
+	}
+
+	index := 0
+	if issuer := el.SelectElement("Issuer"); issuer != nil {
+		index = issuer.Index() + 1
+	}
+	el.InsertChildAt(index, sig)
+	return nil
+}
+
+// toElement marshals v and parses it back as an element that can be
+// signed.
+func toElement(v interface{}) (*etree.Element, error) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+	return doc.Root(), nil
+}
@@ -0,0 +1,36 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUnitModuleReadmeTables fails when the input and output tables of a
+// module README no longer match its variable and output blocks. Regenerate
+// them from the test directory with
+//
+//	go run ./cmd/moduledocs ../modules/*
+func TestUnitModuleReadmeTables(t *testing.T) {
+	t.Parallel()
+
+	modules, err := filepath.Glob(filepath.Join("..", "modules", "*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, modules)
+
+	for _, dir := range modules {
+		name := filepath.Base(dir)
+		t.Run(name, func(t *testing.T) {
+			m := loadModuleConfig(t, filepath.ToSlash(filepath.Join("modules", name)))
+			readme, err := os.ReadFile(filepath.Join(dir, "README.md"))
+			require.NoError(t, err)
+
+			want, err := m.UpdateReadme(readme)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), string(readme), "modules/%s/README.md is out of date; run go run ./cmd/moduledocs ../modules/*", name)
+		})
+	}
+}
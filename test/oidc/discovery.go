@@ -0,0 +1,154 @@
+// Package oidc validates OpenID Provider metadata against OpenID Connect
+// Discovery 1.0, and the key sets it points to, so every provider's tests
+// apply the same rules to the documents their deployments publish.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// WellKnownPath is the path appended to the issuer to locate the discovery
+// document (Discovery 1.0 section 4).
+const WellKnownPath = "/.well-known/openid-configuration"
+
+// Discovery is the OpenID Provider metadata defined in Discovery 1.0 section
+// 3, plus the logout, introspection, revocation and PKCE fields the
+// providers commonly publish.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	RegistrationEndpoint  string `json:"registration_endpoint"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+	CheckSessionIframe    string `json:"check_session_iframe"`
+	ServiceDocumentation  string `json:"service_documentation"`
+	OPPolicyURI           string `json:"op_policy_uri"`
+	OPTosURI              string `json:"op_tos_uri"`
+
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	ResponseModesSupported                     []string `json:"response_modes_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	ACRValuesSupported                         []string `json:"acr_values_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	IDTokenEncryptionAlgValuesSupported        []string `json:"id_token_encryption_alg_values_supported"`
+	IDTokenEncryptionEncValuesSupported        []string `json:"id_token_encryption_enc_values_supported"`
+	UserInfoSigningAlgValuesSupported          []string `json:"userinfo_signing_alg_values_supported"`
+	RequestObjectSigningAlgValuesSupported     []string `json:"request_object_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	DisplayValuesSupported                     []string `json:"display_values_supported"`
+	ClaimTypesSupported                        []string `json:"claim_types_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+	ClaimsLocalesSupported                     []string `json:"claims_locales_supported"`
+	UILocalesSupported                         []string `json:"ui_locales_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+
+	ClaimsParameterSupported                   *bool `json:"claims_parameter_supported"`
+	RequestParameterSupported                  *bool `json:"request_parameter_supported"`
+	RequestURIParameterSupported               *bool `json:"request_uri_parameter_supported"`
+	RequireRequestURIRegistration              *bool `json:"require_request_uri_registration"`
+	FrontchannelLogoutSupported                *bool `json:"frontchannel_logout_supported"`
+	BackchannelLogoutSupported                 *bool `json:"backchannel_logout_supported"`
+	FrontchannelLogoutSessionSupported         *bool `json:"frontchannel_logout_session_supported"`
+	BackchannelLogoutSessionSupported          *bool `json:"backchannel_logout_session_supported"`
+	AuthorizationResponseIssParameterSupported *bool `json:"authorization_response_iss_parameter_supported"`
+
+	// Raw holds every member of the document, including ones the struct
+	// does not model.
+	Raw map[string]json.RawMessage `json:"-"`
+
+	// parseFindings are members that were present with the wrong JSON type.
+	parseFindings []Finding
+}
+
+// Parse decodes a discovery document. Members with the wrong JSON type are
+// left empty and reported by Validate instead of failing the whole parse, so
+// one bad field does not hide the others.
+func Parse(data []byte) (*Discovery, error) {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("discovery document is not a JSON object: %w", err)
+	}
+
+	d := &Discovery{Raw: raw}
+	v := reflect.ValueOf(d).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		member, ok := raw[name]
+		if !ok || string(member) == "null" {
+			continue
+		}
+		if err := json.Unmarshal(member, v.Field(i).Addr().Interface()); err != nil {
+			d.parseFindings = append(d.parseFindings, Finding{
+				Severity: Error,
+				Field:    name,
+				Message:  "must be " + jsonTypeName(field.Type),
+			})
+		}
+	}
+	return d, nil
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		return "an array of strings"
+	case reflect.Ptr:
+		return "a boolean"
+	default:
+		return t.String()
+	}
+}
+
+// Fetch retrieves and parses the discovery document at url. A non-200
+// response or a non-JSON content type is an error.
+func Fetch(ctx context.Context, client *http.Client, url string) (*Discovery, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		return nil, fmt.Errorf("fetching %s: content type %q is not application/json", url, resp.Header.Get("Content-Type"))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", url, err)
+	}
+	return Parse(body)
+}
+
+// DiscoveryURL returns the location of the discovery document for issuer.
+func DiscoveryURL(issuer string) string {
+	return strings.TrimSuffix(issuer, "/") + WellKnownPath
+}
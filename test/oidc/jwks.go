@@ -0,0 +1,380 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWK is a JSON Web Key (RFC 7517) as published in a provider's key set.
+type JWK struct {
+	Kid     string   `json:"kid,omitempty"`
+	Kty     string   `json:"kty"`
+	Use     string   `json:"use,omitempty"`
+	KeyOps  []string `json:"key_ops,omitempty"`
+	Alg     string   `json:"alg,omitempty"`
+	N       string   `json:"n,omitempty"`
+	E       string   `json:"e,omitempty"`
+	Crv     string   `json:"crv,omitempty"`
+	X       string   `json:"x,omitempty"`
+	Y       string   `json:"y,omitempty"`
+	X5c     []string `json:"x5c,omitempty"`
+	X5t     string   `json:"x5t,omitempty"`
+	X5tS256 string   `json:"x5t#S256,omitempty"`
+
+	// Raw holds every member of the key, so private members that must not
+	// be published can be detected.
+	Raw map[string]json.RawMessage `json:"-"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Key returns the key with the given kid.
+func (s *JWKS) Key(kid string) (JWK, bool) {
+	for _, k := range s.Keys {
+		if k.Kid == kid {
+			return k, true
+		}
+	}
+	return JWK{}, false
+}
+
+// KeyIDs returns the kid of every key in document order.
+func (s *JWKS) KeyIDs() []string {
+	ids := make([]string, len(s.Keys))
+	for i, k := range s.Keys {
+		ids[i] = k.Kid
+	}
+	return ids
+}
+
+// Keyfunc returns the public key of the member of the set named by the kid
+// header of t. It is a jwt.Keyfunc.
+func (s *JWKS) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := s.Key(kid)
+	if !ok {
+		return nil, fmt.Errorf("no key %q among %v", kid, s.KeyIDs())
+	}
+	return key.PublicKey()
+}
+
+// ParserOptions are the checks every token verified against a key set must
+// pass: a signature with one of algs, the issuer issuer and an expiry.
+func ParserOptions(issuer string, algs ...string) []jwt.ParserOption {
+	return []jwt.ParserOption{jwt.WithValidMethods(algs), jwt.WithIssuer(issuer), jwt.WithExpirationRequired()}
+}
+
+// ParseJWKS decodes a JSON Web Key Set.
+func ParseJWKS(data []byte) (*JWKS, error) {
+	var doc struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("key set is not a JSON object: %w", err)
+	}
+	if doc.Keys == nil {
+		return nil, errors.New(`key set has no "keys" member`)
+	}
+
+	set := &JWKS{Keys: make([]JWK, len(doc.Keys))}
+	for i, raw := range doc.Keys {
+		if err := json.Unmarshal(raw, &set.Keys[i]); err != nil {
+			return nil, fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		if err := json.Unmarshal(raw, &set.Keys[i].Raw); err != nil {
+			return nil, fmt.Errorf("keys[%d]: %w", i, err)
+		}
+	}
+	return set, nil
+}
+
+// FetchJWKS retrieves and parses the key set at url.
+func FetchJWKS(ctx context.Context, client *http.Client, url string) (*JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json, application/jwk-set+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && mediaType != "application/jwk-set+json") {
+		return nil, fmt.Errorf("fetching %s: content type %q is not application/json", url, resp.Header.Get("Content-Type"))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", url, err)
+	}
+	return ParseJWKS(body)
+}
+
+// PublicKey decodes the key material.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("e: exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("crv: unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("crv: unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("x: not a base64url encoded Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("kty: unsupported key type %q", k.Kty)
+	}
+}
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("is required")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("is not base64url encoded")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// JWKSOptions tunes ValidateJWKS.
+type JWKSOptions struct {
+	// MinRSABits is the smallest acceptable RSA modulus, 2048 by default.
+	MinRSABits int
+	// ExpiryWarning is how close to expiry an x5c certificate may be before
+	// it is reported, 30 days by default.
+	ExpiryWarning time.Duration
+	// Now is the time certificates are checked against, time.Now by default.
+	Now time.Time
+}
+
+// algKeyTypes maps the JWA algorithms a provider may publish to the key
+// type, curve and use they require.
+var algKeyTypes = map[string]struct{ kty, crv, use string }{
+	"RS256":        {"RSA", "", "sig"},
+	"RS384":        {"RSA", "", "sig"},
+	"RS512":        {"RSA", "", "sig"},
+	"PS256":        {"RSA", "", "sig"},
+	"PS384":        {"RSA", "", "sig"},
+	"PS512":        {"RSA", "", "sig"},
+	"ES256":        {"EC", "P-256", "sig"},
+	"ES384":        {"EC", "P-384", "sig"},
+	"ES512":        {"EC", "P-521", "sig"},
+	"EdDSA":        {"OKP", "", "sig"},
+	"RSA-OAEP":     {"RSA", "", "enc"},
+	"RSA-OAEP-256": {"RSA", "", "enc"},
+	"RSA1_5":       {"RSA", "", "enc"},
+	"ECDH-ES":      {"EC", "", "enc"},
+}
+
+// privateMembers are members that carry private or symmetric key material.
+var privateMembers = []string{"d", "p", "q", "dp", "dq", "qi", "oth", "k"}
+
+// ValidateJWKS checks a key set for unique key IDs, acceptable key types and
+// sizes, consistent use and alg members, and valid x5c certificates. Field
+// names in the findings are of the form keys[i].member.
+func ValidateJWKS(set *JWKS, opts JWKSOptions) Findings {
+	if opts.MinRSABits == 0 {
+		opts.MinRSABits = 2048
+	}
+	if opts.ExpiryWarning == 0 {
+		opts.ExpiryWarning = 30 * 24 * time.Hour
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	v := &validator{}
+	if len(set.Keys) == 0 {
+		v.add(Error, "keys", "is empty")
+		return v.findings
+	}
+
+	seen := map[string]int{}
+	for i, k := range set.Keys {
+		field := func(member string) string { return fmt.Sprintf("keys[%d].%s", i, member) }
+
+		switch {
+		case k.Kid == "" && len(set.Keys) > 1:
+			v.add(Error, field("kid"), "is required when the set has more than one key")
+		case k.Kid == "":
+			v.add(Warning, field("kid"), "is recommended")
+		default:
+			if j, dup := seen[k.Kid]; dup {
+				v.add(Error, field("kid"), fmt.Sprintf("%q duplicates keys[%d]", k.Kid, j))
+			} else {
+				seen[k.Kid] = i
+			}
+		}
+
+		for _, m := range privateMembers {
+			if _, ok := k.Raw[m]; ok {
+				v.add(Error, field(m), "is private key material and must not be published")
+			}
+		}
+
+		pub, err := k.PublicKey()
+		if err != nil {
+			v.add(Error, field("kty"), err.Error())
+		}
+		if rsaKey, ok := pub.(*rsa.PublicKey); ok {
+			if bits := rsaKey.N.BitLen(); bits < opts.MinRSABits {
+				v.add(Error, field("n"), fmt.Sprintf("RSA modulus is %d bits, minimum is %d", bits, opts.MinRSABits))
+			}
+			if rsaKey.E < 3 || rsaKey.E%2 == 0 {
+				v.add(Error, field("e"), fmt.Sprintf("RSA exponent %d is invalid", rsaKey.E))
+			}
+		}
+
+		v.checkUseAndAlg(k, field)
+		if len(k.X5c) > 0 {
+			v.checkX5c(k, pub, field, opts)
+		}
+	}
+	return v.findings
+}
+
+func (v *validator) checkUseAndAlg(k JWK, field func(string) string) {
+	validUse := k.Use == "" || k.Use == "sig" || k.Use == "enc"
+	if !validUse {
+		v.add(Error, field("use"), fmt.Sprintf("%q is not sig or enc", k.Use))
+	}
+	if k.Use != "" && len(k.KeyOps) > 0 {
+		v.add(Warning, field("key_ops"), "should not be used together with use")
+	}
+
+	if k.Alg == "" {
+		return
+	}
+	want, known := algKeyTypes[k.Alg]
+	switch {
+	case k.Alg == "none" || (len(k.Alg) == 5 && k.Alg[:2] == "HS"):
+		v.add(Error, field("alg"), fmt.Sprintf("%q must not be published in a key set", k.Alg))
+	case !known:
+		v.add(Warning, field("alg"), fmt.Sprintf("%q is not a recognised algorithm", k.Alg))
+	case want.kty != k.Kty:
+		v.add(Error, field("alg"), fmt.Sprintf("%q requires kty %s, key is %s", k.Alg, want.kty, k.Kty))
+	case want.crv != "" && want.crv != k.Crv:
+		v.add(Error, field("alg"), fmt.Sprintf("%q requires crv %s, key is %s", k.Alg, want.crv, k.Crv))
+	case k.Use != "" && validUse && want.use != k.Use:
+		v.add(Error, field("use"), fmt.Sprintf("%q is inconsistent with alg %q", k.Use, k.Alg))
+	}
+}
+
+// checkX5c verifies the certificate chain: each certificate is current,
+// signed by the next one, and the first one holds the published key.
+func (v *validator) checkX5c(k JWK, pub crypto.PublicKey, field func(string) string, opts JWKSOptions) {
+	certs := make([]*x509.Certificate, 0, len(k.X5c))
+	for i, enc := range k.X5c {
+		der, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			v.add(Error, field(fmt.Sprintf("x5c[%d]", i)), "is not base64 encoded")
+			return
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			v.add(Error, field(fmt.Sprintf("x5c[%d]", i)), fmt.Sprintf("is not a certificate: %v", err))
+			return
+		}
+		certs = append(certs, cert)
+	}
+
+	for i, cert := range certs {
+		name := field(fmt.Sprintf("x5c[%d]", i))
+		switch {
+		case opts.Now.After(cert.NotAfter):
+			v.add(Error, name, fmt.Sprintf("certificate %q expired on %s", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339)))
+		case opts.Now.Before(cert.NotBefore):
+			v.add(Error, name, fmt.Sprintf("certificate %q is not valid until %s", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339)))
+		case cert.NotAfter.Sub(opts.Now) < opts.ExpiryWarning:
+			v.add(Warning, name, fmt.Sprintf("certificate %q expires on %s", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339)))
+		}
+		if i+1 < len(certs) {
+			if err := cert.CheckSignatureFrom(certs[i+1]); err != nil {
+				v.add(Error, name, fmt.Sprintf("is not signed by x5c[%d]: %v", i+1, err))
+			}
+		}
+	}
+
+	leaf := certs[0]
+	if eq, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); ok && !eq.Equal(leaf.PublicKey) {
+		v.add(Error, field("x5c[0]"), "certificate key does not match the published key")
+	}
+	if k.X5t != "" {
+		sum := sha1.Sum(leaf.Raw)
+		if k.X5t != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			v.add(Error, field("x5t"), "does not match the x5c[0] thumbprint")
+		}
+	}
+	if k.X5tS256 != "" {
+		sum := sha256.Sum256(leaf.Raw)
+		if k.X5tS256 != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			v.add(Error, field("x5t#S256"), "does not match the x5c[0] thumbprint")
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mockoidc"
+)
+
+// keySet serves the given mock keys through the JSON encoding the mock
+// provider publishes, so the tests exercise ParseJWKS as well.
+func keySet(t *testing.T, keys ...*mockoidc.SigningKey) *JWKS {
+	t.Helper()
+	jwks := make([]mockoidc.JWK, len(keys))
+	for i, k := range keys {
+		jwks[i] = k.JWK()
+	}
+	data, err := json.Marshal(map[string]interface{}{"keys": jwks})
+	require.NoError(t, err)
+	set, err := ParseJWKS(data)
+	require.NoError(t, err)
+	return set
+}
+
+func signingKey(t *testing.T, bits int, validity time.Duration) *mockoidc.SigningKey {
+	t.Helper()
+	key, err := mockoidc.GenerateSigningKey(bits, "jwks-test", validity)
+	require.NoError(t, err)
+	return key
+}
+
+func TestValidKeySetHasNoFindings(t *testing.T) {
+	set := keySet(t, signingKey(t, 2048, 365*24*time.Hour), signingKey(t, 3072, 365*24*time.Hour))
+	findings := ValidateJWKS(set, JWKSOptions{})
+	assert.Empty(t, findings, findings.String())
+
+	key, ok := set.Key(set.Keys[1].Kid)
+	require.True(t, ok)
+	pub, err := key.PublicKey()
+	require.NoError(t, err)
+	assert.Equal(t, 3072, pub.(*rsa.PublicKey).N.BitLen())
+}
+
+func TestKeyfunc(t *testing.T) {
+	key := signingKey(t, 2048, 365*24*time.Hour)
+	set := keySet(t, key)
+	sign := func(kid string, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		raw, err := token.SignedString(key.Key)
+		require.NoError(t, err)
+		return raw
+	}
+	const issuer = "https://idp.example.com"
+	exp := time.Now().Add(time.Hour).Unix()
+
+	_, err := jwt.Parse(sign(key.ID, jwt.MapClaims{"iss": issuer, "exp": exp}), set.Keyfunc, ParserOptions(issuer, "RS256")...)
+	assert.NoError(t, err)
+
+	_, err = jwt.Parse(sign("other", jwt.MapClaims{"iss": issuer, "exp": exp}), set.Keyfunc, ParserOptions(issuer, "RS256")...)
+	assert.ErrorContains(t, err, `no key "other"`)
+
+	_, err = jwt.Parse(sign(key.ID, jwt.MapClaims{"iss": issuer}), set.Keyfunc, ParserOptions(issuer, "RS256")...)
+	assert.ErrorIs(t, err, jwt.ErrTokenRequiredClaimMissing)
+
+	_, err = jwt.Parse(sign(key.ID, jwt.MapClaims{"iss": issuer, "exp": exp}), set.Keyfunc, ParserOptions(issuer, "ES256")...)
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+}
+
+func TestEmptyKeySet(t *testing.T) {
+	set, err := ParseJWKS([]byte(`{"keys": []}`))
+	require.NoError(t, err)
+	assert.Equal(t, Findings{{Severity: Error, Field: "keys", Message: "is empty"}}, ValidateJWKS(set, JWKSOptions{}))
+
+	_, err = ParseJWKS([]byte(`{"issuer": "https://idp.example.com"}`))
+	assert.ErrorContains(t, err, `no "keys" member`)
+}
+
+func TestDuplicateAndMissingKid(t *testing.T) {
+	key := signingKey(t, 2048, 365*24*time.Hour)
+	set := keySet(t, key, key, signingKey(t, 2048, 365*24*time.Hour))
+	set.Keys[2].Kid = ""
+
+	errs := ValidateJWKS(set, JWKSOptions{}).Errors()
+	assert.Equal(t, Findings{
+		{Severity: Error, Field: "keys[1].kid", Message: `"` + key.ID + `" duplicates keys[0]`},
+		{Severity: Error, Field: "keys[2].kid", Message: "is required when the set has more than one key"},
+	}, errs)
+}
+
+func TestRSAKeySizeMinimum(t *testing.T) {
+	set := keySet(t, signingKey(t, 1024, 365*24*time.Hour))
+
+	errs := ValidateJWKS(set, JWKSOptions{}).Errors()
+	assert.Equal(t, Findings{{Severity: Error, Field: "keys[0].n", Message: "RSA modulus is 1024 bits, minimum is 2048"}}, errs)
+
+	assert.Empty(t, ValidateJWKS(set, JWKSOptions{MinRSABits: 1024}).Errors())
+}
+
+func TestUseAndAlgConsistency(t *testing.T) {
+	set := keySet(t,
+		signingKey(t, 2048, 365*24*time.Hour),
+		signingKey(t, 2048, 365*24*time.Hour),
+		signingKey(t, 2048, 365*24*time.Hour),
+		signingKey(t, 2048, 365*24*time.Hour),
+	)
+	set.Keys[0].Use = "enc"
+	set.Keys[1].Alg = "ES256"
+	set.Keys[2].Alg = "HS256"
+	set.Keys[3].Use = "signing"
+
+	errs := ValidateJWKS(set, JWKSOptions{}).Errors()
+	assert.Equal(t, Findings{
+		{Severity: Error, Field: "keys[0].use", Message: `"enc" is inconsistent with alg "RS256"`},
+		{Severity: Error, Field: "keys[1].alg", Message: `"ES256" requires kty EC, key is RSA`},
+		{Severity: Error, Field: "keys[2].alg", Message: `"HS256" must not be published in a key set`},
+		{Severity: Error, Field: "keys[3].use", Message: `"signing" is not sig or enc`},
+	}, errs)
+}
+
+func TestECKeys(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	k := JWK{
+		Kid: "ec-1",
+		Kty: "EC",
+		Use: "sig",
+		Alg: "ES384",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(priv.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(priv.Y.Bytes()),
+	}
+
+	errs := ValidateJWKS(&JWKS{Keys: []JWK{k}}, JWKSOptions{}).Errors()
+	assert.Equal(t, Findings{{Severity: Error, Field: "keys[0].alg", Message: `"ES384" requires crv P-384, key is P-256`}}, errs)
+
+	k.Alg = "ES256"
+	assert.Empty(t, ValidateJWKS(&JWKS{Keys: []JWK{k}}, JWKSOptions{}))
+
+	k.Y = base64.RawURLEncoding.EncodeToString(big.NewInt(7).Bytes())
+	errs = ValidateJWKS(&JWKS{Keys: []JWK{k}}, JWKSOptions{}).Errors()
+	assert.Equal(t, Findings{{Severity: Error, Field: "keys[0].kty", Message: "point is not on the curve"}}, errs)
+}
+
+func TestPrivateKeyMaterial(t *testing.T) {
+	set, err := ParseJWKS([]byte(`{"keys": [
+		{"kid": "a", "kty": "RSA", "n": "AQAB", "e": "AQAB", "d": "secret"},
+		{"kid": "b", "kty": "oct", "k": "c2VjcmV0"}
+	]}`))
+	require.NoError(t, err)
+
+	errs := ValidateJWKS(set, JWKSOptions{MinRSABits: 1}).Errors()
+	assert.Contains(t, errs, Finding{Severity: Error, Field: "keys[0].d", Message: "is private key material and must not be published"})
+	assert.Contains(t, errs, Finding{Severity: Error, Field: "keys[1].k", Message: "is private key material and must not be published"})
+	assert.Contains(t, errs, Finding{Severity: Error, Field: "keys[1].kty", Message: `kty: unsupported key type "oct"`})
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	soon := keySet(t, signingKey(t, 2048, 7*24*time.Hour))
+	findings := ValidateJWKS(soon, JWKSOptions{})
+	require.Len(t, findings, 1)
+	assert.Equal(t, Warning, findings[0].Severity)
+	assert.Equal(t, "keys[0].x5c[0]", findings[0].Field)
+	assert.Contains(t, findings[0].Message, `certificate "jwks-test" expires on`)
+
+	later := time.Now().Add(8 * 24 * time.Hour)
+	errs := ValidateJWKS(soon, JWKSOptions{Now: later}).Errors()
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, `certificate "jwks-test" expired on`)
+}
+
+func TestCertificateMustMatchKey(t *testing.T) {
+	a := signingKey(t, 2048, 365*24*time.Hour)
+	b := signingKey(t, 2048, 365*24*time.Hour)
+	set := keySet(t, a)
+	set.Keys[0].X5c = b.JWK().X5c
+
+	errs := ValidateJWKS(set, JWKSOptions{}).Errors()
+	assert.Equal(t, Findings{
+		{Severity: Error, Field: "keys[0].x5c[0]", Message: "certificate key does not match the published key"},
+		{Severity: Error, Field: "keys[0].x5t", Message: "does not match the x5c[0] thumbprint"},
+	}, errs)
+}
+
+func TestCertificateChain(t *testing.T) {
+	now := time.Now()
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	leafKey := signingKey(t, 2048, 365*24*time.Hour)
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "signing"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(180 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &leafKey.Key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	set := keySet(t, leafKey)
+	set.Keys[0].X5t = ""
+	set.Keys[0].X5c = []string{
+		base64.StdEncoding.EncodeToString(leafDER),
+		base64.StdEncoding.EncodeToString(caDER),
+	}
+	assert.Empty(t, ValidateJWKS(set, JWKSOptions{}))
+
+	// A chain in the wrong order does not verify.
+	set.Keys[0].X5c[0], set.Keys[0].X5c[1] = set.Keys[0].X5c[1], set.Keys[0].X5c[0]
+	errs := ValidateJWKS(set, JWKSOptions{}).Errors()
+	require.NotEmpty(t, errs)
+	assert.Equal(t, "keys[0].x5c[0]", errs[0].Field)
+	assert.Contains(t, errs[0].Message, "is not signed by x5c[1]")
+}
+
+func TestFetchJWKSFromMockProvider(t *testing.T) {
+	p := mockoidc.Start(t, mockoidc.Options{Flavor: mockoidc.Keycloak})
+	p.RotateKey(signingKey(t, 2048, 365*24*time.Hour))
+
+	set, err := FetchJWKS(context.Background(), p.HTTPClient(), p.Endpoints().JWKS)
+	require.NoError(t, err)
+	assert.Len(t, set.Keys, 2)
+	assert.Equal(t, []string{p.Keys()[0].ID, p.Keys()[1].ID}, set.KeyIDs())
+	assert.Empty(t, ValidateJWKS(set, JWKSOptions{}).Errors())
+}
+
+func TestFetchJWKSFromLocalServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		_, _ = w.Write([]byte(`{"keys": [{"kid": "1", "kty": "RSA", "n": "AQAB", "e": "AQAB"}]}`))
+	}))
+	defer server.Close()
+
+	set, err := FetchJWKS(context.Background(), server.Client(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, set.KeyIDs())
+}
@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/finding"
+)
+
+// Severity grades a finding. Errors are violations of a MUST in the
+// specification; warnings cover RECOMMENDED members and SHOULDs.
+type Severity = finding.Severity
+
+const (
+	Error   = finding.Error
+	Warning = finding.Warning
+)
+
+// Finding is one problem with a discovery document. Field is the metadata
+// member the finding is about.
+type Finding = finding.Finding
+
+// Findings is the result of validating a document.
+type Findings = finding.Findings
+
+// Options are the provider specific expectations a document is checked
+// against in addition to the specification.
+type Options struct {
+	// Issuer is the expected issuer identifier, normally the module's
+	// issuer output. When empty the issuer is only checked for form.
+	Issuer string
+	// DiscoveryURL is the URL the document was fetched from. When set it
+	// must be the issuer followed by /.well-known/openid-configuration.
+	DiscoveryURL string
+	// SigningAlgs must all appear in id_token_signing_alg_values_supported.
+	// RS256 is always required.
+	SigningAlgs []string
+	// Scopes must all appear in scopes_supported.
+	Scopes []string
+	// ResponseTypes must all appear in response_types_supported. "code" is
+	// always required.
+	ResponseTypes []string
+	// AllowLoopbackHTTP downgrades plain http URLs on localhost or a
+	// loopback address to warnings, for a Keycloak started by docker run.
+	AllowLoopbackHTTP bool
+}
+
+// urls returns the members whose values are URLs, keyed by member name.
+func (d *Discovery) urls() map[string]string {
+	return map[string]string{
+		"authorization_endpoint": d.AuthorizationEndpoint,
+		"token_endpoint":         d.TokenEndpoint,
+		"userinfo_endpoint":      d.UserInfoEndpoint,
+		"jwks_uri":               d.JWKSURI,
+		"registration_endpoint":  d.RegistrationEndpoint,
+		"end_session_endpoint":   d.EndSessionEndpoint,
+		"introspection_endpoint": d.IntrospectionEndpoint,
+		"revocation_endpoint":    d.RevocationEndpoint,
+		"check_session_iframe":   d.CheckSessionIframe,
+		"service_documentation":  d.ServiceDocumentation,
+		"op_policy_uri":          d.OPPolicyURI,
+		"op_tos_uri":             d.OPTosURI,
+	}
+}
+
+var subjectTypes = map[string]bool{"public": true, "pairwise": true}
+
+// Validate checks d against OpenID Connect Discovery 1.0 and opts. Findings
+// are ordered by field, errors before warnings.
+func Validate(d *Discovery, opts Options) Findings {
+	v := &validator{}
+	v.findings = append(v.findings, d.parseFindings...)
+
+	v.checkIssuer(d, opts)
+
+	// Required members (section 3). token_endpoint may only be omitted by
+	// implicit-only providers, which none of the modules configure.
+	v.required("authorization_endpoint", d.AuthorizationEndpoint)
+	v.required("token_endpoint", d.TokenEndpoint)
+	v.required("jwks_uri", d.JWKSURI)
+	v.requiredList("response_types_supported", d.ResponseTypesSupported)
+	v.requiredList("subject_types_supported", d.SubjectTypesSupported)
+	v.requiredList("id_token_signing_alg_values_supported", d.IDTokenSigningAlgValuesSupported)
+
+	// Recommended members.
+	v.recommended("userinfo_endpoint", d.UserInfoEndpoint != "")
+	v.recommended("scopes_supported", len(d.ScopesSupported) > 0)
+	v.recommended("claims_supported", len(d.ClaimsSupported) > 0)
+
+	for name, value := range d.urls() {
+		if value != "" {
+			v.checkHTTPS(name, value, opts.AllowLoopbackHTTP)
+		}
+	}
+
+	v.contains("response_types_supported", d.ResponseTypesSupported, append([]string{"code"}, opts.ResponseTypes...))
+	v.contains("id_token_signing_alg_values_supported", d.IDTokenSigningAlgValuesSupported, append([]string{"RS256"}, opts.SigningAlgs...))
+	if len(d.ScopesSupported) > 0 {
+		v.contains("scopes_supported", d.ScopesSupported, append([]string{"openid"}, opts.Scopes...))
+	} else if len(opts.Scopes) > 0 {
+		v.add(Error, "scopes_supported", fmt.Sprintf("is missing; expected %s", strings.Join(opts.Scopes, ", ")))
+	}
+
+	for _, st := range d.SubjectTypesSupported {
+		if !subjectTypes[st] {
+			v.add(Error, "subject_types_supported", fmt.Sprintf("contains unknown subject type %q", st))
+		}
+	}
+	if finding.ContainsString(d.IDTokenSigningAlgValuesSupported, "none") {
+		v.add(Warning, "id_token_signing_alg_values_supported",
+			`includes "none", which must not be used with the authorization code flow`)
+	}
+	if finding.ContainsString(d.TokenEndpointAuthSigningAlgValuesSupported, "none") {
+		v.add(Error, "token_endpoint_auth_signing_alg_values_supported", `must not include "none"`)
+	}
+
+	sort.SliceStable(v.findings, func(i, j int) bool {
+		a, b := v.findings[i], v.findings[j]
+		if a.Field != b.Field {
+			return a.Field < b.Field
+		}
+		return a.Severity == Error && b.Severity != Error
+	})
+	return v.findings
+}
+
+type validator struct {
+	findings Findings
+}
+
+func (v *validator) add(severity Severity, field, message string) {
+	v.findings = append(v.findings, Finding{Severity: severity, Field: field, Message: message})
+}
+
+func (v *validator) required(field, value string) {
+	if value == "" {
+		v.add(Error, field, "is required")
+	}
+}
+
+func (v *validator) requiredList(field string, values []string) {
+	if len(values) == 0 {
+		v.add(Error, field, "is required")
+	}
+}
+
+func (v *validator) recommended(field string, present bool) {
+	if !present {
+		v.add(Warning, field, "is recommended")
+	}
+}
+
+func (v *validator) contains(field string, values, want []string) {
+	if len(values) == 0 {
+		return
+	}
+	for _, w := range want {
+		if !finding.ContainsString(values, w) {
+			v.add(Error, field, fmt.Sprintf("does not include %q", w))
+		}
+	}
+}
+
+func (v *validator) checkHTTPS(field, raw string, allowLoopback bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		v.add(Error, field, fmt.Sprintf("%q is not an absolute URL", raw))
+		return
+	}
+	if u.Scheme == "https" {
+		return
+	}
+	severity := Error
+	if allowLoopback && u.Scheme == "http" && finding.IsLoopback(u.Hostname()) {
+		severity = Warning
+	}
+	v.add(severity, field, fmt.Sprintf("%q does not use https", raw))
+}
+
+// checkIssuer applies section 3's rules for the issuer (https, no query or
+// fragment) and section 4.3's requirement that it exactly match the issuer
+// the document was requested for.
+func (v *validator) checkIssuer(d *Discovery, opts Options) {
+	if d.Issuer == "" {
+		v.add(Error, "issuer", "is required")
+		return
+	}
+	v.checkHTTPS("issuer", d.Issuer, opts.AllowLoopbackHTTP)
+	if u, err := url.Parse(d.Issuer); err == nil && (u.RawQuery != "" || u.Fragment != "") {
+		v.add(Error, "issuer", fmt.Sprintf("%q must not contain a query or fragment", d.Issuer))
+	}
+
+	if opts.Issuer != "" && d.Issuer != opts.Issuer {
+		v.add(Error, "issuer", fmt.Sprintf("is %q, expected %q", d.Issuer, opts.Issuer))
+	}
+	if opts.DiscoveryURL != "" && opts.DiscoveryURL != DiscoveryURL(d.Issuer) {
+		v.add(Error, "issuer", fmt.Sprintf("document was served from %q, expected %q", opts.DiscoveryURL, DiscoveryURL(d.Issuer)))
+	}
+}
@@ -0,0 +1,200 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mockoidc"
+)
+
+const validDocument = `{
+	"issuer": "https://idp.example.com/realms/test",
+	"authorization_endpoint": "https://idp.example.com/realms/test/protocol/openid-connect/auth",
+	"token_endpoint": "https://idp.example.com/realms/test/protocol/openid-connect/token",
+	"userinfo_endpoint": "https://idp.example.com/realms/test/protocol/openid-connect/userinfo",
+	"jwks_uri": "https://idp.example.com/realms/test/protocol/openid-connect/certs",
+	"scopes_supported": ["openid", "profile", "email"],
+	"response_types_supported": ["code", "id_token"],
+	"subject_types_supported": ["public"],
+	"id_token_signing_alg_values_supported": ["RS256", "ES256"],
+	"claims_supported": ["sub", "email"],
+	"x-vendor-extension": {"enabled": true}
+}`
+
+func parse(t *testing.T, doc string) *Discovery {
+	t.Helper()
+	d, err := Parse([]byte(doc))
+	require.NoError(t, err)
+	return d
+}
+
+func TestValidDocumentHasNoFindings(t *testing.T) {
+	d := parse(t, validDocument)
+	findings := Validate(d, Options{
+		Issuer:       "https://idp.example.com/realms/test",
+		DiscoveryURL: "https://idp.example.com/realms/test/.well-known/openid-configuration",
+		Scopes:       []string{"profile", "email"},
+		SigningAlgs:  []string{"ES256"},
+	})
+	assert.Empty(t, findings, findings.String())
+	assert.Contains(t, d.Raw, "x-vendor-extension")
+}
+
+func TestIssuerMismatch(t *testing.T) {
+	findings := Validate(parse(t, validDocument), Options{Issuer: "https://idp.example.com/realms/other"})
+	require.Len(t, findings.Errors(), 1)
+	assert.Equal(t, "issuer", findings[0].Field)
+	assert.Contains(t, findings[0].Message, `expected "https://idp.example.com/realms/other"`)
+}
+
+func TestDiscoveryURLMustMatchIssuer(t *testing.T) {
+	findings := Validate(parse(t, validDocument), Options{
+		DiscoveryURL: "https://idp.example.com/realms/test/.well-known/openid_configuration",
+	})
+	require.Len(t, findings.Errors(), 1)
+	assert.Equal(t, "issuer", findings[0].Field)
+}
+
+func TestMissingRequiredFields(t *testing.T) {
+	findings := Validate(parse(t, `{"issuer": "https://idp.example.com"}`), Options{})
+
+	for _, field := range []string{
+		"authorization_endpoint",
+		"token_endpoint",
+		"jwks_uri",
+		"response_types_supported",
+		"subject_types_supported",
+		"id_token_signing_alg_values_supported",
+	} {
+		got := findings.Field(field)
+		if assert.Len(t, got, 1, field) {
+			assert.Equal(t, Error, got[0].Severity, field)
+			assert.Equal(t, "is required", got[0].Message, field)
+		}
+	}
+	for _, field := range []string{"userinfo_endpoint", "scopes_supported", "claims_supported"} {
+		got := findings.Field(field)
+		if assert.Len(t, got, 1, field) {
+			assert.Equal(t, Warning, got[0].Severity, field)
+		}
+	}
+}
+
+func TestEndpointsMustUseHTTPS(t *testing.T) {
+	d := parse(t, validDocument)
+	d.Issuer = "http://idp.example.com/realms/test"
+	d.TokenEndpoint = "http://idp.example.com/token"
+	d.EndSessionEndpoint = "/logout"
+
+	findings := Validate(d, Options{}).Errors()
+	require.Len(t, findings, 3, findings.String())
+	assert.Equal(t, Finding{Severity: Error, Field: "end_session_endpoint", Message: `"/logout" is not an absolute URL`}, findings[0])
+	assert.Equal(t, Finding{Severity: Error, Field: "issuer", Message: `"http://idp.example.com/realms/test" does not use https`}, findings[1])
+	assert.Equal(t, Finding{Severity: Error, Field: "token_endpoint", Message: `"http://idp.example.com/token" does not use https`}, findings[2])
+}
+
+func TestLoopbackHTTPIsAWarningWhenAllowed(t *testing.T) {
+	d := parse(t, validDocument)
+	d.Issuer = "http://localhost:8080/realms/test"
+	d.JWKSURI = "http://127.0.0.1:8080/realms/test/protocol/openid-connect/certs"
+	d.TokenEndpoint = "http://idp.example.com/token"
+
+	findings := Validate(d, Options{AllowLoopbackHTTP: true})
+	assert.Len(t, findings, 3)
+	errs := findings.Errors()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "token_endpoint", errs[0].Field)
+}
+
+func TestIssuerWithQueryOrFragment(t *testing.T) {
+	d := parse(t, validDocument)
+	d.Issuer = "https://idp.example.com/realms/test?tenant=1"
+	findings := Validate(d, Options{}).Field("issuer")
+	require.Len(t, findings, 1)
+	assert.Contains(t, findings[0].Message, "must not contain a query or fragment")
+}
+
+func TestRequiredValues(t *testing.T) {
+	d := parse(t, validDocument)
+	d.ResponseTypesSupported = []string{"id_token"}
+	d.IDTokenSigningAlgValuesSupported = []string{"HS256", "none"}
+	d.SubjectTypesSupported = []string{"public", "anonymous"}
+	d.ScopesSupported = []string{"profile"}
+	d.TokenEndpointAuthSigningAlgValuesSupported = []string{"none"}
+
+	findings := Validate(d, Options{Scopes: []string{"email"}})
+	assert.Equal(t, Findings{
+		{Severity: Error, Field: "id_token_signing_alg_values_supported", Message: `does not include "RS256"`},
+		{Severity: Warning, Field: "id_token_signing_alg_values_supported", Message: `includes "none", which must not be used with the authorization code flow`},
+		{Severity: Error, Field: "response_types_supported", Message: `does not include "code"`},
+		{Severity: Error, Field: "scopes_supported", Message: `does not include "openid"`},
+		{Severity: Error, Field: "scopes_supported", Message: `does not include "email"`},
+		{Severity: Error, Field: "subject_types_supported", Message: `contains unknown subject type "anonymous"`},
+		{Severity: Error, Field: "token_endpoint_auth_signing_alg_values_supported", Message: `must not include "none"`},
+	}, findings)
+}
+
+func TestWrongJSONTypesAreFindings(t *testing.T) {
+	d := parse(t, `{
+		"issuer": "https://idp.example.com",
+		"authorization_endpoint": "https://idp.example.com/authorize",
+		"token_endpoint": "https://idp.example.com/token",
+		"jwks_uri": "https://idp.example.com/jwks",
+		"response_types_supported": "code",
+		"subject_types_supported": ["public"],
+		"id_token_signing_alg_values_supported": ["RS256"],
+		"request_parameter_supported": "yes"
+	}`)
+
+	errs := Validate(d, Options{}).Errors()
+	assert.Equal(t, Findings{
+		{Severity: Error, Field: "request_parameter_supported", Message: "must be a boolean"},
+		{Severity: Error, Field: "response_types_supported", Message: "must be an array of strings"},
+		{Severity: Error, Field: "response_types_supported", Message: "is required"},
+	}, errs)
+}
+
+func TestParseRejectsNonObjects(t *testing.T) {
+	_, err := Parse([]byte(`["issuer"]`))
+	assert.Error(t, err)
+}
+
+func TestFetchMockProviders(t *testing.T) {
+	for _, flavor := range []mockoidc.Flavor{mockoidc.Generic, mockoidc.AzureAD, mockoidc.Okta, mockoidc.Keycloak, mockoidc.Cognito} {
+		flavor := flavor
+		t.Run(string(flavor), func(t *testing.T) {
+			t.Parallel()
+			p := mockoidc.Start(t, mockoidc.Options{Flavor: flavor})
+
+			d, err := Fetch(context.Background(), p.HTTPClient(), p.DiscoveryURL())
+			require.NoError(t, err)
+			findings := Validate(d, Options{Issuer: p.Issuer(), DiscoveryURL: p.DiscoveryURL()})
+			assert.Empty(t, findings.Errors(), findings.String())
+			assert.Equal(t, p.Endpoints().JWKS, d.JWKSURI)
+		})
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	_, err := Fetch(context.Background(), server.Client(), server.URL+"/missing")
+	assert.ErrorContains(t, err, "unexpected status 404")
+
+	_, err = Fetch(context.Background(), server.Client(), server.URL+"/html")
+	assert.ErrorContains(t, err, `content type "text/html" is not application/json`)
+}
@@ -0,0 +1,301 @@
+package okta
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/compare"
+)
+
+// Config is the part of an organization the okta module inputs control:
+// its SAML and OAuth apps, groups, group rules and sign-on policies, under
+// the module's variable names. Groups, group rules and sign-on policies
+// are keyed as in the inputs, and refer to groups by those keys, which
+// Inspect maps from the Okta IDs in Objects.
+type Config struct {
+	AppName   string `json:"app_name"`
+	AppStatus string `json:"app_status"`
+
+	CreateSAMLApp         bool                 `json:"create_saml_app"`
+	SSOURL                string               `json:"sso_url"`
+	Recipient             string               `json:"recipient"`
+	Destination           string               `json:"destination"`
+	Audience              string               `json:"audience"`
+	SubjectNameIDTemplate string               `json:"subject_name_id_template"`
+	SubjectNameIDFormat   string               `json:"subject_name_id_format"`
+	ResponseSigned        bool                 `json:"response_signed"`
+	AssertionSigned       bool                 `json:"assertion_signed"`
+	SignatureAlgorithm    string               `json:"signature_algorithm"`
+	DigestAlgorithm       string               `json:"digest_algorithm"`
+	AttributeStatements   []AttributeStatement `json:"attribute_statements"`
+	SAMLGroupAssignments  []GroupAssignment    `json:"saml_group_assignments"`
+
+	CreateOAuthApp         bool              `json:"create_oauth_app"`
+	OAuthAppType           string            `json:"oauth_app_type"`
+	ConsentMethod          string            `json:"consent_method"`
+	ResponseTypes          []string          `json:"response_types"`
+	GrantTypes             []string          `json:"grant_types"`
+	RedirectURIs           []string          `json:"redirect_uris"`
+	PostLogoutRedirectURIs []string          `json:"post_logout_redirect_uris"`
+	OAuthGroupAssignments  []GroupAssignment `json:"oauth_group_assignments"`
+
+	Groups         map[string]GroupInput     `json:"groups"`
+	GroupRules     map[string]GroupRuleInput `json:"group_rules"`
+	SignonPolicies map[string]PolicyInput    `json:"signon_policies"`
+}
+
+// GroupAssignment is an element of the module's saml_group_assignments
+// and oauth_group_assignments inputs.
+type GroupAssignment struct {
+	GroupKey string `json:"group_key"`
+	Priority int    `json:"priority"`
+}
+
+// GroupInput is an element of the module's groups input.
+type GroupInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// GroupRuleInput is an element of the module's group_rules input.
+type GroupRuleInput struct {
+	Name             string   `json:"name"`
+	Status           string   `json:"status"`
+	GroupAssignments []string `json:"group_assignments"`
+	ExpressionType   string   `json:"expression_type"`
+	ExpressionValue  string   `json:"expression_value"`
+	UsersExcluded    []string `json:"users_excluded"`
+}
+
+// PolicyInput is an element of the module's signon_policies input.
+type PolicyInput struct {
+	Name           string   `json:"name"`
+	Status         string   `json:"status"`
+	Description    string   `json:"description"`
+	Priority       int      `json:"priority"`
+	GroupsIncluded []string `json:"groups_included"`
+	GroupsExcluded []string `json:"groups_excluded"`
+}
+
+// Objects are the IDs of the objects a configuration created, as its
+// outputs report them. Maps are keyed as in the inputs.
+type Objects struct {
+	SAMLAppID      string
+	OAuthAppID     string
+	Groups         map[string]string
+	GroupRules     map[string]string
+	SignonPolicies map[string]string
+}
+
+// Inspect returns the configuration of objs. Group IDs are reported as
+// the keys of objs.Groups, and as IDs when they are not among them.
+func (c *Client) Inspect(ctx context.Context, objs Objects) (Config, error) {
+	keys := map[string]string{}
+	for key, id := range objs.Groups {
+		keys[id] = key
+	}
+	groupKey := func(id string) string {
+		if key, ok := keys[id]; ok {
+			return key
+		}
+		return id
+	}
+	groupKeys := func(ids []string) []string {
+		var out []string
+		for _, id := range ids {
+			out = append(out, groupKey(id))
+		}
+		return out
+	}
+	assignments := func(appID string) ([]GroupAssignment, error) {
+		groups, err := c.AppGroups(ctx, appID)
+		if err != nil {
+			return nil, fmt.Errorf("reading groups of app %s: %w", appID, err)
+		}
+		var out []GroupAssignment
+		for _, g := range groups {
+			out = append(out, GroupAssignment{GroupKey: groupKey(g.ID), Priority: g.Priority})
+		}
+		return out, nil
+	}
+
+	cfg := Config{
+		Groups:         map[string]GroupInput{},
+		GroupRules:     map[string]GroupRuleInput{},
+		SignonPolicies: map[string]PolicyInput{},
+	}
+	if objs.SAMLAppID != "" {
+		app, err := c.App(ctx, objs.SAMLAppID)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading SAML app %s: %w", objs.SAMLAppID, err)
+		}
+		if app.Settings.SignOn == nil {
+			return Config{}, fmt.Errorf("app %s is a %s app, not a SAML one", app.ID, app.SignOnMode)
+		}
+		s := app.Settings.SignOn
+		cfg.AppName, cfg.AppStatus, cfg.CreateSAMLApp = app.Label, app.Status, true
+		cfg.SSOURL, cfg.Recipient, cfg.Destination, cfg.Audience = s.SSOAcsURL, s.Recipient, s.Destination, s.Audience
+		cfg.SubjectNameIDTemplate, cfg.SubjectNameIDFormat = s.SubjectNameIDTemplate, s.SubjectNameIDFormat
+		cfg.ResponseSigned, cfg.AssertionSigned = s.ResponseSigned, s.AssertionSigned
+		cfg.SignatureAlgorithm, cfg.DigestAlgorithm = s.SignatureAlgorithm, s.DigestAlgorithm
+		for _, a := range s.AttributeStatements {
+			// Group attribute statements are a separate input
+			if a.Type != "GROUP" {
+				cfg.AttributeStatements = append(cfg.AttributeStatements, a)
+			}
+		}
+		if cfg.SAMLGroupAssignments, err = assignments(app.ID); err != nil {
+			return Config{}, err
+		}
+	}
+	if objs.OAuthAppID != "" {
+		app, err := c.App(ctx, objs.OAuthAppID)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading OAuth app %s: %w", objs.OAuthAppID, err)
+		}
+		if app.Settings.OAuthClient == nil {
+			return Config{}, fmt.Errorf("app %s is a %s app, not an OpenID Connect one", app.ID, app.SignOnMode)
+		}
+		s := app.Settings.OAuthClient
+		cfg.AppName, cfg.AppStatus, cfg.CreateOAuthApp = app.Label, app.Status, true
+		cfg.OAuthAppType, cfg.ConsentMethod = s.ApplicationType, s.ConsentMethod
+		cfg.ResponseTypes, cfg.GrantTypes = s.ResponseTypes, s.GrantTypes
+		cfg.RedirectURIs, cfg.PostLogoutRedirectURIs = s.RedirectURIs, s.PostLogoutRedirectURIs
+		if cfg.OAuthGroupAssignments, err = assignments(app.ID); err != nil {
+			return Config{}, err
+		}
+	}
+	for key, id := range objs.Groups {
+		g, err := c.Group(ctx, id)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading group %s: %w", key, err)
+		}
+		cfg.Groups[key] = GroupInput{Name: g.Profile.Name, Description: g.Profile.Description}
+	}
+	for key, id := range objs.GroupRules {
+		r, err := c.GroupRule(ctx, id)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading group rule %s: %w", key, err)
+		}
+		cfg.GroupRules[key] = GroupRuleInput{
+			Name:             r.Name,
+			Status:           r.Status,
+			GroupAssignments: groupKeys(r.Actions.AssignUserToGroups.GroupIDs),
+			ExpressionType:   r.Conditions.Expression.Type,
+			ExpressionValue:  r.Conditions.Expression.Value,
+			UsersExcluded:    r.Conditions.People.Users.Exclude,
+		}
+	}
+	for key, id := range objs.SignonPolicies {
+		p, err := c.Policy(ctx, id)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading sign-on policy %s: %w", key, err)
+		}
+		cfg.SignonPolicies[key] = PolicyInput{
+			Name:           p.Name,
+			Status:         p.Status,
+			Description:    p.Description,
+			Priority:       p.Priority,
+			GroupsIncluded: groupKeys(p.Conditions.People.Groups.Include),
+			GroupsExcluded: groupKeys(p.Conditions.People.Groups.Exclude),
+		}
+	}
+	return cfg, nil
+}
+
+// Diff lists the settings in which c differs from want, one line per
+// setting named after the module input. The settings of an application
+// are only compared when want creates it. Lists other than attribute
+// statements are compared as sets. Recipient and destination are only
+// compared when want sets them, since Okta fills them in otherwise.
+func (c Config) Diff(want Config) []string {
+	var diffs []string
+	add := func(input string, got, want interface{}) {
+		if !reflect.DeepEqual(got, want) {
+			diffs = append(diffs, fmt.Sprintf("%s: got %v, want %v", input, got, want))
+		}
+	}
+
+	add("create_saml_app", c.CreateSAMLApp, want.CreateSAMLApp)
+	add("create_oauth_app", c.CreateOAuthApp, want.CreateOAuthApp)
+	if want.CreateSAMLApp || want.CreateOAuthApp {
+		add("app_name", c.AppName, want.AppName)
+		add("app_status", c.AppStatus, want.AppStatus)
+	}
+	if want.CreateSAMLApp && c.CreateSAMLApp {
+		add("sso_url", c.SSOURL, want.SSOURL)
+		if want.Recipient != "" {
+			add("recipient", c.Recipient, want.Recipient)
+		}
+		if want.Destination != "" {
+			add("destination", c.Destination, want.Destination)
+		}
+		add("audience", c.Audience, want.Audience)
+		add("subject_name_id_template", c.SubjectNameIDTemplate, want.SubjectNameIDTemplate)
+		add("subject_name_id_format", c.SubjectNameIDFormat, want.SubjectNameIDFormat)
+		add("response_signed", c.ResponseSigned, want.ResponseSigned)
+		add("assertion_signed", c.AssertionSigned, want.AssertionSigned)
+		add("signature_algorithm", c.SignatureAlgorithm, want.SignatureAlgorithm)
+		add("digest_algorithm", c.DigestAlgorithm, want.DigestAlgorithm)
+		add("attribute_statements", statements(c.AttributeStatements), statements(want.AttributeStatements))
+		add("saml_group_assignments", groupAssignments(c.SAMLGroupAssignments), groupAssignments(want.SAMLGroupAssignments))
+	}
+	if want.CreateOAuthApp && c.CreateOAuthApp {
+		add("oauth_app_type", c.OAuthAppType, want.OAuthAppType)
+		add("consent_method", c.ConsentMethod, want.ConsentMethod)
+		add("response_types", compare.Set(c.ResponseTypes), compare.Set(want.ResponseTypes))
+		add("grant_types", compare.Set(c.GrantTypes), compare.Set(want.GrantTypes))
+		add("redirect_uris", compare.Set(c.RedirectURIs), compare.Set(want.RedirectURIs))
+		add("post_logout_redirect_uris", compare.Set(c.PostLogoutRedirectURIs), compare.Set(want.PostLogoutRedirectURIs))
+		add("oauth_group_assignments", groupAssignments(c.OAuthGroupAssignments), groupAssignments(want.OAuthGroupAssignments))
+	}
+
+	for _, key := range compare.Keys(c.Groups, want.Groups, &diffs, "groups") {
+		got, want := c.Groups[key], want.Groups[key]
+		input := "groups[" + key + "]."
+		add(input+"name", got.Name, want.Name)
+		add(input+"description", got.Description, want.Description)
+	}
+	for _, key := range compare.Keys(c.GroupRules, want.GroupRules, &diffs, "group_rules") {
+		got, want := c.GroupRules[key], want.GroupRules[key]
+		input := "group_rules[" + key + "]."
+		add(input+"name", got.Name, want.Name)
+		add(input+"status", got.Status, want.Status)
+		add(input+"group_assignments", compare.Set(got.GroupAssignments), compare.Set(want.GroupAssignments))
+		add(input+"expression_type", got.ExpressionType, want.ExpressionType)
+		add(input+"expression_value", got.ExpressionValue, want.ExpressionValue)
+		add(input+"users_excluded", compare.Set(got.UsersExcluded), compare.Set(want.UsersExcluded))
+	}
+	for _, key := range compare.Keys(c.SignonPolicies, want.SignonPolicies, &diffs, "signon_policies") {
+		got, want := c.SignonPolicies[key], want.SignonPolicies[key]
+		input := "signon_policies[" + key + "]."
+		add(input+"name", got.Name, want.Name)
+		add(input+"status", got.Status, want.Status)
+		add(input+"description", got.Description, want.Description)
+		add(input+"priority", got.Priority, want.Priority)
+		add(input+"groups_included", compare.Set(got.GroupsIncluded), compare.Set(want.GroupsIncluded))
+		add(input+"groups_excluded", compare.Set(got.GroupsExcluded), compare.Set(want.GroupsExcluded))
+	}
+	return diffs
+}
+
+// statements formats attribute statements in order, since the order of
+// the attributes in assertions follows them.
+func statements(s []AttributeStatement) []string {
+	out := []string{}
+	for _, a := range s {
+		out = append(out, fmt.Sprintf("%s %s (%s) = %v", a.Type, a.Name, a.Namespace, a.Values))
+	}
+	return out
+}
+
+// groupAssignments flattens group assignments into sorted "group
+// (priority)" entries.
+func groupAssignments(s []GroupAssignment) []string {
+	var out []string
+	for _, a := range s {
+		out = append(out, fmt.Sprintf("%s (%d)", a.GroupKey, a.Priority))
+	}
+	return compare.Set(out)
+}
@@ -0,0 +1,358 @@
+// Package okta reads the objects the okta module manages, applications,
+// groups, group rules and sign-on policies, through the Okta Management
+// API, so the suites can compare the organization with the inputs they
+// applied. The client waits out Okta's rate limits instead of failing.
+//
+// The tests replay API responses recorded under testdata. Replace the
+// organization URL in a new recording with https://dev-000000.okta.com.
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/apierror"
+)
+
+// App is a SAML 2.0 or OpenID Connect application.
+type App struct {
+	ID         string      `json:"id"`
+	Label      string      `json:"label"`
+	Status     string      `json:"status"`
+	SignOnMode string      `json:"signOnMode"`
+	Settings   AppSettings `json:"settings"`
+}
+
+// AppSettings holds the sign-on settings of a SAML application or the
+// client settings of an OpenID Connect one.
+type AppSettings struct {
+	SignOn      *SAMLSettings  `json:"signOn,omitempty"`
+	OAuthClient *OAuthSettings `json:"oauthClient,omitempty"`
+}
+
+// SAMLSettings are the sign-on settings of a SAML application.
+type SAMLSettings struct {
+	SSOAcsURL             string               `json:"ssoAcsUrl"`
+	Recipient             string               `json:"recipient"`
+	Destination           string               `json:"destination"`
+	Audience              string               `json:"audience"`
+	SubjectNameIDTemplate string               `json:"subjectNameIdTemplate"`
+	SubjectNameIDFormat   string               `json:"subjectNameIdFormat"`
+	ResponseSigned        bool                 `json:"responseSigned"`
+	AssertionSigned       bool                 `json:"assertionSigned"`
+	SignatureAlgorithm    string               `json:"signatureAlgorithm"`
+	DigestAlgorithm       string               `json:"digestAlgorithm"`
+	AttributeStatements   []AttributeStatement `json:"attributeStatements"`
+}
+
+// AttributeStatement is an attribute of the assertions of a SAML
+// application. Group attribute statements have the type GROUP.
+type AttributeStatement struct {
+	Type      string   `json:"type"`
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace"`
+	Values    []string `json:"values"`
+}
+
+// OAuthSettings are the client settings of an OpenID Connect application.
+type OAuthSettings struct {
+	ApplicationType        string   `json:"application_type"`
+	ConsentMethod          string   `json:"consent_method"`
+	RedirectURIs           []string `json:"redirect_uris"`
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris"`
+	ResponseTypes          []string `json:"response_types"`
+	GrantTypes             []string `json:"grant_types"`
+}
+
+// AppGroup assigns a group to an application.
+type AppGroup struct {
+	ID       string `json:"id"`
+	Priority int    `json:"priority"`
+}
+
+// Group is a group of users.
+type Group struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Profile struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	} `json:"profile"`
+}
+
+// GroupRule adds the users matching an expression to groups.
+type GroupRule struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Conditions struct {
+		People struct {
+			Users struct {
+				Exclude []string `json:"exclude"`
+			} `json:"users"`
+		} `json:"people"`
+		Expression struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"expression"`
+	} `json:"conditions"`
+	Actions struct {
+		AssignUserToGroups struct {
+			GroupIDs []string `json:"groupIds"`
+		} `json:"assignUserToGroups"`
+	} `json:"actions"`
+}
+
+// Policy is a policy, such as an OKTA_SIGN_ON policy.
+type Policy struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Priority    int    `json:"priority"`
+	Conditions  struct {
+		People struct {
+			Groups struct {
+				Include []string `json:"include"`
+				Exclude []string `json:"exclude"`
+			} `json:"groups"`
+		} `json:"people"`
+	} `json:"conditions"`
+}
+
+// Client reads organization objects.
+type Client struct {
+	// OrgURL is the organization URL, such as https://dev-123.okta.com.
+	OrgURL string
+	Token  string
+	HTTP   *http.Client
+	// Retries is how often a rate limited request is retried, 5 by
+	// default.
+	Retries int
+	// Now and Sleep tell and wait the time. They default to the real
+	// clock; tests replace them to replay recorded rate limits.
+	Now   func() time.Time
+	Sleep func(ctx context.Context, d time.Duration) error
+
+	mu sync.Mutex
+	// resetAt is when the exhausted rate limit of the last response
+	// resets.
+	resetAt time.Time
+}
+
+// New returns a Client for the organization in creds, or for orgURL when
+// it is not empty.
+func New(creds config.OktaCredentials, orgURL string) *Client {
+	if orgURL == "" {
+		orgURL = creds.OrgURL()
+	}
+	return &Client{OrgURL: strings.TrimRight(orgURL, "/"), Token: creds.APIToken, HTTP: http.DefaultClient}
+}
+
+// App returns the application appID.
+func (c *Client) App(ctx context.Context, appID string) (*App, error) {
+	var app App
+	if _, err := c.get(ctx, c.OrgURL+"/api/v1/apps/"+url.PathEscape(appID), &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// AppGroups returns the group assignments of the application appID.
+func (c *Client) AppGroups(ctx context.Context, appID string) ([]AppGroup, error) {
+	return List[AppGroup](ctx, c, "/api/v1/apps/"+url.PathEscape(appID)+"/groups")
+}
+
+// List reads every page of the collection at path, such as /api/v1/apps,
+// following the rel="next" Link headers, and decodes its objects as T.
+func List[T any](ctx context.Context, c *Client, path string) ([]T, error) {
+	var items []T
+	next := c.OrgURL + path + "?limit=200"
+	for next != "" {
+		var page []T
+		header, err := c.get(ctx, next, &page)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+		next = nextLink(header)
+	}
+	return items, nil
+}
+
+// Group returns the group groupID.
+func (c *Client) Group(ctx context.Context, groupID string) (*Group, error) {
+	var g Group
+	if _, err := c.get(ctx, c.OrgURL+"/api/v1/groups/"+url.PathEscape(groupID), &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// GroupRule returns the group rule ruleID.
+func (c *Client) GroupRule(ctx context.Context, ruleID string) (*GroupRule, error) {
+	var r GroupRule
+	if _, err := c.get(ctx, c.OrgURL+"/api/v1/groups/rules/"+url.PathEscape(ruleID), &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Policy returns the policy policyID.
+func (c *Client) Policy(ctx context.Context, policyID string) (*Policy, error) {
+	var p Policy
+	if _, err := c.get(ctx, c.OrgURL+"/api/v1/policies/"+url.PathEscape(policyID), &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// get decodes the JSON body of a GET request into out and returns the
+// response headers. It waits for an exhausted rate limit to reset before
+// sending, and retries requests answered with 429 once the limit resets.
+func (c *Client) get(ctx context.Context, u string, out interface{}) (http.Header, error) {
+	retries := c.Retries
+	if retries == 0 {
+		retries = 5
+	}
+	for attempt := 0; ; attempt++ {
+		if err := c.waitForQuota(ctx); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "SSWS "+c.Token)
+		req.Header.Set("Accept", "application/json")
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		c.track(resp)
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < retries {
+			resp.Body.Close()
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, readError(resp)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", u, err)
+		}
+		return resp.Header, nil
+	}
+}
+
+// track records when the rate limit resets if resp exhausted it.
+func (c *Client) track(resp *http.Response) {
+	remaining := resp.Header.Get("X-Rate-Limit-Remaining")
+	if remaining != "0" && resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-Rate-Limit-Reset"), 10, 64)
+	at := c.now().Add(time.Second)
+	if err == nil {
+		at = time.Unix(reset, 0)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if at.After(c.resetAt) {
+		c.resetAt = at
+	}
+}
+
+func (c *Client) waitForQuota(ctx context.Context) error {
+	c.mu.Lock()
+	d := c.resetAt.Sub(c.now())
+	c.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+	sleep := c.Sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	return sleep(ctx, d)
+}
+
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// nextLink returns the URL of the rel="next" Link header, if any.
+func nextLink(header http.Header) string {
+	for _, link := range header.Values("Link") {
+		for _, part := range strings.Split(link, ",") {
+			target, params, ok := strings.Cut(part, ";")
+			if ok && strings.Contains(params, `rel="next"`) {
+				return strings.Trim(strings.TrimSpace(target), "<>")
+			}
+		}
+	}
+	return ""
+}
+
+// Error is an error response from the Management API.
+type Error struct {
+	URL        string
+	StatusCode int
+	// Code is the Okta error code, such as E0000007 for a missing object.
+	Code    string
+	Summary string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("GET %s: %d %s: %s", e.URL, e.StatusCode, e.Code, e.Summary)
+}
+
+// HTTPStatus returns the status code of the response.
+func (e *Error) HTTPStatus() int {
+	return e.StatusCode
+}
+
+func readError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	e := &Error{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+	var doc struct {
+		ErrorCode    string `json:"errorCode"`
+		ErrorSummary string `json:"errorSummary"`
+	}
+	if json.Unmarshal(body, &doc) == nil && doc.ErrorCode != "" {
+		e.Code, e.Summary = doc.ErrorCode, doc.ErrorSummary
+	} else {
+		e.Summary = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+// IsNotFound reports whether err is a 404 response.
+func IsNotFound(err error) bool {
+	return apierror.IsNotFound(err)
+}
@@ -0,0 +1,247 @@
+package okta_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/okta"
+)
+
+// recordedOrgURL is the organization the recordings were made against.
+const recordedOrgURL = "https://dev-000000.okta.com"
+
+// interaction is a recorded Management API request and its response.
+type interaction struct {
+	Method  string          `json:"method"`
+	URI     string          `json:"uri"`
+	Status  int             `json:"status"`
+	Headers http.Header     `json:"headers"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// replay serves a recording. Requests are matched on method and URI, and
+// repeated requests get the recorded responses in order.
+type replay struct {
+	*httptest.Server
+	mu      sync.Mutex
+	pending map[string][]interaction
+}
+
+func startReplay(t *testing.T, recording string) *replay {
+	data, err := os.ReadFile(filepath.Join("testdata", recording))
+	require.NoError(t, err)
+	var interactions []interaction
+	require.NoError(t, json.Unmarshal(data, &interactions))
+
+	r := &replay{pending: map[string][]interaction{}}
+	for _, i := range interactions {
+		key := i.Method + " " + i.URI
+		r.pending[key] = append(r.pending[key], i)
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "SSWS test-token", req.Header.Get("Authorization"))
+		r.mu.Lock()
+		key := req.Method + " " + req.RequestURI
+		queue := r.pending[key]
+		if len(queue) == 0 {
+			r.mu.Unlock()
+			t.Errorf("unrecorded request %s", key)
+			http.Error(w, "unrecorded request", http.StatusNotImplemented)
+			return
+		}
+		i := queue[0]
+		r.pending[key] = queue[1:]
+		r.mu.Unlock()
+
+		for name, values := range i.Headers {
+			for _, v := range values {
+				w.Header().Add(name, strings.ReplaceAll(v, recordedOrgURL, r.URL))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(i.Status)
+		_, _ = w.Write([]byte(strings.ReplaceAll(string(i.Body), recordedOrgURL, r.URL)))
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *replay) unused() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for key, queue := range r.pending {
+		for range queue {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// clock is the time of the recordings, advanced by the client's waits.
+type clock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func newClient(r *replay) (*okta.Client, *clock) {
+	c := &clock{now: time.Unix(1760000000, 0)}
+	client := okta.New(config.OktaCredentials{APIToken: "test-token"}, r.URL)
+	client.Now = func() time.Time { return c.now }
+	client.Sleep = func(_ context.Context, d time.Duration) error {
+		c.waits = append(c.waits, d)
+		c.now = c.now.Add(d)
+		return nil
+	}
+	return client, c
+}
+
+var samlObjects = okta.Objects{
+	SAMLAppID:      "0oa1samlapp",
+	Groups:         map[string]string{"test-admins": "00g1admins", "test-users": "00g2users"},
+	GroupRules:     map[string]string{"engineers": "0pr1engineers"},
+	SignonPolicies: map[string]string{"admins": "00p1admins"},
+}
+
+func samlConfig() okta.Config {
+	return okta.Config{
+		AppName:               "terratest-saml-abc123",
+		AppStatus:             "ACTIVE",
+		CreateSAMLApp:         true,
+		SSOURL:                "https://test.example.com/saml/acs",
+		Audience:              "https://test.example.com",
+		SubjectNameIDTemplate: "${user.userName}",
+		SubjectNameIDFormat:   "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress",
+		ResponseSigned:        true,
+		AssertionSigned:       true,
+		SignatureAlgorithm:    "RSA_SHA256",
+		DigestAlgorithm:       "SHA256",
+		AttributeStatements: []okta.AttributeStatement{
+			{Type: "EXPRESSION", Name: "email", Namespace: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic", Values: []string{"user.email"}},
+			{Type: "EXPRESSION", Name: "firstName", Namespace: "urn:oasis:names:tc:SAML:2.0:attrname-format:basic", Values: []string{"user.firstName"}},
+		},
+		SAMLGroupAssignments: []okta.GroupAssignment{{GroupKey: "test-users", Priority: 1}, {GroupKey: "test-admins"}},
+		Groups: map[string]okta.GroupInput{
+			"test-admins": {Name: "Test Admins abc123", Description: "Test administrators group"},
+			"test-users":  {Name: "Test Users abc123", Description: "Test users group"},
+		},
+		GroupRules: map[string]okta.GroupRuleInput{
+			"engineers": {
+				Name:             "Engineers abc123",
+				Status:           "ACTIVE",
+				GroupAssignments: []string{"test-users"},
+				ExpressionType:   "urn:okta:expression:1.0",
+				ExpressionValue:  `user.department=="Engineering"`,
+			},
+		},
+		SignonPolicies: map[string]okta.PolicyInput{
+			"admins": {
+				Name:           "Admins abc123",
+				Status:         "ACTIVE",
+				Description:    "Sign-on policy for administrators",
+				Priority:       1,
+				GroupsIncluded: []string{"test-admins"},
+			},
+		},
+	}
+}
+
+func TestInspectSAMLApp(t *testing.T) {
+	r := startReplay(t, "saml-app.json")
+	client, clock := newClient(r)
+
+	got, err := client.Inspect(context.Background(), samlObjects)
+	require.NoError(t, err)
+	assert.Empty(t, got.Diff(samlConfig()))
+	assert.Empty(t, r.unused())
+
+	// The second page waited for the exhausted limit to reset, then for
+	// the reset announced with the 429 response
+	assert.Equal(t, []time.Duration{time.Minute, time.Minute}, clock.waits)
+}
+
+func TestInspectOAuthApp(t *testing.T) {
+	r := startReplay(t, "oauth-app.json")
+	client, clock := newClient(r)
+
+	got, err := client.Inspect(context.Background(), okta.Objects{OAuthAppID: "0oa2oauthapp"})
+	require.NoError(t, err)
+	assert.Empty(t, got.Diff(okta.Config{
+		AppName:                "terratest-oauth-abc123",
+		AppStatus:              "ACTIVE",
+		CreateOAuthApp:         true,
+		OAuthAppType:           "web",
+		ConsentMethod:          "TRUSTED",
+		ResponseTypes:          []string{"code"},
+		GrantTypes:             []string{"authorization_code"},
+		RedirectURIs:           []string{"https://test.example.com/auth/callback"},
+		PostLogoutRedirectURIs: []string{"https://test.example.com/logout"},
+	}))
+	assert.Empty(t, clock.waits)
+}
+
+func TestNotFound(t *testing.T) {
+	client, _ := newClient(startReplay(t, "oauth-app.json"))
+
+	_, err := client.App(context.Background(), "0oamissing")
+	require.Error(t, err)
+	assert.True(t, okta.IsNotFound(err))
+	assert.Contains(t, err.Error(), "E0000007")
+}
+
+func TestRateLimitRetriesExhausted(t *testing.T) {
+	client, clock := newClient(startReplay(t, "oauth-app.json"))
+	client.Retries = 1
+
+	_, err := client.Group(context.Background(), "00gthrottled")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "429 E0000047")
+	assert.False(t, okta.IsNotFound(err))
+	assert.Equal(t, []time.Duration{time.Minute}, clock.waits)
+}
+
+func TestDiff(t *testing.T) {
+	want := samlConfig()
+	got := samlConfig()
+	got.AttributeStatements = got.AttributeStatements[:1]
+	got.SAMLGroupAssignments = got.SAMLGroupAssignments[1:]
+	got.GroupRules["engineers"] = okta.GroupRuleInput{
+		Name:             "Engineers abc123",
+		Status:           "INACTIVE",
+		GroupAssignments: []string{"00g9unknown"},
+		ExpressionType:   "urn:okta:expression:1.0",
+		ExpressionValue:  `user.department=="Engineering"`,
+	}
+	delete(got.SignonPolicies, "admins")
+	got.Groups["stray"] = okta.GroupInput{Name: "Stray"}
+	// Okta fills in the recipient when the inputs leave it empty
+	got.Recipient = got.SSOURL
+
+	assert.Equal(t, []string{
+		"attribute_statements: got [EXPRESSION email (urn:oasis:names:tc:SAML:2.0:attrname-format:basic) = [user.email]], " +
+			"want [EXPRESSION email (urn:oasis:names:tc:SAML:2.0:attrname-format:basic) = [user.email] " +
+			"EXPRESSION firstName (urn:oasis:names:tc:SAML:2.0:attrname-format:basic) = [user.firstName]]",
+		"saml_group_assignments: got [test-admins (0)], want [test-admins (0) test-users (1)]",
+		"groups[stray]: unexpected",
+		"group_rules[engineers].status: got INACTIVE, want ACTIVE",
+		"group_rules[engineers].group_assignments: got [00g9unknown], want [test-users]",
+		"signon_policies[admins]: missing",
+	}, got.Diff(want))
+
+	// OAuth settings are not compared for SAML configurations
+	got = samlConfig()
+	got.RedirectURIs = []string{"https://unexpected.example.com"}
+	assert.Empty(t, got.Diff(want))
+}
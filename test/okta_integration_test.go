@@ -1,119 +1,95 @@
 package test
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 	"testing"
-	"time"
 
-	"github.com/gruntwork-io/terratest/modules/random"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/okta"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/wait"
 )
 
 func TestOktaIntegrationSAMLExample(t *testing.T) {
 	t.Parallel()
 
-	// Generate unique names to avoid conflicts
-	uniqueID := random.UniqueId()
-	appName := fmt.Sprintf("test-saml-%s", uniqueID)
-
-	// Configure Terraform options
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/okta-integration",
-		Vars: map[string]interface{}{
-			"okta_org_name":  getOktaOrgFromEnv(t),
-			"okta_base_url":  "okta.com",
-			"okta_api_token": getOktaTokenFromEnv(t),
-			"app_name":       appName,
-			"app_description": fmt.Sprintf("Test SAML application %s", uniqueID),
-			"create_saml_app": true,
-			"sso_url":         "https://test.example.com/saml/acs",
-			"audience":        "https://test.example.com",
-			"destination":     "https://test.example.com/saml/acs",
-			"attribute_statements": []map[string]interface{}{
-				{
-					"type":      "EXPRESSION",
-					"name":      "email",
-					"namespace": "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					"values":    []string{"user.email"},
-				},
-				{
-					"type":      "EXPRESSION",
-					"name":      "firstName",
-					"namespace": "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					"values":    []string{"user.firstName"},
-				},
-			},
-			"tags": map[string]string{
-				"Environment": "test",
-				"Project":     "terratest",
-				"ManagedBy":   "terraform",
-			},
-		},
-	}
-
-	// Clean up resources after test
-	defer terraform.Destroy(t, terraformOptions)
-
-	// Deploy the infrastructure
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Test outputs
-	testOktaSAMLOutputs(t, terraformOptions)
-
-	// Test SAML endpoints
-	testOktaSAMLEndpoints(t, terraformOptions)
-
-	// Test group creation
-	testOktaGroups(t, terraformOptions)
+	runStages(t, config.Okta, func() *terraform.Options {
+		b := OktaExample(t)
+		return b.Vars(map[string]interface{}{
+			"app_name":             b.Name("saml"),
+			"app_description":      fmt.Sprintf("Test SAML application %s", b.ID()),
+			"create_saml_app":      true,
+			"sso_url":              "https://test.example.com/saml/acs",
+			"audience":             "https://test.example.com",
+			"destination":          "https://test.example.com/saml/acs",
+			"attribute_statements": oktaProfileAttributeStatements,
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Test outputs
+		testOktaSAMLOutputs(t, terraformOptions)
+
+		// Hold the outputs to their contract
+		testOutputContract(t, "examples/okta-integration", terraformOptions)
+
+		// Test SAML endpoints
+		testOktaSAMLEndpoints(t, liveHTTPClient(),
+			terraform.Output(t, terraformOptions, "saml_metadata_url"),
+			saml.Options{
+				SSOURL:      terraform.Output(t, terraformOptions, "saml_sso_url"),
+				Certificate: terraform.Output(t, terraformOptions, "saml_certificate"),
+				// Module defaults; the example does not override them
+				SignatureAlgorithm: "RSA_SHA256",
+				NameIDFormat:       saml.NameIDFormatEmailAddress,
+			})
+
+		// Test group creation
+		testOktaGroups(t, terraformOptions)
+
+		// Verify the app, attribute statements and groups as configured
+		testOktaConfiguration(t, terraformOptions)
+	})
 }
 
 func TestOktaIntegrationOAuthExample(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	appName := fmt.Sprintf("test-oauth-%s", uniqueID)
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/okta-integration",
-		Vars: map[string]interface{}{
-			"okta_org_name":      getOktaOrgFromEnv(t),
-			"okta_base_url":      "okta.com",
-			"okta_api_token":     getOktaTokenFromEnv(t),
-			"app_name":           appName,
-			"create_saml_app":    false,
-			"create_oauth_app":   true,
-			"oauth_app_type":     "web",
-			"redirect_uris":      []string{"https://test.example.com/auth/callback"},
+	runStages(t, config.Okta, func() *terraform.Options {
+		b := OktaExample(t)
+		return b.Vars(map[string]interface{}{
+			"app_name":                  b.Name("oauth"),
+			"create_saml_app":           false,
+			"create_oauth_app":          true,
+			"oauth_app_type":            "web",
+			"redirect_uris":             []string{"https://test.example.com/auth/callback"},
 			"post_logout_redirect_uris": []string{"https://test.example.com/logout"},
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Test OAuth outputs
-	testOktaOAuthOutputs(t, terraformOptions)
-
-	// Test OAuth endpoints
-	testOktaOAuthEndpoints(t, terraformOptions)
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Test OAuth outputs
+		testOktaOAuthOutputs(t, terraformOptions)
+
+		// Hold the authorization server to the OpenID Connect profile of
+		// Okta. No user signs in: the web app is not granted the password
+		// flow.
+		testOIDCConformance(t, liveHTTPClient(), outputIdentityProvider(t, config.Okta, terraformOptions), nil)
+
+		// Verify the client settings as configured
+		testOktaConfiguration(t, terraformOptions)
+	})
 }
 
 func TestOktaIntegrationMobileApp(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	appName := fmt.Sprintf("test-mobile-%s", uniqueID)
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/okta-integration",
-		Vars: map[string]interface{}{
-			"okta_org_name":    getOktaOrgFromEnv(t),
-			"okta_base_url":    "okta.com",
-			"okta_api_token":   getOktaTokenFromEnv(t),
-			"app_name":         appName,
+	runStages(t, config.Okta, func() *terraform.Options {
+		b := OktaExample(t)
+		return b.Vars(map[string]interface{}{
+			"app_name":         b.Name("mobile"),
 			"create_saml_app":  false,
 			"create_oauth_app": true,
 			"oauth_app_type":   "native",
@@ -121,56 +97,48 @@ func TestOktaIntegrationMobileApp(t *testing.T) {
 				"com.example.app://auth/callback",
 				"https://example.com/mobile/callback",
 			},
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Verify native app configuration
-	oauthAppID := terraform.Output(t, terraformOptions, "oauth_app_id")
-	assert.NotEmpty(t, oauthAppID)
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Verify native app configuration
+		oauthAppID := terraform.Output(t, terraformOptions, "oauth_app_id")
+		assert.NotEmpty(t, oauthAppID)
+		testOktaConfiguration(t, terraformOptions)
+	})
 }
 
 func TestOktaIntegrationWithGroups(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	appName := fmt.Sprintf("test-groups-%s", uniqueID)
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/okta-integration",
-		Vars: map[string]interface{}{
-			"okta_org_name":  getOktaOrgFromEnv(t),
-			"okta_base_url":  "okta.com",
-			"okta_api_token": getOktaTokenFromEnv(t),
-			"app_name":       appName,
+	runStages(t, config.Okta, func() *terraform.Options {
+		b := OktaExample(t)
+		return b.Vars(map[string]interface{}{
+			"app_name":        b.Name("groups"),
 			"create_saml_app": true,
-			"sso_url":        "https://test.example.com/saml/acs",
-			"audience":       "https://test.example.com",
+			"sso_url":         "https://test.example.com/saml/acs",
+			"audience":        "https://test.example.com",
 			"groups": map[string]interface{}{
 				"test-users": map[string]interface{}{
-					"name":        fmt.Sprintf("Test Users %s", uniqueID),
+					"name":        fmt.Sprintf("Test Users %s", b.ID()),
 					"description": "Test users group",
 					"type":        "OKTA_GROUP",
 				},
 				"test-admins": map[string]interface{}{
-					"name":        fmt.Sprintf("Test Admins %s", uniqueID),
+					"name":        fmt.Sprintf("Test Admins %s", b.ID()),
 					"description": "Test administrators group",
 					"type":        "OKTA_GROUP",
 				},
 			},
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Verify groups were created
-	groupIDs := terraform.OutputMap(t, terraformOptions, "group_ids")
-	assert.NotEmpty(t, groupIDs)
-	assert.Contains(t, groupIDs, "test-users")
-	assert.Contains(t, groupIDs, "test-admins")
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Verify groups were created
+		groupIDs := terraform.OutputMap(t, terraformOptions, "group_ids")
+		assert.NotEmpty(t, groupIDs)
+		assert.Contains(t, groupIDs, "test-users")
+		assert.Contains(t, groupIDs, "test-admins")
+
+		// Verify the groups' names and descriptions
+		testOktaConfiguration(t, terraformOptions)
+	})
 }
 
 func testOktaSAMLOutputs(t *testing.T, terraformOptions *terraform.Options) {
@@ -210,50 +178,81 @@ func testOktaOAuthOutputs(t *testing.T, terraformOptions *terraform.Options) {
 	assert.Contains(t, authURL, "/authorize")
 	assert.Contains(t, tokenURL, "/token")
 	assert.Contains(t, userinfoURL, "/userinfo")
-	assert.Contains(t, oidcConfigURL, "/.well-known/openid_configuration")
+	assert.Contains(t, oidcConfigURL, "/.well-known/openid-configuration")
 }
 
-func testOktaSAMLEndpoints(t *testing.T, terraformOptions *terraform.Options) {
+func testOktaSAMLEndpoints(t *testing.T, client *http.Client, metadataURL string, opts saml.Options) {
+	// New apps serve their metadata a few seconds after apply
+	waitReady(t, client, metadataURL, wait.Status(http.StatusOK))
+
 	// Test SAML metadata endpoint
-	metadataURL := terraform.Output(t, terraformOptions, "saml_metadata_url")
-	
-	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Get(metadataURL)
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, err)
 	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
 
 	// Verify content type is XML
 	contentType := resp.Header.Get("Content-Type")
 	assert.Contains(t, contentType, "xml")
+
+	// Verify the metadata matches what the module configured
+	metadata := validateSAMLMetadata(t, client, metadataURL, opts)
+	idp := metadata.IDPSSODescriptor()
+	require.NotNil(t, idp)
+	assert.NotEmpty(t, idp.SSOLocation(saml.HTTPRedirectBinding))
 }
 
-func testOktaOAuthEndpoints(t *testing.T, terraformOptions *terraform.Options) {
-	// Test OpenID Connect configuration endpoint
-	oidcConfigURL := terraform.Output(t, terraformOptions, "openid_configuration_url")
-	
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Get(oidcConfigURL)
-	assert.NoError(t, err)
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
-	defer resp.Body.Close()
+// oktaProfileAttributeStatements send profile fields to the service
+// provider.
+var oktaProfileAttributeStatements = []map[string]interface{}{
+	{
+		"type":      "EXPRESSION",
+		"name":      "email",
+		"namespace": "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+		"values":    []string{"user.email"},
+	},
+	{
+		"type":      "EXPRESSION",
+		"name":      "firstName",
+		"namespace": "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+		"values":    []string{"user.firstName"},
+	},
+}
+
+// oktaRoleAttributeStatements derive a role from group membership.
+var oktaRoleAttributeStatements = []map[string]interface{}{
+	{
+		"type":      "EXPRESSION",
+		"name":      "email",
+		"namespace": "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+		"values":    []string{"user.email"},
+	},
+	{
+		"type":      "EXPRESSION",
+		"name":      "roles",
+		"namespace": "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
+		"values":    []string{"isMemberOfGroupName(\"Administrators\") ? \"admin\" : \"user\""},
+	},
+}
+
+// testOktaSAMLAssertion signs in on behalf of sp and checks that the
+// assertion carries every attribute in statements, in its namespace.
+func testOktaSAMLAssertion(t *testing.T, client *http.Client, sp samlServiceProvider, statements []map[string]interface{}) *saml.Assertion {
+	assertion := testSAMLSignIn(t, client, sp)
 
-	// Parse OpenID configuration
-	var oidcConfig map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&oidcConfig)
-	assert.NoError(t, err)
-
-	// Verify required OIDC endpoints
-	assert.Contains(t, oidcConfig, "issuer")
-	assert.Contains(t, oidcConfig, "authorization_endpoint")
-	assert.Contains(t, oidcConfig, "token_endpoint")
-	assert.Contains(t, oidcConfig, "userinfo_endpoint")
-	assert.Contains(t, oidcConfig, "jwks_uri")
-
-	// Verify issuer matches expected pattern
-	issuer, ok := oidcConfig["issuer"].(string)
-	assert.True(t, ok)
-	assert.Contains(t, issuer, ".okta.com")
+	formats := map[string]string{}
+	for _, s := range assertion.AttributeStatements {
+		for _, attr := range s.Attributes {
+			formats[attr.Name] = attr.NameFormat
+		}
+	}
+	for _, statement := range statements {
+		name := statement["name"].(string)
+		if assert.Contains(t, formats, name, "attribute statement %s", name) {
+			assert.Equal(t, statement["namespace"], formats[name], "namespace of %s", name)
+		}
+	}
+	return assertion
 }
 
 func testOktaGroups(t *testing.T, terraformOptions *terraform.Options) {
@@ -265,17 +264,10 @@ func testOktaGroups(t *testing.T, terraformOptions *terraform.Options) {
 func TestOktaValidation(t *testing.T) {
 	t.Parallel()
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/okta-integration",
-		Vars: map[string]interface{}{
-			"okta_org_name":    getOktaOrgFromEnv(t),
-			"okta_base_url":    "okta.com",
-			"okta_api_token":   getOktaTokenFromEnv(t),
-			"app_name":         "test-validation",
-			"oauth_app_type":   "invalid-type", // Invalid value
-			"create_oauth_app": true,
-		},
-	}
+	terraformOptions := OktaExample(t).Vars(map[string]interface{}{
+		"oauth_app_type":   "invalid-type", // Invalid value
+		"create_oauth_app": true,
+	}).Build()
 
 	// This should fail due to validation
 	_, err := terraform.InitAndPlanE(t, terraformOptions)
@@ -286,81 +278,188 @@ func TestOktaValidation(t *testing.T) {
 func TestOktaMinimalConfig(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	appName := fmt.Sprintf("test-minimal-%s", uniqueID)
-
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/okta-integration",
-		Vars: map[string]interface{}{
-			"okta_org_name":  getOktaOrgFromEnv(t),
-			"okta_base_url":  "okta.com",
-			"okta_api_token": getOktaTokenFromEnv(t),
-			"app_name":       appName,
-		},
-	}
-
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
-
-	// Verify minimal configuration works (defaults to SAML app)
-	samlAppID := terraform.Output(t, terraformOptions, "saml_app_id")
-	assert.NotEmpty(t, samlAppID)
+	runStages(t, config.Okta, func() *terraform.Options {
+		b := OktaExample(t)
+		return b.Var("app_name", b.Name("minimal")).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Verify minimal configuration works (defaults to SAML app)
+		samlAppID := terraform.Output(t, terraformOptions, "saml_app_id")
+		assert.NotEmpty(t, samlAppID)
+		testOktaConfiguration(t, terraformOptions)
+	})
 }
 
 func TestOktaAttributeMapping(t *testing.T) {
 	t.Parallel()
 
-	uniqueID := random.UniqueId()
-	appName := fmt.Sprintf("test-attributes-%s", uniqueID)
+	runStages(t, config.Okta, func() *terraform.Options {
+		b := OktaExample(t)
+		return b.Vars(map[string]interface{}{
+			"app_name":             b.Name("attributes"),
+			"create_saml_app":      true,
+			"sso_url":              "https://test.example.com/saml/acs",
+			"audience":             "https://test.example.com",
+			"attribute_statements": oktaRoleAttributeStatements,
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		// Verify SAML app was created with attribute mapping
+		samlAppID := terraform.Output(t, terraformOptions, "saml_app_id")
+		assert.NotEmpty(t, samlAppID)
+		testOktaConfiguration(t, terraformOptions)
+	})
+}
 
-	terraformOptions := &terraform.Options{
-		TerraformDir: "../examples/okta-integration",
-		Vars: map[string]interface{}{
-			"okta_org_name":  getOktaOrgFromEnv(t),
-			"okta_base_url":  "okta.com",
-			"okta_api_token": getOktaTokenFromEnv(t),
-			"app_name":       appName,
-			"create_saml_app": true,
-			"sso_url":        "https://test.example.com/saml/acs",
-			"audience":       "https://test.example.com",
-			"attribute_statements": []map[string]interface{}{
-				{
-					"type":      "EXPRESSION",
-					"name":      "email",
-					"namespace": "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					"values":    []string{"user.email"},
+func TestOktaGroupRulesAndPolicies(t *testing.T) {
+	t.Parallel()
+
+	runStages(t, config.Okta, func() *terraform.Options {
+		b := OktaModule(t)
+		return b.Vars(map[string]interface{}{
+			"create_saml_app":      true,
+			"sso_url":              "https://test.example.com/saml/acs",
+			"audience":             "https://test.example.com",
+			"attribute_statements": oktaRoleAttributeStatements,
+			"groups": map[string]interface{}{
+				"admins": map[string]interface{}{
+					"name":        b.Name("groups") + "-admins",
+					"description": "Test administrators group",
+					"skip_users":  true,
+				},
+				"engineers": map[string]interface{}{
+					"name":        b.Name("groups") + "-engineers",
+					"description": "Added by the engineering rule",
+					"skip_users":  true,
 				},
-				{
-					"type":      "EXPRESSION",
-					"name":      "roles",
-					"namespace": "urn:oasis:names:tc:SAML:2.0:attrname-format:basic",
-					"values":    []string{"isMemberOfGroupName(\"Administrators\") ? \"admin\" : \"user\""},
+			},
+			"group_rules": map[string]interface{}{
+				"engineering": map[string]interface{}{
+					"name":              b.Name("groups") + "-engineering",
+					"status":            "ACTIVE",
+					"group_assignments": []string{"engineers"},
+					"expression_type":   "urn:okta:expression:1.0",
+					"expression_value":  `user.department=="Engineering"`,
+					"users_excluded":    []string{},
 				},
 			},
-		},
+			"saml_group_assignments": []map[string]interface{}{
+				{"group_key": "admins", "priority": 0, "profile": map[string]string{}},
+				{"group_key": "engineers", "priority": 1, "profile": map[string]string{}},
+			},
+			"signon_policies": map[string]interface{}{
+				"admins": map[string]interface{}{
+					"name":            b.Name("app") + "-admins",
+					"status":          "ACTIVE",
+					"description":     "Sign-on policy for administrators",
+					"priority":        1,
+					"groups_included": []string{"admins"},
+					"groups_excluded": []string{},
+				},
+			},
+		}).Build()
+	}, func(terraformOptions *terraform.Options) {
+		testOktaConfiguration(t, terraformOptions)
+		testOutputContract(t, "modules/okta", terraformOptions)
+	})
+}
+
+// testOktaConfiguration reads the apps, groups, group rules and sign-on
+// policies back through the Management API and checks them against the
+// configuration terraformOptions applied.
+func testOktaConfiguration(t *testing.T, terraformOptions *terraform.Options) {
+	want := expectedOktaConfig(t, terraformOptions)
+
+	var objs okta.Objects
+	if want.CreateSAMLApp {
+		objs.SAMLAppID = terraform.Output(t, terraformOptions, "saml_app_id")
+	}
+	if want.CreateOAuthApp {
+		objs.OAuthAppID = terraform.Output(t, terraformOptions, "oauth_app_id")
+	}
+	if len(want.Groups) > 0 {
+		objs.Groups = terraform.OutputMap(t, terraformOptions, "group_ids")
+	}
+	if len(want.GroupRules) > 0 {
+		objs.GroupRules = oktaOutputIDs(t, terraformOptions, "group_rules")
+	}
+	if len(want.SignonPolicies) > 0 {
+		objs.SignonPolicies = oktaOutputIDs(t, terraformOptions, "signon_policies")
 	}
 
-	defer terraform.Destroy(t, terraformOptions)
-	terraform.InitAndApply(t, terraformOptions)
+	client := okta.New(testConfig.Okta(), "")
+	waitMatches(t, "okta configuration", func(ctx context.Context) ([]string, error) {
+		got, err := client.Inspect(ctx, objs)
+		if err != nil {
+			return nil, err
+		}
+		return got.Diff(want), nil
+	})
+}
 
-	// Verify SAML app was created with attribute mapping
-	samlAppID := terraform.Output(t, terraformOptions, "saml_app_id")
-	assert.NotEmpty(t, samlAppID)
+// oktaOutputIDs returns the id attribute of every object in the map
+// output name.
+func oktaOutputIDs(t *testing.T, terraformOptions *terraform.Options, name string) map[string]string {
+	ids := map[string]string{}
+	for key, v := range terraform.OutputMapOfObjects(t, terraformOptions, name) {
+		object, ok := v.(map[string]interface{})
+		require.True(t, ok, "%s[%s] is not an object", name, key)
+		ids[key] = fmt.Sprint(object["id"])
+	}
+	return ids
+}
+
+// expectedOktaConfig returns the configuration terraformOptions asks for:
+// its variables over the defaults of the configuration it applies, which
+// are over the okta module's defaults.
+func expectedOktaConfig(t *testing.T, terraformOptions *terraform.Options) okta.Config {
+	t.Helper()
+
+	var want okta.Config
+	decodeInputs(t, terraformOptions, "modules/okta", &want)
+	return want
+}
+
+func TestUnitExpectedOktaConfig(t *testing.T) {
+	t.Parallel()
+
+	example := newOptionsBuilder(config.Okta, "../examples/okta-integration").Vars(map[string]interface{}{
+		"app_name":             "terratest-app-abc123",
+		"attribute_statements": oktaRoleAttributeStatements,
+	}).Build()
+	want := expectedOktaConfig(t, example)
+	assert.True(t, want.CreateSAMLApp)
+	assert.False(t, want.CreateOAuthApp)
+	assert.Equal(t, "terratest-app-abc123", want.AppName)
+	assert.Equal(t, "ACTIVE", want.AppStatus)
+	assert.Equal(t, "https://example.com/saml/acs", want.SSOURL)
+	assert.Equal(t, "RSA_SHA256", want.SignatureAlgorithm)
+	assert.Equal(t, "${user.userName}", want.SubjectNameIDTemplate)
+	assert.Equal(t, []string{"email", "roles"}, []string{want.AttributeStatements[0].Name, want.AttributeStatements[1].Name})
+	assert.Equal(t, map[string]okta.GroupInput{
+		"app-users":  {Name: "Application Users", Description: "Users with access to the application"},
+		"app-admins": {Name: "Application Administrators", Description: "Administrators with full access to the application"},
+	}, want.Groups)
+
+	// Variables replace the example's defaults, not merge with them
+	example.Vars["groups"] = map[string]interface{}{
+		"test-users": map[string]interface{}{"name": "Test Users", "description": "Test users group", "type": "OKTA_GROUP"},
+	}
+	groups := expectedOktaConfig(t, example).Groups
+	assert.Len(t, groups, 1)
+	assert.Contains(t, groups, "test-users")
 }
 
 // Helper functions
 func getOktaOrgFromEnv(t *testing.T) string {
-	oktaOrg := getEnvVar(t, "OKTA_ORG_NAME", "")
-	if oktaOrg == "" {
-		t.Skip("OKTA_ORG_NAME environment variable not set")
-	}
-	return oktaOrg
+	skipUnlessConfigured(t, config.Okta)
+	return testConfig.Okta().OrgName
+}
+
+func getOktaBaseURLFromEnv(t *testing.T) string {
+	skipUnlessConfigured(t, config.Okta)
+	return testConfig.Okta().BaseURL
 }
 
 func getOktaTokenFromEnv(t *testing.T) string {
-	token := getEnvVar(t, "OKTA_API_TOKEN", "")
-	if token == "" {
-		t.Skip("OKTA_API_TOKEN environment variable not set")
-	}
-	return token
-} 
\ No newline at end of file
+	skipUnlessConfigured(t, config.Okta)
+	return testConfig.Okta().APIToken
+}
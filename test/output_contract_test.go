@@ -0,0 +1,73 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/contract"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/idp"
+)
+
+// contractDir holds the output contract of each configuration, named
+// after its directory with slashes replaced by dashes.
+const contractDir = "testdata/contracts"
+
+// loadContract reads the output contract of the configuration in dir,
+// such as modules/okta.
+func loadContract(t *testing.T, dir string) *contract.Contract {
+	t.Helper()
+	c, err := contract.Load(filepath.Join(contractDir, strings.ReplaceAll(dir, "/", "-")+".json"))
+	require.NoError(t, err)
+	return c
+}
+
+// TestUnitOutputContracts checks the output blocks of every module and
+// example against its contract, and the synthetic outputs under
+// test/idp/testdata. Renaming, retyping or changing the sensitivity
+// of an output fails here; update the contract when the change is meant
+// for consumers.
+func TestUnitOutputContracts(t *testing.T) {
+	t.Parallel()
+
+	var dirs []string
+	for _, pattern := range []string{"modules/*", "examples/*"} {
+		matches, err := filepath.Glob(filepath.Join("..", pattern))
+		require.NoError(t, err)
+		for _, match := range matches {
+			dirs = append(dirs, filepath.ToSlash(strings.TrimPrefix(match, ".."+string(filepath.Separator))))
+		}
+	}
+	require.NotEmpty(t, dirs)
+
+	for _, dir := range dirs {
+		dir := dir
+		t.Run(dir, func(t *testing.T) {
+			t.Parallel()
+
+			c := loadContract(t, dir)
+			assert.Empty(t, c.CheckModule(loadModuleConfig(t, dir)), "outputs of %s", dir)
+
+			fixture, err := os.ReadFile(filepath.Join("idp", "testdata", strings.ReplaceAll(dir, "/", "-")+".json"))
+			require.NoError(t, err)
+			outputs, err := idp.ParseOutputs(fixture)
+			require.NoError(t, err)
+			assert.Empty(t, c.CheckOutputs(outputs), "synthetic outputs of %s", dir)
+		})
+	}
+}
+
+// testOutputContract checks the outputs of the configuration in dir,
+// which terraformOptions applied, against its contract.
+func testOutputContract(t *testing.T, dir string, terraformOptions *terraform.Options) {
+	t.Helper()
+
+	outputs, err := idp.ParseOutputs([]byte(terraform.OutputJson(t, terraformOptions, "")))
+	require.NoError(t, err)
+	assert.Empty(t, loadContract(t, dir).CheckOutputs(outputs), "outputs of %s", dir)
+}
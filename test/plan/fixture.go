@@ -0,0 +1,126 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Redacted replaces sensitive values in fixtures.
+const Redacted = "(sensitive value)"
+
+// Fixture prepares `terraform show -json` output for checking in. Values of
+// sensitive variables, attributes and outputs are replaced with Redacted and
+// the configuration section, which repeats the HCL and is not queried, is
+// dropped. The result is indented so fixture diffs stay reviewable.
+func Fixture(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing plan: %w", err)
+	}
+
+	// Sensitivity of variables is only recorded in the configuration.
+	config, _ := doc["configuration"].(map[string]interface{})
+	root, _ := config["root_module"].(map[string]interface{})
+	declared, _ := root["variables"].(map[string]interface{})
+	variables, _ := doc["variables"].(map[string]interface{})
+	for name, decl := range declared {
+		d, _ := decl.(map[string]interface{})
+		v, _ := variables[name].(map[string]interface{})
+		if d["sensitive"] == true && v != nil {
+			v["value"] = Redacted
+		}
+	}
+	delete(doc, "configuration")
+
+	changes, _ := doc["resource_changes"].([]interface{})
+	for _, rc := range changes {
+		rc, _ := rc.(map[string]interface{})
+		if change, ok := rc["change"].(map[string]interface{}); ok {
+			redactChange(change)
+		}
+	}
+	outputs, _ := doc["output_changes"].(map[string]interface{})
+	for _, c := range outputs {
+		if change, ok := c.(map[string]interface{}); ok {
+			redactChange(change)
+		}
+	}
+	redactModule(doc["planned_values"])
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func redactChange(change map[string]interface{}) {
+	change["before"] = redact(change["before"], change["before_sensitive"])
+	change["after"] = redact(change["after"], change["after_sensitive"])
+}
+
+// redactModule redacts planned_values, whose outputs carry a sensitive flag
+// and whose resources carry a sensitive_values mirror.
+func redactModule(values interface{}) {
+	v, _ := values.(map[string]interface{})
+	if v == nil {
+		return
+	}
+	if outputs, ok := v["outputs"].(map[string]interface{}); ok {
+		for _, o := range outputs {
+			o, _ := o.(map[string]interface{})
+			if o["sensitive"] == true {
+				if _, ok := o["value"]; ok {
+					o["value"] = Redacted
+				}
+			}
+		}
+	}
+	module, _ := v["root_module"].(map[string]interface{})
+	if module == nil {
+		module = v
+	}
+	resources, _ := module["resources"].([]interface{})
+	for _, r := range resources {
+		r, _ := r.(map[string]interface{})
+		r["values"] = redact(r["values"], r["sensitive_values"])
+	}
+	children, _ := module["child_modules"].([]interface{})
+	for _, child := range children {
+		redactModule(child)
+	}
+}
+
+// redact replaces the parts of value marked true in the sensitivity
+// mirror. Null values are left alone so "not set" stays visible.
+func redact(value, mirror interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch m := mirror.(type) {
+	case bool:
+		if m {
+			return Redacted
+		}
+	case map[string]interface{}:
+		if v, ok := value.(map[string]interface{}); ok {
+			for k, child := range m {
+				if _, ok := v[k]; ok {
+					v[k] = redact(v[k], child)
+				}
+			}
+		}
+	case []interface{}:
+		if v, ok := value.([]interface{}); ok {
+			for i := range v {
+				if i < len(m) {
+					v[i] = redact(v[i], m[i])
+				}
+			}
+		}
+	}
+	return value
+}
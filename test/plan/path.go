@@ -0,0 +1,95 @@
+package plan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Lookup returns the value at path inside a decoded JSON value.
+//
+// A path is a dot-separated list of object keys and list indexes, such as
+// password_policy.0.minimum_length or tags.Environment. Keys containing dots
+// can be written in brackets: assume_role_policy["cognito.aud"].
+func Lookup(value interface{}, path string) (interface{}, bool) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, false
+	}
+	for _, step := range steps {
+		var ok bool
+		if value, ok = index(value, step); !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// marked walks an after_unknown or after_sensitive mirror of the values
+// along path. A true anywhere on the way marks everything below it.
+func marked(mirror interface{}, path string) bool {
+	steps, err := parsePath(path)
+	if err != nil {
+		return false
+	}
+	for _, step := range steps {
+		if b, ok := mirror.(bool); ok {
+			return b
+		}
+		var ok bool
+		if mirror, ok = index(mirror, step); !ok {
+			return false
+		}
+	}
+	b, _ := mirror.(bool)
+	return b
+}
+
+func index(value interface{}, step string) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child, ok := v[step]
+		return child, ok
+	case []interface{}:
+		i, err := strconv.Atoi(step)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, false
+		}
+		return v[i], true
+	}
+	return nil, false
+}
+
+func parsePath(path string) ([]string, error) {
+	var steps []string
+	for rest := path; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest, `"]`)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated key in path %q", path)
+			}
+			steps = append(steps, rest[2:end])
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated index in path %q", path)
+			}
+			steps = append(steps, rest[1:end])
+			rest = rest[end+1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty step in path %q", path)
+			}
+			steps = append(steps, rest[:end])
+			rest = rest[end:]
+		}
+		rest = strings.TrimPrefix(rest, ".")
+	}
+	return steps, nil
+}
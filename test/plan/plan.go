@@ -0,0 +1,224 @@
+// Package plan loads the JSON form of a terraform plan, as printed by
+// `terraform show -json`, into typed resource-change records that tests can
+// query without applying anything.
+//
+// Plans are normally recorded once with credentials and checked in under
+// testdata, so assertions about what a module would create run offline.
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Action summarises what terraform plans to do with a resource or output.
+type Action string
+
+const (
+	NoOp    Action = "no-op"
+	Create  Action = "create"
+	Read    Action = "read"
+	Update  Action = "update"
+	Delete  Action = "delete"
+	Replace Action = "replace"
+)
+
+func actionOf(actions tfjson.Actions) Action {
+	switch {
+	case actions.Replace():
+		return Replace
+	case actions.Create():
+		return Create
+	case actions.Update():
+		return Update
+	case actions.Delete():
+		return Delete
+	case actions.Read():
+		return Read
+	}
+	return NoOp
+}
+
+// Plan is a parsed plan.
+type Plan struct {
+	TerraformVersion string
+	// Variables are the input variable values the plan was made with.
+	Variables map[string]interface{}
+	// Changes are the resource changes in the order terraform lists them.
+	Changes []*ResourceChange
+	// Outputs are the root module output changes by name.
+	Outputs map[string]*OutputChange
+	// Raw is the full plan for anything the records above leave out.
+	Raw *tfjson.Plan
+}
+
+// ResourceChange is the planned change to one resource instance.
+type ResourceChange struct {
+	// Address is the full instance address, e.g.
+	// module.okta.okta_group.main["app-users"].
+	Address string
+	// ModuleAddress is the address of the containing module, empty for the
+	// root module.
+	ModuleAddress string
+	Mode          tfjson.ResourceMode
+	Type          string
+	Name          string
+	// Index is the count (float64) or for_each (string) key, nil otherwise.
+	Index        interface{}
+	ProviderName string
+	Action       Action
+	// Before and After are the attribute values before and after the
+	// change. Numbers are float64 as decoded by encoding/json.
+	Before map[string]interface{}
+	After  map[string]interface{}
+
+	afterUnknown   interface{}
+	afterSensitive interface{}
+}
+
+// OutputChange is the planned change to a root module output.
+type OutputChange struct {
+	Action Action
+	Before interface{}
+	After  interface{}
+	// Unknown reports that the value is only known after apply.
+	Unknown bool
+	// Sensitive reports that the output is marked sensitive.
+	Sensitive bool
+}
+
+// Parse decodes `terraform show -json` output for a saved plan.
+func Parse(data []byte) (*Plan, error) {
+	var raw tfjson.Plan
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing plan: %w", err)
+	}
+	if err := raw.Validate(); err != nil {
+		return nil, fmt.Errorf("parsing plan: %w", err)
+	}
+
+	p := &Plan{
+		TerraformVersion: raw.TerraformVersion,
+		Variables:        map[string]interface{}{},
+		Outputs:          map[string]*OutputChange{},
+		Raw:              &raw,
+	}
+	for name, v := range raw.Variables {
+		p.Variables[name] = v.Value
+	}
+	for _, rc := range raw.ResourceChanges {
+		if rc.Change == nil {
+			continue
+		}
+		before, _ := rc.Change.Before.(map[string]interface{})
+		after, _ := rc.Change.After.(map[string]interface{})
+		p.Changes = append(p.Changes, &ResourceChange{
+			Address:        rc.Address,
+			ModuleAddress:  rc.ModuleAddress,
+			Mode:           rc.Mode,
+			Type:           rc.Type,
+			Name:           rc.Name,
+			Index:          rc.Index,
+			ProviderName:   rc.ProviderName,
+			Action:         actionOf(rc.Change.Actions),
+			Before:         before,
+			After:          after,
+			afterUnknown:   rc.Change.AfterUnknown,
+			afterSensitive: rc.Change.AfterSensitive,
+		})
+	}
+	for name, c := range raw.OutputChanges {
+		if c == nil {
+			continue
+		}
+		p.Outputs[name] = &OutputChange{
+			Action:    actionOf(c.Actions),
+			Before:    c.Before,
+			After:     c.After,
+			Unknown:   c.AfterUnknown == true,
+			Sensitive: c.AfterSensitive == true,
+		}
+	}
+	return p, nil
+}
+
+// Load reads and parses a plan JSON file.
+func Load(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Attribute returns the value at path in the planned values, or in the
+// prior values for a resource being deleted. It reports false when the
+// attribute is absent, null or only known after apply.
+func (c *ResourceChange) Attribute(path string) (interface{}, bool) {
+	values := c.After
+	if c.Action == Delete {
+		values = c.Before
+	}
+	if c.Unknown(path) {
+		return nil, false
+	}
+	v, ok := Lookup(values, path)
+	if !ok || v == nil {
+		return nil, false
+	}
+	return v, true
+}
+
+// Unknown reports whether the value at path is only known after apply.
+func (c *ResourceChange) Unknown(path string) bool {
+	return marked(c.afterUnknown, path)
+}
+
+// Sensitive reports whether the planned value at path is marked sensitive.
+func (c *ResourceChange) Sensitive(path string) bool {
+	return marked(c.afterSensitive, path)
+}
+
+// Summary counts changes the way `terraform plan` reports them; a
+// replacement counts as both an add and a destroy.
+type Summary struct {
+	Add, Change, Destroy int
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("Plan: %d to add, %d to change, %d to destroy.", s.Add, s.Change, s.Destroy)
+}
+
+// Summary counts the plan's managed resource changes.
+func (p *Plan) Summary() Summary {
+	var s Summary
+	for _, c := range p.Changes {
+		if c.Mode != tfjson.ManagedResourceMode {
+			continue
+		}
+		switch c.Action {
+		case Create:
+			s.Add++
+		case Update:
+			s.Change++
+		case Delete:
+			s.Destroy++
+		case Replace:
+			s.Add++
+			s.Destroy++
+		}
+	}
+	return s
+}
+
+// Output returns the change to the named root module output, or nil.
+func (p *Plan) Output(name string) *OutputChange {
+	return p.Outputs[name]
+}
@@ -0,0 +1,158 @@
+package plan
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadChanges(t *testing.T) *Plan {
+	t.Helper()
+	p, err := Load("testdata/changes.json")
+	require.NoError(t, err)
+	return p
+}
+
+func TestParse(t *testing.T) {
+	p := loadChanges(t)
+
+	assert.Equal(t, "1.6.6", p.TerraformVersion)
+	assert.Equal(t, "demo", p.Variables["realm_name"])
+	require.Len(t, p.Changes, 5)
+
+	client := p.Resource(`module.keycloak.keycloak_openid_client.main["webapp"]`)
+	require.NotNil(t, client)
+	assert.Equal(t, Replace, client.Action)
+	assert.Equal(t, "module.keycloak", client.ModuleAddress)
+	assert.Equal(t, "webapp", client.Index)
+	assert.Nil(t, p.Resource("module.keycloak.keycloak_openid_client.main"))
+
+	assert.Equal(t, Summary{Add: 1, Change: 1, Destroy: 2}, p.Summary())
+	assert.Equal(t, "Plan: 1 to add, 1 to change, 2 to destroy.", p.Summary().String())
+}
+
+func TestParseRejectsOtherJSON(t *testing.T) {
+	_, err := Parse([]byte(`{"format_version": "9.0"}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`[]`))
+	assert.Error(t, err)
+}
+
+func TestAttribute(t *testing.T) {
+	p := loadChanges(t)
+	realm := p.Resource("module.keycloak.keycloak_realm.main")
+	client := p.Resource(`module.keycloak.keycloak_openid_client.main["webapp"]`)
+	legacy := p.Resource(`module.keycloak.keycloak_group.main["legacy"]`)
+
+	v, ok := realm.Attribute("display_name")
+	assert.True(t, ok)
+	assert.Equal(t, "Demo Realm", v)
+	v, _ = realm.Attribute(`attributes["branding.color"]`)
+	assert.Equal(t, "#336699", v)
+	v, _ = realm.Attribute("attributes.frontendUrl")
+	assert.Equal(t, "https://auth.example.com", v)
+	_, ok = realm.Attribute("attributes.missing")
+	assert.False(t, ok)
+
+	v, _ = client.Attribute("valid_redirect_uris.0")
+	assert.Equal(t, "https://example.com/callback", v)
+	v, _ = client.Attribute("valid_redirect_uris[0]")
+	assert.Equal(t, "https://example.com/callback", v)
+
+	// Unknown values are not reported as set.
+	assert.True(t, client.Unknown("id"))
+	_, ok = client.Attribute("id")
+	assert.False(t, ok)
+	assert.False(t, client.Unknown("client_id"))
+
+	assert.True(t, client.Sensitive("client_secret"))
+	assert.False(t, client.Sensitive("valid_redirect_uris.0"))
+
+	// Deleted resources are looked up in their prior values; nulls are not
+	// reported as set.
+	v, _ = legacy.Attribute("name")
+	assert.Equal(t, "Legacy", v)
+	_, ok = legacy.Attribute("parent_id")
+	assert.False(t, ok)
+
+	// A block that is unknown as a whole marks everything below it.
+	keys := p.Resource("data.keycloak_realm_keys.current")
+	assert.True(t, keys.Unknown("keys.0.certificate"))
+}
+
+func TestSelect(t *testing.T) {
+	p := loadChanges(t)
+
+	assert.Equal(t, []string{
+		`module.keycloak.keycloak_group.main["legacy"]`,
+		`module.keycloak.keycloak_group.main["admins"]`,
+	}, p.Addresses(Type("keycloak_group")))
+	assert.Equal(t, []string{
+		`module.keycloak.keycloak_group.main["legacy"]`,
+	}, p.Addresses(Address("module.keycloak.*[\"l*\"]")))
+	assert.Len(t, p.Select(Module("module.keycloak")), 4)
+	assert.Equal(t, []string{"data.keycloak_realm_keys.current"}, p.Addresses(Module("")))
+	assert.Len(t, p.Select(WithAction(Delete, Replace)), 2)
+	assert.Empty(t, p.Select(Type("keycloak_group"), WithAction(Create)))
+
+	assert.Equal(t, []string{`module.keycloak.keycloak_openid_client.main["webapp"]`},
+		p.Addresses(AttributeEquals("valid_redirect_uris", []string{"https://example.com/callback"})))
+	assert.Equal(t, []string{"data.keycloak_realm_keys.current"},
+		p.Addresses(AttributeEquals("algorithms", []string{"RS256"})))
+	assert.Empty(t, p.Select(AttributeEquals("id", "0b5f6b0e-7c1f-4d8e-9a40-2f1c3c9d9a11")))
+}
+
+func TestOutputs(t *testing.T) {
+	p := loadChanges(t)
+
+	secret := p.Output("client_secret")
+	require.NotNil(t, secret)
+	assert.Equal(t, Create, secret.Action)
+	assert.True(t, secret.Sensitive)
+	assert.Equal(t, NoOp, p.Output("realm_id").Action)
+	assert.Nil(t, p.Output("missing"))
+}
+
+func TestWildcardMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.*", "a.b.c", true},
+		{"*.c", "a.b.c", true},
+		{"a*c", "abc", true},
+		{"a*b*c", "aXbYc", true},
+		{"a*a", "a", false},
+		{"a.*", "b.a", false},
+	} {
+		assert.Equal(t, tc.want, wildcardMatch(tc.pattern, tc.s), "%s ~ %s", tc.pattern, tc.s)
+	}
+}
+
+func TestFixtureRedactsSensitiveValues(t *testing.T) {
+	data, err := os.ReadFile("testdata/changes.json")
+	require.NoError(t, err)
+
+	fixture, err := Fixture(data)
+	require.NoError(t, err)
+	assert.NotContains(t, string(fixture), "s3cr3t")
+	assert.NotContains(t, string(fixture), `"configuration"`)
+	assert.True(t, strings.HasSuffix(string(fixture), "}\n"))
+
+	p, err := Parse(fixture)
+	require.NoError(t, err)
+	assert.Equal(t, Redacted, p.Variables["client_secret"])
+	assert.Equal(t, "demo", p.Variables["realm_name"])
+	assert.Equal(t, Redacted, p.Output("client_secret").After)
+
+	client := p.Resource(`module.keycloak.keycloak_openid_client.main["webapp"]`)
+	v, _ := client.Attribute("client_secret")
+	assert.Equal(t, Redacted, v)
+	v, _ = client.Attribute("valid_redirect_uris.0")
+	assert.Equal(t, "https://example.com/callback", v)
+	assert.Equal(t, Redacted, client.Before["client_secret"])
+}
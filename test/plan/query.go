@@ -0,0 +1,129 @@
+package plan
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Filter selects resource changes.
+type Filter func(*ResourceChange) bool
+
+// Type matches resources of any of the given types.
+func Type(types ...string) Filter {
+	return func(c *ResourceChange) bool {
+		for _, t := range types {
+			if c.Type == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Address matches instance addresses against pattern, in which * stands
+// for any run of characters: module.okta.okta_group.main[*] matches every
+// group instance.
+func Address(pattern string) Filter {
+	return func(c *ResourceChange) bool {
+		return wildcardMatch(pattern, c.Address)
+	}
+}
+
+// Module matches resources declared directly in the module at address;
+// an empty address is the root module.
+func Module(address string) Filter {
+	return func(c *ResourceChange) bool {
+		return c.ModuleAddress == address
+	}
+}
+
+// WithAction matches changes whose action is one of actions.
+func WithAction(actions ...Action) Filter {
+	return func(c *ResourceChange) bool {
+		for _, a := range actions {
+			if c.Action == a {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AttributeEquals matches changes whose value at path equals want. want is
+// compared in its JSON form, so 8 matches a planned 8 and []string matches
+// a planned list of strings.
+func AttributeEquals(path string, want interface{}) Filter {
+	normalized, err := normalize(want)
+	return func(c *ResourceChange) bool {
+		if err != nil {
+			return false
+		}
+		got, ok := c.Attribute(path)
+		return ok && reflect.DeepEqual(got, normalized)
+	}
+}
+
+// Select returns the changes that match every filter, in plan order.
+func (p *Plan) Select(filters ...Filter) []*ResourceChange {
+	var matched []*ResourceChange
+outer:
+	for _, c := range p.Changes {
+		for _, f := range filters {
+			if !f(c) {
+				continue outer
+			}
+		}
+		matched = append(matched, c)
+	}
+	return matched
+}
+
+// Addresses returns the addresses of the changes that match every filter.
+func (p *Plan) Addresses(filters ...Filter) []string {
+	var addresses []string
+	for _, c := range p.Select(filters...) {
+		addresses = append(addresses, c.Address)
+	}
+	return addresses
+}
+
+// Resource returns the change to the instance at address, or nil.
+func (p *Plan) Resource(address string) *ResourceChange {
+	for _, c := range p.Changes {
+		if c.Address == address {
+			return c
+		}
+	}
+	return nil
+}
+
+// normalize converts v to the shapes encoding/json decodes into.
+func normalize(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
@@ -0,0 +1,92 @@
+// Package retryable catalogs the transient provider errors that terraform
+// commands in the suites are retried on. testdata holds sample terraform
+// output each entry must match, and output of real failures it must not.
+// None of the samples is captured from a run yet: testdata/sources.txt
+// records, for each, where its error text comes from and which provider
+// version produced it.
+//
+// When a transient error flakes a run, add its pattern to Catalog, bump
+// Version and save the output of the failing run under testdata/retryable,
+// with its provider version in testdata/sources.txt. Output of a real
+// failure that must not be retried goes under testdata/fatal.
+package retryable
+
+import (
+	"regexp"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+)
+
+// Version identifies the catalog. Bump it with every change to Catalog so
+// that retried runs can be traced to the patterns they used.
+//
+//	1: Cognito throttling, Okta rate limits, Azure AD replication lag and
+//	   Keycloak realm creation conflicts.
+//	2: Okta rate limits once the SDK has run out of retries.
+const Version = 2
+
+// Pattern is a retryable error of one provider.
+type Pattern struct {
+	Provider config.Provider
+	// Regexp is matched against the output of the failed command.
+	Regexp string
+	// Reason is logged when a command is retried.
+	Reason string
+}
+
+// Catalog lists the retryable errors of every provider.
+var Catalog = []Pattern{
+	{
+		Provider: config.AWS,
+		Regexp:   `TooManyRequestsException`,
+		Reason:   "Cognito throttled the request",
+	},
+	{
+		Provider: config.Okta,
+		Regexp:   `Status: 429 Too Many Requests|E0000047|: too many requests`,
+		Reason:   "Okta rate limit exceeded",
+	},
+	{
+		Provider: config.Azure,
+		Regexp:   `unexpected status 404 with OData[\s│]+error: Request_ResourceNotFound`,
+		Reason:   "Azure AD object created moments ago has not replicated yet",
+	},
+	{
+		Provider: config.Azure,
+		Regexp:   `NoBackingApplicationObject`,
+		Reason:   "Azure AD application created moments ago has not replicated yet",
+	},
+	{
+		Provider: config.Keycloak,
+		Regexp:   `409 Conflict\. Response body: \{"errorMessage":"Conflict detected`,
+		Reason:   "Keycloak conflict while creating realms in parallel",
+	},
+}
+
+// Errors returns the RetryableTerraformErrors for a test against
+// provider: the provider's catalog entries and terratest's defaults for
+// provider downloads and eventual consistency.
+func Errors(provider config.Provider) map[string]string {
+	errors := make(map[string]string, len(terraform.DefaultRetryableTerraformErrors)+len(Catalog))
+	for re, reason := range terraform.DefaultRetryableTerraformErrors {
+		errors[re] = reason
+	}
+	for _, p := range Catalog {
+		if p.Provider == provider {
+			errors[p.Regexp] = p.Reason
+		}
+	}
+	return errors
+}
+
+// Match returns the catalog entry of provider matching output.
+func Match(provider config.Provider, output string) (Pattern, bool) {
+	for _, p := range Catalog {
+		if p.Provider == provider && regexp.MustCompile(p.Regexp).MatchString(output) {
+			return p, true
+		}
+	}
+	return Pattern{}, false
+}
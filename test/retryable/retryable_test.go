@@ -0,0 +1,121 @@
+package retryable
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+)
+
+// samples returns the sample outputs in testdata/dir by the provider their
+// file name starts with.
+func samples(t *testing.T, dir string) map[string]config.Provider {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", dir, "*.txt"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	byPath := map[string]config.Provider{}
+	for _, path := range paths {
+		for _, p := range config.Providers {
+			if strings.HasPrefix(filepath.Base(path), string(p)+"-") {
+				byPath[path] = p
+			}
+		}
+		require.Contains(t, byPath, path, "%s does not start with a provider name", path)
+	}
+	return byPath
+}
+
+func TestCatalogMatchesSampleErrors(t *testing.T) {
+	for path, provider := range samples(t, "retryable") {
+		output, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		_, ok := Match(provider, string(output))
+		assert.True(t, ok, "%s is not retried", path)
+
+		for _, other := range config.Providers {
+			if other != provider {
+				_, ok := Match(other, string(output))
+				assert.False(t, ok, "%s is retried for %s", path, other)
+			}
+		}
+	}
+}
+
+func TestCatalogIgnoresRealFailures(t *testing.T) {
+	for path := range samples(t, "fatal") {
+		output, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		for _, provider := range config.Providers {
+			p, ok := Match(provider, string(output))
+			assert.False(t, ok, "%s is retried as %q", path, p.Reason)
+		}
+	}
+}
+
+// TestSamplesHaveSources keeps testdata/sources.txt listing every sample
+// once, with its provider and the provider version or "-".
+func TestSamplesHaveSources(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "sources.txt"))
+	require.NoError(t, err)
+
+	listed := map[string]bool{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if !assert.Len(t, fields, 4, "sources.txt: %q", line) {
+			continue
+		}
+		sample, provider, version, source := fields[0], fields[1], fields[2], fields[3]
+		assert.False(t, listed[sample], "sources.txt lists %s twice", sample)
+		listed[sample] = true
+		assert.FileExists(t, filepath.Join("testdata", sample))
+		assert.Contains(t, provider, "/", "sources.txt: %s has no provider source address", sample)
+		assert.Regexp(t, `^(-|v?\d+\.\d+\.\d+)$`, version, "sources.txt: %s", sample)
+		assert.NotEmpty(t, source, "sources.txt: %s", sample)
+	}
+
+	for _, dir := range []string{"retryable", "fatal"} {
+		for path := range samples(t, dir) {
+			sample, err := filepath.Rel("testdata", path)
+			require.NoError(t, err)
+			assert.True(t, listed[filepath.ToSlash(sample)], "%s is missing from testdata/sources.txt", path)
+		}
+	}
+}
+
+func TestCatalogCoversEveryProvider(t *testing.T) {
+	covered := map[config.Provider]bool{}
+	for _, p := range Catalog {
+		_, err := regexp.Compile(p.Regexp)
+		assert.NoError(t, err, p.Regexp)
+		assert.NotEmpty(t, p.Reason, p.Regexp)
+		covered[p.Provider] = true
+	}
+	for _, provider := range config.Providers {
+		assert.True(t, covered[provider], "no retryable errors for %s", provider)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	errors := Errors(config.Okta)
+
+	assert.Equal(t, "Okta rate limit exceeded", errors[`Status: 429 Too Many Requests|E0000047|: too many requests`])
+	assert.NotContains(t, errors, `TooManyRequestsException`)
+	for re, reason := range terraform.DefaultRetryableTerraformErrors {
+		assert.Equal(t, reason, errors[re])
+	}
+}
@@ -50,6 +50,9 @@ USAGE:
 COMMANDS:
     all             Run all tests (default)
     aws-cognito     Run AWS Cognito tests only
+    aws-cognito-local
+                    Run AWS Cognito tests against moto in docker, including
+                    the MFA and password policy tests AWS cannot run
     azure-ad        Run Azure AD tests only
     okta            Run Okta tests only
     keycloak        Run Keycloak tests only
@@ -65,12 +68,16 @@ OPTIONS:
     -p, --parallel NUMBER     Number of parallel tests (default: ${DEFAULT_PARALLEL})
     -v, --verbose             Enable verbose output
     -d, --debug               Enable debug mode
+    -n, --dry-run             With clean, list leaked resources without deleting them
     -h, --help                Show this help message
 
 ENVIRONMENT VARIABLES:
     AWS_ACCESS_KEY_ID         AWS access key
     AWS_SECRET_ACCESS_KEY     AWS secret key
     AWS_DEFAULT_REGION        AWS region (default: us-east-1)
+    AWS_ENDPOINT_URL          Send AWS calls to a local stand-in such as moto
+    MOTO_PORT                 Port aws-cognito-local publishes moto on (default: 5000)
+    MOTO_IMAGE                Image aws-cognito-local runs (default: motoserver/moto:latest)
     
     ARM_TENANT_ID             Azure tenant ID
     ARM_CLIENT_ID             Azure client ID
@@ -81,9 +88,24 @@ ENVIRONMENT VARIABLES:
     OKTA_BASE_URL            Okta base URL (default: okta.com)
     OKTA_API_TOKEN           Okta API token
     
-    KEYCLOAK_URL             Keycloak server URL (default: http://localhost:8080)
+    KEYCLOAK_URL             Keycloak server URL (default: http://localhost:8080; clean
+                             only sweeps Keycloak when it is set)
     KEYCLOAK_USERNAME        Keycloak admin username (default: admin)
     KEYCLOAK_PASSWORD        Keycloak admin password (default: admin)
+    KEYCLOAK_BROKER_HOST     Host name Keycloak reaches this machine at (e.g. host.docker.internal)
+
+    IDP_TEST_PROFILE         Profile to load from the profile file (default: default)
+    IDP_TEST_CONFIG          YAML profile file (default: idp-test.yaml)
+    IDP_TEST_DOTENV          Dotenv file (default: .env)
+    IDP_TEST_SKIP_REPORT     Write the reasons providers were skipped to this JSON file
+    IDP_TEST_SWEEP_OLDER_THAN  Minimum age of leaked resources deleted by clean (default: 1h)
+
+    SKIP_setup, SKIP_deploy,  Skip a stage of the live tests. Stage state is kept
+    SKIP_validate,            under test/.stages until teardown, so a deployment
+    SKIP_teardown             kept with SKIP_teardown can be validated again
+
+    Settings are read from the environment first, then the dotenv file, then
+    the selected profile. See idp-test.yaml.example.
 
 EXAMPLES:
     # Run all tests
@@ -92,12 +114,25 @@ EXAMPLES:
     # Run AWS Cognito tests with verbose output
     $0 -v aws-cognito
 
+    # Run the Cognito tests against a moto container started for the run
+    $0 aws-cognito-local
+
+    # Run them against a moto server that is already running
+    AWS_ENDPOINT_URL=http://localhost:5000 $0 aws-cognito-local
+
     # Run tests with custom timeout and debug mode
     $0 -t 45m -d all
 
     # Generate coverage report
     $0 coverage
 
+    # Deploy Keycloak once, then rerun only its validation
+    SKIP_teardown=1 $0 keycloak
+    SKIP_setup=1 SKIP_deploy=1 SKIP_teardown=1 $0 keycloak
+
+    # List resources leaked by crashed tests, then delete them
+    $0 -n clean && $0 clean
+
     # Setup environment and run Azure AD tests
     $0 setup && $0 azure-ad
 
@@ -156,7 +191,7 @@ check_credentials() {
     local provider=$1
     
     case $provider in
-        "aws-cognito")
+        "aws-cognito"|"aws-cognito-local")
             if [[ -z "$AWS_ACCESS_KEY_ID" ]] || [[ -z "$AWS_SECRET_ACCESS_KEY" ]]; then
                 print_warning "AWS credentials not set. Some tests may be skipped."
                 return 1
@@ -194,6 +229,50 @@ check_credentials() {
     return 0
 }
 
+start_cognito_emulator() {
+    if [[ -n "$AWS_ENDPOINT_URL" ]]; then
+        print_info "Using AWS emulator at $AWS_ENDPOINT_URL"
+    else
+        if ! command -v docker &> /dev/null; then
+            print_error "Docker is not installed. It runs moto for aws-cognito-local."
+            exit 1
+        fi
+
+        local port="${MOTO_PORT:-5000}"
+        print_info "Starting moto on port $port..."
+        MOTO_CONTAINER=$(docker run -d --rm -p "$port:5000" "${MOTO_IMAGE:-motoserver/moto:latest}")
+        trap stop_cognito_emulator EXIT
+        export AWS_ENDPOINT_URL="http://localhost:$port"
+    fi
+
+    local attempt
+    for attempt in $(seq 1 30); do
+        if curl -f -s "$AWS_ENDPOINT_URL/moto-api/" > /dev/null; then
+            break
+        fi
+        if [[ $attempt -eq 30 ]]; then
+            print_error "AWS emulator at $AWS_ENDPOINT_URL did not come up"
+            exit 1
+        fi
+        sleep 1
+    done
+
+    # moto accepts any credentials; never send real ones to it
+    export AWS_ACCESS_KEY_ID="test"
+    export AWS_SECRET_ACCESS_KEY="test"
+    unset AWS_SESSION_TOKEN AWS_PROFILE
+    export AWS_DEFAULT_REGION="${AWS_DEFAULT_REGION:-us-east-1}"
+    print_success "AWS emulator ready at $AWS_ENDPOINT_URL"
+}
+
+stop_cognito_emulator() {
+    if [[ -n "$MOTO_CONTAINER" ]]; then
+        print_info "Stopping moto..."
+        docker stop "$MOTO_CONTAINER" > /dev/null || print_warning "Could not stop moto container $MOTO_CONTAINER"
+        MOTO_CONTAINER=""
+    fi
+}
+
 run_tests() {
     local provider=$1
     local timeout=$2
@@ -204,7 +283,7 @@ run_tests() {
     # Convert provider name to test pattern
     local test_pattern=""
     case $provider in
-        "aws-cognito")
+        "aws-cognito"|"aws-cognito-local")
             test_pattern="TestAWSCognito"
             ;;
         "azure-ad")
@@ -294,25 +373,33 @@ run_coverage() {
 cleanup_resources() {
     print_header "Cleaning Up Test Resources"
     
-    # This would ideally scan for any leftover Terraform state files
-    # and run terraform destroy on them
-    
-    local cleanup_dirs=(
-        "../examples/aws-cognito-basic"
-        "../examples/azure-ad-sso"
-        "../examples/okta-integration"
-        "../examples/keycloak-setup"
-        "../examples/multi-provider"
-    )
-    
-    for dir in "${cleanup_dirs[@]}"; do
-        if [[ -d "$dir" ]] && [[ -f "$dir/.terraform/terraform.tfstate" ]]; then
-            print_info "Cleaning up resources in $dir..."
-            (cd "$dir" && terraform destroy -auto-approve) || true
+    # Destroy whatever is still recorded in an example's local state file.
+    # Terraform keeps it next to the configuration, not under .terraform/.
+    for dir in ../examples/*/; do
+        dir="${dir%/}"
+        if [[ -f "$dir/terraform.tfstate" ]]; then
+            if [[ "$DRY_RUN" == "true" ]]; then
+                print_info "Would destroy resources recorded in $dir"
+            else
+                print_info "Destroying resources recorded in $dir..."
+                (cd "$dir" && terraform destroy -auto-approve -input=false) || print_warning "terraform destroy failed in $dir"
+            fi
         fi
     done
     
-    print_success "Cleanup completed"
+    # Tests that crashed or ran in parallel against the same example leave
+    # objects no state file knows about. Find those by terratest- name
+    # prefix and Purpose=terratest tag through each provider's API.
+    local sweep_args=(-older-than "$SWEEP_OLDER_THAN")
+    if [[ "$DRY_RUN" == "true" ]]; then
+        sweep_args+=(-dry-run)
+    fi
+    if go run ./cmd/sweep "${sweep_args[@]}"; then
+        print_success "Cleanup completed"
+    else
+        print_error "Some test resources could not be cleaned up"
+        return 1
+    fi
 }
 
 validate_environment() {
@@ -359,6 +446,8 @@ TIMEOUT=$DEFAULT_TIMEOUT
 PARALLEL=$DEFAULT_PARALLEL
 VERBOSE="false"
 DEBUG="false"
+DRY_RUN="false"
+SWEEP_OLDER_THAN="${IDP_TEST_SWEEP_OLDER_THAN:-1h}"
 COMMAND=""
 
 while [[ $# -gt 0 ]]; do
@@ -379,11 +468,15 @@ while [[ $# -gt 0 ]]; do
             DEBUG="true"
             shift
             ;;
+        -n|--dry-run)
+            DRY_RUN="true"
+            shift
+            ;;
         -h|--help)
             usage
             exit 0
             ;;
-        all|aws-cognito|azure-ad|okta|keycloak|unit|integration|validation|setup|clean|coverage)
+        all|aws-cognito|aws-cognito-local|azure-ad|okta|keycloak|unit|integration|validation|setup|clean|coverage)
             COMMAND="$1"
             shift
             ;;
@@ -423,6 +516,12 @@ case $COMMAND in
         setup_environment
         run_coverage
         ;;
+    "aws-cognito-local")
+        check_prerequisites
+        setup_environment
+        start_cognito_emulator
+        run_tests "$COMMAND" "$TIMEOUT" "$PARALLEL" "$VERBOSE" "$DEBUG"
+        ;;
     "all")
         check_prerequisites
         setup_environment
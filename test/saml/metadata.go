@@ -0,0 +1,232 @@
+// Package saml parses SAML 2.0 identity provider metadata and checks it
+// against what a module was asked to configure: the SSO URL, NameID format,
+// signing certificate and signature algorithm. It also plays the service
+// provider side of a sign-in: encoding AuthnRequests and verifying the
+// signed Responses that come back.
+package saml
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// XML namespaces used in metadata.
+const (
+	MetadataNS = "urn:oasis:names:tc:SAML:2.0:metadata"
+	XMLDSigNS  = "http://www.w3.org/2000/09/xmldsig#"
+	AlgNS      = "urn:oasis:names:tc:SAML:metadata:algsupport"
+	ProtocolNS = "urn:oasis:names:tc:SAML:2.0:protocol"
+)
+
+// Protocol bindings (SAML 2.0 Bindings section 3).
+const (
+	HTTPRedirectBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	HTTPPostBinding     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	HTTPArtifactBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Artifact"
+	SOAPBinding         = "urn:oasis:names:tc:SAML:2.0:bindings:SOAP"
+)
+
+// NameID formats (SAML 2.0 Core section 8.3).
+const (
+	NameIDFormatUnspecified  = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatX509Subject  = "urn:oasis:names:tc:SAML:1.1:nameid-format:X509SubjectName"
+	NameIDFormatPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatTransient    = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+)
+
+var knownBindings = map[string]bool{
+	HTTPRedirectBinding: true,
+	HTTPPostBinding:     true,
+	HTTPArtifactBinding: true,
+	SOAPBinding:         true,
+}
+
+// EntityDescriptor is the root element of an entity's metadata.
+type EntityDescriptor struct {
+	XMLName           xml.Name           `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID          string             `xml:"entityID,attr"`
+	ID                string             `xml:"ID,attr,omitempty"`
+	ValidUntil        *time.Time         `xml:"validUntil,attr,omitempty"`
+	CacheDuration     string             `xml:"cacheDuration,attr,omitempty"`
+	Signature         *Signature         `xml:"http://www.w3.org/2000/09/xmldsig# Signature,omitempty"`
+	Extensions        *Extensions        `xml:"urn:oasis:names:tc:SAML:2.0:metadata Extensions,omitempty"`
+	IDPSSODescriptors []IDPSSODescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+	SPSSODescriptors  []SPSSODescriptor  `xml:"urn:oasis:names:tc:SAML:2.0:metadata SPSSODescriptor"`
+}
+
+// IDPSSODescriptor describes an identity provider's SSO role.
+type IDPSSODescriptor struct {
+	ProtocolSupportEnumeration string          `xml:"protocolSupportEnumeration,attr"`
+	WantAuthnRequestsSigned    *bool           `xml:"WantAuthnRequestsSigned,attr,omitempty"`
+	Extensions                 *Extensions     `xml:"urn:oasis:names:tc:SAML:2.0:metadata Extensions,omitempty"`
+	KeyDescriptors             []KeyDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+	SingleLogoutServices       []Endpoint      `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleLogoutService"`
+	NameIDFormats              []string        `xml:"urn:oasis:names:tc:SAML:2.0:metadata NameIDFormat"`
+	SingleSignOnServices       []Endpoint      `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+}
+
+// SPSSODescriptor describes a service provider's SSO role. Only the parts
+// the tests compare are modelled.
+type SPSSODescriptor struct {
+	ProtocolSupportEnumeration string            `xml:"protocolSupportEnumeration,attr"`
+	AuthnRequestsSigned        *bool             `xml:"AuthnRequestsSigned,attr,omitempty"`
+	WantAssertionsSigned       *bool             `xml:"WantAssertionsSigned,attr,omitempty"`
+	KeyDescriptors             []KeyDescriptor   `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+	SingleLogoutServices       []Endpoint        `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleLogoutService"`
+	NameIDFormats              []string          `xml:"urn:oasis:names:tc:SAML:2.0:metadata NameIDFormat"`
+	AssertionConsumerServices  []IndexedEndpoint `xml:"urn:oasis:names:tc:SAML:2.0:metadata AssertionConsumerService"`
+}
+
+// Extensions holds the algorithm support extension (SAML V2.0 Metadata
+// Profile for Algorithm Support).
+type Extensions struct {
+	DigestMethods  []AlgorithmRef `xml:"urn:oasis:names:tc:SAML:metadata:algsupport DigestMethod"`
+	SigningMethods []AlgorithmRef `xml:"urn:oasis:names:tc:SAML:metadata:algsupport SigningMethod"`
+}
+
+// AlgorithmRef names an algorithm by URI.
+type AlgorithmRef struct {
+	Algorithm string `xml:"Algorithm,attr"`
+}
+
+// KeyDescriptor publishes a key for signing, encryption or both.
+type KeyDescriptor struct {
+	// Use is "signing", "encryption" or empty for both.
+	Use     string  `xml:"use,attr,omitempty"`
+	KeyInfo KeyInfo `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+}
+
+// KeyInfo is the XML Signature KeyInfo element.
+type KeyInfo struct {
+	KeyName  string   `xml:"http://www.w3.org/2000/09/xmldsig# KeyName,omitempty"`
+	X509Data X509Data `xml:"http://www.w3.org/2000/09/xmldsig# X509Data"`
+}
+
+// X509Data carries base64 encoded DER certificates.
+type X509Data struct {
+	X509Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# X509Certificate"`
+}
+
+// Signature is the enveloped signature of signed metadata. Only the
+// algorithm is modelled; the tests do not verify metadata signatures.
+type Signature struct {
+	SignedInfo struct {
+		SignatureMethod AlgorithmRef `xml:"http://www.w3.org/2000/09/xmldsig# SignatureMethod"`
+	} `xml:"http://www.w3.org/2000/09/xmldsig# SignedInfo"`
+}
+
+// Endpoint is a service location for one binding.
+type Endpoint struct {
+	Binding          string `xml:"Binding,attr"`
+	Location         string `xml:"Location,attr"`
+	ResponseLocation string `xml:"ResponseLocation,attr,omitempty"`
+}
+
+// IndexedEndpoint is an endpoint with an index, such as an assertion
+// consumer service.
+type IndexedEndpoint struct {
+	Endpoint
+	Index     int   `xml:"index,attr"`
+	IsDefault *bool `xml:"isDefault,attr,omitempty"`
+}
+
+// IDPSSODescriptor returns the first identity provider role, or nil.
+func (e *EntityDescriptor) IDPSSODescriptor() *IDPSSODescriptor {
+	if len(e.IDPSSODescriptors) == 0 {
+		return nil
+	}
+	return &e.IDPSSODescriptors[0]
+}
+
+// SSOLocation returns the single sign-on URL for binding, or "".
+func (d *IDPSSODescriptor) SSOLocation(binding string) string {
+	for _, s := range d.SingleSignOnServices {
+		if s.Binding == binding {
+			return s.Location
+		}
+	}
+	return ""
+}
+
+// SigningCertificates decodes the certificates of every key usable for
+// signing, which is every key without use="encryption".
+func (d *IDPSSODescriptor) SigningCertificates() ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, kd := range d.KeyDescriptors {
+		if kd.Use == "encryption" {
+			continue
+		}
+		for _, enc := range kd.KeyInfo.X509Data.X509Certificates {
+			cert, err := ParseCertificate(enc)
+			if err != nil {
+				return nil, err
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
+
+// ParseCertificate decodes a certificate given as PEM or as the bare base64
+// DER found in metadata and in the Okta saml_certificate output. Whitespace
+// is ignored.
+func ParseCertificate(s string) (*x509.Certificate, error) {
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return nil, fmt.Errorf("certificate is neither PEM nor base64: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Parse decodes metadata whose root is an EntityDescriptor.
+func Parse(data []byte) (*EntityDescriptor, error) {
+	var e EntityDescriptor
+	if err := xml.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("parsing SAML metadata: %w", err)
+	}
+	return &e, nil
+}
+
+// Fetch retrieves and parses the metadata at url.
+func Fetch(ctx context.Context, client *http.Client, url string) (*EntityDescriptor, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/samlmetadata+xml, application/xml, text/xml")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %s", url, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.Contains(ct, "xml") {
+		return nil, fmt.Errorf("fetching %s: content type %q is not XML", url, ct)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", url, err)
+	}
+	if len(body) == 0 {
+		return nil, errors.New("metadata is empty")
+	}
+	return Parse(body)
+}
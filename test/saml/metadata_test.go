@@ -0,0 +1,260 @@
+package saml
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// oktaMetadata is shaped like the metadata Okta serves for a SAML app.
+const oktaMetadata = `<?xml version="1.0" encoding="UTF-8"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="http://www.okta.com/exk1abcd">
+  <md:IDPSSODescriptor WantAuthnRequestsSigned="false" protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data>
+          <ds:X509Certificate>%s</ds:X509Certificate>
+        </ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified</md:NameIDFormat>
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress</md:NameIDFormat>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://example.okta.com/app/example_app/exk1abcd/sso/saml"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="https://example.okta.com/app/example_app/exk1abcd/sso/saml"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`
+
+// keycloakDescriptor is shaped like a Keycloak realm's SAML descriptor.
+const keycloakDescriptor = `<md:EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:ds="http://www.w3.org/2000/09/xmldsig#" entityID="http://localhost:8080/realms/test">
+  <md:IDPSSODescriptor WantAuthnRequestsSigned="true" protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo>
+        <ds:KeyName>abc123</ds:KeyName>
+        <ds:X509Data>
+          <ds:X509Certificate>%s</ds:X509Certificate>
+        </ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:ArtifactResolutionService Binding="urn:oasis:names:tc:SAML:2.0:bindings:SOAP" Location="http://localhost:8080/realms/test/protocol/saml/resolve" index="0"/>
+    <md:SingleLogoutService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="http://localhost:8080/realms/test/protocol/saml"/>
+    <md:SingleLogoutService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="http://localhost:8080/realms/test/protocol/saml"/>
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:2.0:nameid-format:persistent</md:NameIDFormat>
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:2.0:nameid-format:transient</md:NameIDFormat>
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified</md:NameIDFormat>
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress</md:NameIDFormat>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="http://localhost:8080/realms/test/protocol/saml"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="http://localhost:8080/realms/test/protocol/saml"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:SOAP" Location="http://localhost:8080/realms/test/protocol/saml"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Artifact" Location="http://localhost:8080/realms/test/protocol/saml"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`
+
+const oktaSSOURL = "https://example.okta.com/app/example_app/exk1abcd/sso/saml"
+
+// certificate returns a self-signed certificate, base64 encoded as in
+// metadata, valid for the given period.
+func certificate(t *testing.T, ec bool, validity time.Duration) string {
+	t.Helper()
+	var (
+		pub  interface{}
+		priv interface{}
+	)
+	if ec {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		pub, priv = &key.PublicKey, key
+	} else {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		pub, priv = &key.PublicKey, key
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: "example"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func parseMetadata(t *testing.T, format, cert string) *EntityDescriptor {
+	t.Helper()
+	md, err := Parse([]byte(fmt.Sprintf(format, cert)))
+	require.NoError(t, err)
+	return md
+}
+
+func TestParseOktaMetadata(t *testing.T) {
+	cert := certificate(t, false, 365*24*time.Hour)
+	md := parseMetadata(t, oktaMetadata, cert)
+
+	assert.Equal(t, "http://www.okta.com/exk1abcd", md.EntityID)
+	idp := md.IDPSSODescriptor()
+	require.NotNil(t, idp)
+	assert.Equal(t, oktaSSOURL, idp.SSOLocation(HTTPPostBinding))
+	assert.Equal(t, oktaSSOURL, idp.SSOLocation(HTTPRedirectBinding))
+	assert.Empty(t, idp.SSOLocation(SOAPBinding))
+	assert.Equal(t, []string{NameIDFormatUnspecified, NameIDFormatEmailAddress}, idp.NameIDFormats)
+
+	certs, err := idp.SigningCertificates()
+	require.NoError(t, err)
+	require.Len(t, certs, 1)
+	assert.Equal(t, "example", certs[0].Subject.CommonName)
+
+	findings := Validate(md, Options{
+		EntityID:           "http://www.okta.com/exk1abcd",
+		SSOURL:             oktaSSOURL,
+		NameIDFormat:       NameIDFormatEmailAddress,
+		Certificate:        cert,
+		SignatureAlgorithm: "RSA_SHA256",
+	})
+	assert.Empty(t, findings, findings.String())
+}
+
+func TestParseKeycloakDescriptor(t *testing.T) {
+	md := parseMetadata(t, keycloakDescriptor, certificate(t, false, 365*24*time.Hour))
+
+	idp := md.IDPSSODescriptor()
+	require.NotNil(t, idp)
+	assert.Len(t, idp.SingleSignOnServices, 4)
+	assert.Len(t, idp.SingleLogoutServices, 2)
+	assert.Equal(t, "abc123", idp.KeyDescriptors[0].KeyInfo.KeyName)
+
+	findings := Validate(md, Options{NameIDFormat: NameIDFormatPersistent})
+	assert.Len(t, findings.Errors(), 6, "every plain http endpoint is an error")
+
+	findings = Validate(md, Options{
+		SSOURL:            "http://localhost:8080/realms/test/protocol/saml",
+		NameIDFormat:      NameIDFormatPersistent,
+		AllowLoopbackHTTP: true,
+	})
+	assert.Empty(t, findings.Errors(), findings.String())
+}
+
+func TestMismatchedExpectations(t *testing.T) {
+	md := parseMetadata(t, oktaMetadata, certificate(t, false, 365*24*time.Hour))
+	other := certificate(t, false, 365*24*time.Hour)
+
+	errs := Validate(md, Options{
+		EntityID:     "http://www.okta.com/other",
+		SSOURL:       "https://example.okta.com/app/other/sso/saml",
+		NameIDFormat: NameIDFormatPersistent,
+		Certificate:  other,
+	}).Errors()
+	assert.Equal(t, Findings{
+		{Severity: Error, Field: "entityID", Message: `is "http://www.okta.com/exk1abcd", expected "http://www.okta.com/other"`},
+		{Severity: Error, Field: "SingleSignOnService", Message: `has no location "https://example.okta.com/app/other/sso/saml" (found ` + oktaSSOURL + `, ` + oktaSSOURL + `)`},
+		{Severity: Error, Field: "NameIDFormat", Message: "does not include " + NameIDFormatPersistent + " (found " + NameIDFormatUnspecified + ", " + NameIDFormatEmailAddress + ")"},
+		{Severity: Error, Field: "KeyDescriptor", Message: `does not publish the expected certificate "CN=example"`},
+	}, errs)
+}
+
+func TestCertificateAsPEM(t *testing.T) {
+	cert := certificate(t, false, 365*24*time.Hour)
+	der, err := base64.StdEncoding.DecodeString(cert)
+	require.NoError(t, err)
+	pemCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	md := parseMetadata(t, oktaMetadata, cert)
+	assert.Empty(t, Validate(md, Options{Certificate: pemCert}))
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	expiring := parseMetadata(t, oktaMetadata, certificate(t, false, 10*24*time.Hour))
+	errs := Validate(expiring, Options{}).Errors()
+	require.Len(t, errs, 1)
+	assert.Equal(t, "KeyDescriptor[0].X509Certificate[0]", errs[0].Field)
+	assert.Contains(t, errs[0].Message, "expires on")
+
+	assert.Empty(t, Validate(expiring, Options{ExpiryWarning: 24 * time.Hour}))
+
+	errs = Validate(expiring, Options{Now: time.Now().Add(11 * 24 * time.Hour)}).Errors()
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Message, "expired on")
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	rsaMetadata := parseMetadata(t, oktaMetadata, certificate(t, false, 365*24*time.Hour))
+	ecMetadata := parseMetadata(t, oktaMetadata, certificate(t, true, 365*24*time.Hour))
+
+	assert.Empty(t, Validate(rsaMetadata, Options{SignatureAlgorithm: "RSA_SHA256"}))
+	assert.Empty(t, Validate(rsaMetadata, Options{SignatureAlgorithm: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"}))
+
+	findings := Validate(rsaMetadata, Options{SignatureAlgorithm: "RSA_SHA1"})
+	assert.Equal(t, Findings{{Severity: Warning, Field: "SigningMethod", Message: `signature_algorithm "RSA_SHA1" uses SHA-1`}}, findings)
+
+	findings = Validate(rsaMetadata, Options{SignatureAlgorithm: "RSA_MD5"})
+	assert.Equal(t, Findings{{Severity: Error, Field: "SigningMethod", Message: `signature_algorithm "RSA_MD5" is not a known algorithm`}}, findings)
+
+	findings = Validate(ecMetadata, Options{SignatureAlgorithm: "RSA_SHA256"})
+	assert.Equal(t, Findings{{Severity: Error, Field: "SigningMethod", Message: `signature_algorithm "RSA_SHA256" cannot be used with the ECDSA key of "CN=example"`}}, findings)
+	assert.Empty(t, Validate(ecMetadata, Options{SignatureAlgorithm: "ECDSA_SHA256"}))
+}
+
+func TestAdvertisedSigningMethods(t *testing.T) {
+	md := parseMetadata(t, oktaMetadata, certificate(t, false, 365*24*time.Hour))
+	md.Extensions = &Extensions{SigningMethods: []AlgorithmRef{{Algorithm: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"}}}
+
+	errs := Validate(md, Options{SignatureAlgorithm: "RSA_SHA256"}).Errors()
+	assert.Equal(t, Findings{{Severity: Error, Field: "SigningMethod",
+		Message: "does not include http://www.w3.org/2001/04/xmldsig-more#rsa-sha256 (found http://www.w3.org/2001/04/xmldsig-more#rsa-sha512)"}}, errs)
+}
+
+func TestStructuralErrors(t *testing.T) {
+	md, err := Parse([]byte(`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.example.com" validUntil="2001-01-01T00:00:00Z">
+  <IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:1.1:protocol">
+    <SingleSignOnService Binding="urn:example:binding" Location="/sso"/>
+  </IDPSSODescriptor>
+</EntityDescriptor>`))
+	require.NoError(t, err)
+
+	assert.Equal(t, Findings{
+		{Severity: Error, Field: "validUntil", Message: "metadata expired on 2001-01-01T00:00:00Z"},
+		{Severity: Error, Field: "IDPSSODescriptor.protocolSupportEnumeration", Message: "does not include urn:oasis:names:tc:SAML:2.0:protocol"},
+		{Severity: Error, Field: "SingleSignOnService[urn:example:binding]", Message: `binding "urn:example:binding" is not a SAML 2.0 binding`},
+		{Severity: Error, Field: "SingleSignOnService[urn:example:binding]", Message: `location "/sso" is not an absolute URL`},
+		{Severity: Error, Field: "KeyDescriptor", Message: "no signing certificate is published"},
+	}, Validate(md, Options{}))
+
+	md, err = Parse([]byte(`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://sp.example.com"><SPSSODescriptor/></EntityDescriptor>`))
+	require.NoError(t, err)
+	assert.Equal(t, Findings{{Severity: Error, Field: "IDPSSODescriptor", Message: "is required"}}, Validate(md, Options{}))
+}
+
+func TestFetch(t *testing.T) {
+	body := fmt.Sprintf(oktaMetadata, certificate(t, false, 365*24*time.Hour))
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml;charset=utf-8")
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	md, err := Fetch(context.Background(), server.Client(), server.URL+"/metadata")
+	require.NoError(t, err)
+	assert.Equal(t, "http://www.okta.com/exk1abcd", md.EntityID)
+
+	_, err = Fetch(context.Background(), server.Client(), server.URL+"/missing")
+	assert.ErrorContains(t, err, "unexpected status 404")
+}
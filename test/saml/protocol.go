@@ -0,0 +1,273 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// AssertionNS is the namespace of assertions and their contents.
+const AssertionNS = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+// Status codes (SAML 2.0 Core section 3.2.2.2).
+const (
+	StatusSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	StatusRequester   = "urn:oasis:names:tc:SAML:2.0:status:Requester"
+	StatusResponder   = "urn:oasis:names:tc:SAML:2.0:status:Responder"
+	StatusAuthnFailed = "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed"
+)
+
+// Attribute name formats (SAML 2.0 Core section 8.2).
+const (
+	AttrNameFormatUnspecified = "urn:oasis:names:tc:SAML:2.0:attrname-format:unspecified"
+	AttrNameFormatBasic       = "urn:oasis:names:tc:SAML:2.0:attrname-format:basic"
+	AttrNameFormatURI         = "urn:oasis:names:tc:SAML:2.0:attrname-format:uri"
+)
+
+// BearerConfirmation is the bearer subject confirmation method.
+const BearerConfirmation = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+// PasswordProtectedTransport is the authentication context class for a
+// password sent over TLS.
+const PasswordProtectedTransport = "urn:oasis:names:tc:SAML:2.0:ac:classes:PasswordProtectedTransport"
+
+// AuthnRequest is a service provider's request to sign a user in.
+type AuthnRequest struct {
+	XMLName                     xml.Name      `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string        `xml:"ID,attr"`
+	Version                     string        `xml:"Version,attr"`
+	IssueInstant                time.Time     `xml:"IssueInstant,attr"`
+	Destination                 string        `xml:"Destination,attr,omitempty"`
+	AssertionConsumerServiceURL string        `xml:"AssertionConsumerServiceURL,attr,omitempty"`
+	ProtocolBinding             string        `xml:"ProtocolBinding,attr,omitempty"`
+	ForceAuthn                  *bool         `xml:"ForceAuthn,attr,omitempty"`
+	Issuer                      string        `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                *NameIDPolicy `xml:"urn:oasis:names:tc:SAML:2.0:protocol NameIDPolicy,omitempty"`
+}
+
+// NameIDPolicy constrains the NameID the identity provider issues.
+type NameIDPolicy struct {
+	Format      string `xml:"Format,attr,omitempty"`
+	AllowCreate *bool  `xml:"AllowCreate,attr,omitempty"`
+}
+
+// LogoutRequest asks the identity provider to end a user's session.
+type LogoutRequest struct {
+	XMLName      xml.Name  `xml:"urn:oasis:names:tc:SAML:2.0:protocol LogoutRequest"`
+	ID           string    `xml:"ID,attr"`
+	Version      string    `xml:"Version,attr"`
+	IssueInstant time.Time `xml:"IssueInstant,attr"`
+	Destination  string    `xml:"Destination,attr,omitempty"`
+	Issuer       string    `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameID       NameID    `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+	SessionIndex string    `xml:"urn:oasis:names:tc:SAML:2.0:protocol SessionIndex,omitempty"`
+}
+
+// Response carries the outcome of an AuthnRequest and, on success, the
+// assertions about the user.
+type Response struct {
+	XMLName      xml.Name    `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	ID           string      `xml:"ID,attr"`
+	InResponseTo string      `xml:"InResponseTo,attr,omitempty"`
+	Version      string      `xml:"Version,attr"`
+	IssueInstant time.Time   `xml:"IssueInstant,attr"`
+	Destination  string      `xml:"Destination,attr,omitempty"`
+	Issuer       string      `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       Status      `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+	Assertions   []Assertion `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+
+	// Signed is set by VerifyResponse when the Response element itself
+	// carried a valid signature.
+	Signed bool `xml:"-"`
+}
+
+// Status is the response status.
+type Status struct {
+	StatusCode    StatusCode `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+	StatusMessage string     `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusMessage,omitempty"`
+}
+
+// StatusCode is a status code URI.
+type StatusCode struct {
+	Value string `xml:"Value,attr"`
+}
+
+// Assertion is a set of statements the identity provider makes about a
+// subject.
+type Assertion struct {
+	XMLName             xml.Name             `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID                  string               `xml:"ID,attr"`
+	Version             string               `xml:"Version,attr"`
+	IssueInstant        time.Time            `xml:"IssueInstant,attr"`
+	Issuer              string               `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject             Subject              `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions          *Conditions          `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions,omitempty"`
+	AuthnStatements     []AuthnStatement     `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnStatement"`
+	AttributeStatements []AttributeStatement `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
+
+	// Signed is set by VerifyResponse when the assertion carried a valid
+	// signature of its own.
+	Signed bool `xml:"-"`
+}
+
+// Subject identifies who the assertion is about.
+type Subject struct {
+	NameID               NameID                `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+	SubjectConfirmations []SubjectConfirmation `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+}
+
+// NameID is the subject's identifier in a given format.
+type NameID struct {
+	Format          string `xml:"Format,attr,omitempty"`
+	SPNameQualifier string `xml:"SPNameQualifier,attr,omitempty"`
+	Value           string `xml:",chardata"`
+}
+
+// SubjectConfirmation says how the bearer of the assertion is confirmed.
+type SubjectConfirmation struct {
+	Method string                  `xml:"Method,attr"`
+	Data   SubjectConfirmationData `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+}
+
+// SubjectConfirmationData restricts where and until when a bearer
+// assertion may be used.
+type SubjectConfirmationData struct {
+	InResponseTo string     `xml:"InResponseTo,attr,omitempty"`
+	NotOnOrAfter *time.Time `xml:"NotOnOrAfter,attr,omitempty"`
+	Recipient    string     `xml:"Recipient,attr,omitempty"`
+}
+
+// Conditions limit the validity period and audience of an assertion.
+type Conditions struct {
+	NotBefore            *time.Time            `xml:"NotBefore,attr,omitempty"`
+	NotOnOrAfter         *time.Time            `xml:"NotOnOrAfter,attr,omitempty"`
+	AudienceRestrictions []AudienceRestriction `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+}
+
+// AudienceRestriction lists the service providers an assertion is for.
+type AudienceRestriction struct {
+	Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+}
+
+// AuthnStatement records when and how the subject authenticated.
+type AuthnStatement struct {
+	AuthnInstant time.Time    `xml:"AuthnInstant,attr"`
+	SessionIndex string       `xml:"SessionIndex,attr,omitempty"`
+	AuthnContext AuthnContext `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnContext"`
+}
+
+// AuthnContext names the authentication method.
+type AuthnContext struct {
+	AuthnContextClassRef string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnContextClassRef"`
+}
+
+// AttributeStatement carries attributes of the subject.
+type AttributeStatement struct {
+	Attributes []Attribute `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+}
+
+// Attribute is one named, possibly multi-valued, attribute.
+type Attribute struct {
+	Name       string   `xml:"Name,attr"`
+	NameFormat string   `xml:"NameFormat,attr,omitempty"`
+	Values     []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+}
+
+// Attributes returns every attribute of the assertion by name. Values of
+// attributes repeated across statements are concatenated.
+func (a *Assertion) Attributes() map[string][]string {
+	attrs := map[string][]string{}
+	for _, s := range a.AttributeStatements {
+		for _, attr := range s.Attributes {
+			attrs[attr.Name] = append(attrs[attr.Name], attr.Values...)
+		}
+	}
+	return attrs
+}
+
+// Attribute returns the values of the named attribute, or nil.
+func (a *Assertion) Attribute(name string) []string {
+	return a.Attributes()[name]
+}
+
+// NewID returns a random identifier usable as an xs:ID, which must not
+// start with a digit.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "_" + hex.EncodeToString(b)
+}
+
+// NewAuthnRequest returns a request from the service provider spEntityID
+// asking for the response to be posted to acsURL.
+func NewAuthnRequest(spEntityID, acsURL, destination string) *AuthnRequest {
+	return &AuthnRequest{
+		ID:                          NewID(),
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC(),
+		Destination:                 destination,
+		AssertionConsumerServiceURL: acsURL,
+		ProtocolBinding:             HTTPPostBinding,
+		Issuer:                      spEntityID,
+	}
+}
+
+// RedirectURL encodes the request for the HTTP-Redirect binding (SAML 2.0
+// Bindings section 3.4): DEFLATE, base64 and a SAMLRequest query parameter.
+func (r *AuthnRequest) RedirectURL(ssoURL, relayState string) (string, error) {
+	data, err := xml.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return "", err
+	}
+	if err := fw.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(ssoURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(buf.Bytes()))
+	if relayState != "" {
+		q.Set("RelayState", relayState)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// DecodeMessage decodes a SAMLRequest or SAMLResponse parameter into out.
+// Messages sent with the HTTP-Redirect binding are deflated as well as
+// base64 encoded.
+func DecodeMessage(value string, deflated bool, out interface{}) error {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("decoding SAML message: %w", err)
+	}
+	if deflated {
+		if data, err = io.ReadAll(flate.NewReader(bytes.NewReader(data))); err != nil {
+			return fmt.Errorf("inflating SAML message: %w", err)
+		}
+	}
+	if err := xml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("parsing SAML message: %w", err)
+	}
+	return nil
+}
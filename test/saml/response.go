@@ -0,0 +1,216 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/finding"
+)
+
+// VerifyResponse checks the XML signatures of a Response against the
+// identity provider's signing certificates and parses it.
+//
+// Either the Response or every Assertion in it must be signed. Only the
+// verified content is parsed, so elements injected next to a signed
+// element are never returned.
+func VerifyResponse(data []byte, certs []*x509.Certificate) (*Response, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("parsing SAML response: %w", err)
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Response" || root.NamespaceURI() != ProtocolNS {
+		return nil, errors.New("SAML response: root element is not a protocol Response")
+	}
+
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: certs})
+
+	responseSigned := hasSignature(root)
+	if responseSigned {
+		verified, err := ctx.Validate(root)
+		if err != nil {
+			return nil, fmt.Errorf("verifying Response signature: %w", err)
+		}
+		root = verified
+	}
+
+	var signed []bool
+	for _, el := range root.ChildElements() {
+		if el.Tag == "EncryptedAssertion" {
+			return nil, errors.New("SAML response: encrypted assertions are not supported")
+		}
+		if el.Tag != "Assertion" || el.NamespaceURI() != AssertionNS {
+			continue
+		}
+		if !hasSignature(el) {
+			if !responseSigned {
+				return nil, fmt.Errorf("SAML response: Assertion %s is not signed", el.SelectAttrValue("ID", ""))
+			}
+			signed = append(signed, false)
+			continue
+		}
+		verified, err := ctx.Validate(el)
+		if err != nil {
+			return nil, fmt.Errorf("verifying Assertion %s signature: %w", el.SelectAttrValue("ID", ""), err)
+		}
+		root.InsertChildAt(el.Index(), verified)
+		root.RemoveChild(el)
+		signed = append(signed, true)
+	}
+
+	out := etree.NewDocument()
+	out.SetRoot(root.Copy())
+	verifiedXML, err := out.WriteToBytes()
+	if err != nil {
+		return nil, err
+	}
+	var resp Response
+	if err := xml.Unmarshal(verifiedXML, &resp); err != nil {
+		return nil, fmt.Errorf("parsing SAML response: %w", err)
+	}
+	resp.Signed = responseSigned
+	for i := range resp.Assertions {
+		resp.Assertions[i].Signed = signed[i]
+	}
+	return &resp, nil
+}
+
+func hasSignature(el *etree.Element) bool {
+	for _, child := range el.ChildElements() {
+		if child.Tag == "Signature" && child.NamespaceURI() == XMLDSigNS {
+			return true
+		}
+	}
+	return false
+}
+
+// ResponseOptions are what a service provider expects of a Response.
+// Empty fields are not checked.
+type ResponseOptions struct {
+	// Issuer is the identity provider's entity ID.
+	Issuer string
+	// Audience is the service provider's entity ID.
+	Audience string
+	// Recipient is the assertion consumer service URL the response was
+	// delivered to.
+	Recipient string
+	// InResponseTo is the ID of the AuthnRequest; empty for IdP initiated
+	// sign-in.
+	InResponseTo string
+	// NameIDFormat is the NameID format the service provider asked for.
+	NameIDFormat string
+	// RequireSignedAssertions fails responses whose assertions are only
+	// covered by the Response signature, like want_assertions_signed.
+	RequireSignedAssertions bool
+	// Now is the time conditions are checked against, time.Now by default.
+	Now time.Time
+	// Skew is the clock skew tolerated, one minute by default.
+	Skew time.Duration
+}
+
+// ValidateResponse checks a verified Response the way a service provider
+// processes it (SAML 2.0 Profiles section 4.1.4.3).
+func ValidateResponse(r *Response, opts ResponseOptions) Findings {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Skew == 0 {
+		opts.Skew = time.Minute
+	}
+
+	v := &validator{}
+	if r.Version != "2.0" {
+		v.add(Error, "Response.Version", fmt.Sprintf("is %q, expected 2.0", r.Version))
+	}
+	if code := r.Status.StatusCode.Value; code != StatusSuccess {
+		message := "is " + code
+		if r.Status.StatusMessage != "" {
+			message += ": " + r.Status.StatusMessage
+		}
+		v.add(Error, "Response.Status", message)
+		return v.findings
+	}
+	if opts.Recipient != "" && r.Destination != "" && r.Destination != opts.Recipient {
+		v.add(Error, "Response.Destination", fmt.Sprintf("is %q, expected %q", r.Destination, opts.Recipient))
+	}
+	if r.InResponseTo != opts.InResponseTo {
+		v.add(Error, "Response.InResponseTo", fmt.Sprintf("is %q, expected %q", r.InResponseTo, opts.InResponseTo))
+	}
+	if opts.Issuer != "" && r.Issuer != "" && r.Issuer != opts.Issuer {
+		v.add(Error, "Response.Issuer", fmt.Sprintf("is %q, expected %q", r.Issuer, opts.Issuer))
+	}
+	if len(r.Assertions) == 0 {
+		v.add(Error, "Assertion", "is required")
+	}
+
+	for i := range r.Assertions {
+		v.checkAssertion(fmt.Sprintf("Assertion[%d]", i), &r.Assertions[i], opts)
+	}
+	return v.findings
+}
+
+func (v *validator) checkAssertion(field string, a *Assertion, opts ResponseOptions) {
+	if opts.RequireSignedAssertions && !a.Signed {
+		v.add(Error, field, "is not signed")
+	}
+	if opts.Issuer != "" && a.Issuer != opts.Issuer {
+		v.add(Error, field+".Issuer", fmt.Sprintf("is %q, expected %q", a.Issuer, opts.Issuer))
+	}
+
+	nameID := a.Subject.NameID
+	if nameID.Value == "" {
+		v.add(Error, field+".Subject.NameID", "is required")
+	}
+	if opts.NameIDFormat != "" && nameID.Format != opts.NameIDFormat {
+		v.add(Error, field+".Subject.NameID", fmt.Sprintf("format is %q, expected %q", nameID.Format, opts.NameIDFormat))
+	}
+
+	bearer := false
+	for _, sc := range a.Subject.SubjectConfirmations {
+		if sc.Method != BearerConfirmation {
+			continue
+		}
+		bearer = true
+		data := sc.Data
+		if opts.Recipient != "" && data.Recipient != opts.Recipient {
+			v.add(Error, field+".SubjectConfirmationData.Recipient", fmt.Sprintf("is %q, expected %q", data.Recipient, opts.Recipient))
+		}
+		if data.InResponseTo != opts.InResponseTo {
+			v.add(Error, field+".SubjectConfirmationData.InResponseTo", fmt.Sprintf("is %q, expected %q", data.InResponseTo, opts.InResponseTo))
+		}
+		if data.NotOnOrAfter == nil {
+			v.add(Error, field+".SubjectConfirmationData.NotOnOrAfter", "is required")
+		} else if !opts.Now.Add(-opts.Skew).Before(*data.NotOnOrAfter) {
+			v.add(Error, field+".SubjectConfirmationData.NotOnOrAfter", fmt.Sprintf("expired at %s", data.NotOnOrAfter.Format(time.RFC3339)))
+		}
+	}
+	if !bearer {
+		v.add(Error, field+".SubjectConfirmation", "has no bearer confirmation")
+	}
+
+	if c := a.Conditions; c != nil {
+		if c.NotBefore != nil && opts.Now.Add(opts.Skew).Before(*c.NotBefore) {
+			v.add(Error, field+".Conditions.NotBefore", fmt.Sprintf("is in the future: %s", c.NotBefore.Format(time.RFC3339)))
+		}
+		if c.NotOnOrAfter != nil && !opts.Now.Add(-opts.Skew).Before(*c.NotOnOrAfter) {
+			v.add(Error, field+".Conditions.NotOnOrAfter", fmt.Sprintf("expired at %s", c.NotOnOrAfter.Format(time.RFC3339)))
+		}
+		if opts.Audience != "" {
+			for _, ar := range c.AudienceRestrictions {
+				if !finding.ContainsString(ar.Audiences, opts.Audience) {
+					v.add(Error, field+".Conditions.AudienceRestriction", fmt.Sprintf("does not include %q", opts.Audience))
+				}
+			}
+		}
+	}
+
+	if len(a.AuthnStatements) == 0 {
+		v.add(Error, field+".AuthnStatement", "is required")
+	}
+}
@@ -0,0 +1,140 @@
+package saml
+
+import (
+	"encoding/xml"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	idpEntityID = "https://idp.example.com/metadata"
+	spEntityID  = "https://sp.example.com"
+	spACSURL    = "https://sp.example.com/saml/acs"
+)
+
+// response returns a valid response to request ID "_req" issued at now.
+func response(now time.Time) *Response {
+	expires := now.Add(5 * time.Minute)
+	return &Response{
+		ID:           "_resp",
+		InResponseTo: "_req",
+		Version:      "2.0",
+		IssueInstant: now,
+		Destination:  spACSURL,
+		Issuer:       idpEntityID,
+		Status:       Status{StatusCode: StatusCode{Value: StatusSuccess}},
+		Assertions: []Assertion{{
+			ID:      "_assertion",
+			Version: "2.0",
+			Issuer:  idpEntityID,
+			Subject: Subject{
+				NameID: NameID{Format: NameIDFormatEmailAddress, Value: "jdoe@example.com"},
+				SubjectConfirmations: []SubjectConfirmation{{
+					Method: BearerConfirmation,
+					Data:   SubjectConfirmationData{InResponseTo: "_req", NotOnOrAfter: &expires, Recipient: spACSURL},
+				}},
+			},
+			Conditions: &Conditions{
+				NotBefore:            &now,
+				NotOnOrAfter:         &expires,
+				AudienceRestrictions: []AudienceRestriction{{Audiences: []string{spEntityID}}},
+			},
+			AuthnStatements: []AuthnStatement{{AuthnInstant: now}},
+			AttributeStatements: []AttributeStatement{
+				{Attributes: []Attribute{{Name: "groups", Values: []string{"admins"}}}},
+				{Attributes: []Attribute{{Name: "groups", Values: []string{"users"}}}},
+			},
+			Signed: true,
+		}},
+	}
+}
+
+func responseOptions(now time.Time) ResponseOptions {
+	return ResponseOptions{
+		Issuer:                  idpEntityID,
+		Audience:                spEntityID,
+		Recipient:               spACSURL,
+		InResponseTo:            "_req",
+		NameIDFormat:            NameIDFormatEmailAddress,
+		RequireSignedAssertions: true,
+		Now:                     now,
+	}
+}
+
+func TestValidResponse(t *testing.T) {
+	now := time.Now()
+	r := response(now)
+	assert.Empty(t, ValidateResponse(r, responseOptions(now)))
+	assert.Equal(t, []string{"admins", "users"}, r.Assertions[0].Attribute("groups"))
+	assert.Nil(t, r.Assertions[0].Attribute("email"))
+}
+
+func TestResponseForAnotherServiceProvider(t *testing.T) {
+	now := time.Now()
+	opts := responseOptions(now)
+	opts.Audience = "https://other.example.com"
+	opts.Recipient = "https://other.example.com/acs"
+	opts.InResponseTo = "_other"
+
+	assert.Equal(t, Findings{
+		{Severity: Error, Field: "Response.Destination", Message: `is "https://sp.example.com/saml/acs", expected "https://other.example.com/acs"`},
+		{Severity: Error, Field: "Response.InResponseTo", Message: `is "_req", expected "_other"`},
+		{Severity: Error, Field: "Assertion[0].SubjectConfirmationData.Recipient", Message: `is "https://sp.example.com/saml/acs", expected "https://other.example.com/acs"`},
+		{Severity: Error, Field: "Assertion[0].SubjectConfirmationData.InResponseTo", Message: `is "_req", expected "_other"`},
+		{Severity: Error, Field: "Assertion[0].Conditions.AudienceRestriction", Message: `does not include "https://other.example.com"`},
+	}, ValidateResponse(response(now), opts))
+}
+
+func TestExpiredResponse(t *testing.T) {
+	issued := time.Now().Add(-time.Hour)
+	findings := ValidateResponse(response(issued), responseOptions(time.Now()))
+	require.Len(t, findings, 2)
+	assert.Equal(t, "Assertion[0].SubjectConfirmationData.NotOnOrAfter", findings[0].Field)
+	assert.Equal(t, "Assertion[0].Conditions.NotOnOrAfter", findings[1].Field)
+
+	// Within the tolerated clock skew a response is still accepted.
+	opts := responseOptions(issued.Add(5*time.Minute + 30*time.Second))
+	assert.Empty(t, ValidateResponse(response(issued), opts))
+}
+
+func TestFailedResponse(t *testing.T) {
+	r := response(time.Now())
+	r.Status = Status{StatusCode: StatusCode{Value: StatusAuthnFailed}, StatusMessage: "bad password"}
+	assert.Equal(t, Findings{{Severity: Error, Field: "Response.Status", Message: "is " + StatusAuthnFailed + ": bad password"}},
+		ValidateResponse(r, responseOptions(time.Now())))
+}
+
+func TestVerifyRejectsUnsignedResponse(t *testing.T) {
+	data, err := xml.Marshal(response(time.Now()))
+	require.NoError(t, err)
+
+	_, err = VerifyResponse(data, nil)
+	assert.EqualError(t, err, "SAML response: Assertion _assertion is not signed")
+
+	_, err = VerifyResponse([]byte(`<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata"/>`), nil)
+	assert.ErrorContains(t, err, "not a protocol Response")
+}
+
+func TestAuthnRequestRedirectURL(t *testing.T) {
+	req := NewAuthnRequest(spEntityID, spACSURL, "https://idp.example.com/sso")
+	req.NameIDPolicy = &NameIDPolicy{Format: NameIDFormatPersistent}
+
+	target, err := req.RedirectURL("https://idp.example.com/sso?tenant=a", "relay")
+	require.NoError(t, err)
+	u, err := url.Parse(target)
+	require.NoError(t, err)
+	assert.Equal(t, "a", u.Query().Get("tenant"))
+	assert.Equal(t, "relay", u.Query().Get("RelayState"))
+
+	var decoded AuthnRequest
+	require.NoError(t, DecodeMessage(u.Query().Get("SAMLRequest"), true, &decoded))
+	assert.Equal(t, req.ID, decoded.ID)
+	assert.Equal(t, spEntityID, decoded.Issuer)
+	assert.Equal(t, spACSURL, decoded.AssertionConsumerServiceURL)
+	assert.Equal(t, NameIDFormatPersistent, decoded.NameIDPolicy.Format)
+	assert.Regexp(t, `^_[0-9a-f]{32}$`, decoded.ID)
+}
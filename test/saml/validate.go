@@ -0,0 +1,269 @@
+package saml
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/internal/finding"
+)
+
+// Severity grades a finding. Errors fail the test; warnings are logged.
+type Severity = finding.Severity
+
+const (
+	Error   = finding.Error
+	Warning = finding.Warning
+)
+
+// Finding is one problem with a metadata document. Field is the element or
+// attribute the finding is about.
+type Finding = finding.Finding
+
+// Findings is the result of validating a document.
+type Findings = finding.Findings
+
+// signatureAlgorithms maps the names the Okta and Keycloak providers accept
+// for signature_algorithm to XML Signature algorithm URIs.
+var signatureAlgorithms = map[string]string{
+	"RSA_SHA1":     "http://www.w3.org/2000/09/xmldsig#rsa-sha1",
+	"RSA_SHA256":   "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256",
+	"RSA_SHA512":   "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512",
+	"DSA_SHA1":     "http://www.w3.org/2000/09/xmldsig#dsa-sha1",
+	"ECDSA_SHA1":   "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha1",
+	"ECDSA_SHA256": "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256",
+	"ECDSA_SHA512": "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512",
+}
+
+// SignatureAlgorithmURI returns the XML Signature URI for a module's
+// signature_algorithm value. URIs are returned unchanged.
+func SignatureAlgorithmURI(name string) (string, bool) {
+	if strings.Contains(name, "://") {
+		return name, true
+	}
+	uri, ok := signatureAlgorithms[strings.ToUpper(name)]
+	return uri, ok
+}
+
+// Options are the values a module was configured with. Empty fields are
+// not checked.
+type Options struct {
+	// EntityID is the expected entityID.
+	EntityID string
+	// SSOURL must be the location of one of the SingleSignOnService
+	// elements, normally the saml_sso_url output.
+	SSOURL string
+	// NameIDFormat must be listed in the IDPSSODescriptor, normally the
+	// subject_name_id_format input.
+	NameIDFormat string
+	// Certificate must be one of the signing certificates, normally the
+	// saml_certificate output. PEM and bare base64 are accepted.
+	Certificate string
+	// SignatureAlgorithm is the signature_algorithm input, either a module
+	// name such as RSA_SHA256 or an algorithm URI.
+	SignatureAlgorithm string
+	// ExpiryWarning is how long before expiry a signing certificate fails
+	// validation, 30 days by default.
+	ExpiryWarning time.Duration
+	// Now is the time certificates are checked against, time.Now by default.
+	Now time.Time
+	// AllowLoopbackHTTP downgrades plain http endpoints on localhost or a
+	// loopback address to warnings.
+	AllowLoopbackHTTP bool
+}
+
+// Validate checks identity provider metadata for a usable IDPSSODescriptor
+// and compares it against opts.
+//
+// Expired certificates and certificates expiring within ExpiryWarning are
+// both errors, so a deployment is caught before its federation breaks.
+func Validate(e *EntityDescriptor, opts Options) Findings {
+	if opts.ExpiryWarning == 0 {
+		opts.ExpiryWarning = 30 * 24 * time.Hour
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+
+	v := &validator{}
+	if e.EntityID == "" {
+		v.add(Error, "entityID", "is required")
+	} else if opts.EntityID != "" && e.EntityID != opts.EntityID {
+		v.add(Error, "entityID", fmt.Sprintf("is %q, expected %q", e.EntityID, opts.EntityID))
+	}
+	if e.ValidUntil != nil && opts.Now.After(*e.ValidUntil) {
+		v.add(Error, "validUntil", fmt.Sprintf("metadata expired on %s", e.ValidUntil.Format(time.RFC3339)))
+	}
+
+	idp := e.IDPSSODescriptor()
+	if idp == nil {
+		v.add(Error, "IDPSSODescriptor", "is required")
+		return v.findings
+	}
+	if !finding.ContainsString(strings.Fields(idp.ProtocolSupportEnumeration), ProtocolNS) {
+		v.add(Error, "IDPSSODescriptor.protocolSupportEnumeration", fmt.Sprintf("does not include %s", ProtocolNS))
+	}
+
+	v.checkEndpoints("SingleSignOnService", idp.SingleSignOnServices, true, opts)
+	v.checkEndpoints("SingleLogoutService", idp.SingleLogoutServices, false, opts)
+
+	if opts.SSOURL != "" {
+		var locations []string
+		for _, s := range idp.SingleSignOnServices {
+			locations = append(locations, s.Location)
+		}
+		if !finding.ContainsString(locations, opts.SSOURL) {
+			v.add(Error, "SingleSignOnService", fmt.Sprintf("has no location %q (found %s)", opts.SSOURL, strings.Join(locations, ", ")))
+		}
+	}
+
+	if opts.NameIDFormat != "" {
+		switch {
+		case len(idp.NameIDFormats) == 0:
+			v.add(Warning, "NameIDFormat", fmt.Sprintf("is not listed; expected %s", opts.NameIDFormat))
+		case !finding.ContainsString(idp.NameIDFormats, opts.NameIDFormat):
+			v.add(Error, "NameIDFormat", fmt.Sprintf("does not include %s (found %s)", opts.NameIDFormat, strings.Join(idp.NameIDFormats, ", ")))
+		}
+	}
+
+	certs := v.checkCertificates(idp, opts)
+
+	if opts.Certificate != "" {
+		want, err := ParseCertificate(opts.Certificate)
+		if err != nil {
+			v.add(Error, "KeyDescriptor", fmt.Sprintf("expected certificate does not parse: %v", err))
+		} else if !containsCert(certs, want) {
+			v.add(Error, "KeyDescriptor", fmt.Sprintf("does not publish the expected certificate %q", want.Subject.String()))
+		}
+	}
+
+	if opts.SignatureAlgorithm != "" {
+		v.checkSignatureAlgorithm(e, idp, certs, opts.SignatureAlgorithm)
+	}
+	return v.findings
+}
+
+type validator struct {
+	findings Findings
+}
+
+func (v *validator) add(severity Severity, field, message string) {
+	v.findings = append(v.findings, Finding{Severity: severity, Field: field, Message: message})
+}
+
+func (v *validator) checkEndpoints(element string, endpoints []Endpoint, required bool, opts Options) {
+	if required && len(endpoints) == 0 {
+		v.add(Error, element, "is required")
+	}
+	for _, ep := range endpoints {
+		field := fmt.Sprintf("%s[%s]", element, ep.Binding)
+		if !knownBindings[ep.Binding] {
+			v.add(Error, field, fmt.Sprintf("binding %q is not a SAML 2.0 binding", ep.Binding))
+		}
+		u, err := url.Parse(ep.Location)
+		switch {
+		case err != nil || u.Host == "":
+			v.add(Error, field, fmt.Sprintf("location %q is not an absolute URL", ep.Location))
+		case u.Scheme == "https":
+		case opts.AllowLoopbackHTTP && u.Scheme == "http" && finding.IsLoopback(u.Hostname()):
+			v.add(Warning, field, fmt.Sprintf("location %q does not use https", ep.Location))
+		default:
+			v.add(Error, field, fmt.Sprintf("location %q does not use https", ep.Location))
+		}
+	}
+}
+
+// checkCertificates decodes the signing certificates and reports missing,
+// malformed, expired and soon to expire ones.
+func (v *validator) checkCertificates(idp *IDPSSODescriptor, opts Options) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for i, kd := range idp.KeyDescriptors {
+		if kd.Use == "encryption" {
+			continue
+		}
+		for j, enc := range kd.KeyInfo.X509Data.X509Certificates {
+			field := fmt.Sprintf("KeyDescriptor[%d].X509Certificate[%d]", i, j)
+			cert, err := ParseCertificate(enc)
+			if err != nil {
+				v.add(Error, field, err.Error())
+				continue
+			}
+			certs = append(certs, cert)
+
+			name := cert.Subject.String()
+			switch {
+			case opts.Now.After(cert.NotAfter):
+				v.add(Error, field, fmt.Sprintf("certificate %q expired on %s", name, cert.NotAfter.Format(time.RFC3339)))
+			case opts.Now.Before(cert.NotBefore):
+				v.add(Error, field, fmt.Sprintf("certificate %q is not valid until %s", name, cert.NotBefore.Format(time.RFC3339)))
+			case cert.NotAfter.Sub(opts.Now) < opts.ExpiryWarning:
+				v.add(Error, field, fmt.Sprintf("certificate %q expires on %s, within %s", name, cert.NotAfter.Format(time.RFC3339), opts.ExpiryWarning))
+			}
+		}
+	}
+	if len(certs) == 0 {
+		v.add(Error, "KeyDescriptor", "no signing certificate is published")
+	}
+	return certs
+}
+
+// checkSignatureAlgorithm compares the configured algorithm with the
+// algorithms the metadata advertises and with the signing key type.
+func (v *validator) checkSignatureAlgorithm(e *EntityDescriptor, idp *IDPSSODescriptor, certs []*x509.Certificate, name string) {
+	uri, ok := SignatureAlgorithmURI(name)
+	if !ok {
+		v.add(Error, "SigningMethod", fmt.Sprintf("signature_algorithm %q is not a known algorithm", name))
+		return
+	}
+	if strings.HasSuffix(uri, "sha1") {
+		v.add(Warning, "SigningMethod", fmt.Sprintf("signature_algorithm %q uses SHA-1", name))
+	}
+
+	var advertised []string
+	for _, ext := range []*Extensions{e.Extensions, idp.Extensions} {
+		if ext == nil {
+			continue
+		}
+		for _, m := range ext.SigningMethods {
+			advertised = append(advertised, m.Algorithm)
+		}
+	}
+	if len(advertised) > 0 && !finding.ContainsString(advertised, uri) {
+		v.add(Error, "SigningMethod", fmt.Sprintf("does not include %s (found %s)", uri, strings.Join(advertised, ", ")))
+	}
+	if e.Signature != nil && e.Signature.SignedInfo.SignatureMethod.Algorithm != "" &&
+		e.Signature.SignedInfo.SignatureMethod.Algorithm != uri {
+		v.add(Warning, "Signature", fmt.Sprintf("metadata is signed with %s, not %s",
+			e.Signature.SignedInfo.SignatureMethod.Algorithm, uri))
+	}
+
+	for _, cert := range certs {
+		var keyType string
+		switch cert.PublicKey.(type) {
+		case *rsa.PublicKey:
+			keyType = "rsa"
+		case *ecdsa.PublicKey:
+			keyType = "ecdsa"
+		default:
+			keyType = "dsa"
+		}
+		if !strings.Contains(uri, "#"+keyType+"-") {
+			v.add(Error, "SigningMethod", fmt.Sprintf("signature_algorithm %q cannot be used with the %s key of %q",
+				name, strings.ToUpper(keyType), cert.Subject.String()))
+		}
+	}
+}
+
+func containsCert(certs []*x509.Certificate, want *x509.Certificate) bool {
+	for _, c := range certs {
+		if bytes.Equal(c.Raw, want.Raw) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mockoidc"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/mocksaml"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/saml"
+)
+
+// samlServiceProvider is the service provider side of a SAML federation as
+// a module configures it.
+type samlServiceProvider struct {
+	EntityID string
+	ACSURL   string
+	// SSOURL is where AuthnRequests are sent.
+	SSOURL string
+	// Certificates are the trusted identity provider signing certificates.
+	Certificates         []*x509.Certificate
+	NameIDFormat         string
+	WantAssertionsSigned bool
+}
+
+// testSAMLSignIn signs in at a mock identity provider on behalf of sp over
+// the HTTP-Redirect binding. The posted Response must verify against the
+// certificates sp trusts and pass sp's checks; its assertion is returned.
+func testSAMLSignIn(t *testing.T, client *http.Client, sp samlServiceProvider) *saml.Assertion {
+	t.Helper()
+
+	req := saml.NewAuthnRequest(sp.EntityID, sp.ACSURL, sp.SSOURL)
+	if sp.NameIDFormat != "" {
+		req.NameIDPolicy = &saml.NameIDPolicy{Format: sp.NameIDFormat}
+	}
+	target, err := req.RedirectURL(sp.SSOURL, "")
+	require.NoError(t, err)
+
+	resp, err := client.Get(target)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+
+	posted, err := mocksaml.ReadPostedResponse(body)
+	require.NoError(t, err)
+	assert.Equal(t, sp.ACSURL, posted.ACSURL)
+
+	response, err := saml.VerifyResponse(posted.XML, sp.Certificates)
+	require.NoError(t, err)
+	findings := saml.ValidateResponse(response, saml.ResponseOptions{
+		Audience:                sp.EntityID,
+		Recipient:               sp.ACSURL,
+		InResponseTo:            req.ID,
+		NameIDFormat:            sp.NameIDFormat,
+		RequireSignedAssertions: sp.WantAssertionsSigned,
+	})
+	require.Empty(t, findings.Errors(), "SAML response for %s:\n%s", sp.EntityID, findings.Errors())
+	require.Len(t, response.Assertions, 1)
+	return &response.Assertions[0]
+}
+
+// serveSAMLMetadata serves identity provider metadata with a fresh signing
+// certificate over TLS. endpoints returns the entity ID and SSO location for
+// the server's URL. The certificate is returned the way the Okta
+// saml_certificate output encodes it.
+func serveSAMLMetadata(t *testing.T, endpoints func(baseURL string) (entityID, location string), nameIDFormats ...string) (*httptest.Server, string) {
+	t.Helper()
+
+	key, err := mockoidc.GenerateSigningKey(2048, "saml-test", 365*24*time.Hour)
+	require.NoError(t, err)
+	certificate := base64.StdEncoding.EncodeToString(key.Certificate.Raw)
+
+	var metadata []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml;charset=utf-8")
+		_, _ = w.Write(metadata)
+	}))
+	t.Cleanup(server.Close)
+
+	entityID, location := endpoints(server.URL)
+	metadata, err = xml.Marshal(saml.EntityDescriptor{
+		EntityID: entityID,
+		IDPSSODescriptors: []saml.IDPSSODescriptor{{
+			ProtocolSupportEnumeration: saml.ProtocolNS,
+			KeyDescriptors: []saml.KeyDescriptor{{
+				Use: "signing",
+				KeyInfo: saml.KeyInfo{
+					X509Data: saml.X509Data{X509Certificates: []string{certificate}},
+				},
+			}},
+			SingleLogoutServices: []saml.Endpoint{
+				{Binding: saml.HTTPPostBinding, Location: location},
+			},
+			NameIDFormats: nameIDFormats,
+			SingleSignOnServices: []saml.Endpoint{
+				{Binding: saml.HTTPPostBinding, Location: location},
+				{Binding: saml.HTTPRedirectBinding, Location: location},
+			},
+		}},
+	})
+	require.NoError(t, err)
+	return server, certificate
+}
+
+func TestUnitOktaSAMLEndpoints(t *testing.T) {
+	t.Parallel()
+
+	var ssoURL string
+	server, certificate := serveSAMLMetadata(t, func(baseURL string) (string, string) {
+		ssoURL = baseURL + "/app/test_app/exk1test/sso/saml"
+		return "http://www.okta.com/exk1test", ssoURL
+	}, saml.NameIDFormatUnspecified, saml.NameIDFormatEmailAddress)
+
+	testOktaSAMLEndpoints(t, server.Client(), server.URL+"/app/exk1test/sso/saml/metadata", saml.Options{
+		SSOURL:             ssoURL,
+		Certificate:        certificate,
+		SignatureAlgorithm: "RSA_SHA256",
+		NameIDFormat:       saml.NameIDFormatEmailAddress,
+	})
+}
+
+func TestUnitKeycloakSAMLDescriptor(t *testing.T) {
+	t.Parallel()
+
+	var issuer string
+	server, _ := serveSAMLMetadata(t, func(baseURL string) (string, string) {
+		issuer = baseURL + "/realms/test-realm"
+		return issuer, issuer + "/protocol/saml"
+	}, saml.NameIDFormatPersistent, saml.NameIDFormatTransient)
+
+	testKeycloakSAMLDescriptor(t, server.Client(), server.URL+"/realms/test-realm/protocol/saml/descriptor", issuer)
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	test_structure "github.com/gruntwork-io/terratest/modules/test-structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+)
+
+// Live tests run in these stages. Setting SKIP_<stage> to any value skips
+// the stage.
+const (
+	stageSetup    = "setup"
+	stageDeploy   = "deploy"
+	stageValidate = "validate"
+	stageTeardown = "teardown"
+)
+
+// stagesRoot holds a directory per staged test with its copy of the
+// configuration, the terraform state and the saved options.
+const stagesRoot = ".stages"
+
+// runStages runs a live test as terratest stages:
+//
+//   - setup copies the modules and examples into the test's stage
+//     directory and saves the options setup returns, unique names included;
+//   - deploy applies the saved options;
+//   - validate passes the saved options to validate;
+//   - teardown destroys the resources and removes the stage directory.
+//
+// A test can be deployed once with SKIP_teardown set and validated again
+// with SKIP_setup, SKIP_deploy and SKIP_teardown set; a run with only
+// SKIP_setup and SKIP_deploy set validates once more and then tears down.
+// validate must take every name and input from the options it is given,
+// since setup does not run when it is skipped. The saved options include
+// provider credentials, so stage directories are not committed.
+func runStages(t *testing.T, provider config.Provider, setup func() *terraform.Options, validate func(opts *terraform.Options)) {
+	t.Helper()
+	skipUnlessConfigured(t, provider)
+
+	dir := stageDir(t)
+
+	defer test_structure.RunTestStage(t, stageTeardown, func() {
+		terraform.Destroy(t, test_structure.LoadTerraformOptions(t, dir))
+		require.NoError(t, os.RemoveAll(dir))
+	})
+
+	test_structure.RunTestStage(t, stageSetup, func() {
+		if test_structure.IsTestDataPresent(t, test_structure.FormatTestDataPath(dir, "TerraformOptions.json")) {
+			t.Fatalf("%s holds a deployment kept by an earlier run; tear it down with SKIP_setup, SKIP_deploy and SKIP_validate set", dir)
+		}
+		opts := setup()
+		opts.TerraformDir = copyConfiguration(t, dir, opts.TerraformDir)
+		test_structure.SaveTerraformOptions(t, dir, opts)
+	})
+
+	test_structure.RunTestStage(t, stageDeploy, func() {
+		terraform.InitAndApply(t, test_structure.LoadTerraformOptions(t, dir))
+	})
+
+	test_structure.RunTestStage(t, stageValidate, func() {
+		validate(test_structure.LoadTerraformOptions(t, dir))
+	})
+}
+
+// stageDir returns the stage directory of the running test.
+func stageDir(t *testing.T) string {
+	return filepath.Join(stagesRoot, filepath.FromSlash(t.Name()))
+}
+
+// copyConfiguration copies the repository's modules and examples into
+// dir, so the relative module sources of the examples keep working, and
+// returns the copy of terraformDir. terraformDir is relative to the test
+// directory, like "../examples/keycloak-setup".
+func copyConfiguration(t *testing.T, dir, terraformDir string) string {
+	t.Helper()
+
+	rel, err := filepath.Rel("..", terraformDir)
+	require.NoError(t, err)
+
+	src := filepath.Join(dir, "src")
+	for _, tree := range []string{"modules", "examples"} {
+		dest := filepath.Join(src, tree)
+		require.NoError(t, os.MkdirAll(dest, 0o755))
+		require.NoError(t, files.CopyFolderContentsWithFilter(filepath.Join("..", tree), dest, terraformFiles))
+	}
+	return filepath.Join(src, rel)
+}
+
+// terraformFiles filters out local state, variable files and hidden
+// files other than the provider lock file, as terratest's own copies do.
+func terraformFiles(path string) bool {
+	if files.PathIsTerraformLockFile(path) || files.PathIsTerraformVersionFile(path) {
+		return true
+	}
+	return !files.PathContainsHiddenFileOrFolder(path) && !files.PathContainsTerraformStateOrVars(path)
+}
+
+func TestUnitCopyConfiguration(t *testing.T) {
+	dir := t.TempDir()
+
+	got := copyConfiguration(t, dir, "../examples/keycloak-setup")
+
+	assert.Equal(t, filepath.Join(dir, "src", "examples", "keycloak-setup"), got)
+	assert.FileExists(t, filepath.Join(got, "main.tf"))
+	// The example's module source, ../../modules/keycloak, resolves
+	// inside the copy.
+	assert.DirExists(t, filepath.Join(got, "..", "..", "modules", "keycloak"))
+
+	assert.True(t, terraformFiles("../examples/keycloak-setup/.terraform.lock.hcl"))
+	assert.False(t, terraformFiles("../examples/keycloak-setup/.terraform/modules/modules.json"))
+	assert.False(t, terraformFiles("../examples/keycloak-setup/terraform.tfstate"))
+	assert.False(t, terraformFiles("../examples/keycloak-setup/terraform.tfvars"))
+}
@@ -0,0 +1,125 @@
+package sweep
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+)
+
+const (
+	kindApplication = "application"
+	kindGroup       = "group"
+
+	defaultGraphURL = "https://graph.microsoft.com"
+	defaultLoginURL = "https://login.microsoftonline.com"
+)
+
+// AzureAD sweeps Azure AD applications, whose service principals go with
+// them, and groups through Microsoft Graph. Deleted objects stay in the
+// directory recycle bin for 30 days.
+type AzureAD struct {
+	// GraphURL is the Graph API root.
+	GraphURL string
+	// Client sends authenticated Graph requests.
+	Client *http.Client
+}
+
+// NewAzureAD returns an AzureAD sweeper authenticating with the client
+// credentials in creds. Empty loginURL and graphURL select the public
+// cloud endpoints.
+func NewAzureAD(ctx context.Context, creds config.AzureCredentials, loginURL, graphURL string) *AzureAD {
+	if loginURL == "" {
+		loginURL = defaultLoginURL
+	}
+	if graphURL == "" {
+		graphURL = defaultGraphURL
+	}
+	graphURL = strings.TrimRight(graphURL, "/")
+	cc := clientcredentials.Config{
+		ClientID:     creds.ClientID,
+		ClientSecret: creds.ClientSecret,
+		TokenURL:     fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimRight(loginURL, "/"), creds.TenantID),
+		Scopes:       []string{graphURL + "/.default"},
+	}
+	return &AzureAD{GraphURL: graphURL, Client: cc.Client(ctx)}
+}
+
+func (s *AzureAD) Name() string { return "azure-ad" }
+
+var graphCollections = map[string]string{
+	kindApplication: "applications",
+	kindGroup:       "groups",
+}
+
+// graphSelect are the properties listed per kind; groups have no tags.
+var graphSelect = map[string]string{
+	kindApplication: "id,displayName,createdDateTime,tags",
+	kindGroup:       "id,displayName,createdDateTime",
+}
+
+type graphObject struct {
+	ID              string    `json:"id"`
+	DisplayName     string    `json:"displayName"`
+	CreatedDateTime time.Time `json:"createdDateTime"`
+	Tags            []string  `json:"tags"`
+}
+
+func (s *AzureAD) List(ctx context.Context, _ Criteria) ([]Resource, error) {
+	var resources []Resource
+	for _, kind := range []string{kindApplication, kindGroup} {
+		objects, err := s.list(ctx, s.GraphURL+"/v1.0/"+graphCollections[kind]+"?$select="+graphSelect[kind])
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objects {
+			resources = append(resources, Resource{Kind: kind, ID: o.ID, Name: o.DisplayName, Created: o.CreatedDateTime, Tags: graphTags(o.Tags)})
+		}
+	}
+	return resources, nil
+}
+
+// list follows the @odata.nextLink of each page.
+func (s *AzureAD) list(ctx context.Context, next string) ([]graphObject, error) {
+	var objects []graphObject
+	for next != "" {
+		var page struct {
+			Value    []graphObject `json:"value"`
+			NextLink string        `json:"@odata.nextLink"`
+		}
+		if _, err := getJSON(ctx, s.Client, next, nil, &page); err != nil {
+			return nil, err
+		}
+		objects = append(objects, page.Value...)
+		next = page.NextLink
+	}
+	return objects, nil
+}
+
+func (s *AzureAD) Delete(ctx context.Context, r Resource) error {
+	collection, ok := graphCollections[r.Kind]
+	if !ok {
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	return deleteURL(ctx, s.Client, s.GraphURL+"/v1.0/"+collection+"/"+url.PathEscape(r.ID), nil)
+}
+
+// graphTags reads application tags written as key=value or key:value;
+// other tags become keys with an empty value.
+func graphTags(tags []string) map[string]string {
+	m := map[string]string{}
+	for _, tag := range tags {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok {
+			k, v, _ = strings.Cut(tag, ":")
+		}
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,131 @@
+package sweep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/cognitoidentity"
+	"github.com/aws/aws-sdk-go/service/cognitoidentityprovider"
+)
+
+const (
+	kindUserPool     = "user pool"
+	kindIdentityPool = "identity pool"
+)
+
+// Cognito sweeps Cognito user pools, with their domains, and identity
+// pools. The IAM roles of an identity pool are not deleted.
+//
+// Identity pools report no creation time, so they are only swept with
+// Criteria.IncludeUnknownAge.
+type Cognito struct {
+	UserPools     *cognitoidentityprovider.CognitoIdentityProvider
+	IdentityPools *cognitoidentity.CognitoIdentity
+}
+
+// NewCognito returns a Cognito sweeper using the session p, typically a
+// *session.Session. Set cfgs[i].Endpoint to sweep a local stand-in.
+func NewCognito(p client.ConfigProvider, cfgs ...*aws.Config) *Cognito {
+	return &Cognito{
+		UserPools:     cognitoidentityprovider.New(p, cfgs...),
+		IdentityPools: cognitoidentity.New(p, cfgs...),
+	}
+}
+
+func (s *Cognito) Name() string { return "aws-cognito" }
+
+func (s *Cognito) List(ctx context.Context, c Criteria) ([]Resource, error) {
+	var pools []*cognitoidentityprovider.UserPoolDescriptionType
+	err := s.UserPools.ListUserPoolsPagesWithContext(ctx,
+		&cognitoidentityprovider.ListUserPoolsInput{MaxResults: aws.Int64(60)},
+		func(page *cognitoidentityprovider.ListUserPoolsOutput, _ bool) bool {
+			pools = append(pools, page.UserPools...)
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("listing user pools: %w", err)
+	}
+
+	var resources []Resource
+	for _, p := range pools {
+		r := Resource{Kind: kindUserPool, ID: aws.StringValue(p.Id), Name: aws.StringValue(p.Name), Created: aws.TimeValue(p.CreationDate)}
+		// Tags are only in the full description; skip the call when the
+		// name decides.
+		if !c.named(r.Name) {
+			out, err := s.UserPools.DescribeUserPoolWithContext(ctx, &cognitoidentityprovider.DescribeUserPoolInput{UserPoolId: p.Id})
+			if err != nil {
+				return nil, fmt.Errorf("describing user pool %s: %w", r.ID, err)
+			}
+			r.Tags = aws.StringValueMap(out.UserPool.UserPoolTags)
+		}
+		resources = append(resources, r)
+	}
+
+	err = s.IdentityPools.ListIdentityPoolsPagesWithContext(ctx,
+		&cognitoidentity.ListIdentityPoolsInput{MaxResults: aws.Int64(60)},
+		func(page *cognitoidentity.ListIdentityPoolsOutput, _ bool) bool {
+			for _, p := range page.IdentityPools {
+				resources = append(resources, Resource{Kind: kindIdentityPool, ID: aws.StringValue(p.IdentityPoolId), Name: aws.StringValue(p.IdentityPoolName)})
+			}
+			return true
+		})
+	if err != nil {
+		return nil, fmt.Errorf("listing identity pools: %w", err)
+	}
+	for i, r := range resources {
+		if r.Kind != kindIdentityPool || c.named(r.Name) {
+			continue
+		}
+		out, err := s.IdentityPools.DescribeIdentityPoolWithContext(ctx, &cognitoidentity.DescribeIdentityPoolInput{IdentityPoolId: aws.String(r.ID)})
+		if err != nil {
+			return nil, fmt.Errorf("describing identity pool %s: %w", r.ID, err)
+		}
+		resources[i].Tags = aws.StringValueMap(out.IdentityPoolTags)
+	}
+	return resources, nil
+}
+
+func (s *Cognito) Delete(ctx context.Context, r Resource) error {
+	switch r.Kind {
+	case kindUserPool:
+		return s.deleteUserPool(ctx, r.ID)
+	case kindIdentityPool:
+		_, err := s.IdentityPools.DeleteIdentityPoolWithContext(ctx, &cognitoidentity.DeleteIdentityPoolInput{IdentityPoolId: aws.String(r.ID)})
+		return ignoreNotFound(err)
+	}
+	return fmt.Errorf("unknown kind %q", r.Kind)
+}
+
+// deleteUserPool deletes the pool's domains first, since a pool with a
+// domain cannot be deleted.
+func (s *Cognito) deleteUserPool(ctx context.Context, id string) error {
+	out, err := s.UserPools.DescribeUserPoolWithContext(ctx, &cognitoidentityprovider.DescribeUserPoolInput{UserPoolId: aws.String(id)})
+	if err != nil {
+		return ignoreNotFound(err)
+	}
+	for _, domain := range []*string{out.UserPool.Domain, out.UserPool.CustomDomain} {
+		if aws.StringValue(domain) == "" {
+			continue
+		}
+		_, err := s.UserPools.DeleteUserPoolDomainWithContext(ctx, &cognitoidentityprovider.DeleteUserPoolDomainInput{Domain: domain, UserPoolId: aws.String(id)})
+		if err != nil {
+			return fmt.Errorf("deleting domain %s: %w", aws.StringValue(domain), err)
+		}
+	}
+	_, err = s.UserPools.DeleteUserPoolWithContext(ctx, &cognitoidentityprovider.DeleteUserPoolInput{UserPoolId: aws.String(id)})
+	return ignoreNotFound(err)
+}
+
+// ignoreNotFound treats an object deleted concurrently, for instance by
+// the test's own deferred destroy, as deleted.
+func ignoreNotFound(err error) error {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == cognitoidentityprovider.ErrCodeResourceNotFoundException {
+		return nil
+	}
+	return err
+}
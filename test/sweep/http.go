@@ -0,0 +1,78 @@
+package sweep
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// getJSON decodes the JSON body of a GET request into out and returns the
+// response headers.
+func getJSON(ctx context.Context, client *http.Client, url string, header http.Header, out interface{}) (http.Header, error) {
+	resp, err := do(ctx, client, http.MethodGet, url, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", url, err)
+	}
+	return resp.Header, nil
+}
+
+// deleteURL sends a DELETE request. An object that is already gone counts
+// as deleted.
+func deleteURL(ctx context.Context, client *http.Client, url string, header http.Header) error {
+	return send(ctx, client, http.MethodDelete, url, header, http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+}
+
+// send sends a request without a body and checks the response status.
+func send(ctx context.Context, client *http.Client, method, url string, header http.Header, ok ...int) error {
+	resp, err := do(ctx, client, method, url, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkStatus(resp, ok...)
+}
+
+func do(ctx context.Context, client *http.Client, method, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	return client.Do(req)
+}
+
+// statusError is an unexpected HTTP response from a provider API.
+type statusError struct {
+	Method, URL string
+	StatusCode  int
+	Body        string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, strings.TrimSpace(e.Body))
+}
+
+// checkStatus returns a statusError unless resp has one of the ok codes.
+func checkStatus(resp *http.Response, ok ...int) error {
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &statusError{resp.Request.Method, resp.Request.URL.String(), resp.StatusCode, string(body)}
+}
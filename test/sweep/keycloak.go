@@ -0,0 +1,73 @@
+package sweep
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+)
+
+const kindRealm = "realm"
+
+// Keycloak sweeps Keycloak realms, and everything in them, through the
+// admin REST API. Keycloak does not record when a realm was created, so
+// realms are only swept with Criteria.IncludeUnknownAge.
+type Keycloak struct {
+	URL string
+	// Client sends requests authenticated as a master realm administrator.
+	Client *http.Client
+}
+
+// NewKeycloak returns a Keycloak sweeper that logs in to the master realm
+// with the admin credentials in creds on first use.
+func NewKeycloak(ctx context.Context, creds config.KeycloakCredentials) *Keycloak {
+	cfg := &oauth2.Config{
+		ClientID: creds.ClientID,
+		Endpoint: oauth2.Endpoint{
+			TokenURL:  creds.URL + "/realms/master/protocol/openid-connect/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+	src := &passwordTokenSource{ctx: ctx, cfg: cfg, username: creds.Username, password: creds.Password}
+	return &Keycloak{URL: strings.TrimRight(creds.URL, "/"), Client: oauth2.NewClient(ctx, oauth2.ReuseTokenSource(nil, src))}
+}
+
+// passwordTokenSource logs in with the resource owner password grant each
+// time a token is needed; admin tokens live for a minute by default.
+type passwordTokenSource struct {
+	ctx                context.Context
+	cfg                *oauth2.Config
+	username, password string
+}
+
+func (s *passwordTokenSource) Token() (*oauth2.Token, error) {
+	return s.cfg.PasswordCredentialsToken(s.ctx, s.username, s.password)
+}
+
+func (s *Keycloak) Name() string { return "keycloak" }
+
+func (s *Keycloak) List(ctx context.Context, _ Criteria) ([]Resource, error) {
+	var realms []struct {
+		ID    string `json:"id"`
+		Realm string `json:"realm"`
+	}
+	if _, err := getJSON(ctx, s.Client, s.URL+"/admin/realms?briefRepresentation=true", nil, &realms); err != nil {
+		return nil, err
+	}
+	var resources []Resource
+	for _, r := range realms {
+		if r.Realm == "master" {
+			continue
+		}
+		resources = append(resources, Resource{Kind: kindRealm, ID: r.ID, Name: r.Realm})
+	}
+	return resources, nil
+}
+
+func (s *Keycloak) Delete(ctx context.Context, r Resource) error {
+	return deleteURL(ctx, s.Client, s.URL+"/admin/realms/"+url.PathEscape(r.Name), nil)
+}
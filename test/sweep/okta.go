@@ -0,0 +1,84 @@
+package sweep
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+	"github.com/sourabh-virdi/terraform-idp-automation/test/okta"
+)
+
+// Okta sweeps Okta applications and groups through the Management API.
+// Okta objects carry no tags, so only names are matched.
+type Okta struct {
+	// Client lists the objects, waiting out rate limits.
+	Client *okta.Client
+}
+
+// NewOkta returns an Okta sweeper for the organization in creds, or for
+// orgURL when it is not empty.
+func NewOkta(creds config.OktaCredentials, orgURL string) *Okta {
+	return &Okta{Client: okta.New(creds, orgURL)}
+}
+
+func (s *Okta) Name() string { return "okta" }
+
+func (s *Okta) header() http.Header {
+	return http.Header{"Authorization": {"SSWS " + s.Client.Token}}
+}
+
+type oktaApp struct {
+	ID      string    `json:"id"`
+	Label   string    `json:"label"`
+	Created time.Time `json:"created"`
+}
+
+type oktaGroup struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Created time.Time `json:"created"`
+	Profile struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+}
+
+func (s *Okta) List(ctx context.Context, _ Criteria) ([]Resource, error) {
+	apps, err := okta.List[oktaApp](ctx, s.Client, "/api/v1/apps")
+	if err != nil {
+		return nil, err
+	}
+	groups, err := okta.List[oktaGroup](ctx, s.Client, "/api/v1/groups")
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []Resource
+	for _, a := range apps {
+		resources = append(resources, Resource{Kind: kindApplication, ID: a.ID, Name: a.Label, Created: a.Created})
+	}
+	for _, g := range groups {
+		// Built-in groups and groups imported from apps cannot be deleted.
+		if g.Type == "OKTA_GROUP" {
+			resources = append(resources, Resource{Kind: kindGroup, ID: g.ID, Name: g.Profile.Name, Created: g.Created})
+		}
+	}
+	return resources, nil
+}
+
+func (s *Okta) Delete(ctx context.Context, r Resource) error {
+	switch r.Kind {
+	case kindApplication:
+		// Active applications must be deactivated before deletion.
+		app := s.Client.OrgURL + "/api/v1/apps/" + url.PathEscape(r.ID)
+		if err := send(ctx, s.Client.HTTP, http.MethodPost, app+"/lifecycle/deactivate", s.header(), http.StatusOK, http.StatusNotFound); err != nil {
+			return err
+		}
+		return deleteURL(ctx, s.Client.HTTP, app, s.header())
+	case kindGroup:
+		return deleteURL(ctx, s.Client.HTTP, s.Client.OrgURL+"/api/v1/groups/"+url.PathEscape(r.ID), s.header())
+	}
+	return fmt.Errorf("unknown kind %q", r.Kind)
+}
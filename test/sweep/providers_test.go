@@ -0,0 +1,280 @@
+package sweep
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/config"
+)
+
+// standIn is a local API server recording the mutating calls it receives.
+type standIn struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls []string
+}
+
+func newStandIn(t *testing.T, handler func(s *standIn, w http.ResponseWriter, r *http.Request)) *standIn {
+	s := &standIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(s, w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *standIn) record(call string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, call)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// sweepAll runs s, selecting objects of unknown age too.
+func sweepAll(t *testing.T, s Sweeper) {
+	t.Helper()
+	c := criteria()
+	c.IncludeUnknownAge = true
+	var log bytes.Buffer
+	_, err := Run(context.Background(), []Sweeper{s}, c, false, &log)
+	require.NoError(t, err, log.String())
+}
+
+// epoch formats t the way AWS JSON protocols encode timestamps.
+func epoch(t time.Time) float64 {
+	return float64(t.Unix())
+}
+
+func TestCognito(t *testing.T) {
+	old := epoch(now.Add(-2 * time.Hour))
+	pools := map[string]map[string]interface{}{
+		"us-east-1_old":  {"Id": "us-east-1_old", "Name": "terratest-pool-abc123", "CreationDate": old, "Domain": "terratest-pool-abc123"},
+		"us-east-1_tag":  {"Id": "us-east-1_tag", "Name": "orders", "CreationDate": old, "UserPoolTags": map[string]string{"Purpose": "terratest-saml"}},
+		"us-east-1_prod": {"Id": "us-east-1_prod", "Name": "production", "CreationDate": old},
+		"us-east-1_new":  {"Id": "us-east-1_new", "Name": "terratest-mfa-pool-xyz789", "CreationDate": epoch(now)},
+	}
+
+	api := newStandIn(t, func(s *standIn, w http.ResponseWriter, r *http.Request) {
+		var in map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		target := r.Header.Get("X-Amz-Target")
+		_, op, _ := strings.Cut(target, ".")
+
+		switch op {
+		case "ListUserPools":
+			// Two pages, to check pagination is followed.
+			if in["NextToken"] == nil {
+				writeJSON(w, 200, map[string]interface{}{"UserPools": []interface{}{pools["us-east-1_old"], pools["us-east-1_tag"]}, "NextToken": "page2"})
+				return
+			}
+			writeJSON(w, 200, map[string]interface{}{"UserPools": []interface{}{pools["us-east-1_prod"], pools["us-east-1_new"]}})
+		case "DescribeUserPool":
+			pool, ok := pools[in["UserPoolId"].(string)]
+			if !ok {
+				writeJSON(w, 400, map[string]string{"__type": "ResourceNotFoundException", "message": "not found"})
+				return
+			}
+			writeJSON(w, 200, map[string]interface{}{"UserPool": pool})
+		case "ListIdentityPools":
+			writeJSON(w, 200, map[string]interface{}{"IdentityPools": []interface{}{
+				map[string]string{"IdentityPoolId": "us-east-1:1", "IdentityPoolName": "terratest-identity-abc123"},
+				map[string]string{"IdentityPoolId": "us-east-1:2", "IdentityPoolName": "shared"},
+			}})
+		case "DescribeIdentityPool":
+			writeJSON(w, 200, map[string]interface{}{"IdentityPoolId": in["IdentityPoolId"], "IdentityPoolName": "shared", "AllowUnauthenticatedIdentities": false})
+		case "DeleteUserPoolDomain":
+			s.record(fmt.Sprintf("%s %s %s", op, in["UserPoolId"], in["Domain"]))
+			writeJSON(w, 200, map[string]interface{}{})
+		case "DeleteUserPool":
+			s.record(fmt.Sprintf("%s %s", op, in["UserPoolId"]))
+			delete(pools, in["UserPoolId"].(string))
+			writeJSON(w, 200, map[string]interface{}{})
+		case "DeleteIdentityPool":
+			s.record(fmt.Sprintf("%s %s", op, in["IdentityPoolId"]))
+			writeJSON(w, 200, map[string]interface{}{})
+		default:
+			writeJSON(w, 400, map[string]string{"__type": "UnknownOperationException", "message": target})
+		}
+	})
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(api.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	sweepAll(t, NewCognito(sess))
+
+	assert.Equal(t, []string{
+		"DeleteUserPoolDomain us-east-1_old terratest-pool-abc123",
+		"DeleteUserPool us-east-1_old",
+		"DeleteUserPool us-east-1_tag",
+		"DeleteIdentityPool us-east-1:1",
+	}, api.calls)
+}
+
+func TestAzureAD(t *testing.T) {
+	created := now.Add(-2 * time.Hour).Format(time.RFC3339)
+	api := newStandIn(t, func(s *standIn, w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tenant-id/oauth2/v2.0/token" {
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+			writeJSON(w, 200, map[string]interface{}{"access_token": "graph-token", "token_type": "Bearer", "expires_in": 3600})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer graph-token" {
+			writeJSON(w, 401, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodDelete:
+			s.record(r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/v1.0/applications" && r.URL.Query().Get("page") == "":
+			assert.Contains(t, r.URL.Query().Get("$select"), "tags")
+			writeJSON(w, 200, map[string]interface{}{
+				"value": []interface{}{
+					map[string]interface{}{"id": "app-1", "displayName": "terratest-app-abc123", "createdDateTime": created},
+					map[string]interface{}{"id": "app-2", "displayName": "billing", "createdDateTime": created, "tags": []string{"Purpose=terratest"}},
+				},
+				"@odata.nextLink": s.URL + "/v1.0/applications?page=2",
+			})
+		case r.URL.Path == "/v1.0/applications":
+			writeJSON(w, 200, map[string]interface{}{"value": []interface{}{
+				map[string]interface{}{"id": "app-3", "displayName": "billing-prod", "createdDateTime": created, "tags": []string{"WindowsAzureActiveDirectoryIntegratedApp"}},
+			}})
+		case r.URL.Path == "/v1.0/groups":
+			assert.NotContains(t, r.URL.Query().Get("$select"), "tags")
+			writeJSON(w, 200, map[string]interface{}{"value": []interface{}{
+				map[string]interface{}{"id": "group-1", "displayName": "terratest-roles-abc123", "createdDateTime": created},
+				map[string]interface{}{"id": "group-2", "displayName": "Finance", "createdDateTime": created},
+				map[string]interface{}{"id": "group-3", "displayName": "test-client-admins", "createdDateTime": created},
+			}})
+		default:
+			writeJSON(w, 404, map[string]string{"error": r.URL.String()})
+		}
+	})
+
+	creds := config.AzureCredentials{TenantID: "tenant-id", ClientID: "client", ClientSecret: "secret"}
+	sweepAll(t, NewAzureAD(context.Background(), creds, api.URL, api.URL))
+
+	assert.Equal(t, []string{"/v1.0/applications/app-1", "/v1.0/applications/app-2", "/v1.0/groups/group-1"}, api.calls)
+}
+
+func TestOkta(t *testing.T) {
+	created := now.Add(-2 * time.Hour).Format(time.RFC3339)
+	api := newStandIn(t, func(s *standIn, w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "SSWS okta-token" {
+			writeJSON(w, 401, map[string]string{"errorCode": "E0000011"})
+			return
+		}
+
+		switch {
+		case r.Method != http.MethodGet:
+			s.record(r.Method + " " + r.URL.Path)
+			if strings.HasSuffix(r.URL.Path, "/lifecycle/deactivate") {
+				writeJSON(w, 200, map[string]interface{}{})
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/api/v1/apps" && r.URL.Query().Get("after") == "":
+			w.Header().Add("Link", fmt.Sprintf(`<%s/api/v1/apps?limit=200>; rel="self"`, s.URL))
+			w.Header().Add("Link", fmt.Sprintf(`<%s/api/v1/apps?after=0oa2&limit=200>; rel="next"`, s.URL))
+			writeJSON(w, 200, []interface{}{
+				map[string]interface{}{"id": "0oa1", "label": "terratest-saml-abc123", "created": created},
+				map[string]interface{}{"id": "0oa2", "label": "Salesforce", "created": created},
+			})
+		case r.URL.Path == "/api/v1/apps":
+			writeJSON(w, 200, []interface{}{
+				map[string]interface{}{"id": "0oa3", "label": "terratest-oauth-xyz789", "created": created},
+			})
+		case r.URL.Path == "/api/v1/groups":
+			writeJSON(w, 200, []interface{}{
+				map[string]interface{}{"id": "00g0", "type": "BUILT_IN", "created": created, "profile": map[string]string{"name": "Everyone"}},
+				map[string]interface{}{"id": "00g1", "type": "OKTA_GROUP", "created": created, "profile": map[string]string{"name": "terratest-groups-abc123"}},
+				map[string]interface{}{"id": "00g2", "type": "OKTA_GROUP", "created": created, "profile": map[string]string{"name": "Engineering"}},
+			})
+		default:
+			writeJSON(w, 404, map[string]string{"errorCode": "E0000007"})
+		}
+	})
+
+	sweepAll(t, NewOkta(config.OktaCredentials{APIToken: "okta-token"}, api.URL))
+
+	assert.Equal(t, []string{
+		"POST /api/v1/apps/0oa1/lifecycle/deactivate",
+		"DELETE /api/v1/apps/0oa1",
+		"POST /api/v1/apps/0oa3/lifecycle/deactivate",
+		"DELETE /api/v1/apps/0oa3",
+		"DELETE /api/v1/groups/00g1",
+	}, api.calls)
+}
+
+func TestKeycloak(t *testing.T) {
+	api := newStandIn(t, func(s *standIn, w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/realms/master/protocol/openid-connect/token" {
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "password", r.Form.Get("grant_type"))
+			assert.Equal(t, "admin-cli", r.Form.Get("client_id"))
+			if r.Form.Get("username") != "admin" || r.Form.Get("password") != "secret" {
+				writeJSON(w, 401, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			writeJSON(w, 200, map[string]interface{}{"access_token": "admin-token", "token_type": "Bearer", "expires_in": 60})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer admin-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodDelete:
+			s.record(r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/admin/realms":
+			writeJSON(w, 200, []interface{}{
+				map[string]string{"id": "master", "realm": "master"},
+				map[string]string{"id": "r1", "realm": "terratest-realm-abc123"},
+				map[string]string{"id": "r2", "realm": "customers"},
+				map[string]string{"id": "r3", "realm": "terratest-saml-idp-xyz789"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	creds := config.KeycloakCredentials{URL: api.URL, ClientID: "admin-cli", Username: "admin", Password: "secret"}
+	sweepAll(t, NewKeycloak(context.Background(), creds))
+	assert.Equal(t, []string{"/admin/realms/terratest-realm-abc123", "/admin/realms/terratest-saml-idp-xyz789"}, api.calls)
+
+	// Without IncludeUnknownAge realms are never selected.
+	var log bytes.Buffer
+	results, err := Run(context.Background(), []Sweeper{NewKeycloak(context.Background(), creds)}, criteria(), true, &log)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	creds.Password = "wrong"
+	_, err = NewKeycloak(context.Background(), creds).List(context.Background(), criteria())
+	assert.ErrorContains(t, err, "invalid_grant")
+}
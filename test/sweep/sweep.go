@@ -0,0 +1,170 @@
+// Package sweep finds and deletes identity provider objects leaked by the
+// integration suites: resources left behind when a test crashed or was
+// interrupted before terraform destroy ran.
+//
+// A resource is leaked when its name starts with one of the prefixes the
+// suites use or it carries a Purpose=terratest tag, and it is older than a
+// threshold so that tests still running are left alone.
+package sweep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultPrefixes are the name prefixes of everything the suites create
+// with a random suffix. The prefix is specific to the suites: names such as
+// test-app- are common enough that people create them by hand.
+var DefaultPrefixes = []string{"terratest-"}
+
+// DefaultTags are the tags marking a resource as created by the suites.
+// A tag matches when its value equals the one here or extends it with a
+// dash, as in Purpose=terratest-saml.
+var DefaultTags = map[string]string{"Purpose": "terratest"}
+
+// Resource is an object found at a provider.
+type Resource struct {
+	// Kind is the type of object, such as "user pool" or "realm".
+	Kind string
+	ID   string
+	Name string
+	// Created is when the object was created, zero when the provider does
+	// not report it.
+	Created time.Time
+	Tags    map[string]string
+}
+
+func (r Resource) String() string {
+	return fmt.Sprintf("%s %s (%s)", r.Kind, r.Name, r.ID)
+}
+
+// Sweeper lists and deletes the objects of one provider.
+type Sweeper interface {
+	// Name identifies the provider in reports.
+	Name() string
+	// List returns every candidate object. Sweepers may narrow the list
+	// by name server-side, so objects outside the criteria can be missing.
+	List(ctx context.Context, c Criteria) ([]Resource, error)
+	Delete(ctx context.Context, r Resource) error
+}
+
+// Criteria select the objects to delete.
+type Criteria struct {
+	Prefixes []string
+	Tags     map[string]string
+	// OlderThan is the minimum age of an object.
+	OlderThan time.Duration
+	// IncludeUnknownAge also selects matching objects whose creation time
+	// the provider does not report, such as Keycloak realms.
+	IncludeUnknownAge bool
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+// ParsePrefixes splits a comma-separated list of name prefixes, dropping
+// blanks. An empty prefix would match every name, so a list without any
+// other prefix is an error.
+func ParsePrefixes(s string) ([]string, error) {
+	var prefixes []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("no name prefixes in %q", s)
+	}
+	return prefixes, nil
+}
+
+// DefaultCriteria selects objects named or tagged by the suites that are
+// older than olderThan.
+func DefaultCriteria(olderThan time.Duration) Criteria {
+	return Criteria{Prefixes: DefaultPrefixes, Tags: DefaultTags, OlderThan: olderThan}
+}
+
+// Match reports whether r is selected, and if not, why.
+func (c Criteria) Match(r Resource) (bool, string) {
+	if !c.named(r.Name) && !c.tagged(r.Tags) {
+		return false, "name and tags do not match"
+	}
+	if r.Created.IsZero() {
+		if c.IncludeUnknownAge {
+			return true, ""
+		}
+		return false, "creation time unknown"
+	}
+	now := time.Now
+	if c.Now != nil {
+		now = c.Now
+	}
+	if age := now().Sub(r.Created); age < c.OlderThan {
+		return false, fmt.Sprintf("only %s old", age.Round(time.Second))
+	}
+	return true, ""
+}
+
+func (c Criteria) named(name string) bool {
+	for _, p := range c.Prefixes {
+		if p != "" && strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Criteria) tagged(tags map[string]string) bool {
+	for k, want := range c.Tags {
+		if v, ok := tags[k]; ok && (v == want || strings.HasPrefix(v, want+"-")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Result is what Run did with one selected object.
+type Result struct {
+	Provider string
+	Resource Resource
+	// Deleted is false in a dry run and when Err is set.
+	Deleted bool
+	Err     error
+}
+
+// Run lists the objects of each sweeper and deletes those selected by c,
+// writing one line per selected object to log. With dryRun set nothing is
+// deleted. Providers that cannot be listed are reported and skipped; the
+// returned error joins every listing and deletion failure.
+func Run(ctx context.Context, sweepers []Sweeper, c Criteria, dryRun bool, log io.Writer) ([]Result, error) {
+	var results []Result
+	var errs []error
+	for _, s := range sweepers {
+		resources, err := s.List(ctx, c)
+		if err != nil {
+			fmt.Fprintf(log, "%s: listing failed: %v\n", s.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+			continue
+		}
+		for _, r := range resources {
+			if ok, _ := c.Match(r); !ok {
+				continue
+			}
+			result := Result{Provider: s.Name(), Resource: r}
+			if dryRun {
+				fmt.Fprintf(log, "%s: would delete %s\n", s.Name(), r)
+			} else if result.Err = s.Delete(ctx, r); result.Err != nil {
+				fmt.Fprintf(log, "%s: deleting %s failed: %v\n", s.Name(), r, result.Err)
+				errs = append(errs, fmt.Errorf("%s: deleting %s: %w", s.Name(), r, result.Err))
+			} else {
+				result.Deleted = true
+				fmt.Fprintf(log, "%s: deleted %s\n", s.Name(), r)
+			}
+			results = append(results, result)
+		}
+	}
+	return results, errors.Join(errs...)
+}
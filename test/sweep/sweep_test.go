@@ -0,0 +1,138 @@
+package sweep
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func criteria() Criteria {
+	c := DefaultCriteria(time.Hour)
+	c.Now = func() time.Time { return now }
+	return c
+}
+
+func TestMatch(t *testing.T) {
+	old, recent := now.Add(-2*time.Hour), now.Add(-10*time.Minute)
+
+	for _, tc := range []struct {
+		name     string
+		resource Resource
+		want     bool
+		reason   string
+	}{
+		{"prefix", Resource{Name: "terratest-pool-abc123", Created: old}, true, ""},
+		{"tag", Resource{Name: "payments", Created: old, Tags: map[string]string{"Purpose": "terratest"}}, true, ""},
+		{"tag with suffix", Resource{Name: "payments", Created: old, Tags: map[string]string{"Purpose": "terratest-saml"}}, true, ""},
+		{"other tag value", Resource{Name: "payments", Created: old, Tags: map[string]string{"Purpose": "terratestx"}}, false, "name and tags do not match"},
+		{"no match", Resource{Name: "production-pool", Created: old}, false, "name and tags do not match"},
+		{"prefix is not a substring", Resource{Name: "my-terratest-pool-1", Created: old}, false, "name and tags do not match"},
+		{"generic test name", Resource{Name: "test-app-abc123", Created: old}, false, "name and tags do not match"},
+		{"too recent", Resource{Name: "terratest-realm-abc123", Created: recent}, false, "only 10m0s old"},
+		{"unknown age", Resource{Name: "terratest-realm-abc123"}, false, "creation time unknown"},
+	} {
+		ok, reason := criteria().Match(tc.resource)
+		assert.Equal(t, tc.want, ok, tc.name)
+		assert.Equal(t, tc.reason, reason, tc.name)
+	}
+
+	c := criteria()
+	c.IncludeUnknownAge = true
+	ok, _ := c.Match(Resource{Name: "terratest-realm-abc123"})
+	assert.True(t, ok)
+}
+
+func TestParsePrefixes(t *testing.T) {
+	prefixes, err := ParsePrefixes(" terratest-, legacy- ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"terratest-", "legacy-"}, prefixes)
+
+	prefixes, err = ParsePrefixes("terratest-,")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"terratest-"}, prefixes)
+
+	for _, s := range []string{"", ",", " , "} {
+		_, err := ParsePrefixes(s)
+		assert.Error(t, err, "%q", s)
+	}
+}
+
+func TestEmptyPrefixMatchesNothing(t *testing.T) {
+	c := criteria()
+	c.Prefixes = []string{""}
+	ok, _ := c.Match(Resource{Name: "production-pool", Created: now.Add(-2 * time.Hour)})
+	assert.False(t, ok)
+}
+
+// fakeSweeper is a Sweeper over a fixed list of resources.
+type fakeSweeper struct {
+	resources []Resource
+	listErr   error
+	deleteErr map[string]error
+	deleted   []string
+}
+
+func (s *fakeSweeper) Name() string { return "fake" }
+
+func (s *fakeSweeper) List(context.Context, Criteria) ([]Resource, error) {
+	return s.resources, s.listErr
+}
+
+func (s *fakeSweeper) Delete(_ context.Context, r Resource) error {
+	if err := s.deleteErr[r.ID]; err != nil {
+		return err
+	}
+	s.deleted = append(s.deleted, r.ID)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	old := now.Add(-2 * time.Hour)
+	newSweeper := func() *fakeSweeper {
+		return &fakeSweeper{resources: []Resource{
+			{Kind: "realm", ID: "1", Name: "terratest-realm-a", Created: old},
+			{Kind: "realm", ID: "2", Name: "keep-me", Created: old},
+			{Kind: "realm", ID: "3", Name: "terratest-saml-b", Created: old},
+			{Kind: "realm", ID: "4", Name: "terratest-saml-c", Created: now},
+		}}
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		s := newSweeper()
+		var log bytes.Buffer
+		results, err := Run(context.Background(), []Sweeper{s}, criteria(), true, &log)
+		require.NoError(t, err)
+		assert.Empty(t, s.deleted)
+		assert.Len(t, results, 2)
+		assert.Equal(t, "fake: would delete realm terratest-realm-a (1)\nfake: would delete realm terratest-saml-b (3)\n", log.String())
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		s := newSweeper()
+		s.deleteErr = map[string]error{"3": errors.New("conflict")}
+		var log bytes.Buffer
+		results, err := Run(context.Background(), []Sweeper{s}, criteria(), false, &log)
+		assert.ErrorContains(t, err, "fake: deleting realm terratest-saml-b (3): conflict")
+		assert.Equal(t, []string{"1"}, s.deleted)
+		require.Len(t, results, 2)
+		assert.True(t, results[0].Deleted)
+		assert.False(t, results[1].Deleted)
+		assert.Error(t, results[1].Err)
+	})
+
+	t.Run("listing fails", func(t *testing.T) {
+		failing := &fakeSweeper{listErr: errors.New("unauthorized")}
+		s := newSweeper()
+		var log bytes.Buffer
+		results, err := Run(context.Background(), []Sweeper{failing, s}, criteria(), false, &log)
+		assert.ErrorContains(t, err, "fake: unauthorized")
+		assert.Len(t, results, 2, "later providers are still swept")
+	})
+}
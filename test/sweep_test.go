@@ -0,0 +1,48 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/sweep"
+)
+
+// uniqueNamePattern matches the names the suites build from a prefix and
+// random.UniqueId, as in fmt.Sprintf("terratest-pool-%s", uniqueID) or
+// "terratest-pool-" + uniqueID, and the OptionsBuilder names, as in
+// b.Name("pool").
+var uniqueNamePattern = regexp.MustCompile(`"((?:terra)?test-[a-z-]*-)(?:%s"|"\s*\+\s*uniqueID)|\.Name\("([a-z-]+)"\)`)
+
+// TestUnitSweepPrefixesCoverSuites fails when a suite names resources
+// with a prefix the sweeper would not recognise if they leaked.
+func TestUnitSweepPrefixesCoverSuites(t *testing.T) {
+	t.Parallel()
+
+	files, err := filepath.Glob("*_test.go")
+	require.NoError(t, err)
+
+	found := 0
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		require.NoError(t, err)
+		for _, m := range uniqueNamePattern.FindAllStringSubmatch(string(src), -1) {
+			found++
+			prefix := m[1]
+			if m[2] != "" {
+				prefix = "terratest-" + m[2] + "-"
+			}
+			covered := false
+			for _, p := range sweep.DefaultPrefixes {
+				covered = covered || strings.HasPrefix(prefix, p)
+			}
+			assert.True(t, covered, "%s: names starting with %q are not in sweep.DefaultPrefixes", file, prefix)
+		}
+	}
+	assert.NotZero(t, found, "no generated names found; has the naming pattern changed?")
+}
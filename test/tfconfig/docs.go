@@ -0,0 +1,160 @@
+package tfconfig
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// The generated tables of a README sit between these markers.
+const (
+	DocsBegin = "<!-- BEGIN_TF_DOCS -->"
+	DocsEnd   = "<!-- END_TF_DOCS -->"
+)
+
+// Markdown renders the module's input and output tables.
+func (m *Module) Markdown() string {
+	var b strings.Builder
+	b.WriteString("## Inputs\n\n")
+	if len(m.Variables) == 0 {
+		b.WriteString("No inputs.\n")
+	} else {
+		b.WriteString("| Name | Description | Type | Default | Required | Sensitive |\n")
+		b.WriteString("|------|-------------|------|---------|:--------:|:---------:|\n")
+		for _, v := range m.Variables {
+			def := "n/a"
+			if !v.Required() {
+				def = "`" + escapeCell(FormatValue(v.Default)) + "`"
+			}
+			fmt.Fprintf(&b, "| %s | %s | `%s` | %s | %s | %s |\n",
+				v.Name, escapeCell(v.Description), TypeName(v.Type), def, yesNo(v.Required()), yesNo(v.Sensitive))
+		}
+	}
+
+	b.WriteString("\n## Outputs\n\n")
+	if len(m.Outputs) == 0 {
+		b.WriteString("No outputs.\n")
+	} else {
+		b.WriteString("| Name | Description | Sensitive |\n")
+		b.WriteString("|------|-------------|:---------:|\n")
+		for _, o := range m.Outputs {
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", o.Name, escapeCell(o.Description), yesNo(o.Sensitive))
+		}
+	}
+	return b.String()
+}
+
+// UpdateReadme replaces the text between DocsBegin and DocsEnd in readme
+// with the module's tables.
+func (m *Module) UpdateReadme(readme []byte) ([]byte, error) {
+	begin := bytes.Index(readme, []byte(DocsBegin))
+	end := bytes.Index(readme, []byte(DocsEnd))
+	if begin < 0 || end < begin {
+		return nil, fmt.Errorf("README has no %s ... %s section", DocsBegin, DocsEnd)
+	}
+
+	var out bytes.Buffer
+	out.Write(readme[:begin+len(DocsBegin)])
+	out.WriteString("\n")
+	out.WriteString(m.Markdown())
+	out.Write(readme[end:])
+	return out.Bytes(), nil
+}
+
+// TypeName renders a type constraint the way the READMEs abbreviate it:
+// collection element types are spelled out, object and tuple attributes
+// are not.
+func TypeName(ty cty.Type) string {
+	switch {
+	case ty == cty.DynamicPseudoType:
+		return "any"
+	case ty.IsPrimitiveType():
+		return ty.FriendlyName()
+	case ty.IsListType():
+		return "list(" + TypeName(ty.ElementType()) + ")"
+	case ty.IsSetType():
+		return "set(" + TypeName(ty.ElementType()) + ")"
+	case ty.IsMapType():
+		return "map(" + TypeName(ty.ElementType()) + ")"
+	case ty.IsObjectType():
+		return "object"
+	case ty.IsTupleType():
+		return "tuple"
+	}
+	return ty.FriendlyName()
+}
+
+// FormatValue renders val as a single-line HCL literal.
+func FormatValue(val cty.Value) string {
+	switch {
+	case val.IsNull():
+		return "null"
+	case !val.IsKnown():
+		return "(known after apply)"
+	}
+
+	ty := val.Type()
+	switch {
+	case ty == cty.String:
+		return fmt.Sprintf("%q", val.AsString())
+	case ty == cty.Number:
+		return val.AsBigFloat().Text('f', -1)
+	case ty == cty.Bool:
+		if val.True() {
+			return "true"
+		}
+		return "false"
+	case ty.IsListType() || ty.IsSetType() || ty.IsTupleType():
+		var elems []string
+		for it := val.ElementIterator(); it.Next(); {
+			_, v := it.Element()
+			elems = append(elems, FormatValue(v))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case ty.IsMapType() || ty.IsObjectType():
+		m := val.AsValueMap()
+		if len(m) == 0 {
+			return "{}"
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		attrs := make([]string, len(keys))
+		for i, k := range keys {
+			attrs[i] = formatKey(k) + " = " + FormatValue(m[k])
+		}
+		return "{ " + strings.Join(attrs, ", ") + " }"
+	}
+	return val.GoString()
+}
+
+// formatKey quotes map keys that are not valid identifiers.
+func formatKey(k string) string {
+	for i, r := range k {
+		isLetter := r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		if !isLetter && (i == 0 || r != '-' && (r < '0' || r > '9')) {
+			return fmt.Sprintf("%q", k)
+		}
+	}
+	if k == "" {
+		return `""`
+	}
+	return k
+}
+
+func escapeCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(strings.TrimSpace(s), "\n", "<br>")
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,376 @@
+// Package tfconfig reads the declarations of a terraform module directory
+// with the HCL parser, so tests can check a module's interface without the
+// terraform binary.
+package tfconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// Module is the parsed declarations of one module directory.
+type Module struct {
+	Dir string
+	// Variables are the input variables in declaration order, file by file.
+	Variables []*Variable
+	Outputs   []*Output
+	// ModuleCalls are the module blocks calling child modules.
+	ModuleCalls []*ModuleCall
+	// VariableRefs are the references to each input variable outside the
+	// variable blocks themselves.
+	VariableRefs map[string][]hcl.Range
+}
+
+// Variable is a variable block.
+type Variable struct {
+	Name        string
+	Description string
+	// Type is the type constraint, cty.DynamicPseudoType when absent.
+	Type cty.Type
+	// TypeDefaults are the defaults of optional object attributes.
+	TypeDefaults *typeexpr.Defaults
+	// Default is the default value converted to Type, cty.NilVal when the
+	// variable is required.
+	Default     cty.Value
+	Sensitive   bool
+	Nullable    bool
+	Validations []*Validation
+	DeclRange   hcl.Range
+}
+
+// Required reports whether the variable has no default.
+func (v *Variable) Required() bool {
+	return v.Default == cty.NilVal
+}
+
+// Validation is a validation block of a variable.
+type Validation struct {
+	Condition    hcl.Expression
+	ErrorMessage hcl.Expression
+	DeclRange    hcl.Range
+}
+
+// Output is an output block.
+type Output struct {
+	Name        string
+	Description string
+	Value       hcl.Expression
+	Sensitive   bool
+	DeclRange   hcl.Range
+}
+
+// ModuleCall is a module block.
+type ModuleCall struct {
+	Name   string
+	Source string
+	// Arguments are the input variables set by the call, without the
+	// source, version and other meta-arguments.
+	Arguments map[string]*hcl.Attribute
+	DeclRange hcl.Range
+}
+
+var fileSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "variable", LabelNames: []string{"name"}},
+		{Type: "output", LabelNames: []string{"name"}},
+		{Type: "module", LabelNames: []string{"name"}},
+	},
+}
+
+var variableSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "description"},
+		{Name: "type"},
+		{Name: "default"},
+		{Name: "sensitive"},
+		{Name: "nullable"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "validation"},
+	},
+}
+
+var validationSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "condition", Required: true},
+		{Name: "error_message", Required: true},
+	},
+}
+
+var outputSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{
+		{Name: "description"},
+		{Name: "value", Required: true},
+		{Name: "sensitive"},
+		{Name: "depends_on"},
+	},
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "precondition"},
+	},
+}
+
+// moduleMetaArguments are the module block arguments that are not inputs
+// of the called module.
+var moduleMetaArguments = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"count":      true,
+	"for_each":   true,
+	"providers":  true,
+	"depends_on": true,
+}
+
+// Load parses the *.tf files in dir.
+func Load(dir string) (*Module, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	parser := hclparse.NewParser()
+	m := &Module{Dir: dir, VariableRefs: map[string][]hcl.Range{}}
+	var diags hcl.Diagnostics
+	for _, path := range files {
+		f, fileDiags := parser.ParseHCLFile(path)
+		diags = append(diags, fileDiags...)
+		if f == nil {
+			continue
+		}
+		content, _, contentDiags := f.Body.PartialContent(fileSchema)
+		diags = append(diags, contentDiags...)
+		for _, block := range content.Blocks {
+			switch block.Type {
+			case "variable":
+				v, varDiags := decodeVariable(block)
+				diags = append(diags, varDiags...)
+				m.Variables = append(m.Variables, v)
+			case "output":
+				o, outDiags := decodeOutput(block)
+				diags = append(diags, outDiags...)
+				m.Outputs = append(m.Outputs, o)
+			case "module":
+				mc, callDiags := decodeModuleCall(block)
+				diags = append(diags, callDiags...)
+				m.ModuleCalls = append(m.ModuleCalls, mc)
+			}
+		}
+		if body, ok := f.Body.(*hclsyntax.Body); ok {
+			collectVariableRefs(body, m.VariableRefs)
+		}
+	}
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("loading %s: %w", dir, diags)
+	}
+	return m, nil
+}
+
+// Variable returns the named variable, or nil.
+func (m *Module) Variable(name string) *Variable {
+	for _, v := range m.Variables {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// Output returns the named output, or nil.
+func (m *Module) Output(name string) *Output {
+	for _, o := range m.Outputs {
+		if o.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+// ModuleCall returns the named module call, or nil.
+func (m *Module) ModuleCall(name string) *ModuleCall {
+	for _, mc := range m.ModuleCalls {
+		if mc.Name == name {
+			return mc
+		}
+	}
+	return nil
+}
+
+func decodeVariable(block *hcl.Block) (*Variable, hcl.Diagnostics) {
+	v := &Variable{
+		Name:      block.Labels[0],
+		Type:      cty.DynamicPseudoType,
+		Nullable:  true,
+		DeclRange: block.DefRange,
+	}
+	content, diags := block.Body.Content(variableSchema)
+
+	if attr, ok := content.Attributes["description"]; ok {
+		diags = append(diags, decodeLiteral(attr, &v.Description)...)
+	}
+	if attr, ok := content.Attributes["sensitive"]; ok {
+		diags = append(diags, decodeLiteral(attr, &v.Sensitive)...)
+	}
+	if attr, ok := content.Attributes["nullable"]; ok {
+		diags = append(diags, decodeLiteral(attr, &v.Nullable)...)
+	}
+	if attr, ok := content.Attributes["type"]; ok {
+		ty, defaults, typeDiags := typeexpr.TypeConstraintWithDefaults(attr.Expr)
+		diags = append(diags, typeDiags...)
+		if !typeDiags.HasErrors() {
+			v.Type, v.TypeDefaults = ty, defaults
+		}
+	}
+	if attr, ok := content.Attributes["default"]; ok {
+		val, valDiags := attr.Expr.Value(nil)
+		diags = append(diags, valDiags...)
+		if !valDiags.HasErrors() {
+			converted, err := v.convert(val)
+			if err != nil {
+				diags = append(diags, &hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid default value for variable",
+					Detail:   fmt.Sprintf("This default value is not compatible with the variable's type constraint: %s.", err),
+					Subject:  attr.Expr.Range().Ptr(),
+				})
+			} else {
+				v.Default = converted
+			}
+		}
+	}
+
+	for _, b := range content.Blocks {
+		vc, vcDiags := b.Body.Content(validationSchema)
+		diags = append(diags, vcDiags...)
+		if vcDiags.HasErrors() {
+			continue
+		}
+		v.Validations = append(v.Validations, &Validation{
+			Condition:    vc.Attributes["condition"].Expr,
+			ErrorMessage: vc.Attributes["error_message"].Expr,
+			DeclRange:    b.DefRange,
+		})
+	}
+	return v, diags
+}
+
+func decodeOutput(block *hcl.Block) (*Output, hcl.Diagnostics) {
+	o := &Output{Name: block.Labels[0], DeclRange: block.DefRange}
+	content, _, diags := block.Body.PartialContent(outputSchema)
+
+	if attr, ok := content.Attributes["description"]; ok {
+		diags = append(diags, decodeLiteral(attr, &o.Description)...)
+	}
+	if attr, ok := content.Attributes["sensitive"]; ok {
+		diags = append(diags, decodeLiteral(attr, &o.Sensitive)...)
+	}
+	if attr, ok := content.Attributes["value"]; ok {
+		o.Value = attr.Expr
+	}
+	return o, diags
+}
+
+func decodeModuleCall(block *hcl.Block) (*ModuleCall, hcl.Diagnostics) {
+	mc := &ModuleCall{
+		Name:      block.Labels[0],
+		Arguments: map[string]*hcl.Attribute{},
+		DeclRange: block.DefRange,
+	}
+	attrs, diags := block.Body.JustAttributes()
+	for name, attr := range attrs {
+		if moduleMetaArguments[name] {
+			continue
+		}
+		mc.Arguments[name] = attr
+	}
+	if attr, ok := attrs["source"]; ok {
+		diags = append(diags, decodeLiteral(attr, &mc.Source)...)
+	} else {
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Missing source argument",
+			Detail:   fmt.Sprintf("Module %q has no source argument.", mc.Name),
+			Subject:  block.DefRange.Ptr(),
+		})
+	}
+	return mc, diags
+}
+
+// collectVariableRefs records the var.<name> references in body, skipping
+// variable blocks, whose validations refer to the variable itself.
+func collectVariableRefs(body *hclsyntax.Body, refs map[string][]hcl.Range) {
+	for _, attr := range body.Attributes {
+		for _, traversal := range attr.Expr.Variables() {
+			if traversal.RootName() != "var" || len(traversal) < 2 {
+				continue
+			}
+			if step, ok := traversal[1].(hcl.TraverseAttr); ok {
+				refs[step.Name] = append(refs[step.Name], traversal.SourceRange())
+			}
+		}
+	}
+	for _, block := range body.Blocks {
+		if block.Type == "variable" {
+			continue
+		}
+		collectVariableRefs(block.Body, refs)
+	}
+}
+
+// ParseValue parses src as an HCL expression, the way a value in a .tfvars
+// file is written, and converts it to the variable's type.
+func (v *Variable) ParseValue(src string) (cty.Value, error) {
+	expr, diags := hclsyntax.ParseExpression([]byte(src), v.Name+".tfvars", hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, diags
+	}
+	return v.convert(val)
+}
+
+func (v *Variable) convert(val cty.Value) (cty.Value, error) {
+	if v.TypeDefaults != nil && !val.IsNull() {
+		val = v.TypeDefaults.Apply(val)
+	}
+	return convert.Convert(val, v.Type)
+}
+
+// decodeLiteral decodes a literal attribute into a string or bool.
+func decodeLiteral(attr *hcl.Attribute, out interface{}) hcl.Diagnostics {
+	val, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return diags
+	}
+	var err error
+	switch out := out.(type) {
+	case *string:
+		val, err = convert.Convert(val, cty.String)
+		if err == nil && !val.IsNull() {
+			*out = val.AsString()
+		}
+	case *bool:
+		val, err = convert.Convert(val, cty.Bool)
+		if err == nil && !val.IsNull() {
+			*out = val.True()
+		}
+	}
+	if err != nil {
+		return hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid " + attr.Name,
+			Detail:   err.Error(),
+			Subject:  attr.Expr.Range().Ptr(),
+		}}
+	}
+	return nil
+}
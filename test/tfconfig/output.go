@@ -0,0 +1,188 @@
+package tfconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// CheckModuleRefs resolves the module.<call>.<output> references of the
+// output blocks against the modules they call, and returns one difference
+// per reference to a module that is not called or to an output the called
+// module does not declare. terraform rejects both. Modules are loaded from
+// local sources relative to m.Dir; references into registry or remote
+// modules are not checked.
+func (m *Module) CheckModuleRefs() []string {
+	var diffs []string
+	children := map[string]*Module{}
+	for _, o := range m.Outputs {
+		seen := map[string]bool{}
+		for _, traversal := range o.Value.Variables() {
+			if traversal.RootName() != "module" || len(traversal) < 3 {
+				continue
+			}
+			callStep, ok := traversal[1].(hcl.TraverseAttr)
+			if !ok {
+				continue
+			}
+			outputStep, ok := traversal[2].(hcl.TraverseAttr)
+			if !ok {
+				continue
+			}
+			ref := "module." + callStep.Name + "." + outputStep.Name
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+
+			call := m.ModuleCall(callStep.Name)
+			if call == nil {
+				diffs = append(diffs, fmt.Sprintf("%s: refers to %s, but module %s is not called", o.Name, ref, callStep.Name))
+				continue
+			}
+			if !strings.HasPrefix(call.Source, "./") && !strings.HasPrefix(call.Source, "../") {
+				continue
+			}
+			child, ok := children[call.Name]
+			if !ok {
+				var err error
+				child, err = Load(filepath.Join(m.Dir, call.Source))
+				if err != nil {
+					diffs = append(diffs, fmt.Sprintf("%s: module %s: %v", o.Name, call.Name, err))
+				}
+				children[call.Name] = child
+			}
+			if child != nil && child.Output(outputStep.Name) == nil {
+				diffs = append(diffs, fmt.Sprintf("%s: refers to %s, which %s does not output", o.Name, ref, call.Source))
+			}
+		}
+	}
+	return diffs
+}
+
+// CheckOutputType compares the value expression of the named output with
+// the type want, as far as the syntax of the expression tells. Object
+// constructors must build exactly the attributes of an object type, for
+// expressions must build maps or lists of the element type, and other
+// expressions must be of the same kind. What depends on resources or
+// functions of unknown result type is not checked. It returns one
+// difference per mismatch, prefixed with the path to the value.
+func (m *Module) CheckOutputType(name string, want cty.Type) []string {
+	o := m.Output(name)
+	if o == nil {
+		return []string{name + ": not declared"}
+	}
+	return checkExprType(o.Value, want, m, name)
+}
+
+func checkExprType(expr hcl.Expression, want cty.Type, m *Module, path string) []string {
+	if want == cty.DynamicPseudoType {
+		return nil
+	}
+	switch e := expr.(type) {
+	case *hclsyntax.LiteralValueExpr:
+		if e.Val.IsNull() {
+			return nil
+		}
+	case *hclsyntax.ParenthesesExpr:
+		return checkExprType(e.Expression, want, m, path)
+	case *hclsyntax.TemplateWrapExpr:
+		return checkExprType(e.Wrapped, want, m, path)
+	case *hclsyntax.ConditionalExpr:
+		return append(checkExprType(e.TrueResult, want, m, path), checkExprType(e.FalseResult, want, m, path)...)
+	case *hclsyntax.ObjectConsExpr:
+		switch {
+		case want.IsObjectType():
+			return checkObjectCons(e, want, m, path)
+		case want.IsMapType():
+			var diffs []string
+			for _, item := range e.Items {
+				key, ok := objectKey(item.KeyExpr)
+				if !ok {
+					key = "*"
+				}
+				diffs = append(diffs, checkExprType(item.ValueExpr, want.ElementType(), m, path+"."+key)...)
+			}
+			return diffs
+		}
+	case *hclsyntax.TupleConsExpr:
+		if want.IsListType() || want.IsSetType() {
+			var diffs []string
+			for i, elem := range e.Exprs {
+				diffs = append(diffs, checkExprType(elem, want.ElementType(), m, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+			return diffs
+		}
+	case *hclsyntax.ForExpr:
+		switch {
+		case e.KeyExpr != nil && want.IsMapType():
+			elem := want.ElementType()
+			if e.Group {
+				if !elem.IsListType() && !elem.IsTupleType() {
+					return []string{fmt.Sprintf("%s: map of lists in the configuration, %s in the contract", path, TypeName(want))}
+				}
+				elem = elem.ElementType()
+			}
+			return checkExprType(e.ValExpr, elem, m, path+".*")
+		case e.KeyExpr == nil && (want.IsListType() || want.IsSetType()):
+			return checkExprType(e.ValExpr, want.ElementType(), m, path+"[*]")
+		}
+	}
+
+	got := exprType(expr, m, nil)
+	if got == cty.DynamicPseudoType || typeKind(got) == typeKind(want) {
+		return nil
+	}
+	// A variable of a type converting to want without loss passes, as
+	// terraform converts it when the output is read.
+	if _, isVar := expr.(*hclsyntax.ScopeTraversalExpr); isVar && convert.GetConversion(got, want) != nil {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: %s in the configuration, %s in the contract", path, TypeName(got), TypeName(want))}
+}
+
+// checkObjectCons compares the attributes an object constructor builds
+// with those of the object type want.
+func checkObjectCons(e *hclsyntax.ObjectConsExpr, want cty.Type, m *Module, path string) []string {
+	var diffs []string
+	built := map[string]bool{}
+	for _, item := range e.Items {
+		key, ok := objectKey(item.KeyExpr)
+		if !ok {
+			// Computed keys are only known after apply.
+			return nil
+		}
+		built[key] = true
+		if !want.HasAttribute(key) {
+			diffs = append(diffs, fmt.Sprintf("%s.%s: built by the configuration, not in the contract", path, key))
+			continue
+		}
+		diffs = append(diffs, checkExprType(item.ValueExpr, want.AttributeType(key), m, path+"."+key)...)
+	}
+	names := make([]string, 0, len(want.AttributeTypes()))
+	for name := range want.AttributeTypes() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !built[name] {
+			diffs = append(diffs, fmt.Sprintf("%s.%s: in the contract, not built by the configuration", path, name))
+		}
+	}
+	return diffs
+}
+
+// objectKey returns the literal key of an object constructor item.
+func objectKey(expr hclsyntax.Expression) (string, bool) {
+	key, diags := expr.Value(nil)
+	if diags.HasErrors() || !key.IsKnown() || key.IsNull() || key.Type() != cty.String {
+		return "", false
+	}
+	return key.AsString(), true
+}
@@ -0,0 +1,275 @@
+package tfconfig
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FindingKind classifies a difference between a calling configuration and
+// the module it calls.
+type FindingKind string
+
+const (
+	// UnusedVariable is a variable of the caller that nothing refers to.
+	UnusedVariable FindingKind = "unused-variable"
+	// UndeclaredInput is an argument of the module call the module does
+	// not declare.
+	UndeclaredInput FindingKind = "undeclared-input"
+	// MissingInput is a required module input the call does not set.
+	MissingInput FindingKind = "missing-input"
+	// UnexposedInput is an optional module input the call does not set,
+	// leaving it at the module default.
+	UnexposedInput FindingKind = "unexposed-input"
+	// UndeclaredOutput is a reference to a module output the module does
+	// not declare.
+	UndeclaredOutput FindingKind = "undeclared-output"
+	// UnexposedOutput is a module output no output of the caller refers to.
+	UnexposedOutput FindingKind = "unexposed-output"
+	// OutputSensitivity is an output of the caller whose sensitivity
+	// differs from the module outputs it refers to.
+	OutputSensitivity FindingKind = "output-sensitivity"
+	// OutputType is an output of the caller whose type differs from the
+	// module output of the same name it refers to.
+	OutputType FindingKind = "output-type"
+)
+
+// Accepted reports whether findings of kind k may be accepted as drift.
+// Unexposed inputs and outputs are a choice of the caller, and terraform
+// plans around unused variables; it rejects undeclared inputs and outputs
+// outright, and the other kinds are mistakes.
+func (k FindingKind) Accepted() bool {
+	return k == UnusedVariable || k == UnexposedInput || k == UnexposedOutput
+}
+
+// Finding is one difference found by CheckParity.
+type Finding struct {
+	Kind FindingKind
+	// Name is the variable, input or output concerned.
+	Name   string
+	Detail string
+	Range  hcl.Range
+}
+
+// String formats the finding without its source position, so findings
+// can be compared across edits of unrelated lines.
+func (f Finding) String() string {
+	if f.Detail == "" {
+		return fmt.Sprintf("%s %s", f.Kind, f.Name)
+	}
+	return fmt.Sprintf("%s %s: %s", f.Kind, f.Name, f.Detail)
+}
+
+// CheckParity compares caller, a configuration calling module through
+// call, with the module's interface. Module inputs the call sets to a
+// value that does not refer to a variable of the caller count as pinned
+// on purpose and are not reported as unexposed.
+func CheckParity(caller *Module, call *ModuleCall, module *Module) []Finding {
+	var findings []Finding
+
+	for _, v := range caller.Variables {
+		if len(caller.VariableRefs[v.Name]) == 0 {
+			findings = append(findings, Finding{Kind: UnusedVariable, Name: v.Name, Range: v.DeclRange})
+		}
+	}
+
+	for name, attr := range call.Arguments {
+		if module.Variable(name) == nil {
+			findings = append(findings, Finding{Kind: UndeclaredInput, Name: name, Range: attr.NameRange})
+		}
+	}
+	for _, v := range module.Variables {
+		if _, ok := call.Arguments[v.Name]; ok {
+			continue
+		}
+		kind := UnexposedInput
+		if v.Required() {
+			kind = MissingInput
+		}
+		findings = append(findings, Finding{Kind: kind, Name: v.Name, Range: v.DeclRange})
+	}
+
+	exposed := map[string]bool{}
+	for _, o := range caller.Outputs {
+		resolved, sensitive := false, false
+		for _, ref := range moduleOutputRefs(o.Value, call.Name) {
+			mo := module.Output(ref.name)
+			if mo == nil {
+				findings = append(findings, Finding{
+					Kind:   UndeclaredOutput,
+					Name:   ref.name,
+					Detail: fmt.Sprintf("referenced by output %s", o.Name),
+					Range:  ref.rng,
+				})
+				continue
+			}
+			exposed[mo.Name] = true
+			resolved = true
+			sensitive = sensitive || mo.Sensitive
+
+			// Only outputs re-exporting a module output under its own name
+			// are expected to keep its type.
+			if !ref.whole || mo.Name != o.Name {
+				continue
+			}
+			want := typeKind(exprType(mo.Value, module, nil))
+			got := typeKind(exprType(o.Value, caller, func(name string) cty.Type {
+				if name == mo.Name {
+					return exprType(mo.Value, module, nil)
+				}
+				return cty.DynamicPseudoType
+			}))
+			if want != "" && got != "" && want != got {
+				findings = append(findings, Finding{
+					Kind:   OutputType,
+					Name:   o.Name,
+					Detail: fmt.Sprintf("%s in the module, %s here", want, got),
+					Range:  o.DeclRange,
+				})
+			}
+		}
+		// Outputs built from no module output are left to the caller.
+		if resolved && o.Sensitive != sensitive {
+			detail := "sensitive, but refers to no sensitive module output"
+			if sensitive {
+				detail = "refers to a sensitive module output but is not sensitive"
+			}
+			findings = append(findings, Finding{Kind: OutputSensitivity, Name: o.Name, Detail: detail, Range: o.DeclRange})
+		}
+	}
+	for _, o := range module.Outputs {
+		if !exposed[o.Name] {
+			findings = append(findings, Finding{Kind: UnexposedOutput, Name: o.Name, Range: o.DeclRange})
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Kind != findings[j].Kind {
+			return findings[i].Kind < findings[j].Kind
+		}
+		return findings[i].Name < findings[j].Name
+	})
+	return findings
+}
+
+type moduleOutputRef struct {
+	name string
+	// whole is set when the reference is to the output value itself
+	// rather than to an attribute or element of it.
+	whole bool
+	rng   hcl.Range
+}
+
+// moduleOutputRefs returns the module.<call>.<output> references in expr.
+func moduleOutputRefs(expr hcl.Expression, call string) []moduleOutputRef {
+	var refs []moduleOutputRef
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "module" || len(traversal) < 3 {
+			continue
+		}
+		if step, ok := traversal[1].(hcl.TraverseAttr); !ok || step.Name != call {
+			continue
+		}
+		if step, ok := traversal[2].(hcl.TraverseAttr); ok {
+			refs = append(refs, moduleOutputRef{name: step.Name, whole: len(traversal) == 3, rng: traversal.SourceRange()})
+		}
+	}
+	return refs
+}
+
+// exprType infers the type of expr from its syntax alone, returning
+// cty.DynamicPseudoType where that is not possible. Variable references
+// resolve to the variable's type constraint and module output references
+// through moduleOutput, when set.
+func exprType(expr hcl.Expression, m *Module, moduleOutput func(name string) cty.Type) cty.Type {
+	switch e := expr.(type) {
+	case *hclsyntax.LiteralValueExpr:
+		if e.Val.IsNull() {
+			return cty.DynamicPseudoType
+		}
+		return e.Val.Type()
+	case *hclsyntax.TemplateExpr:
+		return cty.String
+	case *hclsyntax.TemplateWrapExpr:
+		return exprType(e.Wrapped, m, moduleOutput)
+	case *hclsyntax.ParenthesesExpr:
+		return exprType(e.Expression, m, moduleOutput)
+	case *hclsyntax.ObjectConsExpr:
+		return cty.EmptyObject
+	case *hclsyntax.TupleConsExpr:
+		return cty.EmptyTuple
+	case *hclsyntax.ForExpr:
+		if e.KeyExpr != nil {
+			return cty.EmptyObject
+		}
+		return cty.EmptyTuple
+	case *hclsyntax.ConditionalExpr:
+		t, f := exprType(e.TrueResult, m, moduleOutput), exprType(e.FalseResult, m, moduleOutput)
+		switch {
+		case t == cty.DynamicPseudoType:
+			return f
+		case f == cty.DynamicPseudoType || typeKind(t) == typeKind(f):
+			return t
+		}
+	case *hclsyntax.BinaryOpExpr:
+		return e.Op.Type
+	case *hclsyntax.UnaryOpExpr:
+		return e.Op.Type
+	case *hclsyntax.FunctionCallExpr:
+		if ty, ok := functionTypes[e.Name]; ok {
+			return ty
+		}
+	case *hclsyntax.ScopeTraversalExpr:
+		last, ok := e.Traversal[len(e.Traversal)-1].(hcl.TraverseAttr)
+		if !ok {
+			break
+		}
+		switch root := e.Traversal.RootName(); {
+		case root == "var" && len(e.Traversal) == 2:
+			if v := m.Variable(last.Name); v != nil {
+				return v.Type
+			}
+		case root == "module" && len(e.Traversal) == 3 && moduleOutput != nil:
+			return moduleOutput(last.Name)
+		}
+	}
+	return cty.DynamicPseudoType
+}
+
+// functionTypes are the result types of functions whose result type does
+// not depend on their arguments.
+var functionTypes = map[string]cty.Type{
+	"format":     cty.String,
+	"join":       cty.String,
+	"jsonencode": cty.String,
+	"length":     cty.Number,
+	"lower":      cty.String,
+	"tobool":     cty.Bool,
+	"tonumber":   cty.Number,
+	"tostring":   cty.String,
+	"upper":      cty.String,
+}
+
+// typeKind names the kind of ty, or returns "" when it is unknown.
+func typeKind(ty cty.Type) string {
+	switch {
+	case ty == cty.DynamicPseudoType:
+		return ""
+	case ty.IsPrimitiveType():
+		return ty.FriendlyName()
+	case ty.IsObjectType():
+		return "object"
+	case ty.IsTupleType():
+		return "tuple"
+	case ty.IsListType():
+		return "list"
+	case ty.IsSetType():
+		return "set"
+	case ty.IsMapType():
+		return "map"
+	}
+	return ""
+}
@@ -0,0 +1,7 @@
+module "app" {
+  source = "../module"
+
+  name        = var.name
+  environment = var.environment
+  api_key     = "pinned"
+}
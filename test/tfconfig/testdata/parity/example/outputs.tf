@@ -0,0 +1,28 @@
+output "id" {
+  value = module.app.id
+}
+
+output "login_url" {
+  value = module.app.endpoints.login
+}
+
+output "secret" {
+  value = module.app.secret
+}
+
+output "url" {
+  value = module.app.url
+}
+
+output "name_count" {
+  value     = length(module.app.names)
+  sensitive = true
+}
+
+output "hosted_ui_url" {
+  value = module.app.hosted_ui_url
+}
+
+output "names" {
+  value = join(",", module.app.names)
+}
@@ -0,0 +1,17 @@
+variable "name" {
+  type = string
+}
+
+variable "environment" {
+  type = string
+}
+
+variable "owner" {
+  type    = string
+  default = "platform"
+
+  validation {
+    condition     = length(var.owner) > 0
+    error_message = "Owner must not be empty."
+  }
+}
@@ -0,0 +1,27 @@
+output "id" {
+  value = null_resource.main.id
+}
+
+output "endpoints" {
+  value = {
+    login  = "https://${var.name}.example.com/login"
+    logout = "https://${var.name}.example.com/logout"
+  }
+}
+
+output "secret" {
+  value     = var.api_key
+  sensitive = true
+}
+
+output "url" {
+  value = "https://${var.name}.example.com"
+}
+
+output "names" {
+  value = [for k, v in var.tags : k]
+}
+
+output "arn" {
+  value = null_resource.main.id
+}
@@ -0,0 +1,22 @@
+variable "name" {
+  type = string
+}
+
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+
+variable "retention_days" {
+  type    = number
+  default = 7
+}
+
+variable "api_key" {
+  type      = string
+  sensitive = true
+}
+
+variable "region" {
+  type = string
+}
@@ -0,0 +1,48 @@
+variable "region" {
+  description = "Region to deploy to"
+  type        = string
+  default     = "us-east-1"
+
+  validation {
+    condition     = can(regex("^[a-z]{2}-[a-z]+-[0-9]$", var.region))
+    error_message = "Region must look like us-east-1."
+  }
+}
+
+variable "token" {
+  type      = string
+  sensitive = true
+  nullable  = false
+}
+
+variable "retention_days" {
+  type    = number
+  default = 7
+
+  validation {
+    condition     = var.retention_days >= 1
+    error_message = "Retention must be at least one day."
+  }
+
+  validation {
+    condition     = var.retention_days <= 30
+    error_message = "Retention of ${var.retention_days} days exceeds the maximum of 30."
+  }
+}
+
+variable "settings" {
+  type = object({
+    name    = string
+    enabled = optional(bool, true)
+  })
+  default = {
+    name = "default"
+  }
+}
+
+variable "legacy" {
+  validation {
+    condition     = startswith(var.legacy, "x")
+    error_message = "Legacy must start with x."
+  }
+}
@@ -0,0 +1,305 @@
+package tfconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func loadVariables(t *testing.T) *Module {
+	t.Helper()
+	m, err := Load("testdata/variables")
+	require.NoError(t, err)
+	return m
+}
+
+func TestLoadVariables(t *testing.T) {
+	m := loadVariables(t)
+
+	var names []string
+	for _, v := range m.Variables {
+		names = append(names, v.Name)
+	}
+	assert.Equal(t, []string{"region", "token", "retention_days", "settings", "legacy"}, names)
+
+	region := m.Variable("region")
+	assert.Equal(t, "Region to deploy to", region.Description)
+	assert.Equal(t, cty.String, region.Type)
+	assert.Equal(t, cty.StringVal("us-east-1"), region.Default)
+	assert.False(t, region.Required())
+	assert.Len(t, region.Validations, 1)
+
+	token := m.Variable("token")
+	assert.True(t, token.Required())
+	assert.True(t, token.Sensitive)
+	assert.False(t, token.Nullable)
+
+	// Optional attributes get their defaults.
+	settings := m.Variable("settings")
+	assert.Equal(t, cty.True, settings.Default.GetAttr("enabled"))
+
+	assert.Equal(t, cty.DynamicPseudoType, m.Variable("legacy").Type)
+	assert.Nil(t, m.Variable("missing"))
+}
+
+func TestLoadRejectsInvalidDefault(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "variables.tf", `
+variable "count" {
+  type    = number
+  default = "many"
+}
+`)
+	_, err := Load(dir)
+	assert.ErrorContains(t, err, "Invalid default value for variable")
+}
+
+func TestParseValue(t *testing.T) {
+	m := loadVariables(t)
+
+	v, err := m.Variable("retention_days").ParseValue("14")
+	require.NoError(t, err)
+	assert.True(t, v.RawEquals(cty.NumberIntVal(14)))
+
+	v, err = m.Variable("settings").ParseValue(`{ name = "custom", enabled = false }`)
+	require.NoError(t, err)
+	assert.Equal(t, cty.False, v.GetAttr("enabled"))
+	v, err = m.Variable("settings").ParseValue(`{ name = "custom" }`)
+	require.NoError(t, err)
+	assert.Equal(t, cty.True, v.GetAttr("enabled"))
+
+	_, err = m.Variable("retention_days").ParseValue(`"many"`)
+	assert.Error(t, err)
+	_, err = m.Variable("settings").ParseValue(`{ enabled = true }`)
+	assert.Error(t, err, "name is required")
+}
+
+func TestValidate(t *testing.T) {
+	m := loadVariables(t)
+
+	for _, tc := range []struct {
+		variable, value string
+		want            []string
+	}{
+		{"region", `"eu-west-1"`, nil},
+		{"region", `"Europe"`, []string{"Region must look like us-east-1."}},
+		{"retention_days", "30", nil},
+		{"retention_days", "0", []string{"Retention must be at least one day."}},
+		{"retention_days", "45", []string{"Retention of 45 days exceeds the maximum of 30."}},
+	} {
+		v := m.Variable(tc.variable)
+		val, err := v.ParseValue(tc.value)
+		require.NoError(t, err)
+		messages, err := v.Validate(val)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, messages, "%s = %s", tc.variable, tc.value)
+	}
+}
+
+func TestValidateUnknownFunction(t *testing.T) {
+	v := loadVariables(t).Variable("legacy")
+	_, err := v.Validate(cty.StringVal("xyz"))
+	assert.ErrorContains(t, err, "Call to unknown function")
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestLoadOutputsAndModuleCalls(t *testing.T) {
+	m, err := Load("testdata/parity/example")
+	require.NoError(t, err)
+
+	call := m.ModuleCall("app")
+	require.NotNil(t, call)
+	assert.Equal(t, "../module", call.Source)
+	var args []string
+	for name := range call.Arguments {
+		args = append(args, name)
+	}
+	assert.ElementsMatch(t, []string{"name", "environment", "api_key"}, args)
+	assert.Nil(t, m.ModuleCall("missing"))
+
+	require.NotNil(t, m.Output("name_count"))
+	assert.True(t, m.Output("name_count").Sensitive)
+	assert.False(t, m.Output("secret").Sensitive)
+
+	assert.Len(t, m.VariableRefs["name"], 1)
+	assert.Empty(t, m.VariableRefs["owner"], "references in validation blocks are not counted")
+}
+
+func TestCheckParity(t *testing.T) {
+	example, err := Load("testdata/parity/example")
+	require.NoError(t, err)
+	module, err := Load("testdata/parity/module")
+	require.NoError(t, err)
+
+	var got []string
+	for _, f := range CheckParity(example, example.ModuleCall("app"), module) {
+		got = append(got, f.String())
+	}
+	assert.Equal(t, []string{
+		"missing-input region",
+		"output-sensitivity name_count: sensitive, but refers to no sensitive module output",
+		"output-sensitivity secret: refers to a sensitive module output but is not sensitive",
+		"output-type names: tuple in the module, string here",
+		"undeclared-input environment",
+		"undeclared-output hosted_ui_url: referenced by output hosted_ui_url",
+		"unexposed-input retention_days",
+		"unexposed-input tags",
+		"unexposed-output arn",
+		"unused-variable owner",
+	}, got)
+
+	for _, kind := range []FindingKind{UnusedVariable, UnexposedInput, UnexposedOutput} {
+		assert.True(t, kind.Accepted(), kind)
+	}
+	for _, kind := range []FindingKind{UndeclaredInput, MissingInput, UndeclaredOutput, OutputSensitivity, OutputType} {
+		assert.False(t, kind.Accepted(), kind)
+	}
+}
+
+func TestCheckModuleRefs(t *testing.T) {
+	example, err := Load("testdata/parity/example")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"hosted_ui_url: refers to module.app.hosted_ui_url, which ../module does not output",
+	}, example.CheckModuleRefs())
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "outputs.tf"), []byte(`
+output "id" {
+  value = module.missing.id
+}
+`), 0o644))
+	m, err := Load(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id: refers to module.missing.id, but module missing is not called"}, m.CheckModuleRefs())
+}
+
+func TestMarkdown(t *testing.T) {
+	m, err := Load("testdata/parity/module")
+	require.NoError(t, err)
+	m.Variables[0].Description = "Name | alias\nof the app"
+
+	assert.Equal(t, `## Inputs
+
+| Name | Description | Type | Default | Required | Sensitive |
+|------|-------------|------|---------|:--------:|:---------:|
+| name | Name \| alias<br>of the app | `+"`string`"+` | n/a | yes | no |
+| tags |  | `+"`map(string)`"+` | `+"`{}`"+` | no | no |
+| retention_days |  | `+"`number`"+` | `+"`7`"+` | no | no |
+| api_key |  | `+"`string`"+` | n/a | yes | yes |
+| region |  | `+"`string`"+` | n/a | yes | no |
+
+## Outputs
+
+| Name | Description | Sensitive |
+|------|-------------|:---------:|
+| id |  | no |
+| endpoints |  | no |
+| secret |  | yes |
+| url |  | no |
+| names |  | no |
+| arn |  | no |
+`, m.Markdown())
+
+	updated, err := m.UpdateReadme([]byte("# App\n\n" + DocsBegin + "\nstale\n" + DocsEnd + "\n\n## License\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "# App\n\n"+DocsBegin+"\n"+m.Markdown()+DocsEnd+"\n\n## License\n", string(updated))
+
+	_, err = m.UpdateReadme([]byte("# App\n"))
+	assert.Error(t, err)
+}
+
+func TestFormatValue(t *testing.T) {
+	for _, tc := range []struct {
+		val  cty.Value
+		want string
+	}{
+		{cty.NullVal(cty.String), "null"},
+		{cty.StringVal(`say "hi"`), `"say \"hi\""`},
+		{cty.NumberFloatVal(1.5), "1.5"},
+		{cty.NumberIntVal(3600), "3600"},
+		{cty.False, "false"},
+		{cty.ListValEmpty(cty.String), "[]"},
+		{cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}), `["a", "b"]`},
+		{cty.MapValEmpty(cty.String), "{}"},
+		{cty.MapVal(map[string]cty.Value{"b": cty.NumberIntVal(2), "app-users": cty.NumberIntVal(1), "1st": cty.NumberIntVal(0)}), `{ "1st" = 0, app-users = 1, b = 2 }`},
+		{cty.ObjectVal(map[string]cty.Value{"tags": cty.ListVal([]cty.Value{cty.StringVal("x")})}), `{ tags = ["x"] }`},
+	} {
+		assert.Equal(t, tc.want, FormatValue(tc.val))
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	assert.Equal(t, "any", TypeName(cty.DynamicPseudoType))
+	assert.Equal(t, "map(object)", TypeName(cty.Map(cty.Object(map[string]cty.Type{"name": cty.String}))))
+	assert.Equal(t, "list(set(number))", TypeName(cty.List(cty.Set(cty.Number))))
+	assert.Equal(t, "tuple", TypeName(cty.Tuple([]cty.Type{cty.String})))
+}
+
+func TestCheckOutputType(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "outputs.tf", `
+variable "names" {
+  type = list(string)
+}
+
+variable "port" {
+  type = number
+}
+
+output "names" {
+  value = var.names
+}
+
+output "port" {
+  value = var.port
+}
+
+output "ids" {
+  value = { for k, v in aws_instance.main : k => v.id }
+}
+
+output "ids_by_zone" {
+  value = { for v in aws_instance.main : v.availability_zone => v.id... }
+}
+
+output "ports" {
+  value = [80, 443]
+}
+
+output "summary" {
+  value = {
+    count   = length(var.names)
+    primary = length(var.names) > 0 ? var.names[0] : null
+  }
+}
+`)
+	m, err := Load(dir)
+	require.NoError(t, err)
+
+	strings := cty.Map(cty.String)
+	assert.Empty(t, m.CheckOutputType("names", cty.List(cty.String)))
+	assert.Empty(t, m.CheckOutputType("port", cty.String), "numbers convert to strings")
+	assert.Empty(t, m.CheckOutputType("ids", strings))
+	assert.Empty(t, m.CheckOutputType("ids_by_zone", cty.Map(cty.List(cty.String))))
+	assert.Empty(t, m.CheckOutputType("ports", cty.List(cty.Number)))
+	assert.Empty(t, m.CheckOutputType("summary", cty.Object(map[string]cty.Type{"count": cty.Number, "primary": cty.String})))
+
+	assert.Equal(t, []string{"names: list(string) in the configuration, number in the contract"}, m.CheckOutputType("names", cty.Number))
+	assert.Equal(t, []string{"ids_by_zone: map of lists in the configuration, map(string) in the contract"}, m.CheckOutputType("ids_by_zone", strings))
+	assert.Equal(t, []string{"ports[0]: number in the configuration, string in the contract", "ports[1]: number in the configuration, string in the contract"}, m.CheckOutputType("ports", cty.List(cty.String)))
+	assert.Equal(t, []string{
+		"summary.count: number in the configuration, string in the contract",
+		"summary.primary: built by the configuration, not in the contract",
+		"summary.name: in the contract, not built by the configuration",
+	}, m.CheckOutputType("summary", cty.Object(map[string]cty.Type{"count": cty.String, "name": cty.String})))
+	assert.Equal(t, []string{"missing: not declared"}, m.CheckOutputType("missing", cty.String))
+}
@@ -0,0 +1,95 @@
+package tfconfig
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// Functions are the terraform functions available to validation
+// conditions. They are the subset cty and HCL implement with terraform's
+// semantics; a condition calling anything else fails to evaluate with
+// "Call to unknown function".
+var Functions = map[string]function.Function{
+	"abs":        stdlib.AbsoluteFunc,
+	"can":        tryfunc.CanFunc,
+	"coalesce":   stdlib.CoalesceFunc,
+	"compact":    stdlib.CompactFunc,
+	"concat":     stdlib.ConcatFunc,
+	"contains":   stdlib.ContainsFunc,
+	"distinct":   stdlib.DistinctFunc,
+	"element":    stdlib.ElementFunc,
+	"flatten":    stdlib.FlattenFunc,
+	"format":     stdlib.FormatFunc,
+	"join":       stdlib.JoinFunc,
+	"jsondecode": stdlib.JSONDecodeFunc,
+	"keys":       stdlib.KeysFunc,
+	"length":     stdlib.LengthFunc,
+	"lookup":     stdlib.LookupFunc,
+	"lower":      stdlib.LowerFunc,
+	"max":        stdlib.MaxFunc,
+	"merge":      stdlib.MergeFunc,
+	"min":        stdlib.MinFunc,
+	"regex":      stdlib.RegexFunc,
+	"regexall":   stdlib.RegexAllFunc,
+	"replace":    stdlib.ReplaceFunc,
+	"setunion":   stdlib.SetUnionFunc,
+	"split":      stdlib.SplitFunc,
+	"substr":     stdlib.SubstrFunc,
+	"tobool":     stdlib.MakeToFunc(cty.Bool),
+	"tolist":     stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+	"tomap":      stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+	"tonumber":   stdlib.MakeToFunc(cty.Number),
+	"toset":      stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+	"tostring":   stdlib.MakeToFunc(cty.String),
+	"trimprefix": stdlib.TrimPrefixFunc,
+	"trimspace":  stdlib.TrimSpaceFunc,
+	"trimsuffix": stdlib.TrimSuffixFunc,
+	"try":        tryfunc.TryFunc,
+	"upper":      stdlib.UpperFunc,
+	"values":     stdlib.ValuesFunc,
+}
+
+// Validate evaluates the variable's validation blocks against val, as
+// terraform does before planning, and returns the error messages of those
+// whose condition is false. An error means a condition or message could
+// not be evaluated at all.
+func (v *Variable) Validate(val cty.Value) ([]string, error) {
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"var": cty.ObjectVal(map[string]cty.Value{v.Name: val}),
+		},
+		Functions: Functions,
+	}
+
+	var messages []string
+	for _, validation := range v.Validations {
+		result, diags := validation.Condition.Value(ctx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q: %w", v.Name, diags)
+		}
+		result, err := convert.Convert(result, cty.Bool)
+		if err != nil || result.IsNull() || !result.IsKnown() {
+			return nil, fmt.Errorf("%s: variable %q: invalid condition result %#v", validation.DeclRange, v.Name, result)
+		}
+		if result.True() {
+			continue
+		}
+
+		message, diags := validation.ErrorMessage.Value(ctx)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("variable %q: %w", v.Name, diags)
+		}
+		message, err = convert.Convert(message, cty.String)
+		if err != nil || message.IsNull() || !message.IsKnown() {
+			return nil, fmt.Errorf("%s: variable %q: invalid error_message", validation.DeclRange, v.Name)
+		}
+		messages = append(messages, message.AsString())
+	}
+	return messages, nil
+}
@@ -0,0 +1,209 @@
+package test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/tfconfig"
+)
+
+// validationCases are the sample inputs every variable validation in the
+// modules and examples is checked against, written as in a .tfvars file.
+// Each bad value must fail with exactly message. The bad values used by
+// the live *Validation tests are included so both agree.
+var validationCases = []struct {
+	dir      string
+	variable string
+	good     []string
+	bad      []string
+	message  string
+}{
+	{
+		dir:      "modules/aws-cognito",
+		variable: "advanced_security_mode",
+		good:     []string{`"OFF"`, `"AUDIT"`, `"ENFORCED"`},
+		bad:      []string{`"off"`, `"STRICT"`, `""`},
+		message:  "Advanced security mode must be OFF, AUDIT, or ENFORCED.",
+	},
+	{
+		dir:      "modules/aws-cognito",
+		variable: "mfa_configuration",
+		good:     []string{`"OFF"`, `"OPTIONAL"`, `"REQUIRED"`},
+		bad:      []string{`"ON"`, `"optional"`, `""`},
+		message:  "MFA configuration must be OFF, OPTIONAL, or REQUIRED.",
+	},
+	{
+		dir:      "modules/keycloak",
+		variable: "ssl_required",
+		good:     []string{`"all"`, `"external"`, `"none"`},
+		bad:      []string{`"ALL"`, `"internal"`, `""`},
+		message:  "SSL required must be one of: all, external, none.",
+	},
+	{
+		dir:      "examples/aws-cognito-basic",
+		variable: "mfa_configuration",
+		good:     []string{`"OFF"`, `"OPTIONAL"`, `"REQUIRED"`},
+		bad:      []string{`"INVALID_VALUE"`, `"ON"`, `"optional"`},
+		message:  "MFA configuration must be OFF, OPTIONAL, or REQUIRED.",
+	},
+	{
+		dir:      "examples/aws-cognito-basic",
+		variable: "advanced_security_mode",
+		good:     []string{`"OFF"`, `"AUDIT"`, `"ENFORCED"`},
+		bad:      []string{`"audit"`, `"STRICT"`},
+		message:  "Advanced security mode must be OFF, AUDIT, or ENFORCED.",
+	},
+	{
+		dir:      "examples/azure-ad-sso",
+		variable: "sign_in_audience",
+		good:     []string{`"AzureADMyOrg"`, `"AzureADMultipleOrgs"`, `"AzureADandPersonalMicrosoftAccount"`, `"PersonalMicrosoftAccount"`},
+		bad:      []string{`"InvalidAudience"`, `"azureadmyorg"`, `"AzureADMultipleOrgs "`},
+		message:  "Sign-in audience must be one of: AzureADMyOrg, AzureADMultipleOrgs, AzureADandPersonalMicrosoftAccount, PersonalMicrosoftAccount.",
+	},
+	{
+		dir:      "examples/okta-integration",
+		variable: "oauth_app_type",
+		good:     []string{`"web"`, `"native"`, `"browser"`, `"service"`},
+		bad:      []string{`"invalid-type"`, `"Web"`, `"spa"`},
+		message:  "OAuth app type must be one of: web, native, browser, service.",
+	},
+}
+
+var (
+	moduleConfigsMu sync.Mutex
+	moduleConfigs   = map[string]*tfconfig.Module{}
+)
+
+// loadModuleConfig parses a module or example directory, relative to the
+// repository root, once per test binary.
+func loadModuleConfig(t *testing.T, dir string) *tfconfig.Module {
+	t.Helper()
+	moduleConfigsMu.Lock()
+	defer moduleConfigsMu.Unlock()
+
+	if m, ok := moduleConfigs[dir]; ok {
+		return m
+	}
+	m, err := tfconfig.Load(filepath.Join("..", dir))
+	require.NoError(t, err)
+	moduleConfigs[dir] = m
+	return m
+}
+
+// decodeInputs decodes the inputs terraformOptions applies into out, a
+// pointer to a struct whose JSON names are input names: the defaults of
+// module, relative to the repository root, then those of the configuration
+// in terraformOptions.TerraformDir, then its variables. Each input replaces
+// the whole field, as terraform replaces the whole value. Inputs without a
+// field are ignored and null defaults leave out's value.
+func decodeInputs(t *testing.T, terraformOptions *terraform.Options, module string, out interface{}) {
+	t.Helper()
+
+	root, err := tfconfig.Load(terraformOptions.TerraformDir)
+	require.NoError(t, err)
+
+	for _, m := range []*tfconfig.Module{loadModuleConfig(t, module), root} {
+		for _, v := range m.Variables {
+			if v.Required() || v.Default.IsNull() {
+				continue
+			}
+			value, err := ctyjson.Marshal(v.Default, v.Default.Type())
+			require.NoError(t, err)
+			decodeInput(t, out, v.Name, value)
+		}
+	}
+	for name, v := range terraformOptions.Vars {
+		value, err := json.Marshal(v)
+		require.NoError(t, err)
+		decodeInput(t, out, name, value)
+	}
+}
+
+// decodeInput sets the field of out named after the input, if any.
+func decodeInput(t *testing.T, out interface{}, input string, value json.RawMessage) {
+	t.Helper()
+
+	s := reflect.ValueOf(out).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		name, _, _ := strings.Cut(s.Type().Field(i).Tag.Get("json"), ",")
+		if name != input {
+			continue
+		}
+		field := s.Field(i)
+		field.Set(reflect.Zero(field.Type()))
+		require.NoError(t, json.Unmarshal(value, field.Addr().Interface()), "decoding input %s", input)
+	}
+}
+
+func TestUnitVariableValidationMessages(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range validationCases {
+		tc := tc
+		t.Run(tc.dir+"/"+tc.variable, func(t *testing.T) {
+			t.Parallel()
+
+			v := loadModuleConfig(t, tc.dir).Variable(tc.variable)
+			require.NotNil(t, v, "variable %s is not declared in %s", tc.variable, tc.dir)
+			require.NotEmpty(t, v.Validations, "variable %s has no validation block", tc.variable)
+
+			if !v.Required() {
+				messages, err := v.Validate(v.Default)
+				require.NoError(t, err)
+				assert.Empty(t, messages, "default value fails validation")
+			}
+			for _, src := range tc.good {
+				messages := validate(t, v, src)
+				assert.Empty(t, messages, "%s = %s", tc.variable, src)
+			}
+			for _, src := range tc.bad {
+				messages := validate(t, v, src)
+				assert.Equal(t, []string{tc.message}, messages, "%s = %s", tc.variable, src)
+			}
+		})
+	}
+}
+
+func validate(t *testing.T, v *tfconfig.Variable, src string) []string {
+	t.Helper()
+	val, err := v.ParseValue(src)
+	require.NoError(t, err, "%s = %s", v.Name, src)
+	messages, err := v.Validate(val)
+	require.NoError(t, err, "%s = %s", v.Name, src)
+	return messages
+}
+
+// TestUnitVariableValidationsCovered fails when a validation block is added
+// without sample inputs in validationCases.
+func TestUnitVariableValidationsCovered(t *testing.T) {
+	t.Parallel()
+
+	covered := map[string]bool{}
+	for _, tc := range validationCases {
+		covered[tc.dir+"/"+tc.variable] = true
+	}
+
+	for _, pattern := range []string{"modules/*", "examples/*"} {
+		dirs, err := filepath.Glob(filepath.Join("..", pattern))
+		require.NoError(t, err)
+		for _, dir := range dirs {
+			rel, err := filepath.Rel("..", dir)
+			require.NoError(t, err)
+			rel = filepath.ToSlash(rel)
+			for _, v := range loadModuleConfig(t, rel).Variables {
+				if len(v.Validations) > 0 {
+					assert.True(t, covered[rel+"/"+v.Name], "%s: variable %q has validation blocks but no validationCases entry", v.DeclRange, v.Name)
+				}
+			}
+		}
+	}
+}
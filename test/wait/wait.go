@@ -0,0 +1,165 @@
+// Package wait polls freshly created identity provider objects until they
+// become readable. Azure AD applications, service principals and Okta apps
+// are often not served for several seconds after terraform apply returns,
+// so checks made straight away race the provider's replication.
+package wait
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sourabh-virdi/terraform-idp-automation/test/oidc"
+)
+
+const (
+	defaultInitialDelay = 250 * time.Millisecond
+	defaultMaxDelay     = 10 * time.Second
+)
+
+// Backoff is the delay between attempts. It starts at Initial and doubles
+// up to Max; zero values select 250ms and 10s.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+func (b Backoff) delays() func() time.Duration {
+	next, max := b.Initial, b.Max
+	if next <= 0 {
+		next = defaultInitialDelay
+	}
+	if max <= 0 {
+		max = defaultMaxDelay
+	}
+	return func() time.Duration {
+		d := next
+		if next *= 2; next > max {
+			next = max
+		}
+		return d
+	}
+}
+
+// Condition makes one attempt and returns nil once the object is ready, or
+// an error saying why it is not.
+type Condition func(ctx context.Context) error
+
+// Result describes a wait that converged.
+type Result struct {
+	// Attempts is the number of times the condition was checked.
+	Attempts int
+	// Elapsed is the time from the first attempt until the condition held.
+	Elapsed time.Duration
+}
+
+// Until checks cond immediately and then with exponential backoff until it
+// holds or ctx is done. When ctx ends first, the error wraps ctx's error
+// and reports the condition's last error.
+func Until(ctx context.Context, b Backoff, cond Condition) (Result, error) {
+	start := time.Now()
+	delay := b.delays()
+	for attempt := 1; ; attempt++ {
+		err := cond(ctx)
+		if err == nil {
+			return Result{Attempts: attempt, Elapsed: time.Since(start)}, nil
+		}
+
+		timer := time.NewTimer(delay())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Result{Attempts: attempt, Elapsed: time.Since(start)},
+				fmt.Errorf("not ready after %d attempts in %s: %w (last error: %v)",
+					attempt, time.Since(start).Round(time.Millisecond), ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// Predicate checks a response. body is the complete response body.
+type Predicate func(resp *http.Response, body []byte) error
+
+// URL returns a condition that GETs url with client and holds when every
+// predicate accepts the response.
+func URL(client *http.Client, url string, preds ...Predicate) Condition {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", url, err)
+		}
+		for _, pred := range preds {
+			if err := pred(resp, body); err != nil {
+				return fmt.Errorf("%s: %w", url, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Status accepts responses with one of codes.
+func Status(codes ...int) Predicate {
+	return func(resp *http.Response, _ []byte) error {
+		for _, code := range codes {
+			if resp.StatusCode == code {
+				return nil
+			}
+		}
+		return fmt.Errorf("status %s", resp.Status)
+	}
+}
+
+// JSONField accepts JSON objects with a non-null value at path, whose
+// dot-separated elements name nested object members, as in
+// "jwks_uri" or "signing.keys".
+func JSONField(path string) Predicate {
+	return func(_ *http.Response, body []byte) error {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return fmt.Errorf("response is not JSON: %w", err)
+		}
+		for _, name := range strings.Split(path, ".") {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: not an object at %q", path, name)
+			}
+			if v = obj[name]; v == nil {
+				return fmt.Errorf("%s is not set", path)
+			}
+		}
+		return nil
+	}
+}
+
+// JWKSKid accepts key sets containing a key with the given ID. An empty
+// kid accepts any non-empty key set.
+func JWKSKid(kid string) Predicate {
+	return func(_ *http.Response, body []byte) error {
+		set, err := oidc.ParseJWKS(body)
+		if err != nil {
+			return err
+		}
+		if len(set.Keys) == 0 {
+			return errors.New("key set has no keys")
+		}
+		if _, ok := set.Key(kid); kid != "" && !ok {
+			return fmt.Errorf("no key %q among %v", kid, set.KeyIDs())
+		}
+		return nil
+	}
+}
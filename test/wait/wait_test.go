@@ -0,0 +1,98 @@
+package wait
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fast = Backoff{Initial: time.Millisecond, Max: 4 * time.Millisecond}
+
+// eventually serves 404 for the first misses requests and body afterwards.
+func eventually(t *testing.T, misses int32, body string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= misses {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return s, &requests
+}
+
+func TestUntilWaitsForStatus(t *testing.T) {
+	s, requests := eventually(t, 3, `{}`)
+
+	res, err := Until(context.Background(), fast, URL(s.Client(), s.URL, Status(http.StatusOK)))
+	require.NoError(t, err)
+	assert.Equal(t, 4, res.Attempts)
+	assert.Equal(t, int32(4), requests.Load())
+	assert.Positive(t, res.Elapsed)
+}
+
+func TestUntilReportsLastError(t *testing.T) {
+	s, _ := eventually(t, 1<<30, `{}`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res, err := Until(ctx, fast, URL(s.Client(), s.URL, Status(http.StatusOK)))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "status 404 Not Found")
+	assert.Greater(t, res.Attempts, 1)
+}
+
+func TestBackoffDoubles(t *testing.T) {
+	next := Backoff{Initial: time.Second, Max: 5 * time.Second}.delays()
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		got = append(got, next())
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, got)
+
+	assert.Equal(t, defaultInitialDelay, Backoff{}.delays()())
+}
+
+func TestJSONField(t *testing.T) {
+	for _, tc := range []struct {
+		body, path string
+		ok         bool
+	}{
+		{`{"issuer":"https://idp.example.com"}`, "issuer", true},
+		{`{"issuer":null}`, "issuer", false},
+		{`{}`, "issuer", false},
+		{`{"a":{"b":[1]}}`, "a.b", true},
+		{`{"a":"b"}`, "a.b", false},
+		{`not json`, "issuer", false},
+	} {
+		err := JSONField(tc.path)(nil, []byte(tc.body))
+		assert.Equal(t, tc.ok, err == nil, "%s in %s: %v", tc.path, tc.body, err)
+	}
+}
+
+func TestJWKSKid(t *testing.T) {
+	const set = `{"keys":[{"kty":"RSA","kid":"k1","n":"AQAB","e":"AQAB"}]}`
+
+	assert.NoError(t, JWKSKid("k1")(nil, []byte(set)))
+	assert.NoError(t, JWKSKid("")(nil, []byte(set)))
+	assert.ErrorContains(t, JWKSKid("k2")(nil, []byte(set)), `no key "k2" among [k1]`)
+	assert.ErrorContains(t, JWKSKid("")(nil, []byte(`{"keys":[]}`)), "no keys")
+}
+
+func TestUntilWaitsForKeyRotation(t *testing.T) {
+	s, _ := eventually(t, 0, `{"keys":[{"kty":"RSA","kid":"old","n":"AQAB","e":"AQAB"}]}`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, err := Until(ctx, fast, URL(s.Client(), s.URL, Status(http.StatusOK), JWKSKid("new")))
+	assert.ErrorContains(t, err, `no key "new"`)
+}